@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Returned (wrapped) by bestAnswer when no earlier question is similar
+// enough to reuse its answer
+var errNoGoodAnswer = errors.New("no good match")
+
+// Find the AI reply to the user's earlier human message most similar to
+// question, following REPLIES_TO, and return it with the similarity of the
+// two questions as confidence. Fails with errNoGoodAnswer when the best
+// question scores below cfg.AnswerMinSimilarity or none has a reply, and
+// with errNoMessages when the user has no messages.
+func bestAnswer(ctx context.Context, client *openai.Client, userID string, question string) (Message, float64, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	count, err := countUserMessages(ctx, session, userID)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	if count == 0 {
+		return Message{}, 0, errNoMessages
+	}
+
+	embedding, err := getQueryEmbedding(ctx, client, question)
+	if err != nil {
+		return Message{}, 0, fmt.Errorf("failed to embed question: %v", err)
+	}
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		// Newest reply first, so a question answered twice reuses the latest answer
+		query := `
+			MATCH (reply:Message {userId: $userId})-[:REPLIES_TO]->(q:Message {userId: $userId, sender: "human"})
+			RETURN q, [(q)-[:HAS_CHUNK]->(c:Chunk) | c], reply
+			ORDER BY reply.timestamp DESC, reply.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+
+		var best ScoredMessage
+		found := false
+		queryMessage := Message{Embedding: embedding}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			questionNode, ok := values[0].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			replyNode, ok := values[2].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			earlier := messageFromNode(questionNode)
+			earlier.Chunks = chunksFromValue(values[1])
+			if len(earlier.Embedding) == 0 {
+				continue
+			}
+			if similarity := messageSimilarity(queryMessage, earlier); !found || similarity > best.Similarity {
+				best = ScoredMessage{Message: messageFromNode(replyNode), Similarity: similarity}
+				found = true
+			}
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: no answered questions yet", errNoGoodAnswer)
+		}
+		return best, nil
+	}, txTimeout(ctx))
+	if err != nil {
+		if errors.Is(err, errNoGoodAnswer) {
+			return Message{}, 0, err
+		}
+		return Message{}, 0, fmt.Errorf("failed to find best answer: %w", neo4jError(ctx, err))
+	}
+
+	best := result.(ScoredMessage)
+	if best.Similarity < cfg.AnswerMinSimilarity {
+		return Message{}, best.Similarity, fmt.Errorf("%w: closest earlier question scores %.3f, below %.2f", errNoGoodAnswer, best.Similarity, cfg.AnswerMinSimilarity)
+	}
+	return best.Message, best.Similarity, nil
+}
+
+// Print an answer found by bestAnswer
+func printBestAnswer(answer Message, confidence float64) {
+	timestamp := time.Unix(answer.Timestamp, 0).Format("2006-01-02 15:04")
+	fmt.Printf("💡 Earlier answer (confidence %.3f, %s): %s\n", confidence, timestamp, answer.Content)
+}
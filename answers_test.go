@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBestAnswer(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.EmbeddingDimensions = 3
+		c.AnswerMinSimilarity = 0.9
+	})
+	ctx := context.Background()
+	client, _ := newFakeOpenAI(t)
+	userID := createTestUser(t, session)
+
+	question := "giay size 42 con khong?"
+	if _, _, err := bestAnswer(ctx, client, userID, question); !errors.Is(err, errNoMessages) {
+		t.Fatalf("bestAnswer without messages = %v, want errNoMessages", err)
+	}
+
+	// the fake server embeds a text as [len(text), 1, 0]
+	now := time.Now().Unix()
+	similar := storeTestMessage(t, session, userID, Message{Content: "giày size 42?", Timestamp: now, Embedding: []float64{float64(len(queryEmbeddingText(question))), 1, 0}})
+	if _, _, err := bestAnswer(ctx, client, userID, question); !errors.Is(err, errNoGoodAnswer) {
+		t.Fatalf("bestAnswer without replies = %v, want errNoGoodAnswer", err)
+	}
+
+	other := storeTestMessage(t, session, userID, Message{Content: "ship mất bao lâu?", Timestamp: now + 1, Embedding: []float64{0, 1, 0}})
+	reply := func(to Message, content string, timestamp int64) Message {
+		t.Helper()
+		answer := storeTestMessage(t, session, userID, Message{Sender: "ai", Content: content, Timestamp: timestamp, Embedding: []float64{0, 0, 1}})
+		if err := linkReply(ctx, session, to.MessageID, answer.MessageID); err != nil {
+			t.Fatalf("linkReply: %v", err)
+		}
+		return answer
+	}
+	reply(similar, "dạ còn size 42 ạ", now+2)
+	reply(other, "ship 2-3 ngày ạ", now+3)
+	latest := reply(similar, "dạ size 42 vẫn còn ạ", now+4)
+
+	// a question answered twice reuses the newest answer
+	answer, confidence, err := bestAnswer(ctx, client, userID, question)
+	if err != nil {
+		t.Fatalf("bestAnswer: %v", err)
+	}
+	if answer.MessageID != latest.MessageID || confidence < 0.999 {
+		t.Errorf("bestAnswer = %q with confidence %.3f, want %q with confidence 1", answer.Content, confidence, latest.Content)
+	}
+
+	cfg.AnswerMinSimilarity = 1.5
+	if _, confidence, err := bestAnswer(ctx, client, userID, question); !errors.Is(err, errNoGoodAnswer) || confidence < 0.999 {
+		t.Errorf("bestAnswer below the minimum = %.3f, %v; want the best similarity and errNoGoodAnswer", confidence, err)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Version of the archive layout written by exportArchive
+const archiveFormatVersion = 1
+
+// Entry names inside a user data archive
+const (
+	archiveManifestEntry = "manifest.json"
+	archiveProfileEntry  = "profile.json"
+	archiveMessagesEntry = "messages.jsonl"
+	archiveTopicsEntry   = "topics.json"
+	archiveEdgesEntry    = "edges.jsonl"
+)
+
+// Describes the contents of a user data archive
+type archiveManifest struct {
+	FormatVersion int      `json:"formatVersion"`
+	UserID        string   `json:"userId"`
+	ExportedAt    int64    `json:"exportedAt"`
+	Messages      int      `json:"messages"`
+	Topics        int      `json:"topics"`
+	Edges         int      `json:"edges"`
+	Embeddings    bool     `json:"embeddings"`
+	Entries       []string `json:"entries"`
+}
+
+// CONTEXTUAL_LINK between two of the user's messages
+type archiveEdge struct {
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Similarity float64 `json:"similarity"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+// Load the similarity edges between a user's own messages, each edge once
+func loadUserEdges(ctx context.Context, session neo4j.SessionWithContext, userID string) ([]archiveEdge, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m1:Message {userId: $userId})-[r:CONTEXTUAL_LINK]-(m2:Message {userId: $userId})
+			WHERE m1.messageId < m2.messageId
+			RETURN m1.messageId, m2.messageId, r.similarity, r.timestamp
+			ORDER BY m1.messageId, m2.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+
+		var edges []archiveEdge
+		for records.Next(ctx) {
+			values := records.Record().Values
+			edge := archiveEdge{}
+			edge.From, _ = values[0].(string)
+			edge.To, _ = values[1].(string)
+			edge.Similarity, _ = values[2].(float64)
+			edge.Timestamp, _ = values[3].(int64)
+			edges = append(edges, edge)
+		}
+		return edges, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load edges: %v", err)
+	}
+	return result.([]archiveEdge), nil
+}
+
+// Write a zip archive of everything stored for a user: profile, messages
+// (with embeddings only when cfg.ArchiveEmbeddings is set), topics, edges and
+// a manifest. importArchive reads it back.
+func exportArchive(ctx context.Context, userID string, w io.Writer) error {
+	user, err := getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return err
+	}
+	edges, err := loadUserEdges(ctx, session, userID)
+	if err != nil {
+		return err
+	}
+
+	var topics []string
+	for _, message := range messages {
+		for _, topic := range message.Topics {
+			if !containsString(topics, topic) {
+				topics = append(topics, topic)
+			}
+		}
+	}
+
+	archive := zip.NewWriter(w)
+	writeJSON := func(name string, value any) error {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	writeJSONL := func(name string, count int, value func(i int) any) error {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(entry)
+		for i := 0; i < count; i++ {
+			if err := encoder.Encode(value(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	manifest := archiveManifest{
+		FormatVersion: archiveFormatVersion,
+		UserID:        userID,
+		ExportedAt:    time.Now().Unix(),
+		Messages:      len(messages),
+		Topics:        len(topics),
+		Edges:         len(edges),
+		Embeddings:    cfg.ArchiveEmbeddings,
+		Entries:       []string{archiveProfileEntry, archiveMessagesEntry, archiveTopicsEntry, archiveEdgesEntry},
+	}
+	if err := writeJSON(archiveManifestEntry, manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	if err := writeJSON(archiveProfileEntry, user); err != nil {
+		return fmt.Errorf("failed to write profile: %v", err)
+	}
+	err = writeJSONL(archiveMessagesEntry, len(messages), func(i int) any {
+		message := messages[i]
+		if !cfg.ArchiveEmbeddings {
+			message.Embedding = nil
+			message.Chunks = nil
+		}
+		return message
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write messages: %v", err)
+	}
+	if err := writeJSON(archiveTopicsEntry, topics); err != nil {
+		return fmt.Errorf("failed to write topics: %v", err)
+	}
+	if err := writeJSONL(archiveEdgesEntry, len(edges), func(i int) any { return edges[i] }); err != nil {
+		return fmt.Errorf("failed to write edges: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+
+	slog.Info("Exported archive", "userId", userID, "messages", len(messages), "topics", len(topics), "edges", len(edges))
+	return nil
+}
+
+// Open an archive entry and decode it with fn
+func readArchiveEntry(archive *zip.Reader, name string, fn func(io.Reader) error) error {
+	entry, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("archive is missing %s: %v", name, err)
+	}
+	defer entry.Close()
+	if err := fn(entry); err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	return nil
+}
+
+// Recreate a user from an archive written by exportArchive, keeping its
+// user and message IDs. Fails if the user already exists. Messages archived
+// without embeddings are queued for enrichment; messages that cannot be
+// stored are reported in the BatchResult. Returns the user ID.
+func importArchive(ctx context.Context, r io.ReaderAt, size int64) (string, BatchResult, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", BatchResult{}, fmt.Errorf("failed to open archive: %v", err)
+	}
+
+	var manifest archiveManifest
+	err = readArchiveEntry(archive, archiveManifestEntry, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&manifest)
+	})
+	if err != nil {
+		return "", BatchResult{}, err
+	}
+	if manifest.FormatVersion != archiveFormatVersion {
+		return "", BatchResult{}, fmt.Errorf("unsupported archive format version %d", manifest.FormatVersion)
+	}
+
+	var user User
+	err = readArchiveEntry(archive, archiveProfileEntry, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&user)
+	})
+	if err != nil {
+		return "", BatchResult{}, err
+	}
+	if user.UserID == "" {
+		return "", BatchResult{}, fmt.Errorf("archive profile has no userId")
+	}
+
+	var messages []Message
+	err = readArchiveEntry(archive, archiveMessagesEntry, func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var message Message
+			if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+				return err
+			}
+			messages = append(messages, message)
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return "", BatchResult{}, err
+	}
+
+	var edges []archiveEdge
+	err = readArchiveEntry(archive, archiveEdgesEntry, func(r io.Reader) error {
+		decoder := json.NewDecoder(r)
+		for decoder.More() {
+			var edge archiveEdge
+			if err := decoder.Decode(&edge); err != nil {
+				return err
+			}
+			edges = append(edges, edge)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", BatchResult{}, err
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, "MATCH (u:User {userId: $userId}) RETURN count(u)", map[string]any{"userId": user.UserID})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if count, _ := record.Values[0].(int64); count > 0 {
+			return nil, fmt.Errorf("user %s already exists", user.UserID)
+		}
+
+		query := `
+			CREATE (u:User {
+				userId: $userId,
+				name: $name,
+				createdAt: $createdAt,
+				lastActive: $lastActive,
+				language: $language,
+				tone: $tone,
+				addressingStyle: $addressingStyle
+			})
+		`
+		params := map[string]any{
+			"userId":          user.UserID,
+			"name":            user.Name,
+			"createdAt":       user.CreatedAt,
+			"lastActive":      user.LastActive,
+			"language":        user.Preferences.Language,
+			"tone":            user.Preferences.Tone,
+			"addressingStyle": user.Preferences.AddressingStyle,
+		}
+		_, err = tx.Run(ctx, query, params)
+		return nil, err
+	})
+	if err != nil {
+		return "", BatchResult{}, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	var batch BatchResult
+	messageCtx := ctx
+	for i, message := range messages {
+		if err := ctx.Err(); err != nil {
+			return user.UserID, batch, err
+		}
+		if i%max(cfg.TopicUpsertBatchSize, 1) == 0 {
+			messageCtx = topicBatchContext(ctx, session, messages[i:min(i+cfg.TopicUpsertBatchSize, len(messages))])
+		}
+		if len(message.Embedding) == 0 {
+			message.NeedsEnrichment = true
+		}
+		// Scrims and chat sessions are not archived
+		message.ScrimID = ""
+		message.SessionID = ""
+		if err := addMessageAndCreateEdges(messageCtx, session, message, user.UserID); err != nil {
+			batch.fail(message.MessageID, err)
+			continue
+		}
+		batch.succeed(message.MessageID)
+	}
+
+	// Restore archived edges (similarities may differ from the current
+	// thresholds) and the archived lastActive, which ingestion overwrote
+	_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		for _, edge := range edges {
+			edgeQuery := `
+				MATCH (m1:Message {messageId: $messageId1})
+				MATCH (m2:Message {messageId: $messageId2})
+				WHERE m1 <> m2
+				MERGE (m1)-[r:CONTEXTUAL_LINK]-(m2)
+				ON CREATE SET r.similarity = $similarity, r.timestamp = $timestamp
+			`
+			edgeParams := map[string]any{
+				"messageId1": edge.From,
+				"messageId2": edge.To,
+				"similarity": edge.Similarity,
+				"timestamp":  edge.Timestamp,
+			}
+			if _, err := tx.Run(ctx, edgeQuery, edgeParams); err != nil {
+				return nil, fmt.Errorf("failed to create edge: %v", err)
+			}
+		}
+
+		lastActiveQuery := "MATCH (u:User {userId: $userId}) SET u.lastActive = $lastActive"
+		_, err := tx.Run(ctx, lastActiveQuery, map[string]any{"userId": user.UserID, "lastActive": user.LastActive})
+		return nil, err
+	})
+	if err != nil {
+		return user.UserID, batch, fmt.Errorf("failed to restore edges: %v", err)
+	}
+
+	logBatchFailures("Archive import", batch)
+	slog.Info("Imported archive", "userId", user.UserID, "messages", batch.Succeeded, "archivedMessages", len(messages), "edges", len(edges))
+	return user.UserID, batch, nil
+}
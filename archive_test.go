@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.ArchiveEmbeddings = true
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+		c.TopicTags = defaultTopicTags
+	})
+	ctx := context.Background()
+
+	userID := createTestUser(t, session)
+	first := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: 1000, Embedding: []float64{1, 0}, Topics: []string{"Giày"}})
+	second := storeTestMessage(t, session, userID, Message{Sender: "ai", Content: "còn size 42", Timestamp: 1001, Embedding: []float64{0.9, 0.1}, Topics: []string{"Giày"}})
+
+	var archive bytes.Buffer
+	if err := exportArchive(ctx, userID, &archive); err != nil {
+		t.Fatalf("exportArchive: %v", err)
+	}
+	deleteTestUser(t, session, userID)
+
+	importedID, batch, err := importArchive(ctx, bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil || batch.Err() != nil {
+		t.Fatalf("importArchive: %v, %v", err, batch.Err())
+	}
+	if importedID != userID || batch.Succeeded != 2 {
+		t.Errorf("imported user %s with %d messages, want %s with 2", importedID, batch.Succeeded, userID)
+	}
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("%d messages after import, want 2", len(messages))
+	}
+	for i, want := range []Message{first, second} {
+		got := messages[i]
+		if got.MessageID != want.MessageID || got.Content != want.Content || got.Timestamp != want.Timestamp ||
+			!reflect.DeepEqual(got.Embedding, want.Embedding) || !reflect.DeepEqual(got.Topics, want.Topics) {
+			t.Errorf("message %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if n := countTestLinks(t, session, first.MessageID, second.MessageID); n != 1 {
+		t.Errorf("%d links after import, want 1", n)
+	}
+
+	// importing over an existing user is refused
+	if _, _, err := importArchive(ctx, bytes.NewReader(archive.Bytes()), int64(archive.Len())); err == nil {
+		t.Error("importArchive recreated an existing user")
+	}
+}
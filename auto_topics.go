@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// topicPromptVersion recorded on BELONGS_TO edges created by auto-topics
+const autoTopicVersion = "auto"
+
+// System prompt for naming an auto-topic
+const autoTopicNamingPrompt = `Các tin nhắn sau cùng nói về một chủ đề thương mại điện tử.
+Đặt tên ngắn gọn cho chủ đề đó (1 đến 3 từ, tiếng Việt, viết hoa chữ cái đầu).
+Chỉ trả về tên chủ đề, không giải thích, không có dấu ngoặc kép.`
+
+// Group messages into clusters whose members are pairwise at least
+// threshold similar and share no topic. Clusters are grown greedily from
+// the oldest unassigned message; only clusters of at least minSize are
+// returned.
+func findAutoTopicClusters(messages []Message, threshold float64, minSize int) [][]Message {
+	assigned := make([]bool, len(messages))
+	var clusters [][]Message
+	for i, seed := range messages {
+		if assigned[i] || len(seed.Embedding) == 0 {
+			continue
+		}
+
+		members := []int{i}
+		for j := i + 1; j < len(messages); j++ {
+			if assigned[j] || len(messages[j].Embedding) == 0 {
+				continue
+			}
+			similar := true
+			for _, k := range members {
+				if cosineSimilarity(messages[j].Embedding, messages[k].Embedding) < threshold {
+					similar = false
+					break
+				}
+			}
+			if similar {
+				members = append(members, j)
+			}
+		}
+		if len(members) < minSize {
+			continue
+		}
+
+		// A tag shared by the whole cluster already covers it
+		shared := append([]string(nil), seed.Topics...)
+		cluster := make([]Message, 0, len(members))
+		for _, k := range members {
+			var kept []string
+			for _, topic := range shared {
+				if containsString(messages[k].Topics, topic) {
+					kept = append(kept, topic)
+				}
+			}
+			shared = kept
+			cluster = append(cluster, messages[k])
+		}
+		if len(shared) > 0 {
+			continue
+		}
+
+		for _, k := range members {
+			assigned[k] = true
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// Ask the LLM for a short name for the theme of a cluster
+func nameTopicCluster(ctx context.Context, client *openai.Client, cluster []Message) (string, error) {
+	var contents []string
+	for _, message := range cluster {
+		contents = append(contents, "- "+message.Content)
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model: cfg.TopicModel,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: autoTopicNamingPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: strings.Join(contents, "\n")},
+		},
+		MaxTokens:   20,
+		Temperature: 0.1,
+	}
+	resp, err := withOpenAIRetry(ctx, func(ctx context.Context) (openai.ChatCompletionResponse, error) {
+		return client.CreateChatCompletion(ctx, request)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to name topic: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from topic naming")
+	}
+
+	name := strings.TrimSpace(resp.Choices[0].Message.Content)
+	name = canonicalTopicName(strings.Trim(name, `"'.`))
+	if name == "" {
+		return "", fmt.Errorf("empty topic name")
+	}
+	return name, nil
+}
+
+// Propose new topics for a user's untagged themes: every cluster found by
+// findAutoTopicClusters (cfg.AutoTopicSimilarity, cfg.AutoTopicMinCluster)
+// is named by the LLM and linked to a Topic node marked auto. Messages that
+// already belong to an auto-topic are left out. Returns the number of
+// topics created.
+func proposeAutoTopics(ctx context.Context, client *openai.Client, userID string) (int, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, "MATCH (t:Topic {auto: true}) RETURN t.name", nil)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for records.Next(ctx) {
+			if name, ok := records.Record().Values[0].(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names, records.Err()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to load auto-topics: %v", err)
+	}
+	autoTopics := result.([]string)
+
+	var candidates []Message
+	for _, message := range messages {
+		covered := false
+		for _, topic := range message.Topics {
+			if containsString(autoTopics, topic) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			candidates = append(candidates, message)
+		}
+	}
+
+	created := 0
+	for _, cluster := range findAutoTopicClusters(candidates, cfg.AutoTopicSimilarity, cfg.AutoTopicMinCluster) {
+		name, err := nameTopicCluster(ctx, client, cluster)
+		if err != nil {
+			return created, err
+		}
+
+		unlock := userIngestLocks.Lock(userID)
+		_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			topicQuery := `
+				MERGE (t:Topic {name: $topicName})
+				ON CREATE SET t.topicId = $topicId, t.createdAt = $timestamp, t.auto = true
+			`
+			topicParams := map[string]any{
+				"topicName": name,
+				"topicId":   generateID(),
+				"timestamp": time.Now().Unix(),
+			}
+			if _, err := tx.Run(ctx, topicQuery, topicParams); err != nil {
+				return nil, err
+			}
+
+			for _, message := range cluster {
+				linkMessageTopics(ctx, tx, message.MessageID, []string{name}, autoTopicVersion)
+				appendQuery := `
+					MATCH (m:Message {messageId: $messageId})
+					WHERE NOT $topicName IN coalesce(m.topics, [])
+					SET m.topics = coalesce(m.topics, []) + $topicName
+				`
+				if _, err := tx.Run(ctx, appendQuery, map[string]any{"messageId": message.MessageID, "topicName": name}); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		})
+		unlock()
+		if err != nil {
+			return created, fmt.Errorf("failed to create auto-topic %q: %v", name, err)
+		}
+
+		created++
+		fmt.Printf("🌱 Auto-topic %q created for %d messages\n", name, len(cluster))
+	}
+
+	fmt.Printf("🌱 Auto-topics for user %s: %d proposed\n", userID, created)
+	return created, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func clusterIDs(clusters [][]Message) [][]string {
+	var ids [][]string
+	for _, cluster := range clusters {
+		var members []string
+		for _, message := range cluster {
+			members = append(members, message.MessageID)
+		}
+		ids = append(ids, members)
+	}
+	return ids
+}
+
+func TestFindAutoTopicClusters(t *testing.T) {
+	// a1-a3 point the same way, b1-b2 another; c is between them
+	messages := []Message{
+		{MessageID: "a1", Embedding: []float64{1, 0, 0}},
+		{MessageID: "b1", Embedding: []float64{0, 1, 0}},
+		{MessageID: "a2", Embedding: []float64{0.99, 0.1, 0}},
+		{MessageID: "c", Embedding: []float64{0.7, 0.7, 0}},
+		{MessageID: "a3", Embedding: []float64{0.98, 0, 0.1}},
+		{MessageID: "b2", Embedding: []float64{0.1, 0.99, 0}},
+		{MessageID: "none"},
+	}
+	tests := []struct {
+		name      string
+		threshold float64
+		minSize   int
+		want      [][]string
+	}{
+		{"tight clusters", 0.95, 2, [][]string{{"a1", "a2", "a3"}, {"b1", "b2"}}},
+		{"min size drops small clusters", 0.95, 3, [][]string{{"a1", "a2", "a3"}}},
+		{"min size above every cluster", 0.95, 4, nil},
+		{"loose threshold pulls in c", 0.6, 4, [][]string{{"a1", "a2", "c", "a3"}}},
+	}
+	for _, tt := range tests {
+		got := clusterIDs(findAutoTopicClusters(messages, tt.threshold, tt.minSize))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: clusters = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindAutoTopicClustersSkipsTaggedThemes(t *testing.T) {
+	tagged := []Message{
+		{MessageID: "m1", Embedding: []float64{1, 0}, Topics: []string{"Giày", "Áo"}},
+		{MessageID: "m2", Embedding: []float64{1, 0.05}, Topics: []string{"Giày"}},
+		{MessageID: "m3", Embedding: []float64{1, 0.1}, Topics: []string{"Giày", "Túi"}},
+	}
+	if got := findAutoTopicClusters(tagged, 0.9, 2); got != nil {
+		t.Errorf("cluster sharing Giày = %v, want none", clusterIDs(got))
+	}
+
+	// no tag common to every member, so the theme is new
+	tagged[2].Topics = []string{"Túi"}
+	want := [][]string{{"m1", "m2", "m3"}}
+	if got := clusterIDs(findAutoTopicClusters(tagged, 0.9, 2)); !reflect.DeepEqual(got, want) {
+		t.Errorf("clusters = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Outcome of one item of a batch operation
+type BatchItemResult struct {
+	// Message ID, or "line N" for file imports
+	ID string `json:"id"`
+	// Nil when the item succeeded
+	Err error `json:"-"`
+	// Err as text, for JSON output
+	Error string `json:"error,omitempty"`
+}
+
+// Per-item outcome of a batch operation (import, replay, backfill,
+// enrichment retry). Failed items do not abort the batch; callers can retry
+// exactly the IDs listed in Failures.
+type BatchResult struct {
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Skipped   int               `json:"skipped"`
+	Items     []BatchItemResult `json:"items"`
+}
+
+// Record a successful item
+func (r *BatchResult) succeed(id string) {
+	r.Succeeded++
+	r.Items = append(r.Items, BatchItemResult{ID: id})
+}
+
+// Record a failed item
+func (r *BatchResult) fail(id string, err error) {
+	r.Failed++
+	r.Items = append(r.Items, BatchItemResult{ID: id, Err: err, Error: err.Error()})
+}
+
+// Record an item that needed no work
+func (r *BatchResult) skip() {
+	r.Skipped++
+}
+
+// Total number of items processed
+func (r BatchResult) Total() int {
+	return r.Succeeded + r.Failed + r.Skipped
+}
+
+// Items that failed, in processing order
+func (r BatchResult) Failures() []BatchItemResult {
+	var failures []BatchItemResult
+	for _, item := range r.Items {
+		if item.Err != nil {
+			failures = append(failures, item)
+		}
+	}
+	return failures
+}
+
+// Summary error when any item failed, nil otherwise
+func (r BatchResult) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d items failed", r.Failed, r.Total())
+}
+
+// Log every failed item of a batch
+func logBatchFailures(operation string, r BatchResult) {
+	for _, item := range r.Failures() {
+		slog.Error(operation+" failed", "item", item.ID, "err", item.Err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchResult(t *testing.T) {
+	var batch BatchResult
+	if err := batch.Err(); err != nil {
+		t.Errorf("Err() of an empty batch = %v, want nil", err)
+	}
+
+	batch.succeed("m1")
+	batch.fail("m2", errors.New("timeout"))
+	batch.skip()
+	batch.succeed("m3")
+	batch.fail("m4", errors.New("invalid"))
+
+	if batch.Succeeded != 2 || batch.Failed != 2 || batch.Skipped != 1 || batch.Total() != 5 {
+		t.Errorf("counts = %d succeeded, %d failed, %d skipped, %d total; want 2, 2, 1, 5",
+			batch.Succeeded, batch.Failed, batch.Skipped, batch.Total())
+	}
+	var failed []string
+	for _, item := range batch.Failures() {
+		failed = append(failed, item.ID+": "+item.Error)
+	}
+	if want := []string{"m2: timeout", "m4: invalid"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("Failures() = %v, want %v", failed, want)
+	}
+	if err := batch.Err(); err == nil || err.Error() != "2 of 5 items failed" {
+		t.Errorf("Err() = %v, want 2 of 5 items failed", err)
+	}
+}
+
+func TestReplayFilePartialFailures(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.OpenAIMaxRetries = 0
+		c.TopicUpsertBatchSize = 0
+	})
+	client, _ := newFakeOpenAI(t)
+	userID := createTestUser(t, session)
+
+	lines := []string{
+		`{"sender": "human", "content": "giày size 42", "timestamp": 1700000000}`,
+		`{"sender": "human", "content": `,
+		`{"sender": "ai", "timestamp": 1700000001}`,
+		`{"sender": "ai", "content": "dạ còn ạ", "timestamp": 1700000002}`,
+	}
+	path := filepath.Join(t.TempDir(), "replay.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := replayFile(context.Background(), client, path, userID, false)
+	if err != nil {
+		t.Fatalf("replayFile: %v", err)
+	}
+	if batch.Succeeded != 2 || batch.Failed != 2 {
+		t.Errorf("replay = %d succeeded, %d failed; want 2 and 2", batch.Succeeded, batch.Failed)
+	}
+	var failed []string
+	for _, item := range batch.Failures() {
+		failed = append(failed, item.ID)
+	}
+	if want := []string{"line 2", "line 3"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed items = %v, want %v", failed, want)
+	}
+
+	messages, err := loadUserMessages(context.Background(), session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("%d messages stored, want the 2 valid lines", len(messages))
+	}
+
+	// the checkpoint stops before the first failed line and is kept
+	if line, err := readCheckpoint(path); err != nil || line != 1 {
+		t.Errorf("checkpoint after a partial replay = %d, %v; want 1", line, err)
+	}
+	batch, err = replayFile(context.Background(), client, path, userID, true)
+	if err != nil {
+		t.Fatalf("resumed replayFile: %v", err)
+	}
+	if got := fmt.Sprintf("%d/%d/%d", batch.Succeeded, batch.Skipped, batch.Failed); got != "0/1/2" {
+		t.Errorf("resumed replay succeeded/skipped/failed = %s, want 0/1/2", got)
+	}
+
+	// replaying again skips what is already stored
+	batch, err = replayFile(context.Background(), client, path, userID, false)
+	if err != nil {
+		t.Fatalf("second replayFile: %v", err)
+	}
+	if got := fmt.Sprintf("%d/%d/%d", batch.Succeeded, batch.Skipped, batch.Failed); got != "0/2/2" {
+		t.Errorf("second replay succeeded/skipped/failed = %s, want 0/2/2", got)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Dimensions and model name of the embeddings produced by fakeEmbedding
+const (
+	fakeEmbeddingDims  = 256
+	fakeEmbeddingModel = "fake-bag-of-words"
+)
+
+// Phrases the generated benchmark dataset is built from
+var (
+	benchProducts = []string{"Áo thun", "Áo sơ mi", "Quần jean", "Quần short", "Giày thể thao", "Giày da", "Túi xách", "Mũ lưỡi trai"}
+	benchIntents  = []string{"Cho mình hỏi %s còn size không?", "%s này có màu khác không shop?", "Mình muốn đổi %s sang size lớn hơn", "Shop ơi %s bao giờ có hàng lại?", "Giá %s hiện tại là bao nhiêu?"}
+	benchOffers   = []string{"", " Có khuyến mãi gì không?", " Được freeship không?", " Mua combo có giảm giá không?"}
+)
+
+// Deterministic bag-of-words embedding for benchmarks without OpenAI. Texts
+// sharing words get similar vectors, so similarity edges still form.
+func fakeEmbedding(text string) []float64 {
+	embedding := make([]float64, fakeEmbeddingDims)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		word = strings.Trim(word, ".,!?")
+		if word == "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(word))
+		embedding[binary.BigEndian.Uint32(sum[:4])%fakeEmbeddingDims] += 1
+	}
+
+	var norm float64
+	for _, v := range embedding {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range embedding {
+			embedding[i] /= norm
+		}
+	}
+	return embedding
+}
+
+// Tags from cfg.TopicTags mentioned verbatim in the content
+func fakeTopics(content string) []string {
+	lower := strings.ToLower(content)
+	topics := []string{}
+	for _, tag := range cfg.TopicTags {
+		if strings.Contains(lower, strings.ToLower(tag)) {
+			topics = append(topics, tag)
+		}
+	}
+	return topics
+}
+
+// MessageEnricher built from fakeEmbedding and fakeTopics
+type fakeEnricher struct{}
+
+func (fakeEnricher) Embed(ctx context.Context, text string) ([]float64, error) {
+	return fakeEmbedding(text), nil
+}
+
+func (fakeEnricher) Extract(ctx context.Context, content string) ([]string, error) {
+	return fakeTopics(content), nil
+}
+
+// Generate n alternating human/ai messages about the benchmark products
+func generateBenchMessages(n int, seed int64) []replayRecord {
+	random := rand.New(rand.NewSource(seed))
+	start := time.Now().Add(-time.Duration(n) * time.Second).Unix()
+	records := make([]replayRecord, n)
+	for i := range records {
+		product := benchProducts[random.Intn(len(benchProducts))]
+		content := fmt.Sprintf(benchIntents[random.Intn(len(benchIntents))], product) + benchOffers[random.Intn(len(benchOffers))]
+		sender := "human"
+		if i%2 == 1 {
+			sender = "ai"
+			content = "Dạ, shop trả lời: " + content
+		}
+		records[i] = replayRecord{Sender: sender, Content: content, Timestamp: start + int64(i)}
+	}
+	return records
+}
+
+// Read up to n records from a replay JSONL file (all when n <= 0)
+func readBenchMessages(path string, n int) ([]replayRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %v", err)
+	}
+	defer file.Close()
+
+	var records []replayRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() && (n <= 0 || len(records) < n) {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record replayRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("invalid dataset line %d: %v", len(records)+1, err)
+		}
+		if record.Sender == "" || record.Content == "" {
+			return nil, fmt.Errorf("dataset line %d: sender and content are required", len(records)+1)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Durations of one ingestion stage across a benchmark run
+type stageTimings []time.Duration
+
+// Duration at the given percentile (0-100), nearest rank
+func (t stageTimings) percentile(p float64) time.Duration {
+	if len(t) == 0 {
+		return 0
+	}
+	sorted := append(stageTimings(nil), t...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// Outcome of a benchmark run
+type benchReport struct {
+	Messages     int
+	Elapsed      time.Duration
+	EdgesCreated int
+	Stages       map[string]stageTimings
+}
+
+// Benchmark stages in pipeline order
+var benchStages = []string{"embed", "topic", "write", "edges"}
+
+// Print throughput, per-stage latency percentiles and edge totals
+func printBenchReport(report benchReport) {
+	fmt.Println("⏱️ Ingestion benchmark:")
+	fmt.Printf("  messages     %d\n", report.Messages)
+	fmt.Printf("  elapsed      %s\n", report.Elapsed.Round(time.Millisecond))
+	if report.Elapsed > 0 {
+		fmt.Printf("  throughput   %.1f messages/sec\n", float64(report.Messages)/report.Elapsed.Seconds())
+	}
+	fmt.Printf("  edges        %d\n", report.EdgesCreated)
+	for _, stage := range benchStages {
+		timings := report.Stages[stage]
+		fmt.Printf("  %-6s       p50 %-10s p95 %s\n", stage, timings.percentile(50).Round(time.Microsecond), timings.percentile(95).Round(time.Microsecond))
+	}
+}
+
+// Ingest records as a fresh benchmark user, timing each stage. With fake
+// set, embeddings and topics come from fakeEnricher instead of OpenAI. The
+// write stage is the whole transaction minus edge creation.
+func runBenchmark(ctx context.Context, records []replayRecord, fake bool, userID string) (benchReport, error) {
+	var enricher MessageEnricher = newOpenAIEnricher(newOpenAIClient(cfg.OpenAIAPIKey))
+	model := cfg.EmbeddingModel
+	if fake {
+		enricher, model = fakeEnricher{}, fakeEmbeddingModel
+	}
+	report := benchReport{Stages: make(map[string]stageTimings)}
+
+	var edgesElapsed time.Duration
+	similarityEdgeObserver = func(elapsed time.Duration, created int) {
+		edgesElapsed = elapsed
+		report.EdgesCreated += created
+	}
+	defer func() { similarityEdgeObserver = nil }()
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	start := time.Now()
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		message := Message{
+			MessageID:   generateID(),
+			Timestamp:   record.Timestamp,
+			Sender:      record.Sender,
+			Content:     record.Content,
+			ContentHash: contentHash(record.Sender, record.Content),
+		}
+		if message.Timestamp == 0 {
+			message.Timestamp = time.Now().Unix()
+		}
+
+		stageStart := time.Now()
+		extraction, err := extractTopicsWith(ctx, enricher, message.Content)
+		if err != nil {
+			return report, err
+		}
+		message.Topics = extraction.Accepted
+		message.TopicPromptVersion = topicPromptVersion()
+		report.Stages["topic"] = append(report.Stages["topic"], time.Since(stageStart))
+
+		stageStart = time.Now()
+		input, contentType := messageEmbeddingText(ctx, message.Content, message.Topics)
+		message.ContentType = contentType
+		message.Embedding, err = enricher.Embed(ctx, input)
+		if err != nil {
+			return report, err
+		}
+		message.EmbeddingModel = model
+		report.Stages["embed"] = append(report.Stages["embed"], time.Since(stageStart))
+
+		stageStart = time.Now()
+		edgesElapsed = 0
+		if err := addMessageAndCreateEdges(ctx, session, message, userID); err != nil {
+			return report, err
+		}
+		report.Stages["write"] = append(report.Stages["write"], time.Since(stageStart)-edgesElapsed)
+		report.Stages["edges"] = append(report.Stages["edges"], edgesElapsed)
+		report.Messages++
+	}
+	report.Elapsed = time.Since(start)
+	return report, nil
+}
+
+// Delete a benchmark user and everything it owns
+func deleteBenchUser(userID string) error {
+	ctx := context.Background()
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {userId: $userId})
+			OPTIONAL MATCH (u)-[:OWNS]->(m:Message)
+			DETACH DELETE u, m
+		`
+		if _, err := tx.Run(ctx, query, map[string]any{"userId": userID}); err != nil {
+			return nil, err
+		}
+		return pruneOrphanChunks(ctx, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete benchmark user: %v", err)
+	}
+	return nil
+}
+
+// bench: measure ingestion throughput and per-stage latency
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	count := flags.Int("n", 200, "number of messages to ingest (with --dataset, at most this many; 0 = all)")
+	dataset := flags.String("dataset", "", "replay JSONL file to ingest instead of generated messages")
+	fake := flags.Bool("fake", true, "use a local fake embedder and tagger instead of OpenAI")
+	seed := flags.Int64("seed", 1, "random seed for generated messages")
+	keep := flags.Bool("keep", false, "keep the benchmark user and its messages afterwards")
+	flags.Parse(args)
+
+	if !*fake && cfg.OpenAIAPIKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY is required without --fake")
+	}
+
+	var records []replayRecord
+	if *dataset != "" {
+		var err error
+		if records, err = readBenchMessages(*dataset, *count); err != nil {
+			return err
+		}
+	} else {
+		if *count <= 0 {
+			return fmt.Errorf("-n must be positive for generated messages")
+		}
+		records = generateBenchMessages(*count, *seed)
+	}
+
+	session := neo4jDriver.NewSession(context.Background(), neo4j.SessionConfig{})
+	userID, err := createUser(context.Background(), session, fmt.Sprintf("bench-%d", time.Now().Unix()))
+	session.Close(context.Background())
+	if err != nil {
+		return err
+	}
+	if !*keep {
+		defer func() {
+			if err := deleteBenchUser(userID); err != nil {
+				slog.Error("Failed to clean up benchmark", "userId", userID, "err", err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := runBenchmark(ctx, records, *fake, userID)
+	printBenchReport(report)
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStageTimingsPercentile(t *testing.T) {
+	var timings stageTimings
+	for _, ms := range []int{50, 10, 40, 20, 30, 100, 90, 80, 70, 60} {
+		timings = append(timings, time.Duration(ms)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 10 * time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{95, 100 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := timings.percentile(tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if timings[0] != 50*time.Millisecond {
+		t.Errorf("percentile sorted the timings in place")
+	}
+	if got := stageTimings(nil).percentile(50); got != 0 {
+		t.Errorf("percentile of no timings = %s, want 0", got)
+	}
+}
+
+func TestFakeEmbedding(t *testing.T) {
+	a := fakeEmbedding("Áo thun còn size không?")
+	if len(a) != fakeEmbeddingDims {
+		t.Fatalf("len = %d, want %d", len(a), fakeEmbeddingDims)
+	}
+	var norm float64
+	for _, v := range a {
+		norm += v * v
+	}
+	if math.Abs(norm-1) > 1e-9 {
+		t.Errorf("squared norm = %v, want 1", norm)
+	}
+
+	same := fakeEmbedding("áo THUN còn size không")
+	related := fakeEmbedding("Áo thun có màu khác không?")
+	unrelated := fakeEmbedding("Giày da bao giờ về hàng")
+	if !reflect.DeepEqual(a, same) {
+		t.Errorf("case and punctuation changed the embedding")
+	}
+	if cosineSimilarity(a, related) <= cosineSimilarity(a, unrelated) {
+		t.Errorf("shared words did not make texts more similar")
+	}
+}
+
+func TestGenerateBenchMessages(t *testing.T) {
+	records := generateBenchMessages(6, 42)
+	if len(records) != 6 {
+		t.Fatalf("%d records, want 6", len(records))
+	}
+	for i, record := range records {
+		wantSender := "human"
+		if i%2 == 1 {
+			wantSender = "ai"
+		}
+		if record.Sender != wantSender || record.Content == "" {
+			t.Errorf("record %d = %+v, want sender %s with content", i, record, wantSender)
+		}
+		if i > 0 && record.Timestamp != records[i-1].Timestamp+1 {
+			t.Errorf("record %d timestamp %d does not follow %d", i, record.Timestamp, records[i-1].Timestamp)
+		}
+	}
+
+	again := generateBenchMessages(6, 42)
+	for i := range records {
+		if records[i].Content != again[i].Content {
+			t.Errorf("record %d differs for the same seed: %q, %q", i, records[i].Content, again[i].Content)
+		}
+	}
+}
+
+func TestReadBenchMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dataset.jsonl")
+	lines := []string{
+		`{"sender": "human", "content": "Áo còn không?"}`,
+		``,
+		`{"sender": "ai", "content": "Dạ còn ạ"}`,
+		`{"sender": "human", "content": "Giày thì sao?"}`,
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readBenchMessages(path, 2)
+	if err != nil {
+		t.Fatalf("readBenchMessages: %v", err)
+	}
+	if len(records) != 2 || records[1].Content != "Dạ còn ạ" {
+		t.Errorf("records = %+v, want the first 2 messages", records)
+	}
+	if records, err := readBenchMessages(path, 0); err != nil || len(records) != 3 {
+		t.Errorf("readBenchMessages without a limit = %d records, %v; want 3", len(records), err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"sender": "human"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBenchMessages(path, 0); err == nil {
+		t.Error("readBenchMessages accepted a line without content")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Keeps consecutive OpenAI requests at least interval apart, so a chat turn
+// (topics, embedding and completion, plus the reply's enrichment) does not
+// burst past the rate limit of low-tier keys. now and sleep are replaceable
+// for tests.
+type callSpacer struct {
+	interval time.Duration
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// Create a callSpacer on the real clock; interval <= 0 disables spacing
+func newCallSpacer(interval time.Duration) *callSpacer {
+	return &callSpacer{interval: interval, now: time.Now, sleep: sleepContext}
+}
+
+// Wait until interval has passed since the previous call, then record this
+// one. Returns ctx's error if cancelled while waiting.
+func (s *callSpacer) wait(ctx context.Context) error {
+	if s == nil || s.interval <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.last.IsZero() {
+		if delay := s.last.Add(s.interval).Sub(s.now()); delay > 0 {
+			if err := s.sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+	}
+	s.last = s.now()
+	return nil
+}
+
+// Sleep for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type callSpacerKey struct{}
+
+// Space the OpenAI requests made with ctx through s
+func withCallSpacer(ctx context.Context, s *callSpacer) context.Context {
+	return context.WithValue(ctx, callSpacerKey{}, s)
+}
+
+// Call spacer carried by ctx, or nil if none
+func contextCallSpacer(ctx context.Context) *callSpacer {
+	s, _ := ctx.Value(callSpacerKey{}).(*callSpacer)
+	return s
+}
+
+// Spacer shared by the interactive chat's OpenAI requests, set up in main
+// from cfg.InteractiveCallSpacing. Nil outside the chat.
+var interactiveCallSpacer *callSpacer
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// callSpacer on a fake clock that advances by the slept durations, which
+// are recorded
+func newTestCallSpacer(interval time.Duration) (*callSpacer, *[]time.Duration, func(time.Duration)) {
+	clock := time.Unix(1700000000, 0)
+	var slept []time.Duration
+	spacer := &callSpacer{
+		interval: interval,
+		now:      func() time.Time { return clock },
+		sleep: func(ctx context.Context, d time.Duration) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			slept = append(slept, d)
+			clock = clock.Add(d)
+			return nil
+		},
+	}
+	return spacer, &slept, func(d time.Duration) { clock = clock.Add(d) }
+}
+
+func TestCallSpacerWait(t *testing.T) {
+	spacer, slept, advance := newTestCallSpacer(time.Second)
+	ctx := context.Background()
+
+	spacer.wait(ctx)
+	spacer.wait(ctx)
+	advance(400 * time.Millisecond)
+	spacer.wait(ctx)
+	advance(2 * time.Second)
+	spacer.wait(ctx)
+
+	// the first call and the one after a long pause go straight through
+	if want := []time.Duration{time.Second, 600 * time.Millisecond}; !reflect.DeepEqual(*slept, want) {
+		t.Errorf("slept %v, want %v", *slept, want)
+	}
+}
+
+func TestCallSpacerCancelled(t *testing.T) {
+	spacer, _, _ := newTestCallSpacer(time.Second)
+	spacer.wait(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := spacer.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestCallSpacerDisabled(t *testing.T) {
+	for _, spacer := range []*callSpacer{nil, newCallSpacer(0)} {
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if err := spacer.wait(context.Background()); err != nil {
+				t.Fatalf("wait: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("disabled spacer waited %s", elapsed)
+		}
+	}
+
+	ctx := withCallSpacer(context.Background(), newCallSpacer(time.Second))
+	if contextCallSpacer(ctx) == nil || contextCallSpacer(context.Background()) != nil {
+		t.Error("contextCallSpacer does not return the spacer carried by the context")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Ways of combining chunk-pair similarities into a message similarity
+const (
+	ChunkSimilarityMax  = "max"
+	ChunkSimilarityMean = "mean"
+)
+
+// Segment of a long message embedded on its own, stored as a :Chunk node
+// linked from the message by HAS_CHUNK
+type Chunk struct {
+	Index     int       `json:"index"`
+	Content   string    `json:"content"`
+	Embedding []float64 `json:"embedding,omitempty"`
+}
+
+// Validate a CHUNK_SIMILARITY value
+func parseChunkSimilarity(value string) (string, error) {
+	switch value {
+	case ChunkSimilarityMax, ChunkSimilarityMean:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid CHUNK_SIMILARITY %q (want %s or %s)", value, ChunkSimilarityMax, ChunkSimilarityMean)
+}
+
+// Split content into segments of at most size runes, breaking after
+// sentences where possible and between words otherwise. Words longer than
+// size are kept whole.
+func splitIntoChunks(content string, size int) []string {
+	var sentences []string
+	start := 0
+	for i, r := range content {
+		if r == '.' || r == '!' || r == '?' || r == '\n' {
+			sentences = append(sentences, content[start:i+utf8.RuneLen(r)])
+			start = i + utf8.RuneLen(r)
+		}
+	}
+	sentences = append(sentences, content[start:])
+
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			chunks = append(chunks, text)
+		}
+		current.Reset()
+	}
+	add := func(text string) {
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(text) > size {
+			flush()
+		}
+		current.WriteString(text)
+	}
+	for _, sentence := range sentences {
+		if utf8.RuneCountInString(strings.TrimSpace(sentence)) <= size {
+			add(sentence)
+			continue
+		}
+		for _, word := range strings.Fields(sentence) {
+			add(" " + word)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// Split and embed a message whose content is longer than cfg.ChunkSize.
+// Shorter messages, or any with chunking off, get no chunks. On failure the
+// message keeps its whole-content embedding only.
+func embedMessageChunks(ctx context.Context, embedder Embedder, message *Message) {
+	message.Chunks = nil
+	if cfg.ChunkSize <= 0 || utf8.RuneCountInString(message.Content) <= cfg.ChunkSize {
+		return
+	}
+	texts := splitIntoChunks(message.Content, cfg.ChunkSize)
+	if len(texts) < 2 {
+		return
+	}
+
+	embeddings, err := embedTexts(ctx, embedder, texts)
+	if err != nil {
+		slog.Warn("Error embedding chunks, using the whole-message embedding", "messageId", message.MessageID, "err", err)
+		return
+	}
+	for i, text := range texts {
+		message.Chunks = append(message.Chunks, Chunk{Index: i, Content: text, Embedding: embeddings[i]})
+	}
+}
+
+// Replace the Chunk nodes of a message with chunks
+func storeMessageChunks(ctx context.Context, tx neo4j.ManagedTransaction, messageID string, chunks []Chunk) error {
+	deleteQuery := `
+		MATCH (:Message {messageId: $messageId})-[:HAS_CHUNK]->(c:Chunk)
+		DETACH DELETE c
+	`
+	if _, err := tx.Run(ctx, deleteQuery, map[string]any{"messageId": messageID}); err != nil {
+		return fmt.Errorf("failed to delete chunks: %v", err)
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	rows := make([]map[string]any, len(chunks))
+	for i, chunk := range chunks {
+		rows[i] = map[string]any{
+			"chunkId":   generateID(),
+			"index":     chunk.Index,
+			"content":   chunk.Content,
+			"embedding": chunk.Embedding,
+		}
+	}
+	createQuery := `
+		MATCH (m:Message {messageId: $messageId})
+		UNWIND $chunks AS chunk
+		CREATE (m)-[:HAS_CHUNK]->(:Chunk {
+			chunkId: chunk.chunkId,
+			messageId: $messageId,
+			index: chunk.index,
+			content: chunk.content,
+			embedding: chunk.embedding
+		})
+	`
+	if _, err := tx.Run(ctx, createQuery, map[string]any{"messageId": messageID, "chunks": rows}); err != nil {
+		return fmt.Errorf("failed to store chunks: %v", err)
+	}
+	return nil
+}
+
+// Delete chunks whose message is gone. Returns the number deleted.
+func pruneOrphanChunks(ctx context.Context, tx neo4j.ManagedTransaction) (int, error) {
+	result, err := tx.Run(ctx, `
+		MATCH (c:Chunk)
+		WHERE NOT (c)<-[:HAS_CHUNK]-(:Message)
+		DETACH DELETE c
+	`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune orphan chunks: %v", err)
+	}
+	summary, err := result.Consume(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune orphan chunks: %v", err)
+	}
+	return summary.Counters().NodesDeleted(), nil
+}
+
+// Decode the chunk nodes returned next to a message, in index order
+func chunksFromValue(value any) []Chunk {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	var chunks []Chunk
+	for _, v := range values {
+		node, ok := v.(neo4j.Node)
+		if !ok {
+			continue
+		}
+		index, _ := node.Props["index"].(int64)
+		content, _ := node.Props["content"].(string)
+		chunks = append(chunks, Chunk{Index: int(index), Content: content, Embedding: decodeStoredEmbedding(node.Props["embedding"], nil)})
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	return chunks
+}
+
+// Decode a list of chunk embeddings of a message returned by a candidate
+// query, skipping malformed ones with a warning
+func chunkEmbeddingsFromValue(messageID string, value any) [][]float64 {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	var embeddings [][]float64
+	for _, v := range values {
+		if embedding, ok := asFloat64Slice(v, "messageId", messageID); ok {
+			embeddings = append(embeddings, embedding)
+		}
+	}
+	return embeddings
+}
+
+// Embeddings of a message's chunks
+func chunkEmbeddings(chunks []Chunk) [][]float64 {
+	embeddings := make([][]float64, 0, len(chunks))
+	for _, chunk := range chunks {
+		embeddings = append(embeddings, chunk.Embedding)
+	}
+	return embeddings
+}
+
+// Similarity of two messages at the chunk level: the max or mean (by
+// cfg.ChunkSimilarity) cosine over all pairs of their chunk embeddings. A
+// message without chunks takes part with its whole-content embedding, so two
+// unchunked messages compare exactly as cosineSimilarity(a, b).
+func chunkedSimilarity(a []float64, chunksA [][]float64, b []float64, chunksB [][]float64) float64 {
+	if len(chunksA) == 0 && len(chunksB) == 0 {
+		return cosineSimilarity(a, b)
+	}
+	if len(chunksA) == 0 {
+		chunksA = [][]float64{a}
+	}
+	if len(chunksB) == 0 {
+		chunksB = [][]float64{b}
+	}
+
+	best, sum := math.Inf(-1), 0.0
+	for _, x := range chunksA {
+		for _, y := range chunksB {
+			similarity := cosineSimilarity(x, y)
+			best = max(best, similarity)
+			sum += similarity
+		}
+	}
+	if cfg.ChunkSimilarity == ChunkSimilarityMean {
+		return sum / float64(len(chunksA)*len(chunksB))
+	}
+	return best
+}
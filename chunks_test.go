@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitIntoChunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		size    int
+		want    []string
+	}{
+		{"short", "Áo thun trắng.", 50, []string{"Áo thun trắng."}},
+		{"sentences grouped", "Áo còn không? Giày size 42. Mũ đỏ!", 28, []string{"Áo còn không? Giày size 42.", "Mũ đỏ!"}},
+		{"long sentence split by words", "một hai ba bốn năm sáu", 8, []string{"một hai", "ba bốn", "năm sáu"}},
+		{"long word kept whole", "siêuuuuuuudài ok", 5, []string{"siêuuuuuuudài", "ok"}},
+	}
+	for _, tt := range tests {
+		got := splitIntoChunks(tt.content, tt.size)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: splitIntoChunks(%q, %d) = %q, want %q", tt.name, tt.content, tt.size, got, tt.want)
+		}
+	}
+
+	content := strings.Repeat("Giày chạy bộ còn size 42 không shop? ", 20)
+	for _, chunk := range splitIntoChunks(content, 80) {
+		if n := utf8.RuneCountInString(chunk); n > 80 {
+			t.Errorf("chunk of %d runes exceeds the size: %q", n, chunk)
+		}
+	}
+}
+
+func TestChunkedSimilarity(t *testing.T) {
+	a := []float64{1, 0}
+	b := []float64{0, 1}
+	chunksA := [][]float64{{1, 0}, {0, 1}}
+	chunksB := [][]float64{{0, 1}}
+
+	tests := []struct {
+		mode    string
+		chunksA [][]float64
+		chunksB [][]float64
+		want    float64
+	}{
+		{ChunkSimilarityMax, nil, nil, 0},
+		{ChunkSimilarityMax, chunksA, nil, 1},
+		{ChunkSimilarityMean, chunksA, nil, 0.5},
+		{ChunkSimilarityMax, chunksA, chunksB, 1},
+		{ChunkSimilarityMean, chunksA, [][]float64{{0, 1}, {0, 1}}, 0.5},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) { c.ChunkSimilarity = tt.mode })
+		if got := chunkedSimilarity(a, tt.chunksA, b, tt.chunksB); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s with %d and %d chunks = %v, want %v", tt.mode, len(tt.chunksA), len(tt.chunksB), got, tt.want)
+		}
+	}
+}
+
+func TestEmbedMessageChunks(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.ChunkSize = 35 })
+	long := "Áo thun trắng còn size M không? Giày chạy bộ có size 42 không?"
+
+	enricher := &stubEnricher{}
+	message := Message{Content: long}
+	embedMessageChunks(context.Background(), enricher, &message)
+	if len(message.Chunks) != 2 {
+		t.Fatalf("%d chunks, want 2", len(message.Chunks))
+	}
+	for i, chunk := range message.Chunks {
+		if chunk.Index != i || !reflect.DeepEqual(chunk.Embedding, stubEmbedding(chunk.Content)) {
+			t.Errorf("chunk %d = %+v, want index %d with its own embedding", i, chunk, i)
+		}
+	}
+
+	// short messages, disabled chunking and failed embeddings leave no chunks
+	short := Message{Content: "Áo còn không?", Chunks: []Chunk{{Content: "stale"}}}
+	embedMessageChunks(context.Background(), enricher, &short)
+	if short.Chunks != nil {
+		t.Errorf("short message chunks = %+v, want none", short.Chunks)
+	}
+	failing := Message{Content: long}
+	embedMessageChunks(context.Background(), &stubEnricher{embedErr: errors.New("down")}, &failing)
+	if failing.Chunks != nil {
+		t.Errorf("chunks = %+v after an embedding error, want none", failing.Chunks)
+	}
+	setTestConfig(t, func(c *Config) { c.ChunkSize = 0 })
+	disabled := Message{Content: long}
+	embedMessageChunks(context.Background(), enricher, &disabled)
+	if disabled.Chunks != nil {
+		t.Errorf("chunks = %+v with chunking off, want none", disabled.Chunks)
+	}
+}
+
+func TestParseChunkSimilarity(t *testing.T) {
+	for _, value := range []string{ChunkSimilarityMax, ChunkSimilarityMean} {
+		if got, err := parseChunkSimilarity(value); err != nil || got != value {
+			t.Errorf("parseChunkSimilarity(%q) = %q, %v", value, got, err)
+		}
+	}
+	if _, err := parseChunkSimilarity("median"); err == nil {
+		t.Error("parseChunkSimilarity accepted median")
+	}
+}
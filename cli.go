@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Subcommands run instead of the interactive chat
+var subcommands = map[string]func(args []string) error{
+	"bench":  runBench,
+	"export": runExport,
+	"ingest": runIngest,
+	"prefs":  runPrefs,
+	"tail":   runTail,
+}
+
+// Run a subcommand with the configuration and Neo4j connection set up
+func runSubcommand(name string, args []string) error {
+	run, ok := subcommands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	if err := initNeo4j(); err != nil {
+		return fmt.Errorf("failed to initialize Neo4j: %v", err)
+	}
+	defer neo4jDriver.Close(context.Background())
+	if err := initSchema(context.Background(), neo4jDriver); err != nil {
+		slog.Error("Failed to initialize schema", "err", err)
+	}
+
+	return run(args)
+}
+
+// tail: print messages as they are ingested
+func runTail(args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ExitOnError)
+	user := flags.String("user", "", "only show messages of this user ID")
+	topic := flags.String("topic", "", "only show messages tagged with this topic")
+	since := flags.String("since", "0s", "also show messages from this long ago (e.g. 10m, 1d)")
+	interval := flags.Duration("interval", 2*time.Second, "polling interval")
+	flags.Parse(args)
+
+	lookback, err := parseDayDuration(*since)
+	if err != nil {
+		return fmt.Errorf("invalid --since: %v", err)
+	}
+	if *interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Println("👀 Tailing messages (Ctrl-C to stop)...")
+	return tailMessages(ctx, os.Stdout, tailOptions{
+		Since:    time.Now().Add(-lookback),
+		UserID:   *user,
+		Topic:    *topic,
+		Interval: *interval,
+	})
+}
+
+// Report whether stdout is a terminal rather than a pipe or file
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
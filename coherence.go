@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Similarity between consecutive messages of a conversation
+type CoherenceReport struct {
+	Messages int     `json:"messages"`
+	Pairs    int     `json:"pairs"`
+	Average  float64 `json:"average"`
+	Variance float64 `json:"variance"`
+	Min      float64 `json:"min"`
+	// Consecutive pairs less similar than the default edge threshold,
+	// i.e. likely topic jumps
+	TopicJumps int `json:"topicJumps"`
+}
+
+// Compute coherence over consecutive pairs of messages. Pairs where either
+// message has no embedding are skipped.
+func computeCoherence(messages []Message) CoherenceReport {
+	report := CoherenceReport{Messages: len(messages)}
+	var similarities []float64
+	for i := 1; i < len(messages); i++ {
+		a, b := messages[i-1].Embedding, messages[i].Embedding
+		if len(a) == 0 || len(a) != len(b) {
+			continue
+		}
+		similarities = append(similarities, cosineSimilarity(a, b))
+	}
+	if len(similarities) == 0 {
+		return report
+	}
+
+	report.Pairs = len(similarities)
+	report.Min = similarities[0]
+	sum := 0.0
+	for _, s := range similarities {
+		sum += s
+		report.Min = min(report.Min, s)
+		if s <= cfg.SimilarityThreshold {
+			report.TopicJumps++
+		}
+	}
+	report.Average = sum / float64(len(similarities))
+	for _, s := range similarities {
+		report.Variance += (s - report.Average) * (s - report.Average)
+	}
+	report.Variance /= float64(len(similarities))
+	return report
+}
+
+// Measure how on-topic a user's conversation stays from the similarity of
+// consecutive messages (by timestamp) using their stored embeddings.
+// Returns errNoMessages when the user has no messages.
+func coherenceScore(ctx context.Context, userID string) (CoherenceReport, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return CoherenceReport{}, err
+	}
+	if len(messages) == 0 {
+		return CoherenceReport{}, errNoMessages
+	}
+	return computeCoherence(messages), nil
+}
+
+// Print a coherence report
+func printCoherence(report CoherenceReport) {
+	if report.Pairs == 0 {
+		fmt.Println("Not enough embedded messages to measure coherence")
+		return
+	}
+	fmt.Printf("🧭 Coherence over %d consecutive pairs (%d messages):\n", report.Pairs, report.Messages)
+	fmt.Printf("  average similarity  %.3f\n", report.Average)
+	fmt.Printf("  variance            %.4f\n", report.Variance)
+	fmt.Printf("  lowest similarity   %.3f\n", report.Min)
+	fmt.Printf("  topic jumps         %d\n", report.TopicJumps)
+}
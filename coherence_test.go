@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeCoherence(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.SimilarityThreshold = 0.5 })
+	messages := []Message{
+		{Embedding: []float64{1, 0}},
+		{Embedding: []float64{1, 0}},
+		{Embedding: []float64{0, 1}},
+		{},
+		{Embedding: []float64{0, 1}},
+		{Embedding: []float64{0, 1, 0}},
+	}
+	got := computeCoherence(messages)
+	want := CoherenceReport{Messages: 6, Pairs: 2, Average: 0.5, Variance: 0.25, Min: 0, TopicJumps: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("computeCoherence = %+v, want %+v", got, want)
+	}
+}
+
+func TestComputeCoherenceWithoutPairs(t *testing.T) {
+	setTestConfig(t, nil)
+	got := computeCoherence([]Message{{Embedding: []float64{1, 0}}})
+	if want := (CoherenceReport{Messages: 1}); got != want {
+		t.Errorf("computeCoherence = %+v, want %+v", got, want)
+	}
+}
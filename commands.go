@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// State of the interactive conversation available to in-chat commands
+type replState struct {
+	client *openai.Client
+	userID string
+}
+
+// Run an in-chat slash command under ctx. Returns false if input is not a
+// command. Each command's calls share one requestContext, except
+// /retryreplies, a batch whose calls are bounded one by one.
+func handleCommand(ctx context.Context, input string, state *replState) bool {
+	if !strings.HasPrefix(input, "/") {
+		return false
+	}
+	cmdCtx, cancel := requestContext(ctx)
+	defer cancel()
+
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case "/config":
+		fmt.Print(describeConfig(cfg))
+	case "/answer":
+		question := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+		if question == "" {
+			fmt.Println("Usage: /answer <question>")
+			break
+		}
+		answer, confidence, err := bestAnswer(cmdCtx, state.client, state.userID, question)
+		if errors.Is(err, errNoMessages) {
+			fmt.Println(noMessagesText)
+			break
+		}
+		if errors.Is(err, errNoGoodAnswer) {
+			fmt.Printf("No earlier answer fits: %v\n", err)
+			break
+		}
+		if err != nil {
+			slog.Error("Error finding an earlier answer", "userId", state.userID, "err", err)
+			break
+		}
+		printBestAnswer(answer, confidence)
+	case "/central":
+		printTopRankedMessages(cmdCtx, state.userID)
+	case "/coherence":
+		report, err := coherenceScore(cmdCtx, state.userID)
+		if errors.Is(err, errNoMessages) {
+			fmt.Println(noMessagesText)
+			break
+		}
+		if err != nil {
+			slog.Error("Error computing coherence", "userId", state.userID, "err", err)
+			break
+		}
+		printCoherence(report)
+	case "/interests":
+		printInterestProfile(cmdCtx, state.userID)
+	case "/isolated":
+		printIsolatedMessages(cmdCtx, state.userID)
+	case "/prefs":
+		handlePrefsCommand(cmdCtx, fields, state.userID)
+	case "/edit":
+		handleEditCommand(cmdCtx, input, fields, state)
+	case "/retag":
+		handleRetagCommand(cmdCtx, input, fields, state.userID)
+	case "/retryreplies":
+		if _, err := answerAwaitingReplies(ctx, state.client, state.userID); err != nil {
+			slog.Error("Error retrying replies", "userId", state.userID, "err", err)
+		}
+	case "/search":
+		query := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+		if query == "" {
+			fmt.Println("Usage: /search <text>")
+			break
+		}
+		results, err := searchMessages(cmdCtx, state.client, state.userID, query, cfg.SearchLimit)
+		if errors.Is(err, errNoMessages) {
+			fmt.Println(noMessagesText)
+			break
+		}
+		if err != nil {
+			slog.Error("Error searching messages", "userId", state.userID, "err", err)
+			break
+		}
+		printSearchResults(results)
+	case "/stats":
+		stats, err := userStats(cmdCtx, state.userID)
+		if errors.Is(err, errNoMessages) {
+			fmt.Println(noMessagesText)
+			break
+		}
+		if err != nil {
+			slog.Error("Error computing stats", "userId", state.userID, "err", err)
+			break
+		}
+		printUserStats(stats)
+	case "/summary":
+		topic := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+		if topic == "" {
+			fmt.Println("Usage: /summary <topic>")
+			break
+		}
+		summary, err := summarizeTopic(cmdCtx, state.client, state.userID, topic)
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Println(summary)
+	case "/topic":
+		topic := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+		if topic == "" {
+			fmt.Println("Usage: /topic <name>")
+			break
+		}
+		session := neo4jDriver.NewSession(cmdCtx, neo4j.SessionConfig{})
+		messages, err := messagesByTopic(cmdCtx, session, state.userID, topic)
+		session.Close(context.Background())
+		if err != nil {
+			slog.Error("Error loading topic messages", "userId", state.userID, "err", err)
+			break
+		}
+		printTopicMessages(canonicalTopicName(topic), messages)
+	case "/topicstats":
+		topicTagStats.print()
+	case "/health":
+		printHealth(cmdCtx)
+	case "/help":
+		printCommandHelp()
+	default:
+		fmt.Printf("Unknown command: %s\n", fields[0])
+		printCommandHelp()
+	}
+	return true
+}
+
+// Print the list of in-chat commands
+func printCommandHelp() {
+	fmt.Println("Commands:")
+	fmt.Println("  /answer <question>  show the earlier answer to your most similar question")
+	fmt.Println("  /central    show your most central messages by PageRank")
+	fmt.Println("  /coherence  show how on-topic the conversation stays")
+	fmt.Println("  /config     show the effective configuration")
+	fmt.Println("  /edit <text>  replace the content of your last message")
+	fmt.Println("  /health     check that Neo4j is reachable")
+	fmt.Println("  /interests  show your topic interest profile")
+	fmt.Println("  /isolated   list messages without similarity edges")
+	fmt.Println("  /prefs [<field> <value>]  show or change your preferences")
+	fmt.Println("  /retag <tag>[, <tag>...]  replace the topics of your last message")
+	fmt.Println("  /retryreplies  answer messages left unanswered by a failed reply")
+	fmt.Println("  /search <text>  find your most similar earlier messages")
+	fmt.Println("  /stats      show message, topic and edge counts")
+	fmt.Println("  /summary <topic>  summarize what you said about a topic")
+	fmt.Println("  /topic <name>  list your messages about a topic")
+	fmt.Println("  /topicstats show how many extracted tags were outside the taxonomy")
+	fmt.Println("  /help       show this help")
+	fmt.Println("  exit        end the conversation")
+}
+
+// In-chat /retag: replace the topics of the user's last message with a
+// comma-separated list of tags ("/retag -" clears them)
+func handleRetagCommand(ctx context.Context, input string, fields []string, userID string) {
+	if len(fields) < 2 {
+		fmt.Println("Usage: /retag <tag>[, <tag>...]")
+		return
+	}
+	var topics []string
+	if list := strings.TrimSpace(strings.TrimPrefix(input, fields[0])); list != "-" {
+		topics = strings.Split(list, ",")
+	}
+
+	messageID, err := latestHumanMessageID(ctx, userID)
+	if errors.Is(err, errNoMessages) {
+		fmt.Println(noMessagesText)
+		return
+	}
+	if err != nil {
+		slog.Error("Error retagging message", "userId", userID, "err", err)
+		return
+	}
+	if err := setMessageTopics(ctx, messageID, topics); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// In-chat /edit: replace the content of the user's last message, which is
+// re-embedded, re-tagged and re-linked
+func handleEditCommand(ctx context.Context, input string, fields []string, state *replState) {
+	content := strings.TrimSpace(strings.TrimPrefix(input, fields[0]))
+	if content == "" {
+		fmt.Println("Usage: /edit <text>")
+		return
+	}
+
+	messageID, err := latestHumanMessageID(ctx, state.userID)
+	if errors.Is(err, errNoMessages) {
+		fmt.Println(noMessagesText)
+		return
+	}
+	if err != nil {
+		slog.Error("Error editing message", "userId", state.userID, "err", err)
+		return
+	}
+	message, err := editMessage(ctx, newOpenAIEnricher(state.client), messageID, content)
+	if err != nil {
+		slog.Error("Error editing message", "messageId", messageID, "userId", state.userID, "err", err)
+		return
+	}
+	if message.NeedsEnrichment {
+		fmt.Printf("✏️ Edited message %s; embedding or topics queued for retry\n", messageID)
+		return
+	}
+	fmt.Printf("✏️ Edited message %s: %v\n", messageID, message.Topics)
+}
+
+// Print the current user's interest profile
+func printInterestProfile(ctx context.Context, userID string) {
+	profile, err := userInterestProfile(ctx, userID)
+	if err != nil {
+		slog.Error("Error computing interest profile", "userId", userID, "err", err)
+		return
+	}
+	if len(profile) == 0 {
+		fmt.Println("No topics yet for this user")
+		return
+	}
+	fmt.Println("🎯 Interest profile:")
+	for _, weight := range profile {
+		fmt.Printf("  %-12s %.3f\n", weight.Topic, weight.Weight)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+)
+
+// Gzip an embedding as little-endian float64 values
+func compressEmbedding(embedding []float64) ([]byte, error) {
+	raw := make([]byte, 8*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint64(raw[8*i:], math.Float64bits(v))
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Reverse compressEmbedding
+func decompressEmbedding(data []byte) ([]float64, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// Read one value past the limit to detect oversized embeddings
+	raw, err := io.ReadAll(io.LimitReader(reader, 8*(maxEmbeddingDimensions+1)))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > 8*maxEmbeddingDimensions {
+		return nil, fmt.Errorf("compressed embedding has more than %d dimensions", maxEmbeddingDimensions)
+	}
+	if len(raw)%8 != 0 {
+		return nil, fmt.Errorf("compressed embedding has %d bytes, not a multiple of 8", len(raw))
+	}
+
+	embedding := make([]float64, len(raw)/8)
+	for i := range embedding {
+		embedding[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw[8*i:]))
+		if math.IsNaN(embedding[i]) || math.IsInf(embedding[i], 0) {
+			return nil, fmt.Errorf("compressed embedding element %d is %v", i, embedding[i])
+		}
+	}
+	return embedding, nil
+}
+
+// Property values to store for an embedding: the plain float list, or with
+// cfg.CompressEmbeddings a gzip blob in embeddingGz instead. Compressed
+// embeddings cannot be used by a native Neo4j vector index; similarity is
+// then always computed in Go.
+func storedEmbedding(embedding []float64) (plain any, compressed any) {
+	if !cfg.CompressEmbeddings || len(embedding) == 0 {
+		return embedding, nil
+	}
+	data, err := compressEmbedding(embedding)
+	if err != nil {
+		slog.Warn("Failed to compress embedding, storing it uncompressed", "err", err)
+		return embedding, nil
+	}
+	return nil, data
+}
+
+// Longest embedding accepted when reading one back. Far above any embedding
+// model's output, so only corrupt or foreign values are rejected.
+const maxEmbeddingDimensions = 16384
+
+// Parse an embedding stored as a list property. Integer elements are
+// converted; anything else (strings, nested lists, NaN or infinite values,
+// more than maxEmbeddingDimensions elements) is an error rather than a
+// silently shortened vector. A missing value is an empty embedding.
+func parseEmbedding(value any) ([]float64, error) {
+	if value == nil {
+		return nil, nil
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("embedding is a %T, not a list", value)
+	}
+	if len(values) > maxEmbeddingDimensions {
+		return nil, fmt.Errorf("embedding has %d dimensions, more than %d", len(values), maxEmbeddingDimensions)
+	}
+	embedding := make([]float64, len(values))
+	for i, v := range values {
+		switch n := v.(type) {
+		case float64:
+			embedding[i] = n
+		case int64:
+			embedding[i] = float64(n)
+		default:
+			return nil, fmt.Errorf("embedding element %d is a %T, not a number", i, v)
+		}
+		if math.IsNaN(embedding[i]) || math.IsInf(embedding[i], 0) {
+			return nil, fmt.Errorf("embedding element %d is %v", i, embedding[i])
+		}
+	}
+	return embedding, nil
+}
+
+// Convert a Neo4j list value to []float64 like parseEmbedding, reporting
+// false instead of an error when the value is missing, empty or malformed,
+// for callers that skip such values. A malformed value is logged with
+// attrs, which identify its message or topic.
+func asFloat64Slice(value any, attrs ...any) ([]float64, bool) {
+	embedding, err := parseEmbedding(value)
+	if err != nil {
+		slog.Warn("Skipping malformed embedding", append(attrs, "err", err)...)
+		return nil, false
+	}
+	if len(embedding) == 0 {
+		return nil, false
+	}
+	return embedding, true
+}
+
+// Parse an embedding read back from the embedding / embeddingGz properties
+func parseStoredEmbedding(plain any, compressed any) ([]float64, error) {
+	if data, ok := compressed.([]byte); ok && len(data) > 0 {
+		embedding, err := decompressEmbedding(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress embedding: %v", err)
+		}
+		return embedding, nil
+	}
+	return parseEmbedding(plain)
+}
+
+// Decode an embedding like parseStoredEmbedding, logging a malformed one
+// and treating it as missing
+func decodeStoredEmbedding(plain any, compressed any) []float64 {
+	embedding, err := parseStoredEmbedding(plain, compressed)
+	if err != nil {
+		slog.Warn("Ignoring malformed stored embedding", "err", err)
+		return nil
+	}
+	return embedding
+}
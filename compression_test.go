@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestAsFloat64Slice(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		want   []float64
+		wantOK bool
+	}{
+		{"floats", []any{0.5, -1.0}, []float64{0.5, -1}, true},
+		{"integers", []any{int64(1), 0.25}, []float64{1, 0.25}, true},
+		{"null", nil, nil, false},
+		{"empty", []any{}, nil, false},
+		{"string", "0.1,0.2", nil, false},
+		{"float32 list", []float32{0.1}, nil, false},
+		{"string element", []any{0.1, "0.2"}, nil, false},
+		{"null element", []any{0.1, nil}, nil, false},
+		{"nested list", []any{[]any{0.1, 0.2}}, nil, false},
+		{"NaN", []any{math.NaN()}, nil, false},
+		{"infinite", []any{math.Inf(1)}, nil, false},
+		{"too long", make([]any, maxEmbeddingDimensions+1), nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := asFloat64Slice(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("asFloat64Slice() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("asFloat64Slice() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("asFloat64Slice()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMessageFromNodeMalformedProps(t *testing.T) {
+	node := neo4j.Node{Props: map[string]any{
+		"messageId":   "m1",
+		"timestamp":   "yesterday",
+		"sender":      int64(1),
+		"content":     nil,
+		"embedding":   []any{"a", "b"},
+		"topics":      []any{"refund", int64(3), nil},
+		"repeatCount": 2.5,
+		"model":       "gpt-4o-mini",
+		"temperature": "warm",
+		"totalTokens": "many",
+	}}
+	message := messageFromNode(node)
+	if message.MessageID != "m1" {
+		t.Errorf("MessageID = %q, want m1", message.MessageID)
+	}
+	if message.Timestamp != 0 || message.Sender != "" || message.Content != "" || message.RepeatCount != 0 {
+		t.Errorf("mistyped properties were not left zero: %+v", message)
+	}
+	if message.Embedding != nil {
+		t.Errorf("Embedding = %v, want nil for a malformed value", message.Embedding)
+	}
+	if len(message.Topics) != 1 || message.Topics[0] != "refund" {
+		t.Errorf("Topics = %v, want [refund]", message.Topics)
+	}
+	if message.Generation == nil || message.Generation.Temperature != 0 || message.Generation.TotalTokens != 0 {
+		t.Errorf("Generation = %+v, want the model with zero settings", message.Generation)
+	}
+}
+
+func TestChunkEmbeddingsFromValueSkipsMalformed(t *testing.T) {
+	value := []any{
+		[]any{0.1, 0.2},
+		"not a list",
+		[]any{0.3, "x"},
+		nil,
+		[]any{int64(1), 0.5},
+	}
+	embeddings := chunkEmbeddingsFromValue("m1", value)
+	if len(embeddings) != 2 {
+		t.Fatalf("chunkEmbeddingsFromValue() kept %d embeddings, want 2: %v", len(embeddings), embeddings)
+	}
+	if embeddings[1][0] != 1 {
+		t.Errorf("second embedding = %v, want [1 0.5]", embeddings[1])
+	}
+	if got := chunkEmbeddingsFromValue("m1", "garbage"); got != nil {
+		t.Errorf("chunkEmbeddingsFromValue(string) = %v, want nil", got)
+	}
+}
+
+func TestMalformedEmbeddingWarnsWithOwner(t *testing.T) {
+	var logs bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	chunkEmbeddingsFromValue("m1", []any{[]any{0.3, "x"}, nil})
+	if got := strings.Count(logs.String(), "Skipping malformed embedding"); got != 1 {
+		t.Errorf("%d warnings for one malformed and one missing embedding, want 1:\n%s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "messageId=m1") {
+		t.Errorf("warning does not name the message:\n%s", logs.String())
+	}
+}
+
+func TestCompressEmbeddingRoundTrip(t *testing.T) {
+	embedding := []float64{0.125, -0.5, 1e-9, 0, 3}
+	data, err := compressEmbedding(embedding)
+	if err != nil {
+		t.Fatalf("compressEmbedding: %v", err)
+	}
+	got, err := decompressEmbedding(data)
+	if err != nil {
+		t.Fatalf("decompressEmbedding: %v", err)
+	}
+	if !reflect.DeepEqual(got, embedding) {
+		t.Errorf("round trip = %v, want %v", got, embedding)
+	}
+}
+
+func TestStoredEmbedding(t *testing.T) {
+	embedding := []float64{0.25, 0.75}
+
+	setTestConfig(t, func(c *Config) { c.CompressEmbeddings = false })
+	plain, compressed := storedEmbedding(embedding)
+	if !reflect.DeepEqual(plain, embedding) || compressed != nil {
+		t.Errorf("storedEmbedding uncompressed = %v, %v", plain, compressed)
+	}
+
+	setTestConfig(t, func(c *Config) { c.CompressEmbeddings = true })
+	plain, compressed = storedEmbedding(embedding)
+	if plain != nil {
+		t.Errorf("plain = %v with compression, want nil", plain)
+	}
+	data, ok := compressed.([]byte)
+	if !ok {
+		t.Fatalf("compressed = %T, want []byte", compressed)
+	}
+	// read back the way messageFromNode does, the blob taking precedence
+	if got := decodeStoredEmbedding(nil, data); !reflect.DeepEqual(got, embedding) {
+		t.Errorf("decoded = %v, want %v", got, embedding)
+	}
+
+	if plain, compressed := storedEmbedding(nil); compressed != nil || len(plain.([]float64)) != 0 {
+		t.Errorf("storedEmbedding(nil) = %v, %v; want an empty plain list", plain, compressed)
+	}
+}
+
+// Gzip raw bytes as a compressed embedding blob
+func gzipTestBytes(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseStoredEmbeddingMalformedCompressed(t *testing.T) {
+	nan := make([]byte, 16)
+	binary.LittleEndian.PutUint64(nan[8:], math.Float64bits(math.NaN()))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not gzip", []byte("not gzip")},
+		{"partial value", gzipTestBytes(t, make([]byte, 12))},
+		{"NaN element", gzipTestBytes(t, nan)},
+		{"too many dimensions", gzipTestBytes(t, make([]byte, 8*(maxEmbeddingDimensions+1)))},
+	}
+	for _, tt := range tests {
+		if _, err := parseStoredEmbedding(nil, tt.data); err == nil {
+			t.Errorf("%s: parseStoredEmbedding accepted the blob", tt.name)
+		}
+		// a malformed blob reads as missing, not as the plain fallback
+		if got := decodeStoredEmbedding([]any{1.0}, tt.data); got != nil {
+			t.Errorf("%s: decodeStoredEmbedding = %v, want nil", tt.name, got)
+		}
+	}
+
+	if got, err := parseStoredEmbedding([]any{0.5, int64(2)}, nil); err != nil || !reflect.DeepEqual(got, []float64{0.5, 2}) {
+		t.Errorf("parseStoredEmbedding(plain) = %v, %v", got, err)
+	}
+	if got, err := parseStoredEmbedding(nil, nil); err != nil || got != nil {
+		t.Errorf("parseStoredEmbedding(nil, nil) = %v, %v; want an empty embedding", got, err)
+	}
+}
+
+func TestMalformedCandidateSkippedForEdges(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.CompressEmbeddings = false
+		c.ServerSideSimilarity = false
+		c.ChunkSize = 0
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+	})
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	good := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0}})
+	corrupt := storeTestMessage(t, session, userID, Message{Content: "giày cỡ 42", Timestamp: now + 1, Embedding: []float64{1, 0}})
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(ctx, "MATCH (m:Message {messageId: $id}) SET m.embedding = ['1', '0']", map[string]any{"id": corrupt.MessageID})
+		return nil, err
+	})
+	if err != nil {
+		t.Fatalf("failed to corrupt embedding: %v", err)
+	}
+
+	message := storeTestMessage(t, session, userID, Message{Content: "giày 42", Timestamp: now + 2, Embedding: []float64{0.9, 0.1}})
+	if n := countTestLinks(t, session, message.MessageID, good.MessageID); n != 1 {
+		t.Errorf("%d links to the well-formed candidate, want 1", n)
+	}
+	if n := countTestLinks(t, session, message.MessageID, corrupt.MessageID); n != 0 {
+		t.Errorf("%d links to the malformed candidate, want 0", n)
+	}
+}
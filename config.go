@@ -0,0 +1,709 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Runtime configuration loaded from environment variables
+type Config struct {
+	OpenAIAPIKey  string
+	Neo4jPassword string
+
+	// Neo4j connection. The URI scheme selects encryption (neo4j+s:// for
+	// TLS, neo4j+ssc:// to accept self-signed certificates); Neo4jCACert
+	// names a PEM file of CAs to verify the server against. The user is read
+	// from NEO4J_USERNAME, or NEO4J_USER for older .env files.
+	Neo4jURI    string
+	Neo4jUser   string
+	Neo4jCACert string
+
+	// Name of the chat user found or created when no user option is given
+	UserName string
+
+	// Format of generated user, message and topic IDs: hex (default),
+	// uuidv4 or uuidv7
+	IDFormat string
+
+	// Minimum level of log records (LOG_LEVEL: debug, info, warn or error)
+	LogLevel slog.Level
+
+	// Extract order numbers, SKUs and prices into :Entity nodes
+	EntityExtraction bool
+
+	// Enrichment retry queue: give up after this many attempts, waiting
+	// RetryBaseDelay * 2^(attempts-1) between them
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+
+	// Bound the similarity scan done for every new message. With a candidate
+	// limit only the most recent N messages are compared, and with a window
+	// only messages newer than now-window; both trade recall (older related
+	// messages never get linked) for constant per-message cost. Zero disables.
+	SimilarityCandidateLimit int
+	SimilarityWindow         time.Duration
+
+	// Factor applied to the cosine similarity of messages sharing a topic,
+	// for edge creation and retrieval ranking. 1 keeps pure cosine.
+	TopicOverlapBoost float64
+
+	// Minimum similarity for a retrieved message to be injected as chat
+	// context, independent of the edge creation threshold
+	RetrievalMinSimilarity float64
+	// Number of related stored messages retrieved as context for each chat
+	// completion (0 = no retrieval)
+	RetrievalK int
+	// Retrieve for every input ("always") or only for questions
+	// ("questions"): input with a question mark or starting with one of
+	// QuestionWords
+	RetrievalTrigger string
+	QuestionWords    []string
+	// Minimum similarity between a new question and an earlier one for
+	// bestAnswer to reuse the earlier answer
+	AnswerMinSimilarity float64
+	// Maximum number of /search results
+	SearchLimit int
+
+	// Find similarity candidates with the native vector index (top
+	// VectorIndexK neighbours), falling back to the scan when unsupported.
+	// The index is created at startup with EmbeddingDimensions dimensions.
+	VectorIndex  bool
+	VectorIndexK int
+
+	// Cosine similarity above which messages get a CONTEXTUAL_LINK edge,
+	// in [-1, 1]
+	SimilarityThreshold float64
+
+	// Link messages with the same contentHash (exact duplicates of each
+	// other). A message is never linked to itself.
+	LinkDuplicates bool
+
+	// Fold a message into the previous one of the same user, sender and
+	// scrim when it has the same normalized content and was sent within
+	// DedupWindow (0 = off), counting the repeat instead of storing a new node
+	DedupWindow time.Duration
+
+	// Compute cosines in Cypher (gds.similarity.cosine or
+	// vector.similarity.cosine) so only candidates that can clear a threshold
+	// are returned, falling back to the in-Go scan when neither exists
+	ServerSideSimilarity bool
+
+	// Per sender-pair similarity thresholds keyed by senderPairKey, e.g.
+	// SIMILARITY_THRESHOLDS="human-human=0.7,ai-human=0.4"
+	SenderPairThresholds map[string]float64
+
+	// Keep at most this many tags per message (0 = no limit)
+	MaxTopicsPerMessage int
+
+	// Background edge reconciliation: every ReconcileInterval (0 = off),
+	// re-check edges of messages added within ReconcileLookback, pausing
+	// ReconcileDelay between messages
+	ReconcileInterval time.Duration
+	ReconcileLookback time.Duration
+	ReconcileDelay    time.Duration
+
+	// Messages expire MessageRetention after their timestamp (0 = never,
+	// overridable per user); expired ones are deleted every
+	// ExpirySweepInterval (0 = no background sweeper)
+	MessageRetention    time.Duration
+	ExpirySweepInterval time.Duration
+
+	// reclassifyAll writes this many messages per transaction and waits
+	// ReclassifyDelay between topic extractions
+	ReclassifyBatchSize int
+	ReclassifyDelay     time.Duration
+
+	// Deadline of each OpenAI request and chat Neo4j write (0 = none)
+	RequestTimeout time.Duration
+	// Retries of an OpenAI request failing with a rate limit or server
+	// error, waiting OpenAIRetryBaseDelay doubled per attempt (0 = no retry)
+	OpenAIMaxRetries     int
+	OpenAIRetryBaseDelay time.Duration
+	// How long Ctrl-C waits for the current message to be stored before the
+	// process exits anyway
+	ShutdownTimeout time.Duration
+
+	// Chat completion tokens a user may use per TokenQuotaPeriod (monthly or
+	// total) before new messages are refused (0 = no quota)
+	TokenQuota       int64
+	TokenQuotaPeriod string
+
+	// Minimum time between OpenAI requests in the interactive chat (0 = no
+	// spacing). The default keeps a turn's calls under free-tier limits.
+	InteractiveCallSpacing time.Duration
+
+	// Taxonomy topic extraction tags messages with, from TOPIC_TAGS_FILE or
+	// TOPIC_TAGS (see loadTopicTags). The topic prompt lists these tags and
+	// tags outside them are rejected.
+	TopicTags []string
+
+	// Treat topic names differing only in case as one topic. Names are
+	// always NFC-normalized and whitespace-trimmed before comparison.
+	TopicCaseFold bool
+
+	// Replay and archive import MERGE the distinct topics of every
+	// TopicUpsertBatchSize messages once, then only link each message to
+	// them (0 = every message MERGEs its own topics)
+	TopicUpsertBatchSize int
+
+	// Embed every tag in TopicTags in the background at startup
+	WarmTopicEmbeddings bool
+
+	// Embed topics first seen on a chat message, and link topics whose name
+	// embeddings have a cosine above TopicSimilarityThreshold by SIMILAR_TOPIC
+	EmbedNewTopics           bool
+	TopicSimilarityThreshold float64
+
+	// Clusters of at least AutoTopicMinCluster messages, pairwise at least
+	// AutoTopicSimilarity similar and sharing no tag, become new topics
+	// when auto-topics run
+	AutoTopicMinCluster int
+	AutoTopicSimilarity float64
+
+	// Damping factor of the message PageRank, in (0, 1)
+	PageRankDamping float64
+
+	// Topic summaries sample at most TopicSummaryMaxMessages messages and
+	// send at most TopicSummaryMaxChars of them; CacheTopicSummaries keeps
+	// each summary until a newer message joins the topic
+	TopicSummaryMaxMessages int
+	TopicSummaryMaxChars    int
+	CacheTopicSummaries     bool
+
+	// Maximum number of messages attached when loading a Topic
+	TopicMessageLimit int
+
+	// Half-life of a topic mention's weight in the user interest profile
+	InterestHalfLife time.Duration
+
+	// Send an input_type hint ("document" for stored messages, "query" for
+	// searches) with embedding requests, for models that support asymmetric
+	// retrieval
+	EmbeddingInputType bool
+
+	// Describe JSON payloads (by StructuredKeys) and links (by page title
+	// when FetchURLTitles is set) before embedding them
+	StructuredContent bool
+	StructuredKeys    []string
+	FetchURLTitles    bool
+
+	// OpenAI models for embeddings, chat replies and summaries, and topic
+	// extraction and naming (TOPIC_MODEL defaults to CHAT_MODEL)
+	EmbeddingModel string
+	ChatModel      string
+	TopicModel     string
+
+	// Expected length of embedding vectors, checked on every embedding
+	// response and by --validate-embeddings and used for the vector index.
+	// Defaults to the size EmbeddingModel produces (see
+	// embeddingModelDimensions).
+	EmbeddingDimensions int
+	// Embeddings kept in memory by input text so repeated content is not
+	// re-embedded (0 = no cache)
+	EmbeddingCacheSize int
+
+	// Template for the text embedded per message and per search query, with
+	// {content}, {topics} and {meta.<key>} placeholders (see
+	// renderEmbeddingTemplate). Defaults to the content only; a literal \n
+	// in EMBEDDING_TEMPLATE starts a new line.
+	EmbeddingTemplate string
+
+	// Messages longer than ChunkSize runes (0 = off) are also split into
+	// segments embedded as :Chunk nodes; message similarity is then the max
+	// or mean (ChunkSimilarity) over chunk pairs
+	ChunkSize       int
+	ChunkSimilarity string
+
+	// Store embeddings as a gzip blob (embeddingGz) instead of a float list.
+	// Saves space but disables native vector indexing.
+	CompressEmbeddings bool
+
+	// Bot reply post-processing (see registerConfiguredPostProcessors):
+	// comma-separated regexes removed from replies, contact redaction and
+	// a disclaimer appended. KeepOriginalResponse stores the unprocessed
+	// reply too.
+	ResponseStripPatterns  []string
+	ResponseRedactContacts bool
+	ResponseDisclaimer     string
+	KeepOriginalResponse   bool
+
+	// Include message embeddings in user data archives
+	ArchiveEmbeddings bool
+
+	// Refuse similarity matrix exports above this many messages
+	SimilarityMatrixMaxMessages int
+}
+
+// Active configuration, populated by loadConfig in main
+var cfg Config
+
+// Load configuration from the environment (and .env via godotenv)
+func loadConfig() (Config, error) {
+	apiKey, err := envSecret("OPENAI_API_KEY", "")
+	if err != nil {
+		return Config{}, err
+	}
+	neo4jPassword, err := envSecret("NEO4J_PASSWORD", "123123123")
+	if err != nil {
+		return Config{}, err
+	}
+
+	idFormat, err := parseIDFormat(envString("ID_FORMAT", IDFormatHex))
+	if err != nil {
+		return Config{}, err
+	}
+
+	logLevel, err := parseLogLevel(envString("LOG_LEVEL", "info"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	similarityThreshold, err := parseSimilarityThreshold(os.Getenv("SIMILARITY_THRESHOLD"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	pageRankDamping, err := parsePageRankDamping(os.Getenv("PAGERANK_DAMPING"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	topicCaseFold := envBool("TOPIC_CASE_FOLD", true)
+	topicTags, err := loadTopicTags(topicCaseFold)
+	if err != nil {
+		return Config{}, err
+	}
+
+	retrievalTrigger, err := parseRetrievalTrigger(envString("RETRIEVAL_TRIGGER", RetrievalQuestions))
+	if err != nil {
+		return Config{}, err
+	}
+
+	tokenQuotaPeriod, err := parseTokenQuotaPeriod(envString("TOKEN_QUOTA_PERIOD", TokenQuotaMonthly))
+	if err != nil {
+		return Config{}, err
+	}
+
+	chunkSimilarity, err := parseChunkSimilarity(envString("CHUNK_SIMILARITY", ChunkSimilarityMax))
+	if err != nil {
+		return Config{}, err
+	}
+
+	embeddingModel := envString("EMBEDDING_MODEL", string(openai.SmallEmbedding3))
+	chatModel := envString("CHAT_MODEL", openai.GPT4oMini)
+
+	loaded := Config{
+		OpenAIAPIKey:  apiKey,
+		Neo4jPassword: neo4jPassword,
+		Neo4jURI:      envString("NEO4J_URI", "neo4j://localhost:7687"),
+		Neo4jUser:     envString("NEO4J_USERNAME", envString("NEO4J_USER", "neo4j")),
+		Neo4jCACert:   envString("NEO4J_CA_CERT", ""),
+		UserName:      envString("USER_NAME", ""),
+		IDFormat:      idFormat,
+		LogLevel:      logLevel,
+
+		EntityExtraction: envBool("ENTITY_EXTRACTION", false),
+		RetryMaxAttempts: envInt("RETRY_MAX_ATTEMPTS", 5),
+		RetryBaseDelay:   envDuration("RETRY_BASE_DELAY", time.Minute),
+
+		SimilarityCandidateLimit: envInt("SIMILARITY_CANDIDATE_LIMIT", 0),
+		SimilarityWindow:         envDuration("SIMILARITY_WINDOW", 0),
+		SimilarityThreshold:      similarityThreshold,
+		LinkDuplicates:           envBool("LINK_DUPLICATES", true),
+		DedupWindow:              envDuration("DEDUP_WINDOW", 0),
+		SenderPairThresholds:     parseSenderPairThresholds(os.Getenv("SIMILARITY_THRESHOLDS")),
+		VectorIndex:              envBool("VECTOR_INDEX", false),
+		ServerSideSimilarity:     envBool("SERVER_SIDE_SIMILARITY", false),
+		VectorIndexK:             envInt("VECTOR_INDEX_K", 50),
+		TopicOverlapBoost:        envFloat("TOPIC_OVERLAP_BOOST", 1),
+		RetrievalMinSimilarity:   envFloat("RETRIEVAL_MIN_SIMILARITY", 0.4),
+		RetrievalK:               envInt("RETRIEVAL_K", 5),
+		RetrievalTrigger:         retrievalTrigger,
+		QuestionWords:            envList("QUESTION_WORDS", defaultQuestionWords),
+		SearchLimit:              envInt("SEARCH_LIMIT", 5),
+		AnswerMinSimilarity:      envFloat("ANSWER_MIN_SIMILARITY", 0.8),
+
+		ReconcileInterval: envDuration("RECONCILE_INTERVAL", 0),
+		ReconcileLookback: envDuration("RECONCILE_LOOKBACK", time.Hour),
+		ReconcileDelay:    envDuration("RECONCILE_DELAY", 50*time.Millisecond),
+
+		MessageRetention:    envDuration("MESSAGE_RETENTION", 0),
+		ExpirySweepInterval: envDuration("EXPIRY_SWEEP_INTERVAL", 0),
+
+		ReclassifyBatchSize:      envInt("RECLASSIFY_BATCH_SIZE", 20),
+		ReclassifyDelay:          envDuration("RECLASSIFY_DELAY", 200*time.Millisecond),
+		RequestTimeout:           envDuration("REQUEST_TIMEOUT", 30*time.Second),
+		OpenAIMaxRetries:         envInt("OPENAI_MAX_RETRIES", 3),
+		OpenAIRetryBaseDelay:     envDuration("OPENAI_RETRY_BASE_DELAY", 500*time.Millisecond),
+		ShutdownTimeout:          envDuration("SHUTDOWN_TIMEOUT", 5*time.Second),
+		TokenQuota:               int64(envInt("TOKEN_QUOTA", 0)),
+		TokenQuotaPeriod:         tokenQuotaPeriod,
+		InteractiveCallSpacing:   envDuration("INTERACTIVE_CALL_SPACING", 500*time.Millisecond),
+		TopicTags:                topicTags,
+		TopicCaseFold:            topicCaseFold,
+		TopicUpsertBatchSize:     envInt("TOPIC_UPSERT_BATCH_SIZE", 0),
+		WarmTopicEmbeddings:      envBool("WARM_TOPIC_EMBEDDINGS", false),
+		EmbedNewTopics:           envBool("EMBED_NEW_TOPICS", true),
+		TopicSimilarityThreshold: envFloat("TOPIC_SIMILARITY_THRESHOLD", 0.85),
+		AutoTopicMinCluster:      envInt("AUTO_TOPIC_MIN_CLUSTER", 5),
+		AutoTopicSimilarity:      envFloat("AUTO_TOPIC_SIMILARITY", 0.8),
+		PageRankDamping:          pageRankDamping,
+		MaxTopicsPerMessage:      envInt("MAX_TOPICS_PER_MESSAGE", 5),
+		TopicSummaryMaxMessages:  envInt("TOPIC_SUMMARY_MAX_MESSAGES", 50),
+		TopicSummaryMaxChars:     envInt("TOPIC_SUMMARY_MAX_CHARS", 8000),
+		CacheTopicSummaries:      envBool("CACHE_TOPIC_SUMMARIES", true),
+		TopicMessageLimit:        envInt("TOPIC_MESSAGE_LIMIT", 50),
+		InterestHalfLife:         envDuration("INTEREST_HALF_LIFE", 30*24*time.Hour),
+
+		EmbeddingInputType:  envBool("EMBEDDING_INPUT_TYPE", false),
+		EmbeddingModel:      embeddingModel,
+		ChatModel:           chatModel,
+		TopicModel:          envString("TOPIC_MODEL", chatModel),
+		EmbeddingDimensions: envInt("EMBEDDING_DIMENSIONS", embeddingModelDimensions(embeddingModel)),
+		EmbeddingCacheSize:  envInt("EMBEDDING_CACHE_SIZE", 1000),
+
+		StructuredContent: envBool("STRUCTURED_CONTENT", false),
+		StructuredKeys:    envList("STRUCTURED_KEYS", []string{"name", "title", "product", "productName", "description", "category", "price", "sku"}),
+		FetchURLTitles:    envBool("FETCH_URL_TITLES", false),
+		EmbeddingTemplate: strings.ReplaceAll(envString("EMBEDDING_TEMPLATE", defaultEmbeddingTemplate), `\n`, "\n"),
+
+		ChunkSize:       envInt("CHUNK_SIZE", 0),
+		ChunkSimilarity: chunkSimilarity,
+
+		CompressEmbeddings: envBool("COMPRESS_EMBEDDINGS", false),
+
+		ResponseStripPatterns:  envList("RESPONSE_STRIP_PATTERNS", nil),
+		ResponseRedactContacts: envBool("RESPONSE_REDACT_CONTACTS", false),
+		ResponseDisclaimer:     envString("RESPONSE_DISCLAIMER", ""),
+		KeepOriginalResponse:   envBool("KEEP_ORIGINAL_RESPONSE", false),
+
+		ArchiveEmbeddings: envBool("ARCHIVE_EMBEDDINGS", false),
+
+		SimilarityMatrixMaxMessages: envInt("SIMILARITY_MATRIX_MAX_MESSAGES", 500),
+	}
+	if err := validateConfig(loaded); err != nil {
+		return Config{}, err
+	}
+	return loaded, nil
+}
+
+// Reject settings outside the range they are meaningful in, as parsed by
+// the env helpers (which only fall back on unparseable values)
+func validateConfig(c Config) error {
+	if c.TopicOverlapBoost < 0 {
+		return fmt.Errorf("invalid TOPIC_OVERLAP_BOOST %v: must not be negative", c.TopicOverlapBoost)
+	}
+	similarities := []struct {
+		name  string
+		value float64
+	}{
+		{"RETRIEVAL_MIN_SIMILARITY", c.RetrievalMinSimilarity},
+		{"ANSWER_MIN_SIMILARITY", c.AnswerMinSimilarity},
+		{"TOPIC_SIMILARITY_THRESHOLD", c.TopicSimilarityThreshold},
+		{"AUTO_TOPIC_SIMILARITY", c.AutoTopicSimilarity},
+	}
+	for _, similarity := range similarities {
+		if similarity.value < -1 || similarity.value > 1 {
+			return fmt.Errorf("invalid %s %v: must be between -1 and 1", similarity.name, similarity.value)
+		}
+	}
+	return nil
+}
+
+// Vector size of an OpenAI embedding model at its default dimensions, 1536
+// for models not listed
+func embeddingModelDimensions(model string) int {
+	switch openai.EmbeddingModel(model) {
+	case openai.LargeEmbedding3:
+		return 3072
+	}
+	return 1536
+}
+
+// Mask a secret for display, keeping only enough to recognize which one is set
+func maskSecret(secret string) string {
+	if secret == "" {
+		return "(not set)"
+	}
+	if len(secret) <= 12 {
+		return "****"
+	}
+	return secret[:3] + "****" + secret[len(secret)-4:]
+}
+
+// Render the configuration in a readable form with secrets masked
+func describeConfig(c Config) string {
+	var b strings.Builder
+	row := func(name string, value any) {
+		fmt.Fprintf(&b, "  %-28s %v\n", name, value)
+	}
+	limit := func(n int) string {
+		if n <= 0 {
+			return "unlimited"
+		}
+		return strconv.Itoa(n)
+	}
+	window := func(d time.Duration) string {
+		if d <= 0 {
+			return "unlimited"
+		}
+		return d.String()
+	}
+
+	b.WriteString("⚙️ Configuration:\n")
+	row("OpenAI API key", maskSecret(c.OpenAIAPIKey))
+	row("Neo4j URI", c.Neo4jURI)
+	row("Neo4j user", c.Neo4jUser)
+	row("Neo4j password", maskSecret(c.Neo4jPassword))
+	row("Neo4j CA certificate", c.Neo4jCACert)
+	row("User name", c.UserName)
+	row("ID format", c.IDFormat)
+	row("Log level", c.LogLevel)
+	row("Embedding model", c.EmbeddingModel)
+	row("Chat model", c.ChatModel)
+	row("Topic model", c.TopicModel)
+	row("Embedding input type hint", c.EmbeddingInputType)
+	row("Embedding dimensions", c.EmbeddingDimensions)
+	row("Embedding cache size", c.EmbeddingCacheSize)
+	row("Embedding template", strconv.Quote(c.EmbeddingTemplate))
+	row("Compress embeddings", c.CompressEmbeddings)
+	row("Chunk size", c.ChunkSize)
+	row("Chunk similarity", c.ChunkSimilarity)
+	row("Similarity candidate limit", limit(c.SimilarityCandidateLimit))
+	row("Similarity window", window(c.SimilarityWindow))
+	row("Vector index", c.VectorIndex)
+	row("Vector index K", c.VectorIndexK)
+	row("Server-side similarity", c.ServerSideSimilarity)
+	row("Similarity threshold", c.SimilarityThreshold)
+	row("Link duplicates", c.LinkDuplicates)
+	row("Dedup window", c.DedupWindow)
+	for _, key := range sortedKeys(c.SenderPairThresholds) {
+		row("Similarity threshold "+key, c.SenderPairThresholds[key])
+	}
+	row("Topic overlap boost", c.TopicOverlapBoost)
+	row("Retrieval min similarity", c.RetrievalMinSimilarity)
+	row("Retrieval k", c.RetrievalK)
+	row("Answer min similarity", c.AnswerMinSimilarity)
+	row("Retrieval trigger", c.RetrievalTrigger)
+	row("Question words", strings.Join(c.QuestionWords, ","))
+	row("Search limit", limit(c.SearchLimit))
+	row("Max topics per message", limit(c.MaxTopicsPerMessage))
+	row("Topic message limit", limit(c.TopicMessageLimit))
+	row("Topic summary max messages", limit(c.TopicSummaryMaxMessages))
+	row("Topic summary max chars", limit(c.TopicSummaryMaxChars))
+	row("Cache topic summaries", c.CacheTopicSummaries)
+	row("Topic prompt version", topicPromptVersion())
+	row("Reclassify batch size", c.ReclassifyBatchSize)
+	row("Reclassify delay", c.ReclassifyDelay)
+	row("Request timeout", window(c.RequestTimeout))
+	row("OpenAI max retries", c.OpenAIMaxRetries)
+	row("OpenAI retry base delay", c.OpenAIRetryBaseDelay)
+	row("Shutdown timeout", c.ShutdownTimeout)
+	row("Token quota", limit(int(c.TokenQuota)))
+	row("Token quota period", c.TokenQuotaPeriod)
+	row("Interactive call spacing", c.InteractiveCallSpacing)
+	row("Topic tags", strings.Join(c.TopicTags, ", "))
+	row("Topic case fold", c.TopicCaseFold)
+	row("Topic upsert batch size", c.TopicUpsertBatchSize)
+	row("Warm topic embeddings", c.WarmTopicEmbeddings)
+	row("Embed new topics", c.EmbedNewTopics)
+	row("Topic similarity threshold", c.TopicSimilarityThreshold)
+	row("Auto-topic min cluster", c.AutoTopicMinCluster)
+	row("Auto-topic similarity", c.AutoTopicSimilarity)
+	row("PageRank damping", c.PageRankDamping)
+	row("Interest half-life", c.InterestHalfLife)
+	row("Similarity matrix max", limit(c.SimilarityMatrixMaxMessages))
+	row("Archive embeddings", c.ArchiveEmbeddings)
+	row("Response strip patterns", len(c.ResponseStripPatterns))
+	row("Response contact redaction", c.ResponseRedactContacts)
+	row("Response disclaimer", c.ResponseDisclaimer != "")
+	row("Keep original response", c.KeepOriginalResponse)
+	row("Entity extraction", c.EntityExtraction)
+	row("Structured content", c.StructuredContent)
+	row("Fetch URL titles", c.FetchURLTitles)
+	row("Reconcile interval", window(c.ReconcileInterval))
+	row("Reconcile lookback", c.ReconcileLookback)
+	row("Message retention", window(c.MessageRetention))
+	row("Expiry sweep interval", window(c.ExpirySweepInterval))
+	row("Retry max attempts", c.RetryMaxAttempts)
+	row("Retry base delay", c.RetryBaseDelay)
+	return b.String()
+}
+
+// Parse SIMILARITY_THRESHOLD, defaulting to defaultSimilarityThreshold when
+// unset. Values outside [-1, 1] can never (or always) match a cosine.
+func parseSimilarityThreshold(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultSimilarityThreshold, nil
+	}
+	threshold, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SIMILARITY_THRESHOLD %q: %v", value, err)
+	}
+	if threshold < -1 || threshold > 1 {
+		return 0, fmt.Errorf("invalid SIMILARITY_THRESHOLD %v: must be between -1 and 1", threshold)
+	}
+	return threshold, nil
+}
+
+// Parse PAGERANK_DAMPING, defaulting to defaultPageRankDamping when unset.
+// A damping of 0 ignores the edges and 1 never converges on a graph with
+// several components.
+func parsePageRankDamping(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultPageRankDamping, nil
+	}
+	damping, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PAGERANK_DAMPING %q: %v", value, err)
+	}
+	if damping <= 0 || damping >= 1 {
+		return 0, fmt.Errorf("invalid PAGERANK_DAMPING %v: must be between 0 and 1", damping)
+	}
+	return damping, nil
+}
+
+// Parse "pair=threshold" entries separated by commas, e.g.
+// "human-human=0.7,human-ai=0.4". Invalid entries are logged and skipped.
+func parseSenderPairThresholds(value string) map[string]float64 {
+	thresholds := make(map[string]float64)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pair, rawThreshold, ok := strings.Cut(entry, "=")
+		senders := strings.Split(pair, "-")
+		if !ok || len(senders) != 2 {
+			slog.Warn("Ignoring invalid similarity threshold entry", "entry", entry)
+			continue
+		}
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(rawThreshold), 64)
+		if err != nil || threshold < -1 || threshold > 1 {
+			slog.Warn("Ignoring invalid similarity threshold entry", "entry", entry)
+			continue
+		}
+		thresholds[senderPairKey(senders[0], senders[1])] = threshold
+	}
+	return thresholds
+}
+
+// Keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Read a secret from the file named by NAME_FILE (the Docker/Kubernetes
+// secrets convention) when set, otherwise from NAME, otherwise def.
+// Trailing newlines in the file are trimmed.
+func envSecret(name string, def string) (string, error) {
+	if path := strings.TrimSpace(os.Getenv(name + "_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %v", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	return def, nil
+}
+
+// Read a string environment variable, falling back to def when unset
+func envString(name string, def string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// Read a boolean environment variable, falling back to def when
+// unset, or with a warning when invalid
+func envBool(name string, def bool) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable, using the default", "name", name, "value", value, "default", def, "err", err)
+		return def
+	}
+	return parsed
+}
+
+// Read an integer environment variable, falling back to def when
+// unset, or with a warning when invalid
+func envInt(name string, def int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable, using the default", "name", name, "value", value, "default", def, "err", err)
+		return def
+	}
+	return parsed
+}
+
+// Read a comma-separated list environment variable, falling back to def when unset
+func envList(name string, def []string) []string {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Read a float environment variable, falling back to def when
+// unset, or with a warning when invalid
+func envFloat(name string, def float64) float64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable, using the default", "name", name, "value", value, "default", def, "err", err)
+		return def
+	}
+	return parsed
+}
+
+// Read a duration environment variable (e.g. "30s" or "7d"), falling back
+// to def when unset, or with a warning when invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+	parsed, err := parseDayDuration(value)
+	if err != nil {
+		slog.Warn("Ignoring invalid environment variable, using the default", "name", name, "value", value, "default", def, "err", err)
+		return def
+	}
+	return parsed
+}
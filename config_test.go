@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Set cfg to the configuration loadConfig produces, changed by edit, for the
+// rest of the test
+func setTestConfig(t *testing.T, edit func(*Config)) {
+	t.Helper()
+	loaded, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if edit != nil {
+		edit(&loaded)
+	}
+	previous := cfg
+	cfg = loaded
+	t.Cleanup(func() { cfg = previous })
+}
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"", "(not set)"},
+		{"short", "****"},
+		{"exactly12chr", "****"},
+		{"sk-proj-abcdefghijklmnop1234", "sk-****1234"},
+	}
+	for _, tt := range tests {
+		if got := maskSecret(tt.secret); got != tt.want {
+			t.Errorf("maskSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeConfigMasksSecrets(t *testing.T) {
+	c := Config{
+		OpenAIAPIKey:             "sk-proj-abcdefghijklmnop1234",
+		Neo4jPassword:            "correct horse battery staple",
+		Neo4jURI:                 "neo4j://db:7687",
+		SimilarityCandidateLimit: 0,
+		SimilarityWindow:         0,
+	}
+	description := describeConfig(c)
+	for _, secret := range []string{c.OpenAIAPIKey, c.Neo4jPassword} {
+		if strings.Contains(description, secret) {
+			t.Errorf("description shows the secret %q:\n%s", secret, description)
+		}
+	}
+	for _, want := range []string{"neo4j://db:7687", "sk-****1234", "unlimited"} {
+		if !strings.Contains(description, want) {
+			t.Errorf("description lacks %q:\n%s", want, description)
+		}
+	}
+}
+
+func TestParseSenderPairThresholds(t *testing.T) {
+	got := parseSenderPairThresholds("human-human=0.7, HUMAN-ai=0.4,bad,ai-ai=2,x=0.5,ai-human=oops,")
+	want := map[string]float64{"human-human": 0.7, "ai-human": 0.4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSenderPairThresholds = %v, want %v", got, want)
+	}
+}
+
+func TestSimilarityThresholdFor(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = map[string]float64{"human-human": 0.7, "ai-human": 0.4}
+	})
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"human", "human", 0.7},
+		{"human", "ai", 0.4},
+		{"ai", "human", 0.4},
+		{"ai", "ai", 0.5},
+	}
+	for _, tt := range tests {
+		if got := similarityThresholdFor(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarityThresholdFor(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEnvSecret(t *testing.T) {
+	const name = "SCRIM_TEST_SECRET"
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(name, "")
+	t.Setenv(name+"_FILE", "")
+	if got, err := envSecret(name, "default"); err != nil || got != "default" {
+		t.Errorf("envSecret unset = %q, %v; want the default", got, err)
+	}
+
+	t.Setenv(name, "from-env")
+	if got, err := envSecret(name, "default"); err != nil || got != "from-env" {
+		t.Errorf("envSecret = %q, %v; want the variable", got, err)
+	}
+
+	t.Setenv(name+"_FILE", path)
+	if got, err := envSecret(name, "default"); err != nil || got != "from-file" {
+		t.Errorf("envSecret = %q, %v; want the trimmed file contents over the variable", got, err)
+	}
+
+	t.Setenv(name+"_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := envSecret(name, "default"); err == nil {
+		t.Error("envSecret ignored an unreadable secret file")
+	}
+}
+
+func TestLoadConfigRejectsOutOfRange(t *testing.T) {
+	for name, value := range map[string]string{
+		"TOPIC_OVERLAP_BOOST":        "-0.5",
+		"RETRIEVAL_MIN_SIMILARITY":   "1.5",
+		"ANSWER_MIN_SIMILARITY":      "-2",
+		"TOPIC_SIMILARITY_THRESHOLD": "85",
+		"AUTO_TOPIC_SIMILARITY":      "1.01",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("loadConfig with %s=%s = %v, want an error naming it", name, value, err)
+			}
+		})
+	}
+}
+
+func TestEnvFallbackWarns(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	t.Setenv("SCRIM_TEST_INT", "five")
+	t.Setenv("SCRIM_TEST_FLOAT", "0,4")
+	t.Setenv("SCRIM_TEST_DURATION", "soon")
+	if got := envInt("SCRIM_TEST_INT", 5); got != 5 {
+		t.Errorf("envInt = %d, want the default", got)
+	}
+	if got := envFloat("SCRIM_TEST_FLOAT", 0.4); got != 0.4 {
+		t.Errorf("envFloat = %v, want the default", got)
+	}
+	if got := envDuration("SCRIM_TEST_DURATION", time.Minute); got != time.Minute {
+		t.Errorf("envDuration = %v, want the default", got)
+	}
+	for _, name := range []string{"SCRIM_TEST_INT", "SCRIM_TEST_FLOAT", "SCRIM_TEST_DURATION"} {
+		if !strings.Contains(logs.String(), "name="+name) {
+			t.Errorf("no warning for invalid %s in %q", name, logs.String())
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Header carrying the correlation ID on OpenAI requests. OpenAI echoes
+// X-Client-Request-Id in its own logs, so support can look a request up by it.
+const correlationHeader = "X-Client-Request-Id"
+
+type correlationKey struct{}
+
+// Attach a correlation ID to the context used for OpenAI calls
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// Correlation ID carried by ctx, or "" if none
+func correlationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// HTTP transport that sends the context's correlation ID as a header and
+// logs it alongside the request, after waiting on the context's call spacer
+type correlationTransport struct {
+	base http.RoundTripper
+}
+
+func (t correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := contextCallSpacer(req.Context()).wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	id := correlationID(req.Context())
+	if id != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(correlationHeader, id)
+		slog.Debug("OpenAI request", "method", req.Method, "path", req.URL.Path, "correlationId", id)
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// Create an OpenAI client whose requests carry the context's correlation ID
+func newOpenAIClient(apiKey string) *openai.Client {
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = &http.Client{Transport: correlationTransport{base: http.DefaultTransport}}
+	return openai.NewClientWithConfig(config)
+}
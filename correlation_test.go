@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// RoundTripper recording the requests it is given
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestCorrelationTransport(t *testing.T) {
+	base := &recordingTransport{}
+	transport := correlationTransport{base: base}
+
+	ctx := withCorrelationID(context.Background(), "turn-42")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/embeddings", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if got := base.requests[0].Header.Get(correlationHeader); got != "turn-42" {
+		t.Errorf("%s = %q, want turn-42", correlationHeader, got)
+	}
+	if req.Header.Get(correlationHeader) != "" {
+		t.Error("RoundTrip modified the caller's request")
+	}
+
+	plain, _ := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/embeddings", nil)
+	if _, err := transport.RoundTrip(plain); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	if _, ok := base.requests[1].Header[correlationHeader]; ok {
+		t.Errorf("%s sent without a correlation ID", correlationHeader)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Content as compared for deduplication: normalized like topic names and
+// lowercased, so re-sent text differing only in case or spacing matches
+func normalizedContent(content string) string {
+	return strings.ToLower(normalizeTopicName(content))
+}
+
+// Report whether content sent at now repeats latest, the sender's previous
+// message: the same normalized content within cfg.DedupWindow
+func isRepeatOf(content string, latest Message, now time.Time) bool {
+	if cfg.DedupWindow <= 0 || latest.Timestamp < now.Add(-cfg.DedupWindow).Unix() {
+		return false
+	}
+	return normalizedContent(latest.Content) == normalizedContent(content)
+}
+
+// The most recent message of the user's sender in the same scrim
+func latestSenderMessage(ctx context.Context, tx neo4j.ManagedTransaction, userID string, sender string, scrimID string) (Message, bool, error) {
+	query := `
+		MATCH (m:Message {userId: $userId, sender: $sender})
+		WHERE coalesce(m.scrimId, "") = $scrimId
+		RETURN m
+		ORDER BY m.timestamp DESC, m.messageId DESC
+		LIMIT 1
+	`
+	params := map[string]any{"userId": userID, "sender": sender, "scrimId": scrimID}
+	records, err := tx.Run(ctx, query, params)
+	if err != nil {
+		return Message{}, false, err
+	}
+	if !records.Next(ctx) {
+		return Message{}, false, records.Err()
+	}
+	node, ok := records.Record().Values[0].(neo4j.Node)
+	if !ok {
+		return Message{}, false, nil
+	}
+	return messageFromNode(node), true, nil
+}
+
+// If content repeats the sender's latest message (see isRepeatOf), count
+// the repeat on that message instead. As for new messages, repeated input
+// is refused over quota and a repeated reply's tokens are counted. The
+// caller holds userIngestLocks for the user.
+func foldIntoLatest(ctx context.Context, tx neo4j.ManagedTransaction, userID string, sender string, content string, scrimID string, generation *GenerationInfo) (Message, bool, error) {
+	latest, found, err := latestSenderMessage(ctx, tx, userID, sender, scrimID)
+	if err != nil || !found || !isRepeatOf(content, latest, time.Now()) {
+		return Message{}, false, err
+	}
+
+	if generation == nil {
+		if err := checkTokenQuota(ctx, tx, userID); err != nil {
+			return Message{}, false, err
+		}
+	}
+	query := `
+		MATCH (m:Message {messageId: $messageId})
+		SET m.repeatCount = coalesce(m.repeatCount, 0) + 1, m.lastRepeatedAt = $timestamp
+		RETURN m.repeatCount
+	`
+	params := map[string]any{"messageId": latest.MessageID, "timestamp": time.Now().Unix()}
+	records, err := tx.Run(ctx, query, params)
+	if err != nil {
+		return Message{}, false, err
+	}
+	record, err := records.Single(ctx)
+	if err != nil {
+		return Message{}, false, err
+	}
+	if generation != nil && generation.TotalTokens > 0 {
+		if err := recordTokenUsage(ctx, tx, userID, generation.TotalTokens); err != nil {
+			return Message{}, false, err
+		}
+	}
+	count, _ := record.Values[0].(int64)
+	latest.RepeatCount = int(count)
+	return latest, true, nil
+}
+
+// With cfg.DedupWindow set, fold a repeat of the sender's latest message
+// into it (see foldIntoLatest) before the new message is enriched. The check
+// runs under the user's ingestion lock; addMessageAndCreateEdges repeats it
+// when storing, so a concurrent identical message is still folded.
+func foldRepeatedMessage(ctx context.Context, session neo4j.SessionWithContext, userID string, sender string, content string, scope messageScope, generation *GenerationInfo) (Message, bool, error) {
+	if cfg.DedupWindow <= 0 {
+		return Message{}, false, nil
+	}
+
+	unlock := userIngestLocks.Lock(userID)
+	defer unlock()
+	var folded Message
+	var found bool
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		var err error
+		folded, found, err = foldIntoLatest(ctx, tx, userID, sender, content, scope.ScrimID, generation)
+		return nil, err
+	}, txTimeout(ctx))
+	if err != nil {
+		return Message{}, false, fmt.Errorf("failed to count repeated message: %w", neo4jError(ctx, err))
+	}
+	return folded, found, nil
+}
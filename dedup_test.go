@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsRepeatOf(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.DedupWindow = time.Minute })
+	now := time.Unix(1_700_000_000, 0)
+	latest := Message{MessageID: "m1", Content: "Còn size M không?", Timestamp: now.Add(-10 * time.Second).Unix()}
+
+	tests := []struct {
+		name    string
+		content string
+		latest  Message
+		want    bool
+	}{
+		{"identical", "Còn size M không?", latest, true},
+		{"case and spacing", "  còn SIZE m   không? ", latest, true},
+		{"different", "Còn size L không?", latest, false},
+		{"outside window", "Còn size M không?", Message{Content: latest.Content, Timestamp: now.Add(-2 * time.Minute).Unix()}, false},
+		{"at window edge", "Còn size M không?", Message{Content: latest.Content, Timestamp: now.Add(-time.Minute).Unix()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRepeatOf(tt.content, tt.latest, now); got != tt.want {
+				t.Errorf("isRepeatOf(%q) = %v, want %v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRepeatOfDisabled(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.DedupWindow = 0 })
+	now := time.Now()
+	if isRepeatOf("hi", Message{Content: "hi", Timestamp: now.Unix()}, now) {
+		t.Error("isRepeatOf() folded a repeat with DedupWindow 0")
+	}
+}
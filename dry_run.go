@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// User ID of a dry run without --user
+const dryRunUserID = "dry-run"
+
+// Set by --dry-run outside --reclassify: ingestMessage builds and enriches
+// the message, then prints the Cypher it would run instead of writing
+var dryRunWrites bool
+
+// MessageEnricher for dry runs: a zero embedding of cfg.EmbeddingDimensions
+// with skipEmbedding and no topics with skipTopics, so a message can be
+// built without spending OpenAI tokens. Other requests go to next.
+type dryRunEnricher struct {
+	next          MessageEnricher
+	skipEmbedding bool
+	skipTopics    bool
+}
+
+func (e dryRunEnricher) Embed(ctx context.Context, text string) ([]float64, error) {
+	if e.skipEmbedding {
+		return make([]float64, cfg.EmbeddingDimensions), nil
+	}
+	return e.next.Embed(ctx, text)
+}
+
+func (e dryRunEnricher) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	if !e.skipEmbedding {
+		return embedTexts(ctx, e.next, texts)
+	}
+	embeddings := make([][]float64, len(texts))
+	for i := range texts {
+		embeddings[i] = make([]float64, cfg.EmbeddingDimensions)
+	}
+	return embeddings, nil
+}
+
+func (e dryRunEnricher) Extract(ctx context.Context, content string) ([]string, error) {
+	if e.skipTopics {
+		return []string{}, nil
+	}
+	return e.next.Extract(ctx, content)
+}
+
+func (e dryRunEnricher) ExtractTags(ctx context.Context, content string) (TopicExtraction, error) {
+	if e.skipTopics {
+		return TopicExtraction{Accepted: []string{}}, nil
+	}
+	return extractTopicsWith(ctx, e.next, content)
+}
+
+// Print the statements addMessageAndCreateEdges would run for the message,
+// followed by the writes that depend on the graph's current contents
+func printDryRunWrite(message Message, userID string) {
+	message.Topics = canonicalTopicNames(message.Topics)
+	fmt.Printf("🧪 Dry run: message %s is not stored\n", message.MessageID)
+
+	query, params := messageNodeStatement(message, userID)
+	printDryRunStatement(query, params)
+	query, params = messageOwnerStatement(message, userID)
+	printDryRunStatement(query, params)
+
+	if len(message.Chunks) > 0 {
+		fmt.Printf("   + %d Chunk nodes\n", len(message.Chunks))
+	}
+	if message.ScrimID != "" {
+		fmt.Printf("   + IN_SCRIM scrim %s\n", message.ScrimID)
+	}
+	if len(message.Topics) > 0 {
+		fmt.Printf("   + BELONGS_TO topics %s\n", strings.Join(message.Topics, ", "))
+	}
+	if len(message.Embedding) > 0 {
+		fmt.Printf("   + CONTEXTUAL_LINK edges to %s's messages with similarity ≥ %.2f\n", userID, cfg.SimilarityThreshold)
+	}
+}
+
+// Print a statement with its parameters in key order. Embeddings are shown
+// by length rather than value.
+func printDryRunStatement(query string, params map[string]any) {
+	fmt.Println(dedentCypher(query))
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("   $%s = %s\n", key, formatDryRunParam(params[key]))
+	}
+	fmt.Println()
+}
+
+func formatDryRunParam(value any) string {
+	switch v := value.(type) {
+	case []float64:
+		return fmt.Sprintf("[%d floats]", len(v))
+	case []byte:
+		return fmt.Sprintf("<%d bytes>", len(v))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// Strip the indentation a query has from being written inside Go code
+func dedentCypher(query string) string {
+	lines := strings.Split(strings.TrimRight(strings.TrimLeft(query, "\n"), " \t\n"), "\n")
+	indent := ""
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prefix := line[:len(line)-len(strings.TrimLeft(line, "\t "))]
+		if indent == "" || len(prefix) < len(indent) {
+			indent = prefix
+		}
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, indent)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Read chat input from stdin until EOF or "exit" and print, for each line,
+// what ingestMessage would store. No replies are generated and Neo4j is not
+// used, so no user or chat session needs to exist.
+func runDryRunChat(ctx context.Context, enricher MessageEnricher, userID string, scope messageScope) error {
+	dryRunWrites = true
+	fmt.Printf("🧪 Dry run as user %s: nothing is written to Neo4j. Type 'exit' to end.\n", userID)
+
+	lines, scanErrs := scanLines(os.Stdin)
+	for {
+		fmt.Print("You: ")
+		input, ok := nextLine(ctx, lines)
+		if !ok || input == "exit" {
+			break
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		if _, err := ingestMessage(ctx, nil, "human", input, enricher, userID, scope, nil, true); err != nil {
+			fmt.Printf("❌ %v\n", err)
+		}
+	}
+
+	select {
+	case err := <-scanErrs:
+		return fmt.Errorf("failed to read standard input: %v", err)
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// IncrementalEmbedder updates an existing embedding when text is appended to a
+// message, instead of embedding the whole content again.
+type IncrementalEmbedder interface {
+	// EmbedAppend returns the embedding of previousContent+appended given the
+	// stored embedding of previousContent. Returning ok=false declines the
+	// edit and a full re-embed is performed instead.
+	EmbedAppend(ctx context.Context, previous []float64, previousContent, appended string) (embedding []float64, ok bool, err error)
+}
+
+// Hook for append-only edits. Nil means every edit is fully re-embedded.
+var incrementalEmbedder IncrementalEmbedder
+
+// Report whether newContent only appends text to oldContent
+func isAppendOnlyEdit(oldContent, newContent string) bool {
+	return len(newContent) > len(oldContent) && strings.HasPrefix(newContent, oldContent)
+}
+
+// Compute the embedding for edited content, giving the incremental hook a
+// chance on append-only edits and falling back to a full re-embed. The hook
+// is skipped under a custom embedding template, whose output is not a plain
+// prefix of the content.
+func embedEditedContent(ctx context.Context, embedder Embedder, oldContent string, oldEmbedding []float64, newContent string, topics []string) ([]float64, error) {
+	if isAppendOnlyEdit(oldContent, newContent) && cfg.EmbeddingTemplate == defaultEmbeddingTemplate {
+		if incrementalEmbedder == nil {
+			slog.Debug("Append-only edit detected, re-embedding in full (incremental embedding could be used here)")
+		} else {
+			embedding, ok, err := incrementalEmbedder.EmbedAppend(ctx, oldEmbedding, oldContent, newContent[len(oldContent):])
+			if err != nil {
+				slog.Warn("Incremental embedding failed, falling back to full re-embed", "err", err)
+			} else if ok {
+				return embedding, nil
+			}
+		}
+	}
+
+	input, _ := messageEmbeddingText(ctx, newContent, topics)
+	return embedder.Embed(ctx, input)
+}
+
+// Give a stored message new content, with its hash, topics and embedding
+// (and chunks) recomputed. A failed extraction or embedding clears that
+// part and flags the message needsEnrichment, so the retry queue redoes it
+// instead of the message keeping values computed from the old content.
+func reenrichEditedMessage(ctx context.Context, enricher MessageEnricher, message Message, newContent string) Message {
+	oldContent, oldEmbedding := message.Content, message.Embedding
+	message.Content = newContent
+	message.ContentHash = contentHash(message.Sender, newContent)
+	message.NeedsEnrichment = false
+	message.ContentType = detectContentType(newContent)
+
+	extraction, err := extractTopicsWith(ctx, enricher, newContent)
+	if err != nil {
+		slog.Error("Error extracting topics", "messageId", message.MessageID, "err", err)
+		message.NeedsEnrichment = true
+		message.Topics = []string{}
+		message.TopicPromptVersion = ""
+		message.TopicTagsRaw, message.TopicTagsRejected = 0, 0
+	} else {
+		message.Topics = canonicalTopicNames(extraction.Accepted)
+		message.TopicPromptVersion = topicPromptVersion()
+		message.TopicTagsRaw = extraction.Raw
+		message.TopicTagsRejected = len(extraction.Rejected)
+	}
+
+	message.Chunks = nil
+	embedding, err := embedEditedContent(ctx, enricher, oldContent, oldEmbedding, newContent, message.Topics)
+	if err != nil {
+		slog.Error("Error getting embedding", "messageId", message.MessageID, "err", err)
+		message.NeedsEnrichment = true
+		message.Embedding = []float64{}
+		message.EmbeddingModel = ""
+	} else {
+		message.Embedding = embedding
+		message.EmbeddingModel = cfg.EmbeddingModel
+		embedMessageChunks(ctx, enricher, &message)
+	}
+	return message
+}
+
+// Replace a message's content, re-enrich it (see reenrichEditedMessage) and
+// rebuild its topic links and similarity edges. Returns the edited message;
+// unchanged content is not re-enriched.
+func editMessage(ctx context.Context, enricher MessageEnricher, messageID string, newContent string) (Message, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	existing, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(ctx, "MATCH (m:Message {messageId: $messageId}) RETURN m, m.userId", map[string]any{"messageId": messageID})
+		if err != nil {
+			return nil, err
+		}
+		record, err := result.Single(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("message %s not found: %v", messageID, err)
+		}
+		return record, nil
+	})
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to load message: %w", neo4jError(ctx, err))
+	}
+	record := existing.(*neo4j.Record)
+	node, ok := record.Values[0].(neo4j.Node)
+	if !ok {
+		return Message{}, fmt.Errorf("message %s not found", messageID)
+	}
+	userID, _ := record.Values[1].(string)
+	message := messageFromNode(node)
+	if message.Content == newContent {
+		return message, nil
+	}
+
+	message = reenrichEditedMessage(ctx, enricher, message, newContent)
+
+	unlock := userIngestLocks.Lock(userID)
+	defer unlock()
+
+	_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		updateQuery := `
+			MATCH (m:Message {messageId: $messageId})
+			SET m.content = $content,
+				m.contentHash = $contentHash,
+				m.contentType = $contentType,
+				m.embedding = $embedding,
+				m.embeddingGz = $embeddingGz,
+				m.embeddingModel = $embeddingModel,
+				m.topics = $topics,
+				m.topicPromptVersion = $topicPromptVersion,
+				m.topicTagsRaw = $topicTagsRaw,
+				m.topicTagsRejected = $topicTagsRejected,
+				m.needsEnrichment = $needsEnrichment,
+				m.enrichmentAttempts = 0,
+				m.enrichmentFailed = false,
+				m.editedAt = $editedAt
+			REMOVE m.nextEnrichmentAt
+			WITH m
+			OPTIONAL MATCH (m)-[r:CONTEXTUAL_LINK]-()
+			DELETE r
+			WITH DISTINCT m
+			OPTIONAL MATCH (m)-[b:BELONGS_TO]->(t:Topic)
+			WHERE NOT t.name IN $topics
+			DELETE b
+		`
+		plainEmbedding, compressedEmbedding := storedEmbedding(message.Embedding)
+		updateParams := map[string]any{
+			"messageId":          messageID,
+			"content":            message.Content,
+			"contentHash":        message.ContentHash,
+			"contentType":        message.ContentType,
+			"embedding":          plainEmbedding,
+			"embeddingGz":        compressedEmbedding,
+			"embeddingModel":     nil,
+			"topics":             message.Topics,
+			"topicPromptVersion": nil,
+			"topicTagsRaw":       message.TopicTagsRaw,
+			"topicTagsRejected":  message.TopicTagsRejected,
+			"needsEnrichment":    message.NeedsEnrichment,
+			"editedAt":           time.Now().Unix(),
+		}
+		if message.EmbeddingModel != "" {
+			updateParams["embeddingModel"] = message.EmbeddingModel
+		}
+		if message.TopicPromptVersion != "" {
+			updateParams["topicPromptVersion"] = message.TopicPromptVersion
+		}
+		if _, err := tx.Run(ctx, updateQuery, updateParams); err != nil {
+			return nil, fmt.Errorf("failed to update message: %v", err)
+		}
+		if err := storeMessageChunks(ctx, tx, messageID, message.Chunks); err != nil {
+			return nil, err
+		}
+		linkMessageTopics(ctx, tx, messageID, message.Topics, message.TopicPromptVersion)
+		if _, err := pruneOrphanTopics(ctx, tx); err != nil {
+			return nil, err
+		}
+		return createSimilarityEdges(ctx, tx, message, userID)
+	})
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to edit message: %w", neo4jError(ctx, err))
+	}
+	return message, nil
+}
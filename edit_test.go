@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// IncrementalEmbedder returning a fixed answer
+type fakeIncrementalEmbedder struct {
+	embedding []float64
+	ok        bool
+	calls     int
+}
+
+func (e *fakeIncrementalEmbedder) EmbedAppend(ctx context.Context, previous []float64, previousContent, appended string) ([]float64, bool, error) {
+	e.calls++
+	return e.embedding, e.ok, nil
+}
+
+// Use hook as the incrementalEmbedder for the rest of the test
+func setIncrementalEmbedder(t *testing.T, hook IncrementalEmbedder) {
+	previous := incrementalEmbedder
+	incrementalEmbedder = hook
+	t.Cleanup(func() { incrementalEmbedder = previous })
+}
+
+// A stored message as reenrichEditedMessage receives it
+func storedTestMessage() Message {
+	return Message{
+		MessageID:          "m1",
+		Sender:             "human",
+		Content:            "Tôi muốn đổi áo",
+		ContentHash:        contentHash("human", "Tôi muốn đổi áo"),
+		Embedding:          stubEmbedding("Tôi muốn đổi áo"),
+		EmbeddingModel:     "old-model",
+		Topics:             []string{"Áo"},
+		TopicPromptVersion: "old",
+	}
+}
+
+func TestIsAppendOnlyEdit(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     bool
+	}{
+		{"order 123", "order 123, size M", true},
+		{"order 123", "order 123", false},
+		{"order 123", "order 124", false},
+		{"order 123", "order", false},
+		{"", "hello", true},
+	}
+	for _, tt := range tests {
+		if got := isAppendOnlyEdit(tt.old, tt.new); got != tt.want {
+			t.Errorf("isAppendOnlyEdit(%q, %q) = %v, want %v", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestReenrichEditedMessageAppendIsFullReembed(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.EmbeddingTemplate = defaultEmbeddingTemplate
+		c.ChunkSize = 0
+	})
+	setIncrementalEmbedder(t, nil)
+
+	newContent := "Tôi muốn đổi áo, và mua thêm giày"
+	enricher := &stubEnricher{topics: []string{"áo", "Giày"}}
+	edited := reenrichEditedMessage(context.Background(), enricher, storedTestMessage(), newContent)
+
+	if len(enricher.embedded) != 1 || enricher.embedded[0] != newContent {
+		t.Fatalf("embedded %q, want the whole new content", enricher.embedded)
+	}
+	if got, want := edited.Embedding, stubEmbedding(newContent); len(got) != 2 || got[0] != want[0] {
+		t.Errorf("Embedding = %v, want %v", got, want)
+	}
+	if edited.Content != newContent || edited.ContentHash != contentHash("human", newContent) {
+		t.Errorf("content or hash not updated: %q %s", edited.Content, edited.ContentHash)
+	}
+	if len(edited.Topics) != 2 || edited.Topics[0] != "Áo" || edited.Topics[1] != "Giày" {
+		t.Errorf("Topics = %v, want re-extracted [Áo Giày]", edited.Topics)
+	}
+	if edited.TopicPromptVersion != topicPromptVersion() || edited.EmbeddingModel != cfg.EmbeddingModel {
+		t.Errorf("version %q / model %q not refreshed", edited.TopicPromptVersion, edited.EmbeddingModel)
+	}
+	if edited.NeedsEnrichment {
+		t.Error("NeedsEnrichment set after a successful edit")
+	}
+}
+
+func TestReenrichEditedMessageIncrementalHook(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.EmbeddingTemplate = defaultEmbeddingTemplate })
+	newContent := "Tôi muốn đổi áo size M"
+
+	t.Run("declined", func(t *testing.T) {
+		hook := &fakeIncrementalEmbedder{ok: false}
+		setIncrementalEmbedder(t, hook)
+		enricher := &stubEnricher{}
+		edited := reenrichEditedMessage(context.Background(), enricher, storedTestMessage(), newContent)
+		if hook.calls != 1 || len(enricher.embedded) != 1 {
+			t.Fatalf("hook calls %d, full embeds %d, want 1 and 1", hook.calls, len(enricher.embedded))
+		}
+		if edited.Embedding[0] != float64(len(newContent)) {
+			t.Errorf("Embedding = %v, want the full re-embed", edited.Embedding)
+		}
+	})
+	t.Run("accepted", func(t *testing.T) {
+		hook := &fakeIncrementalEmbedder{embedding: []float64{9, 9}, ok: true}
+		setIncrementalEmbedder(t, hook)
+		enricher := &stubEnricher{}
+		edited := reenrichEditedMessage(context.Background(), enricher, storedTestMessage(), newContent)
+		if len(enricher.embedded) != 0 || edited.Embedding[0] != 9 {
+			t.Errorf("embedded %q, Embedding %v, want the hook's embedding only", enricher.embedded, edited.Embedding)
+		}
+	})
+	t.Run("not an append", func(t *testing.T) {
+		hook := &fakeIncrementalEmbedder{embedding: []float64{9, 9}, ok: true}
+		setIncrementalEmbedder(t, hook)
+		reenrichEditedMessage(context.Background(), &stubEnricher{}, storedTestMessage(), "Tôi muốn trả hàng")
+		if hook.calls != 0 {
+			t.Errorf("hook called %d times for a rewrite", hook.calls)
+		}
+	})
+}
+
+func TestReenrichEditedMessageFailuresQueueRetry(t *testing.T) {
+	setTestConfig(t, nil)
+	setIncrementalEmbedder(t, nil)
+
+	edited := reenrichEditedMessage(context.Background(), &stubEnricher{embedErr: errors.New("rate limited")}, storedTestMessage(), "Giao hàng bao lâu?")
+	if !edited.NeedsEnrichment || len(edited.Embedding) != 0 || edited.EmbeddingModel != "" {
+		t.Errorf("failed embedding kept %v (model %q), NeedsEnrichment %v; want it cleared and queued", edited.Embedding, edited.EmbeddingModel, edited.NeedsEnrichment)
+	}
+
+	edited = reenrichEditedMessage(context.Background(), &stubEnricher{topicsErr: errors.New("timeout")}, storedTestMessage(), "Giao hàng bao lâu?")
+	if !edited.NeedsEnrichment || len(edited.Topics) != 0 || edited.TopicPromptVersion != "" {
+		t.Errorf("failed extraction kept topics %v (version %q), NeedsEnrichment %v; want them cleared and queued", edited.Topics, edited.TopicPromptVersion, edited.NeedsEnrichment)
+	}
+}
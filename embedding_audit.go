@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Model name reported for embeddings stored without an embeddingModel
+const unknownEmbeddingModel = "unknown"
+
+// Distribution of embedding models and dimensions across a user's messages
+type EmbeddingAudit struct {
+	Messages int            `json:"messages"`
+	ByModel  map[string]int `json:"byModel"`
+	ByDims   map[int]int    `json:"byDims"`
+	// Messages without an embedding
+	Missing int `json:"missing"`
+	// More than one model or dimension is present, so cosine similarities
+	// between some messages compare incompatible vector spaces
+	Mixed bool `json:"mixed"`
+}
+
+// Count a user's embedded messages by embedding model and dimension and flag
+// mixed vector spaces. Returns errNoMessages when the user has no messages.
+func embeddingModelAudit(ctx context.Context, userID string) (EmbeddingAudit, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return EmbeddingAudit{}, err
+	}
+	if len(messages) == 0 {
+		return EmbeddingAudit{}, errNoMessages
+	}
+
+	return auditEmbeddings(messages), nil
+}
+
+// Count messages by embedding model and dimension
+func auditEmbeddings(messages []Message) EmbeddingAudit {
+	audit := EmbeddingAudit{
+		Messages: len(messages),
+		ByModel:  make(map[string]int),
+		ByDims:   make(map[int]int),
+	}
+	for _, message := range messages {
+		if len(message.Embedding) == 0 {
+			audit.Missing++
+			continue
+		}
+		model := message.EmbeddingModel
+		if model == "" {
+			model = unknownEmbeddingModel
+		}
+		audit.ByModel[model]++
+		audit.ByDims[len(message.Embedding)]++
+	}
+	audit.Mixed = len(audit.ByModel) > 1 || len(audit.ByDims) > 1
+	return audit
+}
+
+// Print an embedding audit, suggesting a re-embed when spaces are mixed
+func printEmbeddingAudit(userID string, audit EmbeddingAudit) {
+	fmt.Printf("🧬 Embeddings for user %s (%d messages, %d without embedding):\n", userID, audit.Messages, audit.Missing)
+	for _, model := range sortedKeys(audit.ByModel) {
+		fmt.Printf("  model %-24s %d\n", model, audit.ByModel[model])
+	}
+	dimensions := make([]int, 0, len(audit.ByDims))
+	for dims := range audit.ByDims {
+		dimensions = append(dimensions, dims)
+	}
+	sort.Ints(dimensions)
+	for _, dims := range dimensions {
+		fmt.Printf("  dims  %-24d %d\n", dims, audit.ByDims[dims])
+	}
+	if audit.Mixed {
+		fmt.Printf("⚠️ Mixed embedding spaces: similarities across models are meaningless. Re-embed this user's messages with %s.\n", cfg.EmbeddingModel)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditEmbeddings(t *testing.T) {
+	small := []float64{1, 0}
+	large := []float64{1, 0, 0}
+	tests := []struct {
+		name     string
+		messages []Message
+		want     EmbeddingAudit
+	}{
+		{
+			"one space",
+			[]Message{{Embedding: small, EmbeddingModel: "text-embedding-3-small"}, {Embedding: small, EmbeddingModel: "text-embedding-3-small"}, {}},
+			EmbeddingAudit{Messages: 3, ByModel: map[string]int{"text-embedding-3-small": 2}, ByDims: map[int]int{2: 2}, Missing: 1},
+		},
+		{
+			"mixed models",
+			[]Message{{Embedding: small, EmbeddingModel: "text-embedding-3-small"}, {Embedding: small, EmbeddingModel: "text-embedding-ada-002"}},
+			EmbeddingAudit{Messages: 2, ByModel: map[string]int{"text-embedding-3-small": 1, "text-embedding-ada-002": 1}, ByDims: map[int]int{2: 2}, Mixed: true},
+		},
+		{
+			"mixed dimensions, unknown model",
+			[]Message{{Embedding: small}, {Embedding: large}},
+			EmbeddingAudit{Messages: 2, ByModel: map[string]int{unknownEmbeddingModel: 2}, ByDims: map[int]int{2: 1, 3: 1}, Mixed: true},
+		},
+	}
+	for _, tt := range tests {
+		if got := auditEmbeddings(tt.messages); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: auditEmbeddings = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+// Least recently used cache of embeddings keyed by a SHA-256 of the model,
+// input type and text. Safe for concurrent use.
+type embeddingCache struct {
+	mu      sync.Mutex
+	maxSize int
+	order   *list.List // front is most recently used
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type embeddingCacheEntry struct {
+	key       [sha256.Size]byte
+	embedding []float64
+}
+
+func newEmbeddingCache(maxSize int) *embeddingCache {
+	return &embeddingCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// Key of an embedding request for text
+func embeddingCacheKey(text string, inputType EmbeddingInputType) [sha256.Size]byte {
+	return sha256.Sum256([]byte(cfg.EmbeddingModel + "\x00" + string(inputType) + "\x00" + text))
+}
+
+// Return a copy of the cached embedding, marking it recently used
+func (c *embeddingCache) get(key [sha256.Size]byte) ([]float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return append([]float64(nil), element.Value.(*embeddingCacheEntry).embedding...), true
+}
+
+// Store a copy of an embedding, evicting the least recently used entries
+// beyond maxSize
+func (c *embeddingCache) put(key [sha256.Size]byte, embedding []float64) {
+	if c.maxSize <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	embedding = append([]float64(nil), embedding...)
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*embeddingCacheEntry).embedding = embedding
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&embeddingCacheEntry{key: key, embedding: embedding})
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*embeddingCacheEntry).key)
+	}
+}
+
+// Cache shared by all embedding requests, sized by cfg.EmbeddingCacheSize
+// once the config is loaded
+var sharedEmbeddingCache struct {
+	once  sync.Once
+	cache *embeddingCache
+}
+
+func defaultEmbeddingCache() *embeddingCache {
+	sharedEmbeddingCache.once.Do(func() {
+		sharedEmbeddingCache.cache = newEmbeddingCache(cfg.EmbeddingCacheSize)
+	})
+	return sharedEmbeddingCache.cache
+}
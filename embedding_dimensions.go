@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Embedded message whose vector length differs from cfg.EmbeddingDimensions
+type dimensionMismatch struct {
+	MessageID string
+	UserID    string
+	Dims      int
+}
+
+// Result of validateEmbeddingDimensions
+type EmbeddingDimensionReport struct {
+	Expected   int
+	Scanned    int
+	Mismatched []dimensionMismatch
+	// Mismatched messages queued for re-embedding
+	Queued int
+}
+
+// Scan every embedded message and report those whose embedding length is
+// not cfg.EmbeddingDimensions. Records are streamed, so only mismatches are
+// kept in memory. With fix, mismatched messages lose their embedding and
+// similarity edges and are queued for the retry queue to re-embed.
+func validateEmbeddingDimensions(ctx context.Context, fix bool) (EmbeddingDimensionReport, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	report := EmbeddingDimensionReport{Expected: cfg.EmbeddingDimensions}
+	_, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		// Retried transactions start the scan over
+		report.Scanned = 0
+		report.Mismatched = nil
+
+		// Plain embeddings are measured server-side; compressed ones have
+		// to be decoded here
+		query := `
+			MATCH (m:Message)
+			WHERE m.embedding IS NOT NULL OR m.embeddingGz IS NOT NULL
+			RETURN m.messageId, m.userId, size(m.embedding), m.embeddingGz
+		`
+		records, err := tx.Run(ctx, query, nil)
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(ctx) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			values := records.Record().Values
+			dims, ok := values[2].(int64)
+			if !ok {
+				dims = int64(len(decodeStoredEmbedding(nil, values[3])))
+			}
+			if dims == 0 {
+				continue
+			}
+			report.Scanned++
+			if int(dims) != cfg.EmbeddingDimensions {
+				mismatch := dimensionMismatch{Dims: int(dims)}
+				mismatch.MessageID, _ = values[0].(string)
+				mismatch.UserID, _ = values[1].(string)
+				report.Mismatched = append(report.Mismatched, mismatch)
+			}
+		}
+		return nil, records.Err()
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to scan embeddings: %v", err)
+	}
+	if !fix || len(report.Mismatched) == 0 {
+		return report, nil
+	}
+
+	messageIDs := make([]string, 0, len(report.Mismatched))
+	for _, mismatch := range report.Mismatched {
+		messageIDs = append(messageIDs, mismatch.MessageID)
+	}
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		// Edges were scored against the wrong vector space
+		edgeQuery := `
+			MATCH (m:Message)-[r:CONTEXTUAL_LINK]-()
+			WHERE m.messageId IN $messageIds
+			DELETE r
+		`
+		if _, err := tx.Run(ctx, edgeQuery, map[string]any{"messageIds": messageIDs}); err != nil {
+			return nil, fmt.Errorf("failed to delete edges: %v", err)
+		}
+
+		queueQuery := `
+			MATCH (m:Message)
+			WHERE m.messageId IN $messageIds
+			SET m.embedding = null,
+				m.embeddingGz = null,
+				m.embeddingModel = null,
+				m.needsEnrichment = true,
+				m.enrichmentAttempts = 0
+			REMOVE m.nextEnrichmentAt
+			RETURN count(m)
+		`
+		records, err := tx.Run(ctx, queueQuery, map[string]any{"messageIds": messageIDs})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		queued, _ := record.Values[0].(int64)
+		return int(queued), nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to queue messages for re-embedding: %v", err)
+	}
+	report.Queued = result.(int)
+	return report, nil
+}
+
+// Print a dimension report, listing every mismatched message
+func printEmbeddingDimensionReport(report EmbeddingDimensionReport) {
+	if len(report.Mismatched) == 0 {
+		fmt.Printf("✅ All %d embeddings have %d dimensions\n", report.Scanned, report.Expected)
+		return
+	}
+
+	fmt.Printf("⚠️ %d of %d embeddings do not have %d dimensions:\n", len(report.Mismatched), report.Scanned, report.Expected)
+	for _, mismatch := range report.Mismatched {
+		fmt.Printf("  %s  user %s  %d dims\n", mismatch.MessageID, mismatch.UserID, mismatch.Dims)
+	}
+	if report.Queued > 0 {
+		fmt.Printf("♻️ Queued %d messages for re-embedding; run --process-retry-queue to re-embed them\n", report.Queued)
+	} else {
+		fmt.Println("Run with --reembed to queue them for re-embedding")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestValidateEmbeddingDimensions(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.EmbeddingDimensions = 3
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+	})
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	valid := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0, 0}})
+	wrong := storeTestMessage(t, session, userID, Message{Content: "giày cỡ 42", Timestamp: now + 1, Embedding: []float64{1, 0}})
+	storeTestMessage(t, session, userID, Message{Content: "chưa có embedding", Timestamp: now + 2, NeedsEnrichment: true})
+
+	// the scan covers the whole database, so only this user's messages are checked
+	report, err := validateEmbeddingDimensions(context.Background(), false)
+	if err != nil {
+		t.Fatalf("validateEmbeddingDimensions: %v", err)
+	}
+	if report.Expected != 3 || report.Queued != 0 {
+		t.Errorf("report expects %d dimensions and queued %d, want 3 and none without fix", report.Expected, report.Queued)
+	}
+	found := make(map[string]int)
+	for _, mismatch := range report.Mismatched {
+		if mismatch.UserID == userID {
+			found[mismatch.MessageID] = mismatch.Dims
+		}
+	}
+	if len(found) != 1 || found[wrong.MessageID] != 2 {
+		t.Errorf("mismatches for the user = %v, want only %s with 2 dimensions", found, wrong.MessageID)
+	}
+	if _, ok := found[valid.MessageID]; ok {
+		t.Errorf("message with the configured dimension reported as mismatched")
+	}
+}
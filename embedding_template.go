@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Embed message content only, the behaviour before templates existed
+const defaultEmbeddingTemplate = "{content}"
+
+// {content}, {topics} or {meta.<key>} in an embedding template
+var templatePlaceholder = regexp.MustCompile(`\{(content|topics|meta\.[^{}\s]+)\}`)
+
+// Build embedding input from a template. {content} is replaced by content,
+// {topics} by the comma-separated topics and {meta.<key>} by the JSON
+// fields matching key (see jsonFieldValues). Lines whose placeholders all
+// render empty are dropped, so "Topics: {topics}" disappears for an
+// untagged message.
+func renderEmbeddingTemplate(template string, content string, topics []string, metadata map[string][]string) string {
+	var lines []string
+	for _, line := range strings.Split(template, "\n") {
+		placeholders, filled := 0, 0
+		rendered := templatePlaceholder.ReplaceAllStringFunc(line, func(match string) string {
+			placeholders++
+			name := match[1 : len(match)-1]
+			var value string
+			switch {
+			case name == "content":
+				value = content
+			case name == "topics":
+				value = strings.Join(topics, ", ")
+			default:
+				value = strings.Join(jsonFieldValues(metadata, strings.TrimPrefix(name, "meta.")), ", ")
+			}
+			if value != "" {
+				filled++
+			}
+			return value
+		})
+		if placeholders > 0 && filled == 0 {
+			continue
+		}
+		lines = append(lines, rendered)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// Text to embed for a stored message: embeddingInput rendered through
+// cfg.EmbeddingTemplate, with the fields of JSON payloads as metadata.
+// Also returns the detected content type.
+func messageEmbeddingText(ctx context.Context, content string, topics []string) (string, string) {
+	input, contentType := embeddingInput(ctx, content)
+	if cfg.EmbeddingTemplate == defaultEmbeddingTemplate {
+		return input, contentType
+	}
+
+	metadata := make(map[string][]string)
+	if contentType == ContentTypeJSON {
+		if payload, ok := parseJSONPayload(content); ok {
+			collectJSONFields("", payload, metadata)
+		}
+	}
+	return renderEmbeddingTemplate(cfg.EmbeddingTemplate, input, topics, metadata), contentType
+}
+
+// Text to embed for a search query, rendered through the same template as
+// stored messages so both land in the same space. Queries have no topics
+// or metadata, so only {content} is filled.
+func queryEmbeddingText(query string) string {
+	if cfg.EmbeddingTemplate == defaultEmbeddingTemplate {
+		return query
+	}
+	return renderEmbeddingTemplate(cfg.EmbeddingTemplate, query, nil, nil)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRenderEmbeddingTemplate(t *testing.T) {
+	metadata := map[string][]string{
+		"product.name": {"Giày chạy bộ"},
+		"brand":        {"Bitis"},
+		"tags":         {"sale", "new"},
+	}
+	tests := []struct {
+		name     string
+		template string
+		topics   []string
+		want     string
+	}{
+		{"content only", defaultEmbeddingTemplate, []string{"Giày"}, "giày size 42"},
+		{"content and topics", "{content}\nTopics: {topics}", []string{"Giày", "Giảm giá"}, "giày size 42\nTopics: Giày, Giảm giá"},
+		{"empty topics line dropped", "{content}\nTopics: {topics}", nil, "giày size 42"},
+		{"nested and repeated fields", "{meta.name} ({meta.brand}): {meta.tags}", nil, "Giày chạy bộ (Bitis): sale, new"},
+		{"missing field dropped", "{content}\nColor: {meta.color}", nil, "giày size 42"},
+		{"partly filled line kept", "{meta.color} {meta.brand}", nil, "Bitis"},
+		{"literal line kept", "Tin nhắn:\n{content}", nil, "Tin nhắn:\ngiày size 42"},
+	}
+	for _, tt := range tests {
+		if got := renderEmbeddingTemplate(tt.template, "giày size 42", tt.topics, metadata); got != tt.want {
+			t.Errorf("%s: renderEmbeddingTemplate(%q) = %q, want %q", tt.name, tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestMessageEmbeddingText(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.EmbeddingTemplate = "{content}\nTopics: {topics}\nBrand: {meta.brand}"
+		c.StructuredContent = false
+		c.FetchURLTitles = false
+	})
+	text, contentType := messageEmbeddingText(context.Background(), `{"brand": "Bitis"}`, []string{"Giày"})
+	if want := "{\"brand\": \"Bitis\"}\nTopics: Giày\nBrand: Bitis"; text != want || contentType != ContentTypeJSON {
+		t.Errorf("messageEmbeddingText = %q, %q; want %q, %q", text, contentType, want, ContentTypeJSON)
+	}
+
+	// queries share the template but have no topics or metadata
+	if got := queryEmbeddingText("giày nào rẻ?"); got != "giày nào rẻ?" {
+		t.Errorf("queryEmbeddingText = %q, want the query alone", got)
+	}
+	setTestConfig(t, func(c *Config) { c.EmbeddingTemplate = "Query: {content}" })
+	if got := queryEmbeddingText("giày nào rẻ?"); got != "Query: giày nào rẻ?" {
+		t.Errorf("queryEmbeddingText = %q, want it rendered through the template", got)
+	}
+}
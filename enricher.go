@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Embeds message text stored in the graph
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// Tags message content with topics from cfg.TopicTags
+type TopicExtractor interface {
+	Extract(ctx context.Context, content string) ([]string, error)
+}
+
+// The services a message is enriched with before it is stored
+type MessageEnricher interface {
+	Embedder
+	TopicExtractor
+}
+
+// Optional Embedder extension embedding several texts in one request,
+// returned in input order
+type batchEmbedder interface {
+	EmbedBatch(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// Optional TopicExtractor extension that also reports the tags rejected
+// from the model's answer
+type topicTagExtractor interface {
+	ExtractTags(ctx context.Context, content string) (TopicExtraction, error)
+}
+
+// MessageEnricher backed by the OpenAI embedding and chat APIs
+type openAIEnricher struct {
+	client *openai.Client
+}
+
+func newOpenAIEnricher(client *openai.Client) openAIEnricher {
+	return openAIEnricher{client: client}
+}
+
+func (e openAIEnricher) Embed(ctx context.Context, text string) ([]float64, error) {
+	return getEmbedding(ctx, e.client, text)
+}
+
+func (e openAIEnricher) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	return getEmbeddings(ctx, e.client, texts)
+}
+
+func (e openAIEnricher) Extract(ctx context.Context, content string) ([]string, error) {
+	return extractTopics(ctx, e.client, content)
+}
+
+func (e openAIEnricher) ExtractTags(ctx context.Context, content string) (TopicExtraction, error) {
+	return extractTopicTags(ctx, e.client, content)
+}
+
+// Embed texts with one batch request when the embedder supports it and one
+// request per text otherwise
+func embedTexts(ctx context.Context, embedder Embedder, texts []string) ([][]float64, error) {
+	if batch, ok := embedder.(batchEmbedder); ok {
+		return batch.EmbedBatch(ctx, texts)
+	}
+	embeddings := make([][]float64, 0, len(texts))
+	for _, text := range texts {
+		embedding, err := embedder.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, embedding)
+	}
+	return embeddings, nil
+}
+
+// Extract topics, with rejected-tag details when the extractor reports them
+func extractTopicsWith(ctx context.Context, extractor TopicExtractor, content string) (TopicExtraction, error) {
+	if tags, ok := extractor.(topicTagExtractor); ok {
+		return tags.ExtractTags(ctx, content)
+	}
+	topics, err := extractor.Extract(ctx, content)
+	if err != nil {
+		return TopicExtraction{}, err
+	}
+	return TopicExtraction{Accepted: topics, Raw: len(topics)}, nil
+}
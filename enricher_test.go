@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// MessageEnricher whose embedding of a text is [len(text), 1] and whose
+// topics are fixed, recording what it was asked. Safe for the concurrent
+// calls of fetchEnrichment.
+type stubEnricher struct {
+	mu        sync.Mutex
+	topics    []string
+	embedErr  error
+	topicsErr error
+	embedded  []string
+	extracted []string
+}
+
+// Embedding the stubEnricher returns for text
+func stubEmbedding(text string) []float64 {
+	return []float64{float64(len(text)), 1}
+}
+
+func (e *stubEnricher) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.embedded = append(e.embedded, text)
+	if e.embedErr != nil {
+		return nil, e.embedErr
+	}
+	return stubEmbedding(text), nil
+}
+
+func (e *stubEnricher) Extract(ctx context.Context, content string) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.extracted = append(e.extracted, content)
+	if e.topicsErr != nil {
+		return nil, e.topicsErr
+	}
+	return append([]string{}, e.topics...), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Named entity mentioned in a message
+type Entity struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Supported entity types
+const (
+	EntityOrderNumber = "order_number"
+	EntitySKU         = "sku"
+	EntityPrice       = "price"
+)
+
+var (
+	// "#12345", "order 12345", "đơn hàng số 12345", "mã đơn #12345". RE2's
+	// \b is ASCII-only and would not match before "đơn", so the start of a
+	// match is checked by extractEntities instead.
+	orderNumberPattern = regexp.MustCompile(`(?i)(?:(?:order|mã đơn|đơn hàng|đơn)\s*(?:no\.?|số)?\s*#?\s*|#)(\d{4,})\b`)
+	// "SKU-AB123", "sku: AB-123"
+	skuPattern = regexp.MustCompile(`(?i)\bSKU\s*[-:#]?\s*([A-Z0-9][A-Z0-9-]{2,})`)
+	// "199.000đ", "150k", "250,000 VND", "$19.99"
+	pricePattern       = regexp.MustCompile(`(?i)(\d+(?:[.,]\d{3})*)\s*(vnđ|vnd|đ|₫|k)`)
+	dollarPricePattern = regexp.MustCompile(`\$\s?(\d+(?:\.\d{1,2})?)`)
+)
+
+// Extract order numbers, SKUs and prices from message content
+func extractEntities(content string) []Entity {
+	var entities []Entity
+	seen := make(map[Entity]bool)
+	add := func(entity Entity) {
+		if !seen[entity] {
+			seen[entity] = true
+			entities = append(entities, entity)
+		}
+	}
+
+	for _, loc := range orderNumberPattern.FindAllStringSubmatchIndex(content, -1) {
+		// Skip keywords inside a longer word, e.g. "border 12345" or "recorder#12345"
+		if prev, _ := utf8.DecodeLastRuneInString(content[:loc[0]]); unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+			continue
+		}
+		add(Entity{Type: EntityOrderNumber, Value: content[loc[2]:loc[3]]})
+	}
+	for _, match := range skuPattern.FindAllStringSubmatch(content, -1) {
+		add(Entity{Type: EntitySKU, Value: strings.ToUpper(match[1])})
+	}
+	for _, loc := range pricePattern.FindAllStringSubmatchIndex(content, -1) {
+		// Skip units glued to a longer word, e.g. "5kg"
+		if next, _ := utf8.DecodeRuneInString(content[loc[1]:]); unicode.IsLetter(next) {
+			continue
+		}
+		amount := content[loc[2]:loc[3]]
+		unit := strings.ToLower(content[loc[4]:loc[5]])
+		if unit == "₫" || unit == "vnd" || unit == "vnđ" {
+			unit = "đ"
+		}
+		add(Entity{Type: EntityPrice, Value: amount + unit})
+	}
+	for _, match := range dollarPricePattern.FindAllStringSubmatch(content, -1) {
+		add(Entity{Type: EntityPrice, Value: "$" + match[1]})
+	}
+
+	return entities
+}
+
+// Link a message to its entities via MENTIONS relationships
+func linkMessageEntities(ctx context.Context, tx neo4j.ManagedTransaction, messageID string, entities []Entity) error {
+	for _, entity := range entities {
+		query := `
+			MATCH (m:Message {messageId: $messageId})
+			MERGE (e:Entity {type: $type, value: $value})
+			MERGE (m)-[r:MENTIONS]->(e)
+			ON CREATE SET r.timestamp = $timestamp
+		`
+		params := map[string]any{
+			"messageId": messageID,
+			"type":      entity.Type,
+			"value":     entity.Value,
+			"timestamp": time.Now().Unix(),
+		}
+		if _, err := tx.Run(ctx, query, params); err != nil {
+			return fmt.Errorf("failed to link entity %s=%s: %v", entity.Type, entity.Value, err)
+		}
+	}
+	return nil
+}
+
+// Find a user's messages mentioning the given entity, e.g. order number "12345"
+func messagesMentioningEntity(ctx context.Context, userID string, entityType string, value string) ([]Message, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})-[:MENTIONS]->(e:Entity {type: $type, value: $value})
+			RETURN m
+			ORDER BY m.timestamp
+		`
+		params := map[string]any{
+			"userId": userID,
+			"type":   entityType,
+			"value":  value,
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages []Message
+		for records.Next(ctx) {
+			node, ok := records.Record().Values[0].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			messages = append(messages, messageFromNode(node))
+		}
+		return messages, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages mentioning entity: %v", err)
+	}
+
+	return result.([]Message), nil
+}
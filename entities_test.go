@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractEntities(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []Entity
+	}{
+		{"Where is order 12345?", []Entity{{EntityOrderNumber, "12345"}}},
+		{"mã đơn #67890 chưa tới", []Entity{{EntityOrderNumber, "67890"}}},
+		{"đơn hàng số 1234 và #5678", []Entity{{EntityOrderNumber, "1234"}, {EntityOrderNumber, "5678"}}},
+		{"Đơn 4321 bị hủy", []Entity{{EntityOrderNumber, "4321"}}},
+		{"Cho mình SKU-ab123 giá 199.000đ", []Entity{{EntitySKU, "AB123"}, {EntityPrice, "199.000đ"}}},
+		{"It costs $19.99 or 150k", []Entity{{EntityPrice, "150k"}, {EntityPrice, "$19.99"}}},
+		{"Ship 5kg please", nil},
+		// keywords inside longer words are not order references
+		{"border 12345", nil},
+		{"the recorder#12345 broke", nil},
+		{"reorder 55555 units", nil},
+		{"#123 is too short", nil},
+		{"#12345abc", nil},
+	}
+	for _, tt := range tests {
+		if got := extractEntities(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("extractEntities(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
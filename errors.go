@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Failure modes callers tell apart with errors.Is. The original error stays
+// wrapped, so errors.As still finds driver and API error types.
+var (
+	// Neo4j cannot be reached or rejected the credentials
+	errNeo4jUnavailable = errors.New("Neo4j unavailable")
+	// An embedding request failed; messages are still stored without one
+	errEmbeddingFailed = errors.New("embedding failed")
+	// The OpenAI account has run out of credits or hit its usage limit
+	errOpenAIQuota = errors.New("OpenAI quota exceeded")
+)
+
+// Report whether the error means the database cannot be used at all, as
+// opposed to a failed query: a lost or refused connection, an exhausted
+// retry budget made of those, or an authentication failure
+func isNeo4jUnavailableError(err error) bool {
+	var connectivityErr *neo4j.ConnectivityError
+	if errors.As(err, &connectivityErr) {
+		return true
+	}
+	var limitErr *neo4j.TransactionExecutionLimit
+	if errors.As(err, &limitErr) {
+		for _, attemptErr := range limitErr.Errors {
+			if isNeo4jUnavailableError(attemptErr) {
+				return true
+			}
+		}
+		return false
+	}
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) {
+		switch neo4jErr.Code {
+		case "Neo.ClientError.Security.Unauthorized",
+			"Neo.ClientError.Security.AuthenticationRateLimit",
+			"Neo.TransientError.General.DatabaseUnavailable":
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap a Neo4j error as contextError does, and as errNeo4jUnavailable when
+// the database cannot be used
+func neo4jError(ctx context.Context, err error) error {
+	if err != nil && isNeo4jUnavailableError(err) {
+		return fmt.Errorf("%w: %w", errNeo4jUnavailable, contextError(ctx, err))
+	}
+	return contextError(ctx, err)
+}
+
+// Report whether an OpenAI error is the account's quota running out, which
+// unlike other 429 responses does not clear by waiting
+func isOpenAIQuotaError(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	code, _ := apiErr.Code.(string)
+	return code == "insufficient_quota" || apiErr.Type == "insufficient_quota"
+}
+
+// Wrap an OpenAI error as errOpenAIQuota when the quota has run out
+func openAIError(err error) error {
+	if err != nil && isOpenAIQuotaError(err) {
+		return fmt.Errorf("%w: %w", errOpenAIQuota, err)
+	}
+	return err
+}
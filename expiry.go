@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Override the message retention of one user. Zero reverts to the global
+// cfg.MessageRetention. Applies to messages ingested from now on.
+func setUserRetention(ctx context.Context, userID string, retention time.Duration) error {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {userId: $userId})
+			SET u.retentionSeconds = CASE WHEN $seconds > 0 THEN $seconds END
+			RETURN u
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "seconds": int64(retention.Seconds())})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := records.Single(ctx); err != nil {
+			return nil, fmt.Errorf("user %s not found", userID)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set retention: %v", err)
+	}
+
+	fmt.Printf("🗓️ Retention for user %s set to %s\n", userID, retention)
+	return nil
+}
+
+// Delete messages whose expiresAt has passed, together with their edges,
+// entities they alone mention and topics left without messages. Returns the
+// number of messages deleted.
+func expireOldMessages(ctx context.Context) (int, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, `
+			MATCH (m:Message)
+			WHERE m.expiresAt <= $now
+			DETACH DELETE m
+		`, map[string]any{"now": time.Now().Unix()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete expired messages: %v", err)
+		}
+		summary, err := records.Consume(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete expired messages: %v", err)
+		}
+		deleted := summary.Counters().NodesDeleted()
+		if deleted == 0 {
+			return 0, nil
+		}
+
+		// Chunks, entities and topics only the expired messages pointed at
+		if _, err := pruneOrphanChunks(ctx, tx); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Run(ctx, `
+			MATCH (e:Entity)
+			WHERE NOT (e)<-[:MENTIONS]-(:Message)
+			DETACH DELETE e
+		`, nil); err != nil {
+			return nil, fmt.Errorf("failed to prune orphan entities: %v", err)
+		}
+		if _, err := pruneOrphanTopics(ctx, tx); err != nil {
+			return nil, err
+		}
+		return deleted, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := result.(int)
+	if deleted > 0 {
+		fmt.Printf("🧹 Expired %d messages past their retention\n", deleted)
+	}
+	return deleted, nil
+}
+
+// Run expireOldMessages every cfg.ExpirySweepInterval until ctx is
+// cancelled. Does nothing when the interval is zero (the default).
+func startExpirySweeper(ctx context.Context) {
+	if cfg.ExpirySweepInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.ExpirySweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := expireOldMessages(ctx); err != nil && ctx.Err() == nil {
+					slog.Error("Message expiry failed", "err", err)
+				}
+			}
+		}
+	}()
+}
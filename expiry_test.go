@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExpireOldMessages(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) { c.MessageRetention = 0 })
+	ctx := context.Background()
+
+	userID := createTestUser(t, session)
+	if err := setUserRetention(ctx, userID, time.Hour); err != nil {
+		t.Fatalf("setUserRetention: %v", err)
+	}
+	now := time.Now()
+	old := storeTestMessage(t, session, userID, Message{Content: "old", Timestamp: now.Add(-2 * time.Hour).Unix()})
+	recent := storeTestMessage(t, session, userID, Message{Content: "recent", Timestamp: now.Unix()})
+
+	// without a retention messages never expire
+	keeper := createTestUser(t, session)
+	kept := storeTestMessage(t, session, keeper, Message{Content: "kept", Timestamp: now.Add(-24 * time.Hour).Unix()})
+
+	if _, err := expireOldMessages(ctx); err != nil {
+		t.Fatalf("expireOldMessages: %v", err)
+	}
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].MessageID != recent.MessageID {
+		t.Errorf("messages left = %v, want only %s (not %s)", messages, recent.MessageID, old.MessageID)
+	}
+	messages, err = loadUserMessages(ctx, session, keeper)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].MessageID != kept.MessageID {
+		t.Errorf("messages of the user without retention = %v, want %s", messages, kept.MessageID)
+	}
+}
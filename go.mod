@@ -7,3 +7,5 @@ require github.com/sashabaranov/go-openai v1.41.1
 require github.com/joho/godotenv v1.5.1
 
 require github.com/neo4j/neo4j-go-driver/v5 v5.28.1
+
+require golang.org/x/text v0.28.0
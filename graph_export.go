@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Everything stored for one user, as written by exportUserGraph. Topics list
+// the user's topics without their messages; each message names its topics.
+type userGraph struct {
+	User     User          `json:"user"`
+	Messages []Message     `json:"messages"`
+	Topics   []Topic       `json:"topics"`
+	Edges    []archiveEdge `json:"edges"`
+}
+
+// Load the topics the user's messages belong to, by name
+func loadUserTopics(ctx context.Context, session neo4j.SessionWithContext, userID string) ([]Topic, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (:Message {userId: $userId})-[:BELONGS_TO]->(t:Topic)
+			RETURN DISTINCT t
+			ORDER BY t.name
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+
+		var topics []Topic
+		for records.Next(ctx) {
+			if node, ok := records.Record().Values[0].(neo4j.Node); ok {
+				topics = append(topics, topicFromNode(node))
+			}
+		}
+		return topics, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load topics: %v", err)
+	}
+	return result.([]Topic), nil
+}
+
+// Build a Topic from the properties of a Neo4j :Topic node
+func topicFromNode(node neo4j.Node) Topic {
+	topic := Topic{Messages: []Message{}}
+	topic.TopicID, _ = node.Props["topicId"].(string)
+	topic.Name, _ = node.Props["name"].(string)
+	topic.Embedding = decodeStoredEmbedding(node.Props["embedding"], nil)
+	return topic
+}
+
+// Assemble a user graph, dropping embeddings unless withEmbeddings is set
+// and keeping only edges between the given messages
+func buildUserGraph(user User, messages []Message, topics []Topic, edges []archiveEdge, withEmbeddings bool) userGraph {
+	graph := userGraph{User: user, Messages: []Message{}, Topics: []Topic{}, Edges: []archiveEdge{}}
+	ids := make(map[string]bool, len(messages))
+	for _, message := range messages {
+		if !withEmbeddings {
+			message.Embedding = nil
+			message.Chunks = nil
+		}
+		ids[message.MessageID] = true
+		graph.Messages = append(graph.Messages, message)
+	}
+	for _, topic := range topics {
+		if !withEmbeddings {
+			topic.Embedding = nil
+		}
+		graph.Topics = append(graph.Topics, topic)
+	}
+	for _, edge := range edges {
+		if ids[edge.From] && ids[edge.To] {
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+	return graph
+}
+
+// Export a user's profile, messages, topics and CONTEXTUAL_LINK edges (with
+// their similarity) as one indented JSON document. Embeddings are included
+// only when cfg.ArchiveEmbeddings is set.
+func exportUserGraph(ctx context.Context, session neo4j.SessionWithContext, userID string) ([]byte, error) {
+	user, err := loadUser(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	topics, err := loadUserTopics(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	edges, err := loadUserEdges(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(buildUserGraph(user, messages, topics, edges, cfg.ArchiveEmbeddings), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graph: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// export: write a user's graph, or with --topics only its topic graph, to
+// stdout or a file
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	user := flags.String("user", "", "ID of the user to export")
+	out := flags.String("out", "", "write to this file instead of stdout")
+	topics := flags.Bool("topics", false, "export only topics, their message counts and co-occurrence")
+	format := flags.String("format", TopicGraphJSON, "with --topics, output format: json or dot")
+	flags.Parse(args)
+	if *user == "" {
+		return fmt.Errorf("usage: export --user <userId> [--topics [--format json|dot]] [--out graph.json]")
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if _, err := parseTopicGraphFormat(*format); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	var data []byte
+	if *topics {
+		if _, err := loadUser(ctx, session, *user); err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		if err := exportTopicGraph(ctx, *user, &b, *format); err != nil {
+			return err
+		}
+		data = b.Bytes()
+	} else {
+		var err error
+		if data, err = exportUserGraph(ctx, session, *user); err != nil {
+			return err
+		}
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	fmt.Printf("📤 Exported graph of user %s to %s\n", *user, *out)
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildUserGraph(t *testing.T) {
+	messages := []Message{
+		{MessageID: "m1", Embedding: []float64{1, 0}, Chunks: []Chunk{{Embedding: []float64{1, 0}}}},
+		{MessageID: "m2", Embedding: []float64{0, 1}},
+	}
+	topics := []Topic{{TopicID: "t1", Name: "Giày", Embedding: []float64{1, 1}}}
+	edges := []archiveEdge{
+		{From: "m1", To: "m2", Similarity: 0.9},
+		{From: "m1", To: "other", Similarity: 0.8},
+	}
+
+	graph := buildUserGraph(User{UserID: "u1"}, messages, topics, edges, false)
+	for _, message := range graph.Messages {
+		if message.Embedding != nil || message.Chunks != nil {
+			t.Errorf("message %s keeps its embedding without withEmbeddings", message.MessageID)
+		}
+	}
+	if graph.Topics[0].Embedding != nil {
+		t.Error("topic keeps its embedding without withEmbeddings")
+	}
+	// edges to messages outside the export are dropped
+	if want := edges[:1]; !reflect.DeepEqual(graph.Edges, want) {
+		t.Errorf("edges = %+v, want %+v", graph.Edges, want)
+	}
+	if messages[0].Embedding == nil {
+		t.Error("buildUserGraph modified the caller's messages")
+	}
+
+	graph = buildUserGraph(User{UserID: "u1"}, messages, topics, edges, true)
+	if !reflect.DeepEqual(graph.Messages, messages) || !reflect.DeepEqual(graph.Topics, topics) {
+		t.Error("withEmbeddings dropped embeddings")
+	}
+
+	// an empty user still encodes lists, not null
+	data, err := json.Marshal(buildUserGraph(User{UserID: "u2"}, nil, nil, nil, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"messages", "topics", "edges"} {
+		if _, ok := decoded[key].([]any); !ok {
+			t.Errorf("%s = %v, want an empty list", key, decoded[key])
+		}
+	}
+}
+
+func TestExportUserGraph(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+		c.ArchiveEmbeddings = false
+	})
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	first := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0}, Topics: []string{"Giày"}})
+	second := storeTestMessage(t, session, userID, Message{Sender: "ai", Content: "còn size 42", Timestamp: now + 1, Embedding: []float64{0.9, 0.1}, Topics: []string{"Giày", "Giảm giá"}})
+
+	data, err := exportUserGraph(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("exportUserGraph: %v", err)
+	}
+	var graph userGraph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		t.Fatalf("export is not valid JSON: %v", err)
+	}
+	if graph.User.UserID != userID {
+		t.Errorf("exported user %q, want %q", graph.User.UserID, userID)
+	}
+	if len(graph.Messages) != 2 || graph.Messages[0].MessageID != first.MessageID || graph.Messages[1].MessageID != second.MessageID {
+		t.Fatalf("exported messages = %+v, want the user's two messages in order", graph.Messages)
+	}
+	for _, message := range graph.Messages {
+		if message.Embedding != nil {
+			t.Errorf("message %s exported with its embedding", message.MessageID)
+		}
+	}
+	var names []string
+	for _, topic := range graph.Topics {
+		names = append(names, topic.Name)
+	}
+	if want := []string{"Giày", "Giảm giá"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("exported topics = %v, want %v", names, want)
+	}
+	if len(graph.Edges) != 1 {
+		t.Errorf("exported %d edges, want the one link between the messages", len(graph.Edges))
+	}
+
+	if _, err := exportUserGraph(ctx, session, "missing-"+userID); err == nil {
+		t.Error("exportUserGraph succeeded for an unknown user")
+	}
+}
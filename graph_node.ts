@@ -18,6 +18,12 @@ type Message = {
   content: string;
   embedding: number[];
   topics: Topic[];
+  entities: Entity[];
+};
+
+type Entity = {
+  type: "order_number" | "sku" | "price";
+  value: string;
 };
 
 type Topic = {
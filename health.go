@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// initNeo4j has not created a driver, or could not verify its connection
+var errNeo4jNotInitialized = errors.New("Neo4j driver not initialized")
+
+// Health of the Neo4j connection, as /healthz reports it
+const (
+	healthOK               = "ok"
+	healthUninitialized    = "uninitialized"
+	healthNeo4jUnavailable = "unavailable"
+)
+
+// Check that Neo4j can still be reached, e.g. after a database restart:
+// errNeo4jNotInitialized without a driver, errNeo4jUnavailable when
+// VerifyConnectivity fails
+func healthCheck(ctx context.Context) error {
+	neo4jDriverMu.Lock()
+	driver := neo4jDriver
+	neo4jDriverMu.Unlock()
+	if driver == nil {
+		return errNeo4jNotInitialized
+	}
+	if err := driver.VerifyConnectivity(ctx); err != nil {
+		return fmt.Errorf("%w: %w", errNeo4jUnavailable, contextError(ctx, err))
+	}
+	return nil
+}
+
+// Status name of a healthCheck result
+func healthStatus(err error) string {
+	switch {
+	case err == nil:
+		return healthOK
+	case errors.Is(err, errNeo4jNotInitialized):
+		return healthUninitialized
+	}
+	return healthNeo4jUnavailable
+}
+
+// Body of GET /healthz
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GET /healthz: 200 when Neo4j is reachable, 503 otherwise, with the
+// healthStatus in the body
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r.Context())
+	defer cancel()
+	err := healthCheck(ctx)
+	response := healthResponse{Status: healthStatus(err)}
+	if err != nil {
+		response.Error = err.Error()
+		writeJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// In-chat /health: report whether Neo4j is reachable and how long the check took
+func printHealth(ctx context.Context) {
+	start := time.Now()
+	err := healthCheck(ctx)
+	switch healthStatus(err) {
+	case healthOK:
+		fmt.Printf("✅ Neo4j reachable (%s)\n", time.Since(start).Round(time.Millisecond))
+	case healthUninitialized:
+		fmt.Printf("❌ %v\n", err)
+	default:
+		fmt.Printf("❌ Neo4j unreachable: %v\n", err)
+	}
+}
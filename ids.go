@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Node ID formats selectable with ID_FORMAT
+const (
+	// 32 lowercase hex characters, the original format
+	IDFormatHex = "hex"
+	// Random RFC 9562 UUID
+	IDFormatUUIDv4 = "uuidv4"
+	// Time-ordered RFC 9562 UUID, sorts by creation time for better index locality
+	IDFormatUUIDv7 = "uuidv7"
+)
+
+// Validate an ID format name
+func parseIDFormat(value string) (string, error) {
+	switch value {
+	case IDFormatHex, IDFormatUUIDv4, IDFormatUUIDv7:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown ID format %q (want hex, uuidv4 or uuidv7)", value)
+	}
+}
+
+// Format 16 bytes as a UUID with the given version and the RFC variant
+func formatUUID(b [16]byte, version byte) string {
+	b[6] = b[6]&0x0f | version<<4
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Random version 4 UUID
+func newUUIDv4() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return formatUUID(b, 4)
+}
+
+// Version 7 UUID: 48-bit Unix milliseconds followed by random bits
+func newUUIDv7() string {
+	var b [16]byte
+	rand.Read(b[6:])
+	var millis [8]byte
+	binary.BigEndian.PutUint64(millis[:], uint64(time.Now().UnixMilli()))
+	copy(b[0:6], millis[2:8])
+	return formatUUID(b, 7)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseIDFormat(t *testing.T) {
+	for _, format := range []string{IDFormatHex, IDFormatUUIDv4, IDFormatUUIDv7} {
+		if got, err := parseIDFormat(format); err != nil || got != format {
+			t.Errorf("parseIDFormat(%q) = %q, %v", format, got, err)
+		}
+	}
+	for _, format := range []string{"", "uuid", "UUIDV4", "ulid"} {
+		if _, err := parseIDFormat(format); err == nil {
+			t.Errorf("parseIDFormat(%q) accepted an unknown format", format)
+		}
+	}
+}
+
+func TestGenerateIDFormats(t *testing.T) {
+	tests := []struct {
+		format  string
+		pattern string
+	}{
+		{IDFormatHex, `^[0-9a-f]{32}$`},
+		{IDFormatUUIDv4, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{IDFormatUUIDv7, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) { c.IDFormat = tt.format })
+		pattern := regexp.MustCompile(tt.pattern)
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			id := generateID()
+			if !pattern.MatchString(id) {
+				t.Fatalf("%s ID %q does not match %s", tt.format, id, tt.pattern)
+			}
+			if seen[id] {
+				t.Fatalf("%s ID %q generated twice", tt.format, id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestUUIDv7Timestamp(t *testing.T) {
+	before := time.Now().UnixMilli()
+	id := newUUIDv7()
+	after := time.Now().UnixMilli()
+
+	raw, err := hex.DecodeString(strings.ReplaceAll(id, "-", "")[:12])
+	if err != nil {
+		t.Fatalf("invalid UUID %q: %v", id, err)
+	}
+	var millis int64
+	for _, b := range raw {
+		millis = millis<<8 | int64(b)
+	}
+	if millis < before || millis > after {
+		t.Errorf("UUIDv7 timestamp %d outside [%d, %d]", millis, before, after)
+	}
+
+	// later IDs sort after earlier ones
+	time.Sleep(2 * time.Millisecond)
+	if later := newUUIDv7(); later <= id {
+		t.Errorf("UUIDv7 %q generated later sorts before %q", later, id)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Ingest JSONL records ({userId, sender, content, timestamp}) from r until
+// EOF or ctx is cancelled. Each line is committed on its own; malformed or
+// failing lines are logged and skipped. defaultUserID is used for lines
+// without a userId.
+func ingestJSONLines(ctx context.Context, client *openai.Client, r io.Reader, defaultUserID string) (BatchResult, error) {
+	var batch BatchResult
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if err := ctx.Err(); err != nil {
+			return batch, err
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lineID := fmt.Sprintf("line %d", lineNumber)
+
+		record, err := parseRecordLine(line, defaultUserID)
+		if err != nil {
+			slog.Warn("Skipping invalid line", "line", lineNumber, "err", err)
+			batch.fail(lineID, err)
+			continue
+		}
+
+		message := Message{
+			MessageID:     generateID(),
+			Timestamp:     record.Timestamp,
+			Sender:        record.Sender,
+			Content:       record.Content,
+			ContentHash:   contentHash(record.Sender, record.Content),
+			CorrelationID: generateID(),
+		}
+		enrichMessage(withCorrelationID(ctx, message.CorrelationID), newOpenAIEnricher(client), &message)
+		if err := addMessageAndCreateEdges(ctx, session, message, record.UserID); err != nil {
+			slog.Error("Skipping line", "line", lineNumber, "userId", record.UserID, "err", err)
+			batch.fail(lineID, err)
+			continue
+		}
+		batch.succeed(lineID)
+	}
+	if err := scanner.Err(); err != nil {
+		return batch, fmt.Errorf("failed to read input: %v", err)
+	}
+	return batch, nil
+}
+
+// ingest: stream messages from stdin into the graph
+func runIngest(args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ExitOnError)
+	jsonl := flags.Bool("jsonl", false, "read JSON lines ({userId, sender, content, timestamp}) from stdin")
+	user := flags.String("user", "", "user ID for lines without a userId")
+	flags.Parse(args)
+
+	if !*jsonl {
+		return fmt.Errorf("usage: ingest --jsonl [--user <userId>] < messages.jsonl")
+	}
+	if cfg.OpenAIAPIKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY environment variable is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	batch, err := ingestJSONLines(ctx, newOpenAIClient(cfg.OpenAIAPIKey), os.Stdin, *user)
+	fmt.Printf("📥 Ingested %d lines from stdin, %d skipped\n", batch.Succeeded, batch.Failed)
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIngestJSONLinesStreams(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.OpenAIMaxRetries = 0
+	})
+	client, _ := newFakeOpenAI(t)
+	userID := createTestUser(t, session)
+
+	reader, writer := io.Pipe()
+	type ingestResult struct {
+		batch BatchResult
+		err   error
+	}
+	done := make(chan ingestResult, 1)
+	go func() {
+		batch, err := ingestJSONLines(context.Background(), client, reader, userID)
+		done <- ingestResult{batch, err}
+	}()
+
+	// the first line is stored while the input is still open
+	if _, err := io.WriteString(writer, `{"sender": "human", "content": "giày size 42", "timestamp": 1700000000}`+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		count, err := countUserMessages(context.Background(), session, userID)
+		if err != nil {
+			t.Fatalf("countUserMessages: %v", err)
+		}
+		if count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			writer.Close()
+			t.Fatal("first line not stored before the end of input")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	io.WriteString(writer, "not json\n\n")
+	io.WriteString(writer, `{"sender": "ai", "content": "dạ còn ạ", "timestamp": 1700000001}`+"\n")
+	writer.Close()
+
+	result := <-done
+	if result.err != nil {
+		t.Fatalf("ingestJSONLines: %v", result.err)
+	}
+	var failed []string
+	for _, item := range result.batch.Failures() {
+		failed = append(failed, item.ID)
+	}
+	if result.batch.Succeeded != 2 || !reflect.DeepEqual(failed, []string{"line 2"}) {
+		t.Errorf("ingested %d lines, failed %v; want 2 and [line 2]", result.batch.Succeeded, failed)
+	}
+}
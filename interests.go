@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Weight of a topic in a user's interest profile
+type TopicWeight struct {
+	Topic  string  `json:"topic"`
+	Weight float64 `json:"weight"`
+}
+
+// Contribution of a topic mention of the given age, halving every halfLife
+func recencyDecay(age time.Duration, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return 1
+	}
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// Compute a user's interest profile from the BELONGS_TO edges of their
+// messages. Each mention contributes recencyDecay(age, cfg.InterestHalfLife),
+// so recent topics outweigh older ones. Sorted by weight, highest first.
+func userInterestProfile(ctx context.Context, userID string) ([]TopicWeight, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	now := time.Now()
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})-[:BELONGS_TO]->(t:Topic)
+			RETURN t.name, m.timestamp
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+
+		weights := make(map[string]float64)
+		for records.Next(ctx) {
+			record := records.Record()
+			topic, ok := record.Values[0].(string)
+			if !ok {
+				continue
+			}
+			timestamp, _ := record.Values[1].(int64)
+			weights[topic] += recencyDecay(now.Sub(time.Unix(timestamp, 0)), cfg.InterestHalfLife)
+		}
+		return weights, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute interest profile: %v", err)
+	}
+
+	return rankTopicWeights(result.(map[string]float64)), nil
+}
+
+// Sort topic weights highest first, ties by topic name
+func rankTopicWeights(weights map[string]float64) []TopicWeight {
+	profile := make([]TopicWeight, 0, len(weights))
+	for topic, weight := range weights {
+		profile = append(profile, TopicWeight{Topic: topic, Weight: weight})
+	}
+	sort.Slice(profile, func(i, j int) bool {
+		if profile[i].Weight != profile[j].Weight {
+			return profile[i].Weight > profile[j].Weight
+		}
+		return profile[i].Topic < profile[j].Topic
+	})
+	return profile
+}
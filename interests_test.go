@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecencyDecay(t *testing.T) {
+	week := 7 * 24 * time.Hour
+	tests := []struct {
+		age      time.Duration
+		halfLife time.Duration
+		want     float64
+	}{
+		{0, week, 1},
+		{week, week, 0.5},
+		{3 * week, week, 0.125},
+		{-time.Hour, week, 1},
+		{52 * week, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := recencyDecay(tt.age, tt.halfLife); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("recencyDecay(%v, %v) = %v, want %v", tt.age, tt.halfLife, got, tt.want)
+		}
+	}
+}
+
+func TestRankTopicWeights(t *testing.T) {
+	// two old mentions of Áo weigh less than one recent mention of Giày
+	week := 7 * 24 * time.Hour
+	weights := map[string]float64{
+		"Áo":   2 * recencyDecay(4*week, week),
+		"Giày": recencyDecay(0, week),
+		"Túi":  0.5,
+		"Mũ":   0.5,
+	}
+	got := rankTopicWeights(weights)
+	want := []TopicWeight{{"Giày", 1}, {"Mũ", 0.5}, {"Túi", 0.5}, {"Áo", 0.125}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rankTopicWeights = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Report whether an isolated message has no edges because its embedding is
+// missing (pending or failed enrichment) rather than because nothing else is
+// similar to it
+func isolatedByMissingEmbedding(message Message) bool {
+	return len(message.Embedding) == 0 || message.NeedsEnrichment || message.EnrichmentFailed
+}
+
+// Find a user's messages without any CONTEXTUAL_LINK, oldest first. Such
+// messages are unreachable by graph traversal; isolatedByMissingEmbedding
+// tells failed enrichment apart from genuinely unique content. Returns
+// errNoMessages when the user has no messages at all.
+func isolatedMessages(ctx context.Context, userID string) ([]Message, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})
+			WHERE NOT (m)-[:CONTEXTUAL_LINK]-()
+			RETURN m
+			ORDER BY m.timestamp, m.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+
+		messages := []Message{}
+		for records.Next(ctx) {
+			if node, ok := records.Record().Values[0].(neo4j.Node); ok {
+				messages = append(messages, messageFromNode(node))
+			}
+		}
+		return messages, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find isolated messages: %v", err)
+	}
+	messages := result.([]Message)
+	if len(messages) == 0 {
+		if count, err := countUserMessages(ctx, session, userID); err != nil {
+			return nil, err
+		} else if count == 0 {
+			return nil, errNoMessages
+		}
+	}
+	return messages, nil
+}
+
+// Print a user's isolated messages grouped by cause
+func printIsolatedMessages(ctx context.Context, userID string) {
+	messages, err := isolatedMessages(ctx, userID)
+	if errors.Is(err, errNoMessages) {
+		fmt.Println(noMessagesText)
+		return
+	}
+	if err != nil {
+		slog.Error("Error finding isolated messages", "userId", userID, "err", err)
+		return
+	}
+	if len(messages) == 0 {
+		fmt.Println("No isolated messages for this user")
+		return
+	}
+
+	var missing, unique []Message
+	for _, message := range messages {
+		if isolatedByMissingEmbedding(message) {
+			missing = append(missing, message)
+		} else {
+			unique = append(unique, message)
+		}
+	}
+
+	fmt.Printf("🏝️ Isolated messages: %d\n", len(messages))
+	fmt.Printf("  embedding missing (%d):\n", len(missing))
+	for _, message := range missing {
+		status := "pending retry"
+		if message.EnrichmentFailed {
+			status = "enrichment failed"
+		}
+		fmt.Printf("    %s [%s] %s: %.60s\n", message.MessageID, status, message.Sender, message.Content)
+	}
+	fmt.Printf("  no similar messages (%d):\n", len(unique))
+	for _, message := range unique {
+		fmt.Printf("    %s %s: %.60s\n", message.MessageID, message.Sender, message.Content)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsolatedByMissingEmbedding(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		want    bool
+	}{
+		{"embedded", Message{Embedding: []float64{1, 0}}, false},
+		{"no embedding", Message{}, true},
+		{"pending retry", Message{Embedding: []float64{0, 0}, NeedsEnrichment: true}, true},
+		{"enrichment failed", Message{Embedding: []float64{0, 0}, EnrichmentFailed: true}, true},
+	}
+	for _, tt := range tests {
+		if got := isolatedByMissingEmbedding(tt.message); got != tt.want {
+			t.Errorf("%s: isolatedByMissingEmbedding = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsolatedMessages(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+	})
+	ctx := context.Background()
+
+	userID := createTestUser(t, session)
+	if _, err := isolatedMessages(ctx, userID); !errors.Is(err, errNoMessages) {
+		t.Fatalf("isolatedMessages without messages: err = %v, want errNoMessages", err)
+	}
+
+	now := time.Now().Unix()
+	storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0, 0}})
+	storeTestMessage(t, session, userID, Message{Content: "giày cỡ 42", Timestamp: now + 1, Embedding: []float64{0.9, 0.1, 0}})
+	unique := storeTestMessage(t, session, userID, Message{Content: "mũ lưỡi trai", Timestamp: now + 2, Embedding: []float64{0, 0, 1}})
+	pending := storeTestMessage(t, session, userID, Message{Content: "túi xách", Timestamp: now + 3, NeedsEnrichment: true})
+
+	messages, err := isolatedMessages(ctx, userID)
+	if err != nil {
+		t.Fatalf("isolatedMessages: %v", err)
+	}
+	if len(messages) != 2 || messages[0].MessageID != unique.MessageID || messages[1].MessageID != pending.MessageID {
+		t.Fatalf("isolated = %+v, want the unique then the pending message", messages)
+	}
+	if isolatedByMissingEmbedding(messages[0]) || !isolatedByMissingEmbedding(messages[1]) {
+		t.Errorf("causes = %v, %v; want only the pending message missing an embedding",
+			isolatedByMissingEmbedding(messages[0]), isolatedByMissingEmbedding(messages[1]))
+	}
+}
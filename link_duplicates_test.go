@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkDuplicates(t *testing.T) {
+	tests := []struct {
+		name           string
+		linkDuplicates bool
+		want           int64
+	}{
+		{"linked", true, 1},
+		{"not linked", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := requireNeo4j(t, func(c *Config) {
+				c.ServerSideSimilarity = false
+				c.SimilarityThreshold = 0.5
+				c.SenderPairThresholds = nil
+				c.LinkDuplicates = tt.linkDuplicates
+			})
+			userID := createTestUser(t, session)
+
+			now := time.Now().Unix()
+			first := storeTestMessage(t, session, userID, Message{Content: "còn size 42 không?", Timestamp: now, Embedding: []float64{1, 0}})
+			repeat := storeTestMessage(t, session, userID, Message{Content: "còn size 42 không?", Timestamp: now + 60, Embedding: []float64{1, 0}})
+			// similar but not identical messages link either way
+			similar := storeTestMessage(t, session, userID, Message{Content: "size 42 còn không?", Timestamp: now + 120, Embedding: []float64{0.9, 0.1}})
+
+			if n := countTestLinks(t, session, first.MessageID, repeat.MessageID); n != tt.want {
+				t.Errorf("%d links between duplicates, want %d", n, tt.want)
+			}
+			if n := countTestLinks(t, session, first.MessageID, similar.MessageID); n != 1 {
+				t.Errorf("%d links between similar messages, want 1", n)
+			}
+			for _, message := range []Message{first, repeat, similar} {
+				if n := countTestLinks(t, session, message.MessageID, message.MessageID); n != 0 {
+					t.Errorf("message %s linked to itself", message.MessageID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Why two messages are or are not joined by a CONTEXTUAL_LINK edge
+type LinkExplanation struct {
+	A Message `json:"a"`
+	B Message `json:"b"`
+	// Chunk-aware cosine of the two messages, and the same after the topic
+	// overlap boost, as compared against Threshold
+	Cosine     float64 `json:"cosine"`
+	Similarity float64 `json:"similarity"`
+	Threshold  float64 `json:"threshold"`
+	// Topics both messages are tagged with
+	SharedTopics []string `json:"sharedTopics"`
+	// Reasons the pair is never compared or compares as 0 (different users
+	// or scrims, missing or mismatched embeddings)
+	Problems []string `json:"problems,omitempty"`
+	// The stored edge, if any, with all of its properties
+	Linked bool           `json:"linked"`
+	Edge   map[string]any `json:"edge,omitempty"`
+}
+
+// Report whether the current settings would link the pair
+func (e LinkExplanation) WouldLink() bool {
+	return len(e.Problems) == 0 && e.Similarity > e.Threshold
+}
+
+// Explain the linking decision for two messages: their similarity as
+// createSimilarityEdges computes it, the threshold for their sender pair,
+// shared topics, anything that keeps them from being compared, and the
+// stored edge between them. A missing message is an error.
+func explainLink(ctx context.Context, idA string, idB string) (LinkExplanation, error) {
+	if idA == idB {
+		return LinkExplanation{}, fmt.Errorf("a message is never linked to itself")
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	owners := make(map[string]string)
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message)
+			WHERE m.messageId IN [$idA, $idB]
+			RETURN m, [(m)-[:HAS_CHUNK]->(c:Chunk) | c], m.userId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"idA": idA, "idB": idB})
+		if err != nil {
+			return nil, err
+		}
+		messages := make(map[string]Message)
+		for records.Next(ctx) {
+			values := records.Record().Values
+			if node, ok := values[0].(neo4j.Node); ok {
+				message := messageFromNode(node)
+				message.Chunks = chunksFromValue(values[1])
+				messages[message.MessageID] = message
+				owners[message.MessageID], _ = values[2].(string)
+			}
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+		for _, id := range []string{idA, idB} {
+			if _, ok := messages[id]; !ok {
+				return nil, fmt.Errorf("message %s not found", id)
+			}
+		}
+
+		explanation := LinkExplanation{A: messages[idA], B: messages[idB], SharedTopics: []string{}}
+		edgeQuery := `
+			MATCH (:Message {messageId: $idA})-[r:CONTEXTUAL_LINK]-(:Message {messageId: $idB})
+			RETURN properties(r)
+			LIMIT 1
+		`
+		records, err = tx.Run(ctx, edgeQuery, map[string]any{"idA": idA, "idB": idB})
+		if err != nil {
+			return nil, err
+		}
+		if records.Next(ctx) {
+			explanation.Linked = true
+			explanation.Edge, _ = records.Record().Values[0].(map[string]any)
+		}
+		return explanation, records.Err()
+	}, txTimeout(ctx))
+	if err != nil {
+		return LinkExplanation{}, fmt.Errorf("failed to explain link: %w", neo4jError(ctx, err))
+	}
+
+	explanation := result.(LinkExplanation)
+	a, b := explanation.A, explanation.B
+	explanation.Cosine = chunkedSimilarity(a.Embedding, chunkEmbeddings(a.Chunks), b.Embedding, chunkEmbeddings(b.Chunks))
+	explanation.Similarity = messageSimilarity(a, b)
+	explanation.Threshold = similarityThresholdFor(a.Sender, b.Sender)
+	for _, topic := range a.Topics {
+		if containsString(b.Topics, topic) {
+			explanation.SharedTopics = append(explanation.SharedTopics, topic)
+		}
+	}
+
+	if owners[idA] != owners[idB] {
+		explanation.Problems = append(explanation.Problems, "the messages belong to different users; only a user's own messages are compared")
+	}
+	if a.ScrimID != "" && b.ScrimID != "" && a.ScrimID != b.ScrimID {
+		explanation.Problems = append(explanation.Problems, "the messages were posted to different scrims")
+	}
+	for _, message := range []Message{a, b} {
+		if len(message.Embedding) == 0 {
+			explanation.Problems = append(explanation.Problems, fmt.Sprintf("message %s has no embedding", message.MessageID))
+		}
+	}
+	if len(a.Embedding) > 0 && len(b.Embedding) > 0 && len(a.Embedding) != len(b.Embedding) {
+		explanation.Problems = append(explanation.Problems, fmt.Sprintf("embedding dimensions differ (%d vs %d)", len(a.Embedding), len(b.Embedding)))
+	}
+	return explanation, nil
+}
+
+// Print a link explanation
+func printLinkExplanation(explanation LinkExplanation) {
+	a, b := explanation.A, explanation.B
+	fmt.Printf("🔍 %s (%s): %s\n", a.MessageID, a.Sender, a.Content)
+	fmt.Printf("   %s (%s): %s\n", b.MessageID, b.Sender, b.Content)
+	fmt.Printf("  cosine         %.4f\n", explanation.Cosine)
+	if explanation.Similarity != explanation.Cosine {
+		fmt.Printf("  boosted        %.4f (shared topic, x%.2f)\n", explanation.Similarity, cfg.TopicOverlapBoost)
+	}
+	fmt.Printf("  threshold      %.4f (%s)\n", explanation.Threshold, senderPairKey(a.Sender, b.Sender))
+	if len(explanation.SharedTopics) > 0 {
+		fmt.Printf("  shared topics  %v\n", explanation.SharedTopics)
+	} else {
+		fmt.Println("  shared topics  none")
+	}
+	for _, problem := range explanation.Problems {
+		fmt.Printf("  ⚠️ %s\n", problem)
+	}
+
+	if explanation.Linked {
+		similarity, _ := explanation.Edge["similarity"].(float64)
+		timestamp, _ := explanation.Edge["timestamp"].(int64)
+		fmt.Printf("  edge           linked, stored similarity %.4f, created %s\n", similarity, time.Unix(timestamp, 0).Format(time.RFC3339))
+		for _, key := range sortedKeys(explanation.Edge) {
+			if key != "similarity" && key != "timestamp" {
+				fmt.Printf("    %s = %v\n", key, explanation.Edge[key])
+			}
+		}
+	} else {
+		fmt.Println("  edge           not linked")
+	}
+
+	switch {
+	case explanation.WouldLink() && explanation.Linked:
+		fmt.Println("✅ Linked, and the current settings would link them")
+	case explanation.WouldLink():
+		fmt.Println("➕ Not linked, but the current settings would link them (stored before reaching the threshold, pruned, or outside the candidate window)")
+	case explanation.Linked:
+		fmt.Println("➖ Linked, but the current settings would not link them (the edge predates a threshold or embedding change, or was imported)")
+	default:
+		fmt.Println("❌ Not linked, and the current settings would not link them")
+	}
+}
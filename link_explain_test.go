@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLinkExplanationWouldLink(t *testing.T) {
+	tests := []struct {
+		name        string
+		explanation LinkExplanation
+		want        bool
+	}{
+		{"above threshold", LinkExplanation{Similarity: 0.9, Threshold: 0.7}, true},
+		{"at threshold", LinkExplanation{Similarity: 0.7, Threshold: 0.7}, false},
+		{"problem", LinkExplanation{Similarity: 0.9, Threshold: 0.7, Problems: []string{"different users"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.explanation.WouldLink(); got != tt.want {
+			t.Errorf("%s: WouldLink() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExplainLinkSameMessage(t *testing.T) {
+	// rejected before touching the database
+	if _, err := explainLink(context.Background(), "m1", "m1"); err == nil {
+		t.Error("explainLink accepted a message paired with itself")
+	}
+}
+
+func TestExplainLink(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.ServerSideSimilarity = false
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+		c.TopicOverlapBoost = 1
+	})
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+	otherUser := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	first := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0}, Topics: []string{"Giày", "Giảm giá"}})
+	second := storeTestMessage(t, session, userID, Message{Sender: "ai", Content: "còn size 42", Timestamp: now + 1, Embedding: []float64{0.8, 0.6}, Topics: []string{"Giày"}})
+	elsewhere := storeTestMessage(t, session, otherUser, Message{Content: "giày size 42", Timestamp: now + 2, Embedding: []float64{1, 0}})
+
+	explanation, err := explainLink(ctx, first.MessageID, second.MessageID)
+	if err != nil {
+		t.Fatalf("explainLink: %v", err)
+	}
+	if math.Abs(explanation.Cosine-0.8) > 1e-9 || explanation.Threshold != 0.5 {
+		t.Errorf("cosine %.4f against threshold %.2f, want 0.8 against 0.5", explanation.Cosine, explanation.Threshold)
+	}
+	if !reflect.DeepEqual(explanation.SharedTopics, []string{"Giày"}) {
+		t.Errorf("shared topics = %v, want [Giày]", explanation.SharedTopics)
+	}
+	if !explanation.Linked || !explanation.WouldLink() || len(explanation.Problems) != 0 {
+		t.Errorf("explanation = %+v, want a linked pair the settings would link", explanation)
+	}
+	if _, ok := explanation.Edge["similarity"].(float64); !ok {
+		t.Errorf("edge properties = %v, want the stored similarity", explanation.Edge)
+	}
+
+	explanation, err = explainLink(ctx, first.MessageID, elsewhere.MessageID)
+	if err != nil {
+		t.Fatalf("explainLink across users: %v", err)
+	}
+	if explanation.Linked || explanation.WouldLink() || len(explanation.Problems) != 1 || !strings.Contains(explanation.Problems[0], "different users") {
+		t.Errorf("explanation across users = %+v, want an unlinked pair of different users", explanation)
+	}
+
+	if _, err := explainLink(ctx, first.MessageID, "missing-"+second.MessageID); err == nil {
+		t.Error("explainLink succeeded for an unknown message")
+	}
+}
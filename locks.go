@@ -0,0 +1,48 @@
+package main
+
+import "sync"
+
+// Mutex keyed by string. Entries are reference counted and removed once no
+// goroutine holds or waits for them, so the map does not grow unbounded.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Acquire the lock for key and return the function releasing it
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// Per-user ingestion lock. Writes that create similarity edges for a user
+// hold it for the whole transaction, so a concurrent ingestion for the same
+// user commits first and is visible to the next candidate scan; without it
+// two in-flight messages could miss each other and never be linked. This
+// only serializes writers within this process.
+var userIngestLocks keyedMutex
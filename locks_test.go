@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexSerializesSameKey(t *testing.T) {
+	var locks keyedMutex
+	var mu sync.Mutex
+	inside, maxInside := 0, 0
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.Lock("u1")
+			defer unlock()
+			mu.Lock()
+			inside++
+			maxInside = max(maxInside, inside)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			inside--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxInside != 1 {
+		t.Errorf("%d goroutines held the lock of one key at once, want 1", maxInside)
+	}
+	if len(locks.locks) != 0 {
+		t.Errorf("%d locks left after release, want 0", len(locks.locks))
+	}
+}
+
+func TestKeyedMutexIndependentKeys(t *testing.T) {
+	var locks keyedMutex
+	unlock := locks.Lock("u1")
+	defer unlock()
+
+	acquired := make(chan struct{})
+	go func() {
+		release := locks.Lock("u2")
+		release()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock of u2 blocked by a held lock of u1")
+	}
+}
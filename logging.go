@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parse LOG_LEVEL: debug, info, warn or error, optionally with an offset
+// such as "info+2"
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("invalid LOG_LEVEL %q (want debug, info, warn or error)", value)
+	}
+	return level, nil
+}
+
+// Install the default slog logger on stderr: JSON lines with jsonOutput, the
+// console handler otherwise. Output of the log package (the remaining
+// log.Fatal calls) is logged at error level.
+func setupLogging(level slog.Level, jsonOutput bool) {
+	var handler slog.Handler
+	if jsonOutput {
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	} else {
+		handler = newConsoleHandler(os.Stderr, level)
+	}
+	slog.SetDefault(slog.New(handler))
+	slog.SetLogLoggerLevel(slog.LevelError)
+}
+
+// slog handler writing one "15:04:05 WARN  message key=value ..." line per
+// record, for reading in a terminal
+type consoleHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	// Attributes added by WithAttrs, already formatted, and the group
+	// prefix for keys of later attributes
+	attrs  string
+	prefix string
+}
+
+func newConsoleHandler(w io.Writer, level slog.Leveler) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (h *consoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(ctx context.Context, record slog.Record) error {
+	var buf bytes.Buffer
+	if !record.Time.IsZero() {
+		buf.WriteString(record.Time.Format(time.TimeOnly))
+		buf.WriteByte(' ')
+	}
+	fmt.Fprintf(&buf, "%-5s %s", record.Level, record.Message)
+	buf.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		writeConsoleAttr(&buf, h.prefix, attr)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var buf bytes.Buffer
+	for _, attr := range attrs {
+		writeConsoleAttr(&buf, h.prefix, attr)
+	}
+	clone := *h
+	clone.attrs += buf.String()
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// Append " key=value", flattening groups into dotted keys and quoting
+// values that are empty or contain spaces, quotes or '='
+func writeConsoleAttr(buf *bytes.Buffer, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range value.Group() {
+			writeConsoleAttr(buf, prefix, member)
+		}
+		return
+	}
+
+	text := value.String()
+	if text == "" || strings.ContainsAny(text, " \t\n\"=") {
+		text = strconv.Quote(text)
+	}
+	fmt.Fprintf(buf, " %s%s=%s", prefix, attr.Key, text)
+}
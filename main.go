@@ -1,14 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"math"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -24,6 +29,50 @@ type Message struct {
 	Content   string    `json:"content"`
 	Embedding []float64 `json:"embedding"`
 	Topics    []string  `json:"topics"`
+	Entities  []Entity  `json:"entities"`
+	// Embedding or topic extraction failed and should be retried later
+	NeedsEnrichment bool `json:"needsEnrichment"`
+	// Enrichment retries were exhausted
+	EnrichmentFailed bool `json:"enrichmentFailed"`
+	// topicPromptVersion() in effect when Topics were extracted
+	TopicPromptVersion string `json:"topicPromptVersion"`
+	// ID sent with the OpenAI requests that enriched this message
+	CorrelationID string `json:"correlationId"`
+	// contentHash(sender, content)
+	ContentHash string `json:"contentHash"`
+	// Model that produced Embedding, empty for messages embedded before it was recorded
+	EmbeddingModel string `json:"embeddingModel"`
+	// Separately embedded segments of content longer than cfg.ChunkSize
+	Chunks []Chunk `json:"chunks,omitempty"`
+	// detectContentType(content): prose, json or url
+	ContentType string `json:"contentType"`
+	// Tags the topic model returned, and how many of them were outside cfg.TopicTags
+	TopicTagsRaw      int `json:"topicTagsRaw"`
+	TopicTagsRejected int `json:"topicTagsRejected"`
+	// Model settings that produced an AI message, nil for human messages
+	Generation *GenerationInfo `json:"generation,omitempty"`
+	// Human chat message whose reply has not been generated yet
+	AwaitingReply bool `json:"awaitingReply,omitempty"`
+	// Scrim the message was posted to, empty outside scrims
+	ScrimID string `json:"scrimId,omitempty"`
+	// Chat session (Session node) the message was sent in, empty for
+	// messages ingested outside the chat
+	SessionID string `json:"sessionId,omitempty"`
+	// Times the same content was sent again within cfg.DedupWindow and
+	// folded into this message
+	RepeatCount int `json:"repeatCount,omitempty"`
+}
+
+// Chat model, parameters and token usage behind an AI reply
+type GenerationInfo struct {
+	Model            string  `json:"model"`
+	Temperature      float64 `json:"temperature"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	// Reply as generated, when post-processing changed it and
+	// cfg.KeepOriginalResponse is set
+	OriginalContent string `json:"originalContent,omitempty"`
 }
 
 type Topic struct {
@@ -34,233 +83,603 @@ type Topic struct {
 }
 
 type User struct {
-	UserID      string    `json:"userId"`
-	Name        string    `json:"name"`
-	CreatedAt   int64     `json:"createdAt"`
-	LastActive  int64     `json:"lastActive"`
+	UserID      string          `json:"userId"`
+	Name        string          `json:"name"`
+	CreatedAt   int64           `json:"createdAt"`
+	LastActive  int64           `json:"lastActive"`
 	Preferences UserPreferences `json:"preferences"`
 }
 
 type UserPreferences struct {
-	Language        string   `json:"language"`
-	Tone            string   `json:"tone"`
-	AddressingStyle string   `json:"addressingStyle"`
+	Language        string               `json:"language"`
+	Tone            string               `json:"tone"`
+	AddressingStyle string               `json:"addressingStyle"`
+	Retrieval       RetrievalPreferences `json:"retrieval"`
 }
 
 // Neo4j database connection
-var neo4jDriver neo4j.Driver
+var neo4jDriver neo4j.DriverWithContext
 
-// Initialize Neo4j connection
+// Guards setting neo4jDriver, so concurrent initNeo4j calls create one
+// driver and healthCheck never sees a half-initialized one
+var neo4jDriverMu sync.Mutex
+
+// Initialize Neo4j connection. The driver is only kept once connectivity is
+// verified; later calls reuse it.
 func initNeo4j() error {
-	uri := "neo4j://localhost:7687"
-	username := "neo4j"
-	password := "123123123"
-	
-	var err error
-	neo4jDriver, err = neo4j.NewDriver(uri, neo4j.BasicAuth(username, password, ""))
+	neo4jDriverMu.Lock()
+	defer neo4jDriverMu.Unlock()
+	if neo4jDriver != nil {
+		return nil
+	}
+	uri := cfg.Neo4jURI
+	username := cfg.Neo4jUser
+	password := cfg.Neo4jPassword
+
+	configure, err := neo4jDriverConfig(uri, cfg.Neo4jCACert)
+	if err != nil {
+		return err
+	}
+	driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(username, password, ""), configure)
 	if err != nil {
 		return fmt.Errorf("failed to create Neo4j driver: %v", err)
 	}
-	
+
 	// Test connection
-	err = neo4jDriver.VerifyConnectivity()
+	err = driver.VerifyConnectivity(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to connect to Neo4j: %v", err)
+		driver.Close(context.Background())
+		return fmt.Errorf("%w: %w", errNeo4jUnavailable, err)
 	}
-	
-	fmt.Println("✅ Connected to Neo4j database")
+
+	neo4jDriver = driver
+	slog.Info("Connected to Neo4j", "uri", uri)
 	return nil
 }
 
-// Generate a random ID for nodes
+// Convert a Neo4j list value to []string, dropping non-string elements
+func toStringSlice(value any) []string {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Build a Message from the properties of a Neo4j :Message node
+func messageFromNode(node neo4j.Node) Message {
+	props := node.Props
+	message := Message{
+		Embedding: decodeStoredEmbedding(props["embedding"], props["embeddingGz"]),
+		Topics:    toStringSlice(props["topics"]),
+	}
+	message.MessageID, _ = props["messageId"].(string)
+	message.Timestamp, _ = props["timestamp"].(int64)
+	message.Sender, _ = props["sender"].(string)
+	message.Content, _ = props["content"].(string)
+	message.NeedsEnrichment, _ = props["needsEnrichment"].(bool)
+	message.EnrichmentFailed, _ = props["enrichmentFailed"].(bool)
+	message.TopicPromptVersion, _ = props["topicPromptVersion"].(string)
+	message.CorrelationID, _ = props["correlationId"].(string)
+	message.ContentHash, _ = props["contentHash"].(string)
+	message.EmbeddingModel, _ = props["embeddingModel"].(string)
+	message.AwaitingReply, _ = props["awaitingReply"].(bool)
+	message.ContentType, _ = props["contentType"].(string)
+	message.ScrimID, _ = props["scrimId"].(string)
+	message.SessionID, _ = props["sessionId"].(string)
+	repeatCount, _ := props["repeatCount"].(int64)
+	message.RepeatCount = int(repeatCount)
+	tagsRaw, _ := props["topicTagsRaw"].(int64)
+	tagsRejected, _ := props["topicTagsRejected"].(int64)
+	message.TopicTagsRaw = int(tagsRaw)
+	message.TopicTagsRejected = int(tagsRejected)
+	if model, ok := props["model"].(string); ok {
+		generation := &GenerationInfo{Model: model}
+		generation.Temperature, _ = props["temperature"].(float64)
+		promptTokens, _ := props["promptTokens"].(int64)
+		completionTokens, _ := props["completionTokens"].(int64)
+		totalTokens, _ := props["totalTokens"].(int64)
+		generation.PromptTokens = int(promptTokens)
+		generation.CompletionTokens = int(completionTokens)
+		generation.TotalTokens = int(totalTokens)
+		generation.OriginalContent, _ = props["originalContent"].(string)
+		message.Generation = generation
+	}
+	return message
+}
+
+// Generate a random ID for nodes in the configured cfg.IDFormat
 func generateID() string {
+	switch cfg.IDFormat {
+	case IDFormatUUIDv4:
+		return newUUIDv4()
+	case IDFormatUUIDv7:
+		return newUUIDv7()
+	}
+
 	b := make([]byte, 16)
 	rand.Read(b)
 	return fmt.Sprintf("%x", b)
 }
 
-// Get embedding from OpenAI text-embedding-3-small
-func getEmbedding(client *openai.Client, text string) ([]float64, error) {
-	resp, err := client.CreateEmbeddings(
-		context.Background(),
-		openai.EmbeddingRequest{
-			Input: []string{text},
-			Model: "text-embedding-3-small",
-		},
-	)
+// Embedding input type hint for models that embed queries and documents differently
+type EmbeddingInputType string
+
+const (
+	EmbeddingInputDocument EmbeddingInputType = "document"
+	EmbeddingInputQuery    EmbeddingInputType = "query"
+)
+
+// Get embedding from OpenAI cfg.EmbeddingModel for content stored in the graph
+func getEmbedding(ctx context.Context, client *openai.Client, text string) ([]float64, error) {
+	return createEmbedding(ctx, client, text, EmbeddingInputDocument)
+}
+
+// Get embedding for a search query that is compared against stored messages
+func getQueryEmbedding(ctx context.Context, client *openai.Client, text string) ([]float64, error) {
+	return createEmbedding(ctx, client, queryEmbeddingText(text), EmbeddingInputQuery)
+}
+
+// Get embeddings for several texts stored in the graph in a single request
+func getEmbeddings(ctx context.Context, client *openai.Client, texts []string) ([][]float64, error) {
+	return createEmbeddings(ctx, client, texts, EmbeddingInputDocument)
+}
+
+// Request an embedding, sending the input type hint only when the configured
+// model distinguishes queries from documents (no-op for OpenAI models)
+func createEmbedding(ctx context.Context, client *openai.Client, text string, inputType EmbeddingInputType) ([]float64, error) {
+	embeddings, err := createEmbeddings(ctx, client, []string{text}, inputType)
 	if err != nil {
 		return nil, err
 	}
-	
+	return embeddings[0], nil
+}
+
+// Request embeddings for a batch of inputs, returned in input order. Inputs
+// already in the embedding cache are not sent; the request is bounded by
+// cfg.RequestTimeout.
+func createEmbeddings(ctx context.Context, client *openai.Client, texts []string, inputType EmbeddingInputType) ([][]float64, error) {
+	cache := defaultEmbeddingCache()
+	embeddings := make([][]float64, len(texts))
+	var missing []int
+	for i, text := range texts {
+		if embedding, ok := cache.get(embeddingCacheKey(text, inputType)); ok {
+			embeddings[i] = embedding
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	inputs := make([]string, len(missing))
+	for j, i := range missing {
+		inputs[j] = texts[i]
+	}
+	request := openai.EmbeddingRequest{
+		Input: inputs,
+		Model: openai.EmbeddingModel(cfg.EmbeddingModel),
+	}
+	if cfg.EmbeddingInputType {
+		request.ExtraBody = map[string]any{"input_type": string(inputType)}
+	}
+
+	resp, err := withOpenAIRetry(ctx, func(ctx context.Context) (openai.EmbeddingResponse, error) {
+		return client.CreateEmbeddings(ctx, request)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errEmbeddingFailed, err)
+	}
+
+	fetched, err := embeddingsByIndex(resp, len(inputs), cfg.EmbeddingDimensions)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errEmbeddingFailed, err)
+	}
+	for j, i := range missing {
+		embeddings[i] = fetched[j]
+		cache.put(embeddingCacheKey(texts[i], inputType), fetched[j])
+	}
+	return embeddings, nil
+}
+
+// Match embeddings in a response to their inputs using each item's Index,
+// since the API does not guarantee the data is returned in input order.
+// Every embedding must have the given dimensions: a vector of another size,
+// e.g. from a model not matching EMBEDDING_DIMENSIONS, could never be
+// compared with the stored ones.
+func embeddingsByIndex(resp openai.EmbeddingResponse, count int, dimensions int) ([][]float64, error) {
 	if len(resp.Data) == 0 {
 		return nil, fmt.Errorf("no embedding data received")
 	}
-	
-	// Convert []float32 to []float64
-	embedding := make([]float64, len(resp.Data[0].Embedding))
-	for i, v := range resp.Data[0].Embedding {
-		embedding[i] = float64(v)
+	if len(resp.Data) != count {
+		return nil, fmt.Errorf("received %d embeddings for %d inputs", len(resp.Data), count)
+	}
+
+	embeddings := make([][]float64, count)
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= count {
+			return nil, fmt.Errorf("embedding index %d out of range for %d inputs", item.Index, count)
+		}
+		if embeddings[item.Index] != nil {
+			return nil, fmt.Errorf("duplicate embedding for input %d", item.Index)
+		}
+		if len(item.Embedding) != dimensions {
+			return nil, fmt.Errorf("embedding for input %d has %d dimensions, want %d (check EMBEDDING_MODEL and EMBEDDING_DIMENSIONS)", item.Index, len(item.Embedding), dimensions)
+		}
+
+		// Convert []float32 to []float64
+		embedding := make([]float64, len(item.Embedding))
+		for i, v := range item.Embedding {
+			embedding[i] = float64(v)
+		}
+		embeddings[item.Index] = embedding
 	}
-	return embedding, nil
+	return embeddings, nil
+}
+
+// Version of the topic extraction setup, derived from the prompt, model and
+// tag list. Stored on tagged messages so they can be re-extracted when it changes.
+func topicPromptVersion() string {
+	hash := sha256.New()
+	hash.Write([]byte(topicExtractionPrompt(cfg.TopicTags)))
+	hash.Write([]byte("\x00" + cfg.TopicModel + "\x00"))
+	hash.Write([]byte(strings.Join(cfg.TopicTags, "\x00")))
+	return hex.EncodeToString(hash.Sum(nil))[:12]
 }
 
 // Extract ecommerce topics from content using LLM
-func extractTopics(client *openai.Client, content string) ([]string, error) {
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "gpt-4o-mini",
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role: openai.ChatMessageRoleSystem,
-					Content: `Phân tích nội dung và gán tag thương mại điện tử phù hợp từ danh sách sau:
-
-Danh sách tag có sẵn:
-["Áo", "Quần", "Giày", "Túi", "Mũ", "Khuyến mãi", "Giảm giá", "Freeship", "Combo"]
-
-Quy tắc gán tag:
-1. Chỉ sử dụng các tag trong danh sách trên
-2. Gán tag dựa trên nội dung thực tế của tin nhắn
-3. Một tin nhắn có thể có nhiều tag
-4. Nếu không có tag phù hợp thì trả về "không có tag"
-
-Trả về danh sách tag phân cách bằng dấu phẩy, không có dấu ngoặc kép.`,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: content,
-				},
+func extractTopics(ctx context.Context, client *openai.Client, content string) ([]string, error) {
+	extraction, err := extractTopicTags(ctx, client, content)
+	return extraction.Accepted, err
+}
+
+// Extract topics like extractTopics, also reporting the tags the model
+// returned outside cfg.TopicTags. Every extraction is recorded in topicTagStats.
+func extractTopicTags(ctx context.Context, client *openai.Client, content string) (TopicExtraction, error) {
+	request := openai.ChatCompletionRequest{
+		Model: cfg.TopicModel,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: topicExtractionPrompt(cfg.TopicTags),
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: content,
 			},
-			MaxTokens: 50,
-			Temperature: 0.1,
 		},
-	)
-	
+		MaxTokens:   50,
+		Temperature: 0.1,
+	}
+	resp, err := withOpenAIRetry(ctx, func(ctx context.Context) (openai.ChatCompletionResponse, error) {
+		return client.CreateChatCompletion(ctx, request)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to extract topics: %v", err)
+		return TopicExtraction{}, fmt.Errorf("failed to extract topics: %v", err)
 	}
-	
+
 	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from topic extraction")
+		return TopicExtraction{}, fmt.Errorf("no response from topic extraction")
 	}
-	
-	topicsText := resp.Choices[0].Message.Content
+
+	extraction := validateTopicTags(resp.Choices[0].Message.Content)
+	topicTagStats.record(extraction)
+	if len(extraction.Rejected) > 0 {
+		slog.Warn("Topic extraction returned tags outside the taxonomy", "rejected", extraction.Rejected, "raw", extraction.Raw)
+	}
+	return extraction, nil
+}
+
+// Parse a topic extraction response, keeping tags from cfg.TopicTags. Tags the
+// model invented are reported in Rejected.
+func validateTopicTags(topicsText string) TopicExtraction {
 	// Clean up and split topics
 	topicsText = strings.TrimSpace(topicsText)
 	topicsText = strings.Trim(topicsText, `"'`)
-	
+
 	// Check if no topics found
-	if strings.Contains(strings.ToLower(topicsText), "không có tag") || 
-	   strings.Contains(strings.ToLower(topicsText), "no tag") ||
-	   strings.TrimSpace(topicsText) == "" {
-		return []string{}, nil
+	if strings.Contains(strings.ToLower(topicsText), "không có tag") ||
+		strings.Contains(strings.ToLower(topicsText), "no tag") ||
+		strings.TrimSpace(topicsText) == "" {
+		return TopicExtraction{Accepted: []string{}}
 	}
-	
+
 	// Split by comma and clean each topic
 	topics := strings.Split(topicsText, ",")
 	var cleanedTopics []string
-	
-	// Predefined valid tags
-	validTags := []string{"Áo", "Quần", "Giày", "Túi", "Mũ", "Khuyến mãi", "Giảm giá", "Freeship", "Combo"}
-	
+	extraction := TopicExtraction{}
+
 	for _, topic := range topics {
-		topic = strings.TrimSpace(topic)
+		topic = normalizeTopicName(topic)
 		if topic != "" && topic != "không có tag" {
-			// Only include if it's a valid tag
-			for _, validTag := range validTags {
-				if strings.EqualFold(topic, validTag) {
+			extraction.Raw++
+			// Only include if it's a valid tag, under its taxonomy spelling
+			if validTag := taxonomyTag(topic); validTag != "" {
+				if !containsString(cleanedTopics, validTag) {
 					cleanedTopics = append(cleanedTopics, validTag)
-					break
 				}
+			} else {
+				extraction.Rejected = append(extraction.Rejected, topic)
 			}
 		}
 	}
-	
-	return cleanedTopics, nil
+
+	// Cap over-tagged responses, keeping the tags the model listed first
+	if limit := cfg.MaxTopicsPerMessage; limit > 0 && len(cleanedTopics) > limit {
+		slog.Warn("Topic extraction returned too many tags, keeping the first ones", "tags", len(cleanedTopics), "limit", limit)
+		cleanedTopics = cleanedTopics[:limit]
+	}
+
+	extraction.Accepted = cleanedTopics
+	return extraction
 }
 
-// Print a message node that would be added to the graph
-func printMessageNode(sender string, content string, client *openai.Client, userID string) {
-	// Get embedding from OpenAI
-	embedding, err := getEmbedding(client, content)
-	if err != nil {
-		log.Printf("Error getting embedding: %v", err)
-		embedding = []float64{} // Fallback to empty embedding
+// Report whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
-	
-	// Extract topics from content
-	topics, err := extractTopics(client, content)
-	if err != nil {
-		log.Printf("Error extracting topics: %v", err)
-		topics = []string{} // No fallback topic for errors
+	return false
+}
+
+// Embedding and topics of a message's content. A failed call leaves its
+// field empty and sets its error.
+type messageEnrichment struct {
+	Embedding    []float64
+	Topics       []string
+	Extraction   TopicExtraction
+	ContentType  string
+	EmbeddingErr error
+	TopicsErr    error
+}
+
+// Fetch the embedding and topics of content. The two OpenAI calls run
+// concurrently unless cfg.EmbeddingTemplate embeds {topics}, in which case
+// topics are extracted first.
+func fetchEnrichment(ctx context.Context, enricher MessageEnricher, content string) messageEnrichment {
+	result := messageEnrichment{Embedding: []float64{}, Topics: []string{}}
+
+	extract := func() {
+		extraction, err := extractTopicsWith(ctx, enricher, content)
+		if err != nil {
+			result.TopicsErr = err // No fallback topic for errors
+			return
+		}
+		result.Extraction = extraction
+		result.Topics = extraction.Accepted
+	}
+	embed := func(topics []string) {
+		// Describe JSON payloads and links before embedding them
+		input, contentType := messageEmbeddingText(ctx, content, topics)
+		result.ContentType = contentType
+		embedding, err := enricher.Embed(ctx, input)
+		if err != nil {
+			result.EmbeddingErr = err // Fallback to empty embedding
+			return
+		}
+		result.Embedding = embedding
+	}
+
+	if strings.Contains(cfg.EmbeddingTemplate, "{topics}") {
+		extract()
+		embed(result.Topics)
+		return result
 	}
-	
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		extract()
+	}()
+	embed(nil)
+	wg.Wait()
+	return result
+}
+
+// Fill in a message's embedding, topics and entities. Failures leave the
+// fields empty and flag the message for the enrichment retry queue.
+func enrichMessage(ctx context.Context, enricher MessageEnricher, message *Message) {
+	result := fetchEnrichment(ctx, enricher, message.Content)
+
+	if result.TopicsErr != nil {
+		slog.Error("Error extracting topics", "messageId", message.MessageID, "err", result.TopicsErr)
+		message.NeedsEnrichment = true
+	} else {
+		message.TopicPromptVersion = topicPromptVersion()
+		message.TopicTagsRaw = result.Extraction.Raw
+		message.TopicTagsRejected = len(result.Extraction.Rejected)
+	}
+	message.Topics = result.Topics
+
+	message.ContentType = result.ContentType
+	if result.EmbeddingErr != nil {
+		slog.Error("Error getting embedding", "messageId", message.MessageID, "err", result.EmbeddingErr)
+		message.NeedsEnrichment = true
+	} else {
+		message.EmbeddingModel = cfg.EmbeddingModel
+	}
+	message.Embedding = result.Embedding
+	if len(message.Embedding) > 0 {
+		embedMessageChunks(ctx, enricher, message)
+	}
+
+	// Extract named entities (order numbers, SKUs, prices) when enabled
+	if cfg.EntityExtraction {
+		message.Entities = extractEntities(message.Content)
+	}
+}
+
+// Record the model settings and usage of a chat completion. An unset
+// temperature is stored as the API default of 1.
+func newGenerationInfo(request openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) *GenerationInfo {
+	temperature := float64(request.Temperature)
+	if temperature == 0 {
+		temperature = 1
+	}
+	model := resp.Model
+	if model == "" {
+		model = request.Model
+	}
+	return &GenerationInfo{
+		Model:            model,
+		Temperature:      temperature,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+	}
+}
+
+// Hash identifying a message's sender and content, used to detect re-ingestion
+func contentHash(sender string, content string) string {
+	sum := sha256.Sum256([]byte(sender + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Enrich a message and store it with its similarity edges. Each OpenAI call
+// and the Neo4j write get their own cfg.RequestTimeout under parent. With
+// awaitReply, a human message is stored awaiting a reply until linkReply
+// clears the flag; only chat turns that generate a reply set it.
+// Returns the stored message, or the error that kept it from being stored.
+// Enrichment failures are not errors: the message is stored without an
+// embedding or topics and queued for retry. With cfg.DedupWindow set, a
+// repeat of a recent message returns that message instead. With
+// dryRunWrites the writes are printed and session is not used.
+func ingestMessage(parent context.Context, session neo4j.SessionWithContext, sender string, content string, enricher MessageEnricher, userID string, scope messageScope, generation *GenerationInfo, awaitReply bool) (Message, error) {
+	// Tag every OpenAI request made for this message with one correlation ID
+	correlation := generateID()
+	ctx := withCallSpacer(withCorrelationID(parent, correlation), interactiveCallSpacer)
+
+	// A repeat of a recent message is counted on it before any OpenAI call
+	if !dryRunWrites {
+		dedupCtx, cancelDedup := requestContext(ctx)
+		existing, found, err := foldRepeatedMessage(dedupCtx, session, userID, sender, content, scope, generation)
+		cancelDedup()
+		if err != nil {
+			if errors.Is(err, errTokenQuotaExceeded) || errors.Is(err, errNeo4jUnavailable) {
+				return Message{}, err
+			}
+			slog.Warn("Deduplication failed, storing the message", "userId", userID, "err", err)
+		} else if found {
+			slog.Info("Folded repeated message", "messageId", existing.MessageID, "userId", userID, "repeatCount", existing.RepeatCount)
+			return existing, nil
+		}
+	}
+
 	message := Message{
-		MessageID: generateID(),
-		Timestamp: time.Now().Unix(),
-		Sender:    sender,
-		Content:   content,
-		Embedding: embedding,
-		Topics:    topics,
-	}
-	
-	// Add to Neo4j and create similarity edges in one transaction
-	if err := addMessageAndCreateEdges(message, userID); err != nil {
-		log.Printf("Error adding message to Neo4j: %v", err)
-	}
-}
-
-// Add message and create similarity edges in a single transaction
-func addMessageAndCreateEdges(message Message, userID string) error {
-	session := neo4jDriver.NewSession(neo4j.SessionConfig{})
-	defer session.Close()
-	
-	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
+		MessageID:     generateID(),
+		Timestamp:     time.Now().Unix(),
+		Sender:        sender,
+		Content:       content,
+		ContentHash:   contentHash(sender, content),
+		CorrelationID: correlation,
+		Generation:    generation,
+		AwaitingReply: awaitReply && sender == "human",
+		ScrimID:       scope.ScrimID,
+		SessionID:     scope.SessionID,
+	}
+	enrichMessage(ctx, enricher, &message)
+	if dryRunWrites {
+		printDryRunWrite(message, userID)
+		return message, nil
+	}
+
+	// Add to Neo4j and create similarity edges in one transaction. The write
+	// outlives a shutdown so the message is not lost.
+	writeCtx, cancel := requestContext(context.WithoutCancel(ctx))
+	defer cancel()
+	existing, folded, err := storeMessage(writeCtx, session, message, userID, cfg.DedupWindow > 0)
+	if err != nil {
+		return Message{}, err
+	}
+	if folded {
+		slog.Info("Folded repeated message", "messageId", existing.MessageID, "userId", userID, "repeatCount", existing.RepeatCount)
+		return existing, nil
+	}
+	embedMessageTopics(ctx, session, enricher, message)
+	return message, nil
+}
+
+// Called after each ingested message with the time spent creating its
+// similarity edges and how many were created. Nil outside benchmarks.
+var similarityEdgeObserver func(elapsed time.Duration, created int)
+
+// Add message and create similarity edges in a single transaction on the
+// caller's session, bounded by ctx's deadline
+func addMessageAndCreateEdges(ctx context.Context, session neo4j.SessionWithContext, message Message, userID string) error {
+	_, _, err := storeMessage(ctx, session, message, userID, false)
+	return err
+}
+
+// Store a message like addMessageAndCreateEdges. With foldRepeats, a repeat
+// of the sender's latest message is folded into it instead (see
+// foldIntoLatest), and that message is returned with true.
+func storeMessage(ctx context.Context, session neo4j.SessionWithContext, message Message, userID string, foldRepeats bool) (Message, bool, error) {
+	unlock := userIngestLocks.Lock(userID)
+	defer unlock()
+	if err := ctx.Err(); err != nil {
+		return Message{}, false, fmt.Errorf("failed to add message and create edges: %w", neo4jError(ctx, err))
+	}
+	message.Topics = canonicalTopicNames(message.Topics)
+
+	var existing Message
+	var folded bool
+	work := func(tx neo4j.ManagedTransaction) (any, error) {
+		// A repeat that came in while this message was being enriched
+		if foldRepeats {
+			var err error
+			existing, folded, err = foldIntoLatest(ctx, tx, userID, message.Sender, message.Content, message.ScrimID, message.Generation)
+			if err != nil || folded {
+				return nil, err
+			}
+		}
+
+		// New input is refused once the user is over quota; replies to input
+		// already accepted are still stored
+		if message.Generation == nil {
+			if err := checkTokenQuota(ctx, tx, userID); err != nil {
+				return nil, err
+			}
+		}
+
 		// First, create the message node
-		createQuery := `
-			CREATE (m:Message {
-				messageId: $messageId,
-				userId: $userId,
-				timestamp: $timestamp,
-				sender: $sender,
-				content: $content,
-				embedding: $embedding,
-				topics: $topics
-			})
-			RETURN m
-		`
-		createParams := map[string]any{
-			"messageId": message.MessageID,
-			"userId":    userID,
-			"timestamp": message.Timestamp,
-			"sender":    message.Sender,
-			"content":   message.Content,
-			"embedding": message.Embedding,
-			"topics":    message.Topics,
-		}
-		
-		_, err := tx.Run(createQuery, createParams)
+		createQuery, createParams := messageNodeStatement(message, userID)
+		_, err := tx.Run(ctx, createQuery, createParams)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create message node: %v", err)
 		}
-		
-		// Link message to user
-		linkQuery := `
-			MATCH (u:User {userId: $userId})
-			MATCH (m:Message {messageId: $messageId})
-			CREATE (u)-[:OWNS]->(m)
-			RETURN u, m
-		`
-		linkParams := map[string]any{
-			"userId":    userID,
-			"messageId": message.MessageID,
+		if len(message.Chunks) > 0 {
+			if err := storeMessageChunks(ctx, tx, message.MessageID, message.Chunks); err != nil {
+				return nil, err
+			}
 		}
-		
-		_, err = tx.Run(linkQuery, linkParams)
+
+		// Link message to user
+		linkQuery, linkParams := messageOwnerStatement(message, userID)
+		_, err = tx.Run(ctx, linkQuery, linkParams)
 		if err != nil {
 			return nil, fmt.Errorf("failed to link message to user: %v", err)
 		}
-		
+		if message.ScrimID != "" {
+			if err := linkMessageScrim(ctx, tx, userID, message.MessageID, message.ScrimID); err != nil {
+				return nil, err
+			}
+		}
+		if message.SessionID != "" {
+			if err := linkSessionMessage(ctx, tx, message.SessionID, message.MessageID); err != nil {
+				return nil, err
+			}
+		}
+
 		// Update user's last active timestamp if it's a human message
 		if message.Sender == "human" {
 			updateQuery := `
@@ -272,151 +691,415 @@ func addMessageAndCreateEdges(message Message, userID string) error {
 				"userId":     userID,
 				"lastActive": time.Now().Unix(),
 			}
-			
-			_, err = tx.Run(updateQuery, updateParams)
+
+			_, err = tx.Run(ctx, updateQuery, updateParams)
 			if err != nil {
 				return nil, fmt.Errorf("failed to update user last active: %v", err)
 			}
 		}
-		
-		if len(message.Topics) > 0 {
-			fmt.Printf("📊 Added message node to Neo4j: %s (owned by user: %s, topics: %v)\n", message.MessageID, userID, message.Topics)
-		} else {
-			fmt.Printf("📊 Added message node to Neo4j: %s (owned by user: %s, no topics)\n", message.MessageID, userID)
-		}
-		
-		// Create topic nodes and link messages to them (only if topics exist)
-		for _, topicName := range message.Topics {
-			// Create or merge topic node
-			topicQuery := `
-				MERGE (t:Topic {name: $topicName})
-				ON CREATE SET t.topicId = $topicId, t.createdAt = $timestamp
-				RETURN t
-			`
-			topicParams := map[string]any{
-				"topicName": topicName,
-				"topicId":   generateID(),
-				"timestamp": time.Now().Unix(),
-			}
-			
-			_, err := tx.Run(topicQuery, topicParams)
-			if err != nil {
-				log.Printf("Failed to create topic node: %v", err)
-				continue
-			}
-			
-			// Link message to topic
-			linkTopicQuery := `
-				MATCH (m:Message {messageId: $messageId})
-				MATCH (t:Topic {name: $topicName})
-				MERGE (m)-[:BELONGS_TO]->(t)
-				RETURN m, t
-			`
-			linkTopicParams := map[string]any{
-				"messageId": message.MessageID,
-				"topicName": topicName,
+
+		// Count the reply's tokens against the user's quota
+		if message.Generation != nil && message.Generation.TotalTokens > 0 {
+			if err := recordTokenUsage(ctx, tx, userID, message.Generation.TotalTokens); err != nil {
+				return nil, err
 			}
-			
-			_, err = tx.Run(linkTopicQuery, linkTopicParams)
-			if err != nil {
-				log.Printf("Failed to link message to topic: %v", err)
+		}
+
+		slog.Info("Added message node", "messageId", message.MessageID, "userId", userID, "topics", message.Topics)
+
+		// Create topic nodes and link messages to them (only if topics exist).
+		// Batched ingestion has created the topic nodes already.
+		if topicsUpserted(ctx) {
+			if err := linkUpsertedTopics(ctx, tx, message.MessageID, message.Topics, message.TopicPromptVersion); err != nil {
+				slog.Error("Error linking topics", "messageId", message.MessageID, "err", err)
 			}
+		} else {
+			linkMessageTopics(ctx, tx, message.MessageID, message.Topics, message.TopicPromptVersion)
+		}
+
+		// Link message to its extracted entities
+		if err := linkMessageEntities(ctx, tx, message.MessageID, message.Entities); err != nil {
+			slog.Error("Failed to link message entities", "messageId", message.MessageID, "err", err)
 		}
-		
+
 		// Then, find similar messages and create edges
-		similarityQuery := `
-			MATCH (m1:Message {messageId: $messageId})
-			MATCH (m2:Message {userId: $userId})
-			WHERE m2.messageId <> $messageId
-			RETURN m2.messageId as messageId, m2.embedding as embedding, m2.content as content
+		edgesStart := time.Now()
+		edgesCreated, err := createSimilarityEdges(ctx, tx, message, userID)
+		if err != nil {
+			return nil, err
+		}
+		if similarityEdgeObserver != nil {
+			similarityEdgeObserver(time.Since(edgesStart), edgesCreated)
+		}
+
+		return nil, nil
+	}
+
+	_, err := session.ExecuteWrite(ctx, work, txTimeout(ctx))
+	if err != nil && ((cfg.VectorIndex && isVectorUnsupportedError(err)) || (cfg.ServerSideSimilarity && isFunctionUnsupportedError(err))) {
+		// The failed query marked its capability unavailable; retry with the scan
+		_, err = session.ExecuteWrite(ctx, work, txTimeout(ctx))
+	}
+	if err != nil {
+		return Message{}, false, fmt.Errorf("failed to add message and create edges: %w", neo4jError(ctx, err))
+	}
+
+	return existing, folded, nil
+}
+
+// Cypher and parameters creating the message node
+func messageNodeStatement(message Message, userID string) (string, map[string]any) {
+	query := `
+		CREATE (m:Message {
+			messageId: $messageId,
+			userId: $userId,
+			timestamp: $timestamp,
+			sender: $sender,
+			content: $content,
+			embedding: $embedding,
+			embeddingGz: $embeddingGz,
+			topics: $topics,
+			needsEnrichment: $needsEnrichment,
+			awaitingReply: $awaitingReply,
+			enrichmentAttempts: 0,
+			topicPromptVersion: $topicPromptVersion,
+			correlationId: $correlationId,
+			contentHash: $contentHash,
+			embeddingModel: $embeddingModel,
+			contentType: $contentType,
+			scrimId: $scrimId,
+			sessionId: $sessionId,
+			topicTagsRaw: $topicTagsRaw,
+			topicTagsRejected: $topicTagsRejected,
+			model: $model,
+			temperature: $temperature,
+			promptTokens: $promptTokens,
+			completionTokens: $completionTokens,
+			totalTokens: $totalTokens,
+			originalContent: $originalContent
+		})
+		RETURN m
+	`
+	plainEmbedding, compressedEmbedding := storedEmbedding(message.Embedding)
+	params := map[string]any{
+		"messageId":          message.MessageID,
+		"userId":             userID,
+		"timestamp":          message.Timestamp,
+		"sender":             message.Sender,
+		"content":            message.Content,
+		"embedding":          plainEmbedding,
+		"embeddingGz":        compressedEmbedding,
+		"topics":             message.Topics,
+		"needsEnrichment":    message.NeedsEnrichment,
+		"awaitingReply":      message.AwaitingReply,
+		"topicPromptVersion": message.TopicPromptVersion,
+		"correlationId":      message.CorrelationID,
+		"contentHash":        message.ContentHash,
+		"embeddingModel":     nil,
+		"contentType":        message.ContentType,
+		"scrimId":            scrimParam(message.ScrimID),
+		"sessionId":          nil,
+		"topicTagsRaw":       message.TopicTagsRaw,
+		"topicTagsRejected":  message.TopicTagsRejected,
+		"model":              nil,
+		"temperature":        nil,
+		"promptTokens":       nil,
+		"completionTokens":   nil,
+		"totalTokens":        nil,
+		"originalContent":    nil,
+	}
+	if g := message.Generation; g != nil {
+		params["model"] = g.Model
+		params["temperature"] = g.Temperature
+		params["promptTokens"] = g.PromptTokens
+		params["completionTokens"] = g.CompletionTokens
+		params["totalTokens"] = g.TotalTokens
+		if g.OriginalContent != "" {
+			params["originalContent"] = g.OriginalContent
+		}
+	}
+	if message.EmbeddingModel != "" {
+		params["embeddingModel"] = message.EmbeddingModel
+	}
+	if message.SessionID != "" {
+		params["sessionId"] = message.SessionID
+	}
+	return query, params
+}
+
+// Cypher and parameters linking the message to its user, setting its
+// expiry from the user's or the global retention
+func messageOwnerStatement(message Message, userID string) (string, map[string]any) {
+	query := `
+		MATCH (u:User {userId: $userId})
+		MATCH (m:Message {messageId: $messageId})
+		CREATE (u)-[:OWNS]->(m)
+		WITH u, m, coalesce(u.retentionSeconds, $retentionSeconds) AS retention
+		SET m.expiresAt = CASE WHEN retention > 0 THEN m.timestamp + retention END
+		RETURN u, m
+	`
+	params := map[string]any{
+		"userId":           userID,
+		"messageId":        message.MessageID,
+		"retentionSeconds": int64(cfg.MessageRetention.Seconds()),
+	}
+	return query, params
+}
+
+// Create or merge topic nodes and link the message to them via BELONGS_TO
+func linkMessageTopics(ctx context.Context, tx neo4j.ManagedTransaction, messageID string, topics []string, promptVersion string) {
+	for _, topicName := range topics {
+		// Create or merge topic node
+		topicQuery := `
+			MERGE (t:Topic {name: $topicName})
+			ON CREATE SET t.topicId = $topicId, t.createdAt = $timestamp
+			RETURN t
 		`
-		similarityParams := map[string]any{
-			"messageId": message.MessageID,
-			"userId":    userID,
-		}
-		
-		result, err := tx.Run(similarityQuery, similarityParams)
-		if err != nil {
-			return nil, fmt.Errorf("failed to query existing messages: %v", err)
-		}
-		
-		edgesCreated := 0
-		totalMessages := 0
-		
-		for result.Next() {
-			totalMessages++
-			record := result.Record()
-			existingMessageId := record.Values[0].(string)
-			existingEmbedding := record.Values[1].([]interface{})
-			
-			// Convert interface{} to []float64
-			embedding := make([]float64, len(existingEmbedding))
-			for i, v := range existingEmbedding {
-				embedding[i] = v.(float64)
+		topicParams := map[string]any{
+			"topicName": topicName,
+			"topicId":   generateID(),
+			"timestamp": time.Now().Unix(),
+		}
+
+		_, err := tx.Run(ctx, topicQuery, topicParams)
+		if err != nil {
+			slog.Error("Failed to create topic node", "topic", topicName, "err", err)
+			continue
+		}
+
+		// Link message to topic
+		linkTopicQuery := `
+			MATCH (m:Message {messageId: $messageId})
+			MATCH (t:Topic {name: $topicName})
+			MERGE (m)-[r:BELONGS_TO]->(t)
+			SET r.topicPromptVersion = $promptVersion
+			RETURN m, t
+		`
+		linkTopicParams := map[string]any{
+			"messageId":     messageID,
+			"topicName":     topicName,
+			"promptVersion": promptVersion,
+		}
+
+		_, err = tx.Run(ctx, linkTopicQuery, linkTopicParams)
+		if err != nil {
+			slog.Error("Failed to link message to topic", "messageId", messageID, "topic", topicName, "err", err)
+		}
+	}
+}
+
+// Build the candidate query for similarity edges, honoring the configured
+// time window and candidate limit (most recent messages first)
+func similarityCandidatesQuery(message Message, userID string) (string, map[string]any) {
+	if useVectorIndex(message) {
+		return vectorCandidatesQuery(message, userID)
+	}
+	if useServerSimilarity(message) {
+		return serverSimilarityCandidatesQuery(message, userID, serverCosineExpression())
+	}
+
+	query := `
+		MATCH (m2:Message {userId: $userId})
+		WHERE m2.messageId <> $messageId AND m2.timestamp >= $since
+			AND ($scrimId IS NULL OR m2.scrimId = $scrimId)
+		RETURN m2.messageId as messageId, m2.embedding as embedding, m2.content as content, m2.sender as sender, m2.embeddingGz as embeddingGz, m2.topics as topics, [(m2)-[:HAS_CHUNK]->(c:Chunk) | c.embedding] as chunks
+		ORDER BY m2.timestamp DESC, m2.messageId
+	`
+	params := map[string]any{
+		"messageId": message.MessageID,
+		"userId":    userID,
+		"since":     int64(0),
+		"scrimId":   scrimParam(message.ScrimID),
+	}
+
+	if cfg.SimilarityWindow > 0 {
+		params["since"] = time.Now().Add(-cfg.SimilarityWindow).Unix()
+	}
+	if cfg.SimilarityCandidateLimit > 0 {
+		query += "LIMIT $limit\n"
+		params["limit"] = cfg.SimilarityCandidateLimit
+	}
+
+	return query, params
+}
+
+// Report whether candidates for this message should come from the vector
+// index rather than scanning the user's messages
+func useVectorIndex(message Message) bool {
+	return cfg.VectorIndex && !cfg.CompressEmbeddings && len(message.Embedding) > 0 && vectorIndexAvailable()
+}
+
+// Candidate query using the native vector index: the nearest
+// cfg.VectorIndexK messages of any user, filtered to this user. Returns the
+// same columns as the scan query so the exact cosine is recomputed in Go.
+func vectorCandidatesQuery(message Message, userID string) (string, map[string]any) {
+	query := `
+		CALL db.index.vector.queryNodes($indexName, $k, $embedding) YIELD node AS m2, score
+		WHERE m2.userId = $userId AND m2.messageId <> $messageId AND m2.timestamp >= $since
+			AND ($scrimId IS NULL OR m2.scrimId = $scrimId)
+		RETURN m2.messageId as messageId, m2.embedding as embedding, m2.content as content, m2.sender as sender, m2.embeddingGz as embeddingGz, m2.topics as topics, [(m2)-[:HAS_CHUNK]->(c:Chunk) | c.embedding] as chunks
+		ORDER BY score DESC, m2.timestamp DESC, m2.messageId
+	`
+	params := map[string]any{
+		"indexName": messageVectorIndex,
+		"k":         cfg.VectorIndexK,
+		"embedding": message.Embedding,
+		"messageId": message.MessageID,
+		"userId":    userID,
+		"since":     int64(0),
+		"scrimId":   scrimParam(message.ScrimID),
+	}
+	if cfg.SimilarityWindow > 0 {
+		params["since"] = time.Now().Add(-cfg.SimilarityWindow).Unix()
+	}
+	return query, params
+}
+
+// Default cutoff for creating CONTEXTUAL_LINK edges, see cfg.SimilarityThreshold
+const defaultSimilarityThreshold = 0.5
+
+// Key identifying an unordered pair of senders, e.g. "ai-human"
+func senderPairKey(a, b string) string {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	if a > b {
+		a, b = b, a
+	}
+	return a + "-" + b
+}
+
+// Similarity threshold for linking messages from the two senders, falling
+// back to the global threshold for pairs without a configured value
+func similarityThresholdFor(senderA, senderB string) float64 {
+	if threshold, ok := cfg.SenderPairThresholds[senderPairKey(senderA, senderB)]; ok {
+		return threshold
+	}
+	return cfg.SimilarityThreshold
+}
+
+// Find similar messages of the same user and create CONTEXTUAL_LINK edges to them
+// Candidates without an embedding, or with one of a different dimension
+// than the message's, are skipped with a warning rather than compared as 0.
+func createSimilarityEdges(ctx context.Context, tx neo4j.ManagedTransaction, message Message, userID string) (int, error) {
+	// Messages stored without an embedding are linked once re-enriched
+	if len(message.Embedding) == 0 {
+		return 0, nil
+	}
+
+	similarityQuery, similarityParams := similarityCandidatesQuery(message, userID)
+
+	result, err := tx.Run(ctx, similarityQuery, similarityParams)
+	if err != nil {
+		if useVectorIndex(message) && isVectorUnsupportedError(err) {
+			markVectorIndexUnavailable(err)
+		} else if useServerSimilarity(message) && isFunctionUnsupportedError(err) {
+			markServerSimilarityUnavailable(err)
+		}
+		return 0, fmt.Errorf("failed to query existing messages: %v", err)
+	}
+
+	edgesCreated := 0
+	totalMessages := 0
+	skippedEmpty, skippedDimension := 0, 0
+
+	for result.Next(ctx) {
+		totalMessages++
+		record := result.Record()
+		existingMessageId, ok := record.Values[0].(string)
+		if !ok {
+			continue
+		}
+		// Never link a message to itself, e.g. when deduplication resolved it
+		// to an existing node that the candidate query still returns
+		if existingMessageId == message.MessageID {
+			continue
+		}
+		existingSender, _ := record.Values[3].(string)
+
+		// A malformed candidate embedding skips that candidate, not the message
+		existingEmbedding, err := parseStoredEmbedding(record.Values[1], record.Values[4])
+		if err != nil {
+			slog.Warn("Skipping similarity candidate", "messageId", message.MessageID, "candidateId", existingMessageId, "err", err)
+			continue
+		}
+		if len(existingEmbedding) == 0 {
+			skippedEmpty++
+			continue
+		}
+		if len(existingEmbedding) != len(message.Embedding) {
+			skippedDimension++
+			continue
+		}
+		existing := Message{
+			Embedding: existingEmbedding,
+			Topics:    toStringSlice(record.Values[5]),
+		}
+		for _, chunkEmbedding := range chunkEmbeddingsFromValue(existingMessageId, record.Values[6]) {
+			existing.Chunks = append(existing.Chunks, Chunk{Embedding: chunkEmbedding})
+		}
+
+		// Calculate similarity, boosted when the messages share a topic
+		similarity := messageSimilarity(message, existing)
+
+		// Create edge if similarity exceeds the threshold for this sender pair
+		if similarity > similarityThresholdFor(message.Sender, existingSender) {
+			// Create the edge in the same transaction
+			edgeQuery := `
+				MATCH (m1:Message {messageId: $messageId1})
+				MATCH (m2:Message {messageId: $messageId2})
+				WHERE m1 <> m2 AND ($linkDuplicates OR m1.contentHash IS NULL OR m1.contentHash <> m2.contentHash)
+				MERGE (m1)-[r:CONTEXTUAL_LINK]-(m2)
+				ON CREATE SET r.similarity = $similarity, r.timestamp = $timestamp
+			`
+			edgeParams := map[string]any{
+				"messageId1":     message.MessageID,
+				"messageId2":     existingMessageId,
+				"similarity":     similarity,
+				"timestamp":      time.Now().Unix(),
+				"linkDuplicates": cfg.LinkDuplicates,
 			}
-			
-			// Calculate similarity
-			similarity := cosineSimilarity(message.Embedding, embedding)
-
-			// Create edge if similarity > 0.5
-			if similarity > 0.5 {
-				// Create the edge in the same transaction
-				edgeQuery := `
-					MATCH (m1:Message {messageId: $messageId1})
-					MATCH (m2:Message {messageId: $messageId2})
-					MERGE (m1)-[r:CONTEXTUAL_LINK {similarity: $similarity, timestamp: $timestamp}]-(m2)
-					RETURN r
-				`
-				edgeParams := map[string]any{
-					"messageId1": message.MessageID,
-					"messageId2": existingMessageId,
-					"similarity": similarity,
-					"timestamp":  time.Now().Unix(),
-				}
-				
-				_, err := tx.Run(edgeQuery, edgeParams)
-				if err != nil {
-					log.Printf("Failed to create edge: %v", err)
-				} else {
-					edgesCreated++
+
+			edgeResult, err := tx.Run(ctx, edgeQuery, edgeParams)
+			if err == nil {
+				var summary neo4j.ResultSummary
+				summary, err = edgeResult.Consume(ctx)
+				if err == nil {
+					// Pairs that are already linked are left untouched
+					if created := summary.Counters().RelationshipsCreated(); created > 0 {
+						edgesCreated += created
+						slog.Debug("Created similarity edge", "messageId", message.MessageID, "candidateId", existingMessageId, "similarity", similarity)
+					}
 				}
 			}
+			if err != nil {
+				slog.Error("Failed to create edge", "messageId", message.MessageID, "candidateId", existingMessageId, "similarity", similarity, "err", err)
+			}
 		}
-		
-		if edgesCreated > 0 {
-			fmt.Printf("🔗 Created %d similarity edges for message: %s\n", edgesCreated, message.MessageID)
-		}
-		
-		return result.Consume()
-	})
-	
-	if err != nil {
-		return fmt.Errorf("failed to add message and create edges: %v", err)
 	}
-	
-	return nil
+
+	if edgesCreated > 0 {
+		slog.Info("Created similarity edges", "messageId", message.MessageID, "userId", userID, "edges", edgesCreated)
+	}
+	if skippedEmpty > 0 || skippedDimension > 0 {
+		slog.Warn("Skipped similarity candidates without a comparable embedding", "messageId", message.MessageID, "missing", skippedEmpty, "otherDimension", skippedDimension, "dimensions", len(message.Embedding))
+	}
+
+	if _, err := result.Consume(ctx); err != nil {
+		return edgesCreated, fmt.Errorf("failed to consume similarity query: %v", err)
+	}
+	return edgesCreated, nil
 }
 
-// Create a new user node
-func createUser(name string) (string, error) {
+// Create a new user node on the caller's session, bounded by ctx's deadline
+func createUser(ctx context.Context, session neo4j.SessionWithContext, name string) (string, error) {
 	user := User{
-		UserID:     generateID(),
-		Name:       name,
-		CreatedAt:  time.Now().Unix(),
-		LastActive: time.Now().Unix(),
-		Preferences: UserPreferences{
-			Language:        "en",
-			Tone:            "friendly",
-			AddressingStyle: "you",
-		},
+		UserID:      generateID(),
+		Name:        name,
+		CreatedAt:   time.Now().Unix(),
+		LastActive:  time.Now().Unix(),
+		Preferences: defaultUserPreferences,
 	}
-	
-	fmt.Printf("🔄 Attempting to create user with ID: %s\n", user.UserID)
-	
-	session := neo4jDriver.NewSession(neo4j.SessionConfig{})
-	defer session.Close()
-	
-	_, err := session.WriteTransaction(func(tx neo4j.Transaction) (any, error) {
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
 		query := `
 			CREATE (u:User {
 				userId: $userId,
@@ -438,120 +1121,634 @@ func createUser(name string) (string, error) {
 			"tone":            user.Preferences.Tone,
 			"addressingStyle": user.Preferences.AddressingStyle,
 		}
-		
-		fmt.Printf("🔄 Running Neo4j query with params: %+v\n", params)
-		
-		result, err := tx.Run(query, params)
+
+		slog.Debug("Creating user", "userId", user.UserID, "params", params)
+
+		result, err := tx.Run(ctx, query, params)
 		if err != nil {
-			fmt.Printf("❌ Neo4j query failed: %v\n", err)
 			return nil, err
 		}
-		
-		fmt.Printf("✅ Neo4j query executed successfully\n")
-		return result.Consume()
-	})
-	
+		return result.Consume(ctx)
+	}, txTimeout(ctx))
+
 	if err != nil {
-		return "", fmt.Errorf("failed to create user: %v", err)
+		return "", fmt.Errorf("failed to create user: %w", neo4jError(ctx, err))
 	}
-	
-	fmt.Printf("👤 Created new user: %s (ID: %s)\n", user.Name, user.UserID)
+
+	slog.Info("Created user", "userId", user.UserID, "name", user.Name)
 	return user.UserID, nil
 }
 
+// Similarity of two messages (chunkedSimilarity of their embeddings and
+// chunks) multiplied by cfg.TopicOverlapBoost when they share at least one
+// topic. The default factor of 1 is pure cosine.
+func messageSimilarity(a Message, b Message) float64 {
+	similarity := chunkedSimilarity(a.Embedding, chunkEmbeddings(a.Chunks), b.Embedding, chunkEmbeddings(b.Chunks))
+	if cfg.TopicOverlapBoost == 1 {
+		return similarity
+	}
+	for _, topic := range a.Topics {
+		if containsString(b.Topics, topic) {
+			return similarity * cfg.TopicOverlapBoost
+		}
+	}
+	return similarity
+}
+
+// Report whether the chat cannot go on after err: with Neo4j down nothing
+// more can be stored. Other failures, such as a failed embedding, only
+// affect the current turn.
+func endsChat(err error) bool {
+	return errors.Is(err, errNeo4jUnavailable)
+}
+
 // Calculate cosine similarity between two embeddings
 func cosineSimilarity(a, b []float64) float64 {
 	if len(a) != len(b) || len(a) == 0 {
 		return 0.0
 	}
-	
+
 	var dotProduct, normA, normB float64
 	for i := 0; i < len(a); i++ {
 		dotProduct += a[i] * b[i]
 		normA += a[i] * a[i]
 		normB += b[i] * b[i]
 	}
-	
+
 	if normA == 0 || normB == 0 {
 		return 0.0
 	}
-	
+
 	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
 }
 
 func main() {
+	existingUser := flag.String("user", "", "chat as the existing user with this ID")
+	newUser := flag.String("new-user", "", "create a user with this name and chat as them")
+	userName := flag.String("user-name", "", "chat as the user with this name, creating them if none exists (default $USER_NAME)")
+	processRetry := flag.Bool("process-retry-queue", false, "retry enrichment of messages stored without embedding or topics, then exit")
+	backfill := flag.Bool("backfill-topics", false, "re-extract topics for messages tagged under an older topic prompt, then exit")
+	backfillVersion := flag.String("topic-prompt-version", "", "with --backfill-topics, only re-extract messages tagged under this prompt version")
+	reclassify := flag.Bool("reclassify", false, "with --user, re-extract topics for all of that user's messages under the current taxonomy, then exit")
+	dryRun := flag.Bool("dry-run", false, "print the graph writes chat input would make instead of chatting, without Neo4j; with --reclassify, only print the topic changes")
+	dryRunSkipEmbedding := flag.Bool("dry-run-skip-embedding", false, "with --dry-run, use a zero embedding instead of requesting one")
+	dryRunSkipTopics := flag.Bool("dry-run-skip-topics", false, "with --dry-run, store no topics instead of extracting them")
+	pageRank := flag.Bool("pagerank", false, "with --user, compute and store PageRank over that user's similarity graph, then exit")
+	summarize := flag.String("summarize-topic", "", "with --user, print a summary of that user's messages about this topic, then exit")
+	retryReplies := flag.Bool("retry-replies", false, "with --user, generate replies for messages left unanswered by a failed chat completion, then exit")
+	autoTopics := flag.Bool("auto-topics", false, "with --user, propose new topics for clusters of similar untagged messages, then exit")
+	auditEmbeddings := flag.String("audit-embeddings", "", "report the embedding models and dimensions used by this user ID's messages, then exit")
+	validateDims := flag.Bool("validate-embeddings", false, "report messages whose embedding length differs from EMBEDDING_DIMENSIONS, then exit")
+	reembed := flag.Bool("reembed", false, "with --validate-embeddings, queue mismatched messages for re-embedding by the retry queue")
+	scrim := flag.String("scrim", "", "post this chat's messages to the scrim with this ID, joining it as a participant")
+	newScrim := flag.String("create-scrim", "", "create a scrim with this name and print its ID, then exit")
+	listScrim := flag.String("scrim-messages", "", "list the messages posted to the scrim with this ID, then exit")
+	stream := flag.Bool("stream", stdoutIsTerminal(), "print chat replies as they are generated (default when stdout is a terminal)")
+	explainLinkIDs := flag.String("explain-link", "", "explain why the two comma-separated message IDs are or are not linked, then exit")
+	embedTopics := flag.Bool("embed-topics", false, "embed every topic without an embedding and link similar topics, then exit")
+	similarTopicsOf := flag.String("similar-topics", "", "list the topics whose name embeddings are most similar to this topic, then exit")
+	topicNeighbors := flag.String("topic-neighbors", "", "list this message ID's topics with the topics they most often co-occur with, then exit")
+	similarityMatrix := flag.String("similarity-matrix", "", "write the pairwise similarity matrix CSV for this user ID to stdout, then exit")
+	recomputeActive := flag.String("recompute-last-active", "", "recompute lastActive from message history for this user ID (or \"all\"), then exit")
+	replayPath := flag.String("replay", "", "ingest messages from this JSONL file ({userId, sender, content, timestamp} per line), then exit")
+	replayUser := flag.String("replay-user", "", "with --replay, user ID for lines without a userId")
+	resume := flag.Bool("resume", false, "with --replay, continue after the last checkpointed line")
+	reconcile := flag.Bool("reconcile-edges", false, "create missing similarity edges for recently added messages, then exit")
+	mergeUser := flag.String("merge-user", "", "merge the user with this ID into the --into user, then exit")
+	mergeInto := flag.String("into", "", "with --merge-user, ID of the user to keep")
+	mergePolicy := flag.String("prefs-policy", string(PreferencesKeep), "with --merge-user, how to resolve preferences: keep, newest or fill")
+	expire := flag.Bool("expire-messages", false, "delete messages past their expiresAt, then exit")
+	setRetention := flag.String("set-retention", "", "with --user, set that user's message retention (e.g. 30d, 0 to use the global setting), then exit")
+	exportPath := flag.String("export-archive", "", "with --user, write that user's data to this zip archive, then exit")
+	importPath := flag.String("import-archive", "", "recreate a user from a zip archive written by --export-archive, then exit")
+	inactiveSince := flag.String("inactive-since", "", "list users inactive for longer than this duration (e.g. 30d), then exit")
+	serve := flag.String("serve", "", "serve the HTTP API on this address (e.g. :8080) instead of chatting")
+	logJSON := flag.Bool("log-json", false, "write log records to stderr as JSON lines instead of console text")
+	flag.Parse()
+
 	_ = godotenv.Load()
+	var err error
+	cfg, err = loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	setupLogging(cfg.LogLevel, *logJSON)
 
-	apiKey := os.Getenv("OPENAI_API_KEY")
+	// Subcommands such as "tail" run instead of the chat
+	if flag.NArg() > 0 {
+		if err := runSubcommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatalf("%s: %v", flag.Arg(0), err)
+		}
+		return
+	}
+
+	// A dry run needs no Neo4j, and no OpenAI key when both enrichment
+	// steps are skipped
+	if *dryRun && !*reclassify {
+		if cfg.OpenAIAPIKey == "" && !(*dryRunSkipEmbedding && *dryRunSkipTopics) {
+			log.Fatal("--dry-run requires OPENAI_API_KEY unless --dry-run-skip-embedding and --dry-run-skip-topics are set")
+		}
+		userID := *existingUser
+		if userID == "" {
+			userID = dryRunUserID
+		}
+		enricher := dryRunEnricher{
+			next:          newOpenAIEnricher(newOpenAIClient(cfg.OpenAIAPIKey)),
+			skipEmbedding: *dryRunSkipEmbedding,
+			skipTopics:    *dryRunSkipTopics,
+		}
+		if err := runDryRunChat(context.Background(), enricher, userID, messageScope{ScrimID: *scrim}); err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		return
+	}
+
+	apiKey := cfg.OpenAIAPIKey
 	if apiKey == "" {
-		log.Fatal("Error: OPENAI_API_KEY environment variable not set.")
+		log.Fatal("Error: OPENAI_API_KEY (or OPENAI_API_KEY_FILE) environment variable not set.")
 	}
 
 	// Initialize Neo4j
 	if err := initNeo4j(); err != nil {
 		log.Fatalf("Failed to initialize Neo4j: %v", err)
 	}
-	defer neo4jDriver.Close()
+	defer neo4jDriver.Close(context.Background())
+	slog.Info("Similarity threshold", "similarity", cfg.SimilarityThreshold)
+
+	if err := initSchema(context.Background(), neo4jDriver); err != nil {
+		slog.Error("Failed to initialize schema", "err", err)
+	}
+	if cfg.VectorIndex && !cfg.CompressEmbeddings {
+		if err := ensureVectorIndex(); err != nil {
+			slog.Error("Failed to create vector index", "err", err)
+		}
+	}
+
+	if *auditEmbeddings != "" {
+		audit, err := embeddingModelAudit(context.Background(), *auditEmbeddings)
+		if errors.Is(err, errNoMessages) {
+			fmt.Println(noMessagesText)
+			return
+		}
+		if err != nil {
+			log.Fatalf("Failed to audit embeddings: %v", err)
+		}
+		printEmbeddingAudit(*auditEmbeddings, audit)
+		return
+	}
+
+	if *validateDims {
+		report, err := validateEmbeddingDimensions(context.Background(), *reembed)
+		if err != nil {
+			log.Fatalf("Failed to validate embeddings: %v", err)
+		}
+		printEmbeddingDimensionReport(report)
+		return
+	}
+
+	if *newScrim != "" {
+		session := neo4jDriver.NewSession(context.Background(), neo4j.SessionConfig{})
+		_, err := createScrim(context.Background(), session, *newScrim)
+		session.Close(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to create scrim: %v", err)
+		}
+		return
+	}
+
+	if *listScrim != "" {
+		messages, err := scrimMessages(context.Background(), *listScrim)
+		if err != nil {
+			log.Fatalf("Failed to list scrim messages: %v", err)
+		}
+		printScrimMessages(*listScrim, messages)
+		return
+	}
+
+	if *explainLinkIDs != "" {
+		ids := strings.Split(*explainLinkIDs, ",")
+		if len(ids) != 2 {
+			log.Fatalf("--explain-link wants two message IDs separated by a comma")
+		}
+		explanation, err := explainLink(context.Background(), strings.TrimSpace(ids[0]), strings.TrimSpace(ids[1]))
+		if err != nil {
+			log.Fatalf("Failed to explain link: %v", err)
+		}
+		printLinkExplanation(explanation)
+		return
+	}
+
+	if *similarTopicsOf != "" {
+		topics, err := similarTopics(context.Background(), *similarTopicsOf, topicNeighborLimit)
+		if err != nil {
+			log.Fatalf("Failed to list similar topics: %v", err)
+		}
+		printSimilarTopics(*similarTopicsOf, topics)
+		return
+	}
 
-	client := openai.NewClient(apiKey)
+	if *topicNeighbors != "" {
+		topics, err := messageTopicNeighbors(context.Background(), *topicNeighbors)
+		if err != nil {
+			log.Fatalf("Failed to list topic neighbors: %v", err)
+		}
+		printMessageTopicNeighbors(*topicNeighbors, topics)
+		return
+	}
 
-	// Create a new user for the conversation
-	fmt.Println("🔄 Creating new user...")
-	userID, err := createUser("Shiny")
+	if *similarityMatrix != "" {
+		if err := exportSimilarityMatrix(context.Background(), *similarityMatrix, os.Stdout); err != nil {
+			log.Fatalf("Failed to export similarity matrix: %v", err)
+		}
+		return
+	}
+
+	if *recomputeActive != "" {
+		var err error
+		if *recomputeActive == "all" {
+			err = recomputeAllLastActive(context.Background())
+		} else {
+			_, err = recomputeLastActive(context.Background(), *recomputeActive)
+		}
+		if err != nil {
+			log.Fatalf("Failed to recompute last active: %v", err)
+		}
+		return
+	}
+
+	if *pageRank {
+		if *existingUser == "" {
+			log.Fatal("--pagerank requires --user <userId>")
+		}
+		_, err := rankUserMessages(context.Background(), *existingUser)
+		if errors.Is(err, errGraphTooSmall) {
+			fmt.Printf("Not enough messages and edges to rank (need at least %d messages)\n", minPageRankMessages)
+			return
+		}
+		if err != nil {
+			log.Fatalf("Failed to compute PageRank: %v", err)
+		}
+		printTopRankedMessages(context.Background(), *existingUser)
+		return
+	}
+
+	if *expire {
+		if _, err := expireOldMessages(context.Background()); err != nil {
+			log.Fatalf("Failed to expire messages: %v", err)
+		}
+		return
+	}
+
+	if *setRetention != "" {
+		retention, err := parseDayDuration(*setRetention)
+		if err != nil {
+			log.Fatalf("Invalid --set-retention: %v", err)
+		}
+		if *existingUser == "" {
+			log.Fatal("--set-retention requires --user <userId>")
+		}
+		if err := setUserRetention(context.Background(), *existingUser, retention); err != nil {
+			log.Fatalf("Failed to set retention: %v", err)
+		}
+		return
+	}
+
+	if *exportPath != "" {
+		if *existingUser == "" {
+			log.Fatal("--export-archive requires --user <userId>")
+		}
+		file, err := os.Create(*exportPath)
+		if err != nil {
+			log.Fatalf("Failed to create archive: %v", err)
+		}
+		if err := exportArchive(context.Background(), *existingUser, file); err != nil {
+			file.Close()
+			log.Fatalf("Failed to export archive: %v", err)
+		}
+		if err := file.Close(); err != nil {
+			log.Fatalf("Failed to write archive: %v", err)
+		}
+		return
+	}
+
+	if *importPath != "" {
+		file, err := os.Open(*importPath)
+		if err != nil {
+			log.Fatalf("Failed to open archive: %v", err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			log.Fatalf("Failed to open archive: %v", err)
+		}
+		_, batch, err := importArchive(context.Background(), file, info.Size())
+		if err == nil {
+			err = batch.Err()
+		}
+		if err != nil {
+			log.Fatalf("Failed to import archive: %v", err)
+		}
+		return
+	}
+
+	if *mergeUser != "" {
+		policy, err := parsePreferenceMergePolicy(*mergePolicy)
+		if err != nil {
+			log.Fatalf("Invalid --prefs-policy: %v", err)
+		}
+		if *mergeInto == "" {
+			log.Fatal("--merge-user requires --into <userId>")
+		}
+		if err := mergeUsers(context.Background(), *mergeInto, *mergeUser, policy); err != nil {
+			log.Fatalf("Failed to merge users: %v", err)
+		}
+		return
+	}
+
+	if *inactiveSince != "" {
+		since, err := parseDayDuration(*inactiveSince)
+		if err != nil {
+			log.Fatalf("Invalid --inactive-since: %v", err)
+		}
+		if err := printInactiveUsers(context.Background(), since); err != nil {
+			log.Fatalf("Failed to list inactive users: %v", err)
+		}
+		return
+	}
+
+	client := newOpenAIClient(apiKey)
+	if err := registerConfiguredPostProcessors(); err != nil {
+		log.Fatalf("Invalid response post-processing config: %v", err)
+	}
+
+	if *reclassify {
+		if *existingUser == "" {
+			log.Fatal("--reclassify requires --user <userId>")
+		}
+		if _, err := reclassifyAll(context.Background(), client, *existingUser, *dryRun); err != nil {
+			log.Fatalf("Failed to reclassify messages: %v", err)
+		}
+		return
+	}
+
+	if *summarize != "" {
+		if *existingUser == "" {
+			log.Fatal("--summarize-topic requires --user <userId>")
+		}
+		summary, err := summarizeTopic(context.Background(), client, *existingUser, *summarize)
+		if err != nil {
+			log.Fatalf("Failed to summarize topic: %v", err)
+		}
+		fmt.Println(summary)
+		return
+	}
+
+	if *retryReplies {
+		if *existingUser == "" {
+			log.Fatal("--retry-replies requires --user <userId>")
+		}
+		batch, err := answerAwaitingReplies(context.Background(), client, *existingUser)
+		if err == nil {
+			err = batch.Err()
+		}
+		if err != nil {
+			log.Fatalf("Failed to retry replies: %v", err)
+		}
+		return
+	}
+
+	if *autoTopics {
+		if *existingUser == "" {
+			log.Fatal("--auto-topics requires --user <userId>")
+		}
+		if _, err := proposeAutoTopics(context.Background(), client, *existingUser); err != nil {
+			log.Fatalf("Failed to propose auto-topics: %v", err)
+		}
+		return
+	}
+
+	if *backfill {
+		if _, err := backfillTopics(context.Background(), client, *backfillVersion); err != nil {
+			log.Fatalf("Failed to backfill topics: %v", err)
+		}
+		return
+	}
+
+	if *replayPath != "" {
+		batch, err := replayFile(context.Background(), client, *replayPath, *replayUser, *resume)
+		if err == nil {
+			err = batch.Err()
+		}
+		if err != nil {
+			log.Fatalf("Replay failed: %v", err)
+		}
+		return
+	}
+
+	if *reconcile {
+		if _, err := reconcileEdges(context.Background()); err != nil {
+			log.Fatalf("Failed to reconcile edges: %v", err)
+		}
+		return
+	}
+
+	if *processRetry {
+		if _, err := processRetryQueue(context.Background(), newOpenAIEnricher(client)); err != nil {
+			log.Fatalf("Failed to process retry queue: %v", err)
+		}
+		return
+	}
+
+	if *embedTopics {
+		topicSession := neo4jDriver.NewSession(context.Background(), neo4j.SessionConfig{})
+		defer topicSession.Close(context.Background())
+		embedded, err := embedNewTopics(context.Background(), topicSession, newOpenAIEnricher(client), nil)
+		if err != nil {
+			log.Fatalf("Failed to embed topics: %v", err)
+		}
+		if embedded == 0 {
+			fmt.Println("✅ Every topic already has an embedding")
+		}
+		return
+	}
+
+	// Root context of the chat or HTTP API and its background workers,
+	// cancelled on exit
+	rootCtx, stopRoot := context.WithCancel(context.Background())
+	defer stopRoot()
+	handleShutdownSignals(stopRoot)
+	startEdgeReconciler(rootCtx)
+	startExpirySweeper(rootCtx)
+	startTopicEmbeddingWarmer(rootCtx, client)
+
+	if *serve != "" {
+		if err := serveAPI(rootCtx, *serve, newOpenAIEnricher(client)); err != nil {
+			log.Fatalf("HTTP API failed: %v", err)
+		}
+		return
+	}
+
+	// One Neo4j session for the whole conversation, closed on exit
+	session := neo4jDriver.NewSession(context.Background(), neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	// Pick the user for the conversation
+	userCtx, cancelUser := requestContext(rootCtx)
+	if *userName == "" && *existingUser == "" && *newUser == "" {
+		*userName = cfg.UserName
+	}
+	userID, err := resolveChatUser(userCtx, session, *existingUser, *newUser, *userName)
+	cancelUser()
+	if err != nil {
+		log.Fatalf("Failed to select user: %v", err)
+	}
+	if *scrim != "" {
+		scrimCtx, cancelScrim := requestContext(rootCtx)
+		err := joinScrim(scrimCtx, session, userID, *scrim)
+		cancelScrim()
+		if err != nil {
+			log.Fatalf("Failed to join scrim: %v", err)
+		}
+	}
+	sessionCtx, cancelSession := requestContext(rootCtx)
+	chatSessionID, err := createSession(sessionCtx, session, userID)
+	cancelSession()
 	if err != nil {
-		log.Fatalf("Failed to create user: %v", err)
+		log.Fatalf("Failed to start chat session: %v", err)
 	}
-	fmt.Printf("✅ User created successfully with ID: %s\n", userID)
+	scope := messageScope{SessionID: chatSessionID, ScrimID: *scrim}
 
 	messages := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
-			Content: "You are a helpful and friendly chatbot.",
+			Content: chatSystemPrompt,
 		},
 	}
 
-	fmt.Println("🤖 Chatbot is ready! Type 'exit' to end the conversation.")
+	fmt.Println("🤖 Chatbot is ready! Type 'exit' to end the conversation or /help for commands.")
 	fmt.Println("---------------------------------------------------------")
 
-	scanner := bufio.NewScanner(os.Stdin)
+	// Spread each turn's OpenAI requests out instead of firing them back to back
+	interactiveCallSpacer = newCallSpacer(cfg.InteractiveCallSpacing)
+
+	state := &replState{client: client, userID: userID}
+	enricher := newOpenAIEnricher(client)
+	lines, scanErrs := scanLines(os.Stdin)
 	for {
 		fmt.Print("You: ")
-		if !scanner.Scan() {
+		userInput, ok := nextLine(rootCtx, lines)
+		if !ok {
 			break
 		}
-		userInput := scanner.Text()
 
 		if userInput == "exit" {
 			fmt.Println("Goodbye! 👋")
+			stopRoot()
+			break
+		}
+
+		if handleCommand(rootCtx, userInput, state) {
+			continue
+		}
+
+		// Refuse the turn before spending tokens once the quota is used up
+		quotaCtx, cancelQuota := requestContext(rootCtx)
+		err := checkUserTokenQuota(quotaCtx, session, userID)
+		cancelQuota()
+		if errors.Is(err, errTokenQuotaExceeded) {
+			fmt.Println(err)
+			continue
+		}
+		if endsChat(err) {
+			slog.Error("Ending the chat, Neo4j is unavailable", "err", err)
+			stopRoot()
 			break
 		}
+		if err != nil {
+			slog.Error("Error checking token quota", "userId", userID, "err", err)
+		}
+
+		// Store the user message, awaiting a reply. The chat goes on
+		// without it unless Neo4j is down.
+		human, err := ingestMessage(rootCtx, session, "human", userInput, enricher, userID, scope, nil, true)
+		if endsChat(err) {
+			slog.Error("Ending the chat, Neo4j is unavailable", "err", err)
+			stopRoot()
+			break
+		}
+		if err != nil {
+			slog.Error("Error adding message to Neo4j", "userId", userID, "err", err)
+		}
 
-		// Print user message node
-		printMessageNode("human", userInput, client, userID)
-		
 		messages = append(messages, openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleUser,
 			Content: userInput,
 		})
 
-		resp, err := client.CreateChatCompletion(
-			context.Background(),
-			openai.ChatCompletionRequest{
-				Model:    "gpt-4o-mini",
-				Messages: messages,
-			},
-		)
+		// Follow the user's current preferences, which /prefs may have changed
+		retrieval := RetrievalPreferences{}.Settings()
+		prefsCtx, cancelPrefs := requestContext(rootCtx)
+		prefs, err := getUserPreferences(prefsCtx, session, userID)
+		cancelPrefs()
+		if err != nil {
+			slog.Warn("Error loading preferences, using the default prompt", "userId", userID, "err", err)
+		} else {
+			messages[0].Content = chatSystemPromptFor(prefs)
+			retrieval = prefs.Retrieval.Settings()
+		}
 
+		// Bring related messages from earlier sessions into this completion
+		// only, for input that asks for them
+		history := messages
+		if len(human.Embedding) > 0 && shouldRetrieve(userInput, retrieval) {
+			retrieveCtx, cancelRetrieve := requestContext(rootCtx)
+			related, err := retrieveSimilarMessages(retrieveCtx, session, userID, *scrim, human.Embedding, retrieval.TopK, human.MessageID)
+			cancelRetrieve()
+			if err != nil {
+				slog.Error("Error retrieving related messages", "messageId", human.MessageID, "userId", userID, "err", err)
+			} else if prompt := buildContextPrompt(related, retrieval.MinSimilarity); prompt != "" {
+				history = withContextPrompt(messages, prompt)
+			}
+		}
+
+		replyCtx := withCallSpacer(rootCtx, interactiveCallSpacer)
+		var chatbotResponse string
+		var generation *GenerationInfo
+		if *stream {
+			fmt.Print("Bot: ")
+			chatbotResponse, generation, err = streamReply(replyCtx, client, history, func(delta string) {
+				fmt.Print(delta)
+			})
+			fmt.Println()
+		} else {
+			chatbotResponse, generation, err = generateReply(replyCtx, client, history)
+		}
 		if err != nil {
+			// The human message stays flagged awaitingReply for /retryreplies
 			fmt.Printf("ChatCompletion error: %v\n", err)
 			continue
 		}
+		if !*stream {
+			fmt.Printf("Bot: %s\n", chatbotResponse)
+		}
 
-		chatbotResponse := resp.Choices[0].Message.Content
-		fmt.Printf("Bot: %s\n", chatbotResponse)
-
-		// Print bot response node
-		printMessageNode("ai", chatbotResponse, client, userID)
+		// Store the bot response and link it to the message it answers
+		reply, err := ingestMessage(rootCtx, session, "ai", chatbotResponse, enricher, userID, scope, generation, false)
+		if endsChat(err) {
+			slog.Error("Ending the chat, Neo4j is unavailable", "err", err)
+			stopRoot()
+			break
+		}
+		if err != nil {
+			slog.Error("Error adding message to Neo4j", "userId", userID, "err", err)
+		}
+		if human.MessageID != "" && reply.MessageID != "" {
+			linkCtx, cancelLink := requestContext(rootCtx)
+			if err := linkReply(linkCtx, session, human.MessageID, reply.MessageID); err != nil {
+				slog.Error("Error linking reply", "messageId", human.MessageID, "replyId", reply.MessageID, "err", err)
+			}
+			cancelLink()
+		}
 
 		messages = append(messages, openai.ChatCompletionMessage{
 			Role:    openai.ChatMessageRoleAssistant,
@@ -559,7 +1756,9 @@ func main() {
 		})
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Error reading standard input: %v", err)
+	select {
+	case err := <-scanErrs:
+		slog.Error("Error reading standard input", "err", err)
+	default:
 	}
 }
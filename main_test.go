@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAI client talking to a test server that answers embedding requests
+// with one [len(input), 1] vector per input, padded to cfg.EmbeddingDimensions,
+// and chat completions with chatReply of the last message (empty when unset),
+// or chatStatus as an error status when it is set. The decoded request
+// bodies are recorded.
+type fakeOpenAIServer struct {
+	mu         sync.Mutex
+	requests   []map[string]any
+	headers    []http.Header
+	chatReply  func(content string) string
+	chatStatus int
+}
+
+func newFakeOpenAI(t *testing.T) (*openai.Client, *fakeOpenAIServer) {
+	t.Helper()
+	fake := &fakeOpenAIServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fake.mu.Lock()
+		fake.requests = append(fake.requests, body)
+		fake.headers = append(fake.headers, r.Header.Clone())
+		chatReply, chatStatus := fake.chatReply, fake.chatStatus
+		fake.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			if chatStatus != 0 {
+				w.WriteHeader(chatStatus)
+				fmt.Fprintf(w, `{"error": {"message": "fake chat failure", "type": "server_error"}}`)
+				return
+			}
+			var content, reply string
+			if messages, _ := body["messages"].([]any); len(messages) > 0 {
+				last, _ := messages[len(messages)-1].(map[string]any)
+				content, _ = last["content"].(string)
+			}
+			if chatReply != nil {
+				reply = chatReply(content)
+			}
+			json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply}}},
+			})
+			return
+		}
+
+		inputs, _ := body["input"].([]any)
+		response := openai.EmbeddingResponse{Object: "list"}
+		for i, input := range inputs {
+			text, _ := input.(string)
+			embedding := make([]float32, cfg.EmbeddingDimensions)
+			embedding[0], embedding[1] = float32(len(text)), 1
+			response.Data = append(response.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: embedding})
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	return openai.NewClientWithConfig(config), fake
+}
+
+func TestSimilarityCandidatesQueryBounds(t *testing.T) {
+	message := Message{MessageID: "m1", Embedding: []float64{1, 0}}
+	tests := []struct {
+		name      string
+		limit     int
+		window    time.Duration
+		wantLimit bool
+		wantSince bool
+	}{
+		{"unbounded", 0, 0, false, false},
+		{"candidate limit", 25, 0, true, false},
+		{"time window", 0, time.Hour, false, true},
+		{"both", 10, 24 * time.Hour, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, func(c *Config) {
+				c.VectorIndex = false
+				c.ServerSideSimilarity = false
+				c.SimilarityCandidateLimit = tt.limit
+				c.SimilarityWindow = tt.window
+			})
+			before := time.Now()
+			query, params := similarityCandidatesQuery(message, "u1")
+
+			if got := strings.Contains(query, "LIMIT $limit"); got != tt.wantLimit {
+				t.Errorf("query has LIMIT = %v, want %v:\n%s", got, tt.wantLimit, query)
+			}
+			if tt.wantLimit && params["limit"] != tt.limit {
+				t.Errorf("limit = %v, want %d", params["limit"], tt.limit)
+			}
+			since, _ := params["since"].(int64)
+			if !tt.wantSince {
+				if since != 0 {
+					t.Errorf("since = %d, want 0 without a window", since)
+				}
+				return
+			}
+			if want := before.Add(-tt.window).Unix(); since < want || since > time.Now().Add(-tt.window).Unix() {
+				t.Errorf("since = %d, want about %d", since, want)
+			}
+		})
+	}
+}
+
+func TestCreateEmbeddingsInputType(t *testing.T) {
+	tests := []struct {
+		name      string
+		hint      bool
+		inputType EmbeddingInputType
+		want      any
+	}{
+		{"document hint", true, EmbeddingInputDocument, "document"},
+		{"query hint", true, EmbeddingInputQuery, "query"},
+		{"no hint", false, EmbeddingInputQuery, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, func(c *Config) {
+				c.EmbeddingInputType = tt.hint
+				c.OpenAIMaxRetries = 0
+			})
+			client, fake := newFakeOpenAI(t)
+
+			// unique text so the shared embedding cache cannot answer
+			if _, err := createEmbeddings(context.Background(), client, []string{"input type " + tt.name}, tt.inputType); err != nil {
+				t.Fatalf("createEmbeddings: %v", err)
+			}
+			if len(fake.requests) != 1 {
+				t.Fatalf("%d requests, want 1", len(fake.requests))
+			}
+			if got := fake.requests[0]["input_type"]; got != tt.want {
+				t.Errorf("input_type = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopicPromptVersion(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.TopicModel = "gpt-4o-mini"
+	})
+	base := topicPromptVersion()
+	if len(base) != 12 || base != topicPromptVersion() {
+		t.Fatalf("topicPromptVersion() = %q, want a stable 12-character hash", base)
+	}
+	if base == manualTopicVersion || base == autoTopicVersion {
+		t.Errorf("topicPromptVersion() = %q collides with a reserved version", base)
+	}
+
+	changes := map[string]func(*Config){
+		"model": func(c *Config) { c.TopicModel = "gpt-4o" },
+		"tags":  func(c *Config) { c.TopicTags = append(append([]string{}, defaultTopicTags...), "Đồng hồ") },
+	}
+	for name, change := range changes {
+		setTestConfig(t, func(c *Config) {
+			c.TopicTags = defaultTopicTags
+			c.TopicModel = "gpt-4o-mini"
+			change(c)
+		})
+		if got := topicPromptVersion(); got == base {
+			t.Errorf("changing the %s kept version %q", name, got)
+		}
+	}
+}
+
+func TestEmbeddingsByIndexOrdersByIndex(t *testing.T) {
+	resp := openai.EmbeddingResponse{Data: []openai.Embedding{
+		{Index: 2, Embedding: []float32{3, 3}},
+		{Index: 0, Embedding: []float32{1, 1}},
+		{Index: 1, Embedding: []float32{2, 2}},
+	}}
+	embeddings, err := embeddingsByIndex(resp, 3, 2)
+	if err != nil {
+		t.Fatalf("embeddingsByIndex: %v", err)
+	}
+	for i, embedding := range embeddings {
+		if embedding[0] != float64(i+1) {
+			t.Errorf("embedding %d = %v, want the one of input %d", i, embedding, i)
+		}
+	}
+}
+
+func TestEmbeddingsByIndexRejectsMismatches(t *testing.T) {
+	vector := []float32{1, 1}
+	tests := []struct {
+		name  string
+		data  []openai.Embedding
+		count int
+	}{
+		{"empty", nil, 1},
+		{"fewer than inputs", []openai.Embedding{{Index: 0, Embedding: vector}}, 2},
+		{"more than inputs", []openai.Embedding{{Index: 0, Embedding: vector}, {Index: 1, Embedding: vector}}, 1},
+		{"index out of range", []openai.Embedding{{Index: 0, Embedding: vector}, {Index: 5, Embedding: vector}}, 2},
+		{"duplicate index", []openai.Embedding{{Index: 0, Embedding: vector}, {Index: 0, Embedding: vector}}, 2},
+		{"wrong dimensions", []openai.Embedding{{Index: 0, Embedding: []float32{1, 1, 1}}}, 1},
+		{"one input wrong", []openai.Embedding{{Index: 0, Embedding: vector}, {Index: 1, Embedding: []float32{1}}}, 2},
+	}
+	for _, tt := range tests {
+		if _, err := embeddingsByIndex(openai.EmbeddingResponse{Data: tt.data}, tt.count, 2); err == nil {
+			t.Errorf("%s: embeddingsByIndex accepted the response", tt.name)
+		}
+	}
+}
+
+func TestCreateEmbeddingRejectsWrongDimensions(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.EmbeddingDimensions = 2
+		c.EmbeddingCacheSize = 0
+		c.OpenAIMaxRetries = 0
+	})
+	// a model other than the configured one answers with 3 dimensions
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(openai.EmbeddingResponse{Object: "list", Data: []openai.Embedding{{Object: "embedding", Embedding: []float32{1, 0, 0}}}})
+	}))
+	t.Cleanup(server.Close)
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+
+	_, err := getEmbedding(context.Background(), openai.NewClientWithConfig(config), "giày size 42")
+	if !errors.Is(err, errEmbeddingFailed) || !strings.Contains(err.Error(), "3 dimensions, want 2") {
+		t.Errorf("getEmbedding = %v, want errEmbeddingFailed for 3 dimensions", err)
+	}
+}
+
+func TestValidateTopicTagsCapsTopics(t *testing.T) {
+	tests := []struct {
+		limit int
+		text  string
+		want  []string
+	}{
+		{2, "Áo, Quần, Giày, Túi", []string{"Áo", "Quần"}},
+		{2, "Áo, áo, Áo, Giày", []string{"Áo", "Giày"}},
+		{0, "Áo, Quần, Giày, Túi", []string{"Áo", "Quần", "Giày", "Túi"}},
+		{3, "Giày", []string{"Giày"}},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) {
+			c.TopicTags = defaultTopicTags
+			c.TopicCaseFold = true
+			c.MaxTopicsPerMessage = tt.limit
+		})
+		got := validateTopicTags(tt.text).Accepted
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateTopicTags(%q) with limit %d = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestNewGenerationInfo(t *testing.T) {
+	request := openai.ChatCompletionRequest{Model: "gpt-4o-mini", Temperature: 0.7}
+	resp := openai.ChatCompletionResponse{
+		Model: "gpt-4o-mini-2024-07-18",
+		Usage: openai.Usage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150},
+	}
+	got := newGenerationInfo(request, resp)
+	want := &GenerationInfo{Model: "gpt-4o-mini-2024-07-18", Temperature: float64(float32(0.7)), PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newGenerationInfo = %+v, want %+v", got, want)
+	}
+
+	// the API default temperature and the requested model fill in for unset values
+	got = newGenerationInfo(openai.ChatCompletionRequest{Model: "gpt-4o"}, openai.ChatCompletionResponse{})
+	if got.Model != "gpt-4o" || got.Temperature != 1 {
+		t.Errorf("newGenerationInfo without settings = %+v, want model gpt-4o at temperature 1", got)
+	}
+}
+
+func TestGenerationInfoStoredOnMessage(t *testing.T) {
+	generation := &GenerationInfo{Model: "gpt-4o", Temperature: 0.2, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	_, params := messageNodeStatement(Message{MessageID: "m1", Sender: "ai", Generation: generation}, "u1")
+	if params["model"] != "gpt-4o" || params["temperature"] != 0.2 || params["totalTokens"] != 15 {
+		t.Errorf("generation params = model %v, temperature %v, totalTokens %v", params["model"], params["temperature"], params["totalTokens"])
+	}
+	_, params = messageNodeStatement(Message{MessageID: "m2", Sender: "human"}, "u1")
+	if params["model"] != nil {
+		t.Errorf("model = %v for a human message, want nil", params["model"])
+	}
+
+	// read back as the driver returns it, with integers as int64
+	node := neo4j.Node{Props: map[string]any{
+		"messageId":        "m1",
+		"model":            "gpt-4o",
+		"temperature":      0.2,
+		"promptTokens":     int64(10),
+		"completionTokens": int64(5),
+		"totalTokens":      int64(15),
+	}}
+	if got := messageFromNode(node).Generation; !reflect.DeepEqual(got, generation) {
+		t.Errorf("Generation = %+v, want %+v", got, generation)
+	}
+	if got := messageFromNode(neo4j.Node{Props: map[string]any{"messageId": "m2"}}).Generation; got != nil {
+		t.Errorf("Generation = %+v without a model, want nil", got)
+	}
+}
+
+func TestMessageSimilarityTopicBoost(t *testing.T) {
+	a := Message{Embedding: []float64{1, 0}, Topics: []string{"Giày", "Áo"}}
+	shared := Message{Embedding: []float64{0.6, 0.8}, Topics: []string{"Áo"}}
+	disjoint := Message{Embedding: []float64{0.6, 0.8}, Topics: []string{"Mũ"}}
+	untagged := Message{Embedding: []float64{0.6, 0.8}}
+
+	tests := []struct {
+		boost float64
+		other Message
+		want  float64
+	}{
+		{1, shared, 0.6},
+		{1.5, shared, 0.9},
+		{1.5, disjoint, 0.6},
+		{1.5, untagged, 0.6},
+		{0.5, shared, 0.3},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) { c.TopicOverlapBoost = tt.boost })
+		if got := messageSimilarity(a, tt.other); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("boost %v, topics %v: messageSimilarity = %v, want %v", tt.boost, tt.other.Topics, got, tt.want)
+		}
+	}
+}
+
+func TestMinimumCandidateSimilarity(t *testing.T) {
+	tests := []struct {
+		threshold float64
+		pairs     map[string]float64
+		boost     float64
+		want      float64
+	}{
+		{0.5, nil, 1, 0.5},
+		{0.5, map[string]float64{"human-ai": 0.4}, 1, 0.4},
+		{0.6, nil, 1.5, 0.4},
+		// a boost below 1 never lets a lower cosine through
+		{0.6, nil, 0.5, 0.6},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) {
+			c.SimilarityThreshold = tt.threshold
+			c.SenderPairThresholds = tt.pairs
+			c.TopicOverlapBoost = tt.boost
+		})
+		if got := minimumCandidateSimilarity(); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("minimumCandidateSimilarity(%v, %v, boost %v) = %v, want %v", tt.threshold, tt.pairs, tt.boost, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// How conflicting preferences are resolved when merging two users
+type PreferenceMergePolicy string
+
+const (
+	// Keep the preferences of the user that is kept
+	PreferencesKeep PreferenceMergePolicy = "keep"
+	// Take the preferences of whichever user was active most recently
+	PreferencesNewest PreferenceMergePolicy = "newest"
+	// Keep the kept user's values, filling empty ones from the merged user
+	PreferencesFill PreferenceMergePolicy = "fill"
+)
+
+// Parse a preference merge policy name
+func parsePreferenceMergePolicy(value string) (PreferenceMergePolicy, error) {
+	switch policy := PreferenceMergePolicy(value); policy {
+	case PreferencesKeep, PreferencesNewest, PreferencesFill:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown preference merge policy %q (want keep, newest or fill)", value)
+	}
+}
+
+// Resolve the preferences of a merged user according to the policy
+func mergePreferences(keep User, merged User, policy PreferenceMergePolicy) UserPreferences {
+	switch policy {
+	case PreferencesNewest:
+		if merged.LastActive > keep.LastActive {
+			return merged.Preferences
+		}
+		return keep.Preferences
+	case PreferencesFill:
+		prefs := keep.Preferences
+		if prefs.Language == "" {
+			prefs.Language = merged.Preferences.Language
+		}
+		if prefs.Tone == "" {
+			prefs.Tone = merged.Preferences.Tone
+		}
+		if prefs.AddressingStyle == "" {
+			prefs.AddressingStyle = merged.Preferences.AddressingStyle
+		}
+		return prefs
+	default:
+		return keep.Preferences
+	}
+}
+
+// Merge the user mergeID into keepID in one transaction: its messages are
+// re-owned by keepID, similarity edges between the two message sets are
+// created, preferences are consolidated by policy, lastActive becomes the
+// later of the two and the merged user node is deleted.
+func mergeUsers(ctx context.Context, keepID string, mergeID string, policy PreferenceMergePolicy) error {
+	if keepID == mergeID {
+		return fmt.Errorf("cannot merge user %s into itself", keepID)
+	}
+
+	// Lock in a fixed order so concurrent merges cannot deadlock
+	first, second := keepID, mergeID
+	if first > second {
+		first, second = second, first
+	}
+	unlockFirst := userIngestLocks.Lock(first)
+	defer unlockFirst()
+	unlockSecond := userIngestLocks.Lock(second)
+	defer unlockSecond()
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		loadUser := func(userID string) (User, error) {
+			records, err := tx.Run(ctx, "MATCH (u:User {userId: $userId}) RETURN u", map[string]any{"userId": userID})
+			if err != nil {
+				return User{}, err
+			}
+			record, err := records.Single(ctx)
+			if err != nil {
+				return User{}, fmt.Errorf("user %s not found", userID)
+			}
+			node, _ := record.Values[0].(neo4j.Node)
+			return userFromNode(node), nil
+		}
+		loadMessages := func(userID string) ([]Message, error) {
+			records, err := tx.Run(ctx, "MATCH (:User {userId: $userId})-[:OWNS]->(m:Message) RETURN m", map[string]any{"userId": userID})
+			if err != nil {
+				return nil, err
+			}
+			var messages []Message
+			for records.Next(ctx) {
+				if node, ok := records.Record().Values[0].(neo4j.Node); ok {
+					messages = append(messages, messageFromNode(node))
+				}
+			}
+			return messages, records.Err()
+		}
+
+		keep, err := loadUser(keepID)
+		if err != nil {
+			return nil, err
+		}
+		merged, err := loadUser(mergeID)
+		if err != nil {
+			return nil, err
+		}
+		keptMessages, err := loadMessages(keepID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages of %s: %v", keepID, err)
+		}
+		mergedMessages, err := loadMessages(mergeID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages of %s: %v", mergeID, err)
+		}
+
+		// Repoint ownership
+		repointQuery := `
+			MATCH (keep:User {userId: $keepId})
+			MATCH (old:User {userId: $mergeId})-[r:OWNS]->(m:Message)
+			MERGE (keep)-[:OWNS]->(m)
+			SET m.userId = $keepId
+			DELETE r
+		`
+		if _, err := tx.Run(ctx, repointQuery, map[string]any{"keepId": keepID, "mergeId": mergeID}); err != nil {
+			return nil, fmt.Errorf("failed to repoint messages: %v", err)
+		}
+
+		// Link the two histories, which were never compared while split
+		edgesCreated := 0
+		for _, a := range mergedMessages {
+			for _, b := range keptMessages {
+				similarity := messageSimilarity(a, b)
+				if similarity <= similarityThresholdFor(a.Sender, b.Sender) {
+					continue
+				}
+				edgeQuery := `
+					MATCH (m1:Message {messageId: $messageId1})
+					MATCH (m2:Message {messageId: $messageId2})
+					MERGE (m1)-[r:CONTEXTUAL_LINK]-(m2)
+					ON CREATE SET r.similarity = $similarity, r.timestamp = $timestamp
+				`
+				edgeParams := map[string]any{
+					"messageId1": a.MessageID,
+					"messageId2": b.MessageID,
+					"similarity": similarity,
+					"timestamp":  time.Now().Unix(),
+				}
+				if _, err := tx.Run(ctx, edgeQuery, edgeParams); err != nil {
+					return nil, fmt.Errorf("failed to create edge: %v", err)
+				}
+				edgesCreated++
+			}
+		}
+
+		prefs := mergePreferences(keep, merged, policy)
+		lastActive := max(keep.LastActive, merged.LastActive)
+		createdAt := min(keep.CreatedAt, merged.CreatedAt)
+		updateQuery := `
+			MATCH (keep:User {userId: $keepId})
+			SET keep.language = $language,
+				keep.tone = $tone,
+				keep.addressingStyle = $addressingStyle,
+				keep.lastActive = $lastActive,
+				keep.createdAt = $createdAt
+			WITH keep
+			MATCH (old:User {userId: $mergeId})
+			DETACH DELETE old
+		`
+		updateParams := map[string]any{
+			"keepId":          keepID,
+			"mergeId":         mergeID,
+			"language":        prefs.Language,
+			"tone":            prefs.Tone,
+			"addressingStyle": prefs.AddressingStyle,
+			"lastActive":      lastActive,
+			"createdAt":       createdAt,
+		}
+		if _, err := tx.Run(ctx, updateQuery, updateParams); err != nil {
+			return nil, fmt.Errorf("failed to update merged user: %v", err)
+		}
+
+		fmt.Printf("🔀 Merged user %s into %s: %d messages moved, %d cross edges created\n", mergeID, keepID, len(mergedMessages), edgesCreated)
+		return nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to merge users: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePreferenceMergePolicy(t *testing.T) {
+	for _, value := range []string{"keep", "newest", "fill"} {
+		if policy, err := parsePreferenceMergePolicy(value); err != nil || string(policy) != value {
+			t.Errorf("parsePreferenceMergePolicy(%q) = %q, %v", value, policy, err)
+		}
+	}
+	if _, err := parsePreferenceMergePolicy("Newest"); err == nil {
+		t.Error("parsePreferenceMergePolicy accepted an unknown policy")
+	}
+}
+
+func TestMergePreferences(t *testing.T) {
+	keep := User{LastActive: 100, Preferences: UserPreferences{Language: "vi", Tone: ""}}
+	merged := User{LastActive: 200, Preferences: UserPreferences{Language: "en", Tone: "formal", AddressingStyle: "you"}}
+
+	tests := []struct {
+		policy PreferenceMergePolicy
+		keep   User
+		want   UserPreferences
+	}{
+		{PreferencesKeep, keep, keep.Preferences},
+		{PreferencesNewest, keep, merged.Preferences},
+		{PreferencesNewest, User{LastActive: 300, Preferences: keep.Preferences}, keep.Preferences},
+		{PreferencesFill, keep, UserPreferences{Language: "vi", Tone: "formal", AddressingStyle: "you"}},
+	}
+	for _, tt := range tests {
+		if got := mergePreferences(tt.keep, merged, tt.policy); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("mergePreferences(%s) = %+v, want %+v", tt.policy, got, tt.want)
+		}
+	}
+}
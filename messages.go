@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Message together with the ID of the user owning it
+type userMessage struct {
+	Message Message
+	UserID  string
+}
+
+// Load all messages owned by a user in timestamp order, with their chunks
+func loadUserMessages(ctx context.Context, session neo4j.SessionWithContext, userID string) ([]Message, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})
+			RETURN m, [(m)-[:HAS_CHUNK]->(c:Chunk) | c]
+			ORDER BY m.timestamp, m.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+
+		var messages []Message
+		for records.Next(ctx) {
+			values := records.Record().Values
+			if node, ok := values[0].(neo4j.Node); ok {
+				message := messageFromNode(node)
+				message.Chunks = chunksFromValue(values[1])
+				messages = append(messages, message)
+			}
+		}
+		return messages, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", neo4jError(ctx, err))
+	}
+	return result.([]Message), nil
+}
+
+// Page size limits of loadUserMessagePage callers such as the HTTP API
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 500
+)
+
+// One page of a user's messages in timestamp order. NextCursor fetches the
+// following page and is empty on the last one.
+type messagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// Cursor pointing just after a message: "<timestamp>:<messageId>"
+func messageCursor(message Message) string {
+	return fmt.Sprintf("%d:%s", message.Timestamp, message.MessageID)
+}
+
+// Parse a messageCursor
+func parseMessageCursor(cursor string) (int64, string, error) {
+	rawTimestamp, messageID, ok := strings.Cut(cursor, ":")
+	timestamp, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if !ok || err != nil || messageID == "" {
+		return 0, "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return timestamp, messageID, nil
+}
+
+// Load up to limit of a user's messages following cursor ("" for the first
+// page), with their chunks. Pages are keyed on (timestamp, messageId), so
+// messages stored while paging never shift later pages.
+func loadUserMessagePage(ctx context.Context, session neo4j.SessionWithContext, userID string, cursor string, limit int) (messagePage, error) {
+	if limit <= 0 {
+		return messagePage{}, fmt.Errorf("page size must be positive")
+	}
+	after, afterID := int64(math.MinInt64), ""
+	if cursor != "" {
+		var err error
+		if after, afterID, err = parseMessageCursor(cursor); err != nil {
+			return messagePage{}, err
+		}
+	}
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})
+			WHERE m.timestamp > $after OR (m.timestamp = $after AND m.messageId > $afterId)
+			RETURN m, [(m)-[:HAS_CHUNK]->(c:Chunk) | c]
+			ORDER BY m.timestamp, m.messageId
+			LIMIT $limit
+		`
+		params := map[string]any{
+			"userId":  userID,
+			"after":   after,
+			"afterId": afterID,
+			// One extra row tells whether another page follows
+			"limit": limit + 1,
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+
+		messages := []Message{}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			if node, ok := values[0].(neo4j.Node); ok {
+				message := messageFromNode(node)
+				message.Chunks = chunksFromValue(values[1])
+				messages = append(messages, message)
+			}
+		}
+		return messages, records.Err()
+	})
+	if err != nil {
+		return messagePage{}, fmt.Errorf("failed to load messages: %w", neo4jError(ctx, err))
+	}
+
+	page := messagePage{Messages: result.([]Message)}
+	if len(page.Messages) > limit {
+		page.Messages = page.Messages[:limit]
+		page.NextCursor = messageCursor(page.Messages[limit-1])
+	}
+	return page, nil
+}
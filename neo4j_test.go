@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Connect to the Neo4j database in NEO4J_TEST_URI for the rest of the test,
+// with NEO4J_TEST_USER and NEO4J_TEST_PASSWORD, or skip the test when it is
+// unset. Tests only touch users they create with createTestUser.
+func requireNeo4j(t *testing.T, edit func(*Config)) neo4j.SessionWithContext {
+	t.Helper()
+	uri := os.Getenv("NEO4J_TEST_URI")
+	if uri == "" {
+		t.Skip("NEO4J_TEST_URI not set")
+	}
+	setTestConfig(t, func(c *Config) {
+		c.Neo4jURI = uri
+		c.Neo4jUser = envString("NEO4J_TEST_USER", "neo4j")
+		c.Neo4jPassword = os.Getenv("NEO4J_TEST_PASSWORD")
+		c.Neo4jCACert = ""
+		c.VectorIndex = false
+		if edit != nil {
+			edit(c)
+		}
+	})
+	if err := initNeo4j(); err != nil {
+		t.Fatalf("initNeo4j: %v", err)
+	}
+	t.Cleanup(func() {
+		neo4jDriverMu.Lock()
+		defer neo4jDriverMu.Unlock()
+		if neo4jDriver != nil {
+			neo4jDriver.Close(context.Background())
+			neo4jDriver = nil
+		}
+	})
+
+	session := neo4jDriver.NewSession(context.Background(), neo4j.SessionConfig{})
+	t.Cleanup(func() { session.Close(context.Background()) })
+	return session
+}
+
+// Create a user for the test, deleted with its messages and chunks when the
+// test ends
+func createTestUser(t *testing.T, session neo4j.SessionWithContext) string {
+	t.Helper()
+	ctx := context.Background()
+	userID, err := createUser(ctx, session, "test "+t.Name())
+	if err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+	t.Cleanup(func() { deleteTestUser(t, session, userID) })
+	return userID
+}
+
+// Delete a user with its messages and chunks, and prune orphaned topics
+func deleteTestUser(t *testing.T, session neo4j.SessionWithContext, userID string) {
+	t.Helper()
+	ctx := context.Background()
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {userId: $userId})
+			OPTIONAL MATCH (m:Message {userId: $userId})
+			OPTIONAL MATCH (m)-[:HAS_CHUNK]->(c:Chunk)
+			DETACH DELETE u, m, c
+		`
+		if _, err := tx.Run(ctx, query, map[string]any{"userId": userID}); err != nil {
+			return nil, err
+		}
+		return pruneOrphanTopics(ctx, tx)
+	})
+	if err != nil {
+		t.Errorf("failed to delete test user %s: %v", userID, err)
+	}
+}
+
+// Store a message for a test user as ingestMessage would after enrichment
+func storeTestMessage(t *testing.T, session neo4j.SessionWithContext, userID string, message Message) Message {
+	t.Helper()
+	if message.MessageID == "" {
+		message.MessageID = generateID()
+	}
+	if message.Sender == "" {
+		message.Sender = "human"
+	}
+	message.ContentHash = contentHash(message.Sender, message.Content)
+	if err := addMessageAndCreateEdges(context.Background(), session, message, userID); err != nil {
+		t.Fatalf("addMessageAndCreateEdges: %v", err)
+	}
+	return message
+}
+
+// Number of CONTEXTUAL_LINK edges between two messages
+func countTestLinks(t *testing.T, session neo4j.SessionWithContext, messageID1, messageID2 string) int64 {
+	t.Helper()
+	ctx := context.Background()
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (:Message {messageId: $a})-[r:CONTEXTUAL_LINK]-(:Message {messageId: $b})
+			RETURN count(r)
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"a": messageID1, "b": messageID2})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return record.Values[0], nil
+	})
+	if err != nil {
+		t.Fatalf("failed to count links: %v", err)
+	}
+	return result.(int64)
+}
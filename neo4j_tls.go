@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/config"
+)
+
+// Encryption implied by a Neo4j URI scheme
+type neo4jEncryption struct {
+	// TLS is used at all (+s and +ssc schemes)
+	Encrypted bool
+	// The server certificate is accepted without verification (+ssc)
+	SelfSigned bool
+}
+
+// Parse the encryption settings from a neo4j://, bolt:// or their +s and
+// +ssc variants. Also checks the URI names a host, so a malformed NEO4J_URI
+// fails before the driver is created.
+func parseNeo4jEncryption(uri string) (neo4jEncryption, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return neo4jEncryption{}, fmt.Errorf("invalid Neo4j URI %q: %v", uri, err)
+	}
+	base, suffix, _ := strings.Cut(parsed.Scheme, "+")
+	if base != "neo4j" && base != "bolt" {
+		return neo4jEncryption{}, fmt.Errorf("unsupported Neo4j URI scheme %q (want neo4j, bolt or their +s and +ssc variants)", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return neo4jEncryption{}, fmt.Errorf("invalid Neo4j URI %q: missing host", uri)
+	}
+	switch suffix {
+	case "":
+		return neo4jEncryption{}, nil
+	case "s":
+		return neo4jEncryption{Encrypted: true}, nil
+	case "ssc":
+		return neo4jEncryption{Encrypted: true, SelfSigned: true}, nil
+	default:
+		return neo4jEncryption{}, fmt.Errorf("unsupported Neo4j URI scheme %q", parsed.Scheme)
+	}
+}
+
+// Report whether the URI points at this machine
+func isLocalNeo4jHost(uri string) bool {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Build the driver configuration for the URI. With caFile set (only valid
+// for +s schemes) the server certificate must be signed by that CA, which
+// allows self-signed certificates to be verified instead of trusted blindly
+// with +ssc. Warns when a remote server is reached without TLS.
+func neo4jDriverConfig(uri string, caFile string) (func(*config.Config), error) {
+	encryption, err := parseNeo4jEncryption(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !encryption.Encrypted && !isLocalNeo4jHost(uri) {
+		slog.Warn("Connecting to remote Neo4j without TLS; use a neo4j+s:// URI", "uri", uri)
+	}
+	if caFile == "" {
+		return func(*config.Config) {}, nil
+	}
+	if !encryption.Encrypted || encryption.SelfSigned {
+		return nil, fmt.Errorf("NEO4J_CA_CERT requires a neo4j+s:// or bolt+s:// URI")
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NEO4J_CA_CERT: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return func(c *config.Config) {
+		c.TlsConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j/config"
+)
+
+func TestParseNeo4jEncryption(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    neo4jEncryption
+		wantErr bool
+	}{
+		{"neo4j://localhost:7687", neo4jEncryption{}, false},
+		{"bolt://db.internal:7687", neo4jEncryption{}, false},
+		{"neo4j+s://abc.databases.neo4j.io", neo4jEncryption{Encrypted: true}, false},
+		{"bolt+ssc://10.0.0.5:7687", neo4jEncryption{Encrypted: true, SelfSigned: true}, false},
+		{"http://localhost:7474", neo4jEncryption{}, true},
+		{"neo4j+x://localhost", neo4jEncryption{}, true},
+		{"neo4j://", neo4jEncryption{}, true},
+		{"localhost:7687", neo4jEncryption{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseNeo4jEncryption(tt.uri)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseNeo4jEncryption(%q) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseNeo4jEncryption(%q) = %+v, want %+v", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestIsLocalNeo4jHost(t *testing.T) {
+	tests := map[string]bool{
+		"neo4j://localhost:7687":   true,
+		"bolt://127.0.0.1:7687":    true,
+		"neo4j://[::1]:7687":       true,
+		"neo4j://db.example.com":   false,
+		"neo4j+s://10.0.0.5:7687":  false,
+		"neo4j://localhost.evil.x": false,
+	}
+	for uri, want := range tests {
+		if got := isLocalNeo4jHost(uri); got != want {
+			t.Errorf("isLocalNeo4jHost(%q) = %v, want %v", uri, got, want)
+		}
+	}
+}
+
+func TestNeo4jDriverConfigCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	configure, err := neo4jDriverConfig("neo4j+s://db.example.com", caFile)
+	if err != nil {
+		t.Fatalf("neo4jDriverConfig: %v", err)
+	}
+	var c config.Config
+	configure(&c)
+	if c.TlsConfig == nil || c.TlsConfig.RootCAs == nil {
+		t.Fatal("TlsConfig not set from the CA certificate")
+	}
+	if _, err := server.Certificate().Verify(x509.VerifyOptions{Roots: c.TlsConfig.RootCAs, DNSName: "example.com"}); err != nil {
+		t.Errorf("server certificate not trusted by the configured pool: %v", err)
+	}
+
+	emptyFile := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(emptyFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	failures := []struct {
+		uri    string
+		caFile string
+	}{
+		{"neo4j://db.example.com", caFile},
+		{"neo4j+ssc://db.example.com", caFile},
+		{"neo4j+s://db.example.com", filepath.Join(t.TempDir(), "missing.pem")},
+		{"neo4j+s://db.example.com", emptyFile},
+	}
+	for _, tt := range failures {
+		if _, err := neo4jDriverConfig(tt.uri, tt.caFile); err == nil {
+			t.Errorf("neo4jDriverConfig(%q, %q) accepted the CA certificate", tt.uri, filepath.Base(tt.caFile))
+		}
+	}
+
+	// without a CA the driver defaults are left alone
+	configure, err = neo4jDriverConfig("neo4j+s://db.example.com", "")
+	if err != nil {
+		t.Fatalf("neo4jDriverConfig without a CA: %v", err)
+	}
+	c = config.Config{}
+	configure(&c)
+	if c.TlsConfig != nil {
+		t.Errorf("TlsConfig = %+v without a CA, want nil", c.TlsConfig)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Report whether an OpenAI call failed with a rate limit (429) or server
+// error (5xx) that may succeed when retried
+func isRetryableOpenAIError(err error) bool {
+	if isOpenAIQuotaError(err) {
+		return false
+	}
+	status := 0
+	var apiErr *openai.APIError
+	var requestErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &requestErr):
+		status = requestErr.HTTPStatusCode
+	}
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// Delay before retry number attempt (from 0): cfg.OpenAIRetryBaseDelay
+// doubled per attempt, with the upper half jittered so concurrent callers
+// spread out
+func openAIRetryDelay(attempt int) time.Duration {
+	delay := cfg.OpenAIRetryBaseDelay << attempt
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Run an OpenAI call, retrying rate-limit and server errors up to
+// cfg.OpenAIMaxRetries times with openAIRetryDelay between attempts. Each
+// attempt gets its own requestContext; other errors, timeouts included, are
+// returned immediately, and cancelling ctx ends the backoff.
+func withOpenAIRetry[T any](ctx context.Context, call func(context.Context) (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := requestContext(ctx)
+		result, err := call(attemptCtx)
+		err = contextError(attemptCtx, err)
+		cancel()
+		if err == nil || attempt >= cfg.OpenAIMaxRetries || !isRetryableOpenAIError(err) {
+			return result, openAIError(err)
+		}
+
+		delay := openAIRetryDelay(attempt)
+		slog.Warn("OpenAI request failed, retrying", "attempt", attempt+1, "attempts", cfg.OpenAIMaxRetries+1, "delay", delay.Round(time.Millisecond), "correlationId", correlationID(ctx), "err", err)
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return result, fmt.Errorf("cancelled while retrying: %w (%v)", sleepErr, err)
+		}
+	}
+}
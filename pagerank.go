@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Smallest conversation graph PageRank is computed for
+const minPageRankMessages = 3
+
+// PageRank damping used when PAGERANK_DAMPING is unset
+const defaultPageRankDamping = 0.85
+
+// Power iteration stops after this many rounds or once scores change by
+// less than pageRankTolerance in total
+const (
+	pageRankIterations = 100
+	pageRankTolerance  = 1e-9
+)
+
+// Returned by rankUserMessages when the graph has too few messages or no
+// edges for the scores to say anything
+var errGraphTooSmall = errors.New("conversation graph too small to rank")
+
+// PageRank over an undirected graph whose edges are weighted by similarity:
+// each node passes its score to its neighbours in proportion to edge weight.
+// Nodes without edges spread their score evenly. Scores sum to 1.
+func computePageRank(nodes []string, edges []archiveEdge, damping float64) map[string]float64 {
+	n := float64(len(nodes))
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		index[node] = i
+	}
+
+	type neighbour struct {
+		node   int
+		weight float64
+	}
+	neighbours := make([][]neighbour, len(nodes))
+	outWeight := make([]float64, len(nodes))
+	for _, edge := range edges {
+		from, okFrom := index[edge.From]
+		to, okTo := index[edge.To]
+		if !okFrom || !okTo || from == to {
+			continue
+		}
+		weight := max(edge.Similarity, 0)
+		if weight == 0 {
+			continue
+		}
+		neighbours[from] = append(neighbours[from], neighbour{to, weight})
+		neighbours[to] = append(neighbours[to], neighbour{from, weight})
+		outWeight[from] += weight
+		outWeight[to] += weight
+	}
+
+	scores := make([]float64, len(nodes))
+	for i := range scores {
+		scores[i] = 1 / n
+	}
+	for iteration := 0; iteration < pageRankIterations; iteration++ {
+		dangling := 0.0
+		for i, score := range scores {
+			if outWeight[i] == 0 {
+				dangling += score
+			}
+		}
+
+		next := make([]float64, len(nodes))
+		for i := range next {
+			next[i] = (1-damping)/n + damping*dangling/n
+		}
+		for i, score := range scores {
+			for _, nb := range neighbours[i] {
+				next[nb.node] += damping * score * nb.weight / outWeight[i]
+			}
+		}
+
+		delta := 0.0
+		for i := range scores {
+			delta += math.Abs(next[i] - scores[i])
+		}
+		scores = next
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+
+	ranks := make(map[string]float64, len(nodes))
+	for i, node := range nodes {
+		ranks[node] = scores[i]
+	}
+	return ranks
+}
+
+// Compute PageRank (damping cfg.PageRankDamping) over a user's
+// CONTEXTUAL_LINK graph in Go and store it as pageRank on each message.
+// Returns errGraphTooSmall for fewer than minPageRankMessages messages or a
+// graph without edges.
+func rankUserMessages(ctx context.Context, userID string) (int, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return 0, err
+	}
+	edges, err := loadUserEdges(ctx, session, userID)
+	if err != nil {
+		return 0, err
+	}
+	if len(messages) < minPageRankMessages || len(edges) == 0 {
+		return 0, errGraphTooSmall
+	}
+
+	nodes := make([]string, len(messages))
+	for i, message := range messages {
+		nodes[i] = message.MessageID
+	}
+	ranks := computePageRank(nodes, edges, cfg.PageRankDamping)
+
+	rows := make([]map[string]any, 0, len(ranks))
+	for _, node := range nodes {
+		rows = append(rows, map[string]any{"messageId": node, "rank": ranks[node]})
+	}
+	_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			UNWIND $rows AS row
+			MATCH (m:Message {messageId: row.messageId})
+			SET m.pageRank = row.rank, m.pageRankAt = $now
+		`
+		_, err := tx.Run(ctx, query, map[string]any{"rows": rows, "now": time.Now().Unix()})
+		return nil, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store PageRank: %v", err)
+	}
+
+	fmt.Printf("🏆 Ranked %d messages over %d edges for user %s\n", len(nodes), len(edges), userID)
+	return len(nodes), nil
+}
+
+// Load a user's messages with the highest stored PageRank, at most limit
+func topRankedMessages(ctx context.Context, userID string, limit int) ([]ScoredMessage, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})
+			WHERE m.pageRank IS NOT NULL
+			RETURN m, m.pageRank
+			ORDER BY m.pageRank DESC, m.timestamp DESC, m.messageId
+			LIMIT $limit
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "limit": limit})
+		if err != nil {
+			return nil, err
+		}
+		var ranked []ScoredMessage
+		for records.Next(ctx) {
+			values := records.Record().Values
+			node, ok := values[0].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			rank, _ := values[1].(float64)
+			ranked = append(ranked, ScoredMessage{Message: messageFromNode(node), Similarity: rank})
+		}
+		return ranked, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ranked messages: %v", err)
+	}
+	return result.([]ScoredMessage), nil
+}
+
+// Print the most central messages of a user
+func printTopRankedMessages(ctx context.Context, userID string) {
+	ranked, err := topRankedMessages(ctx, userID, cfg.SearchLimit)
+	if err != nil {
+		slog.Error("Error loading ranked messages", "userId", userID, "err", err)
+		return
+	}
+	if len(ranked) == 0 {
+		fmt.Println("No ranked messages yet, run --pagerank first")
+		return
+	}
+	fmt.Println("🏆 Most central messages:")
+	for _, result := range ranked {
+		fmt.Printf("  %.4f %s: %s\n", result.Similarity, result.Message.Sender, result.Message.Content)
+	}
+}
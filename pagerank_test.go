@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputePageRankPath(t *testing.T) {
+	// a - b - c with equal weights: by symmetry a and c share a score, and
+	// a = (1-d)/3 + d*b/2, b = (1-d)/3 + d*2a
+	nodes := []string{"a", "b", "c"}
+	edges := []archiveEdge{
+		{From: "a", To: "b", Similarity: 0.9},
+		{From: "b", To: "c", Similarity: 0.9},
+	}
+	ranks := computePageRank(nodes, edges, 0.85)
+
+	want := map[string]float64{"a": 0.07125 / 0.2775, "b": 1 - 2*0.07125/0.2775, "c": 0.07125 / 0.2775}
+	for node, score := range want {
+		if math.Abs(ranks[node]-score) > 1e-6 {
+			t.Errorf("rank of %s = %.6f, want %.6f", node, ranks[node], score)
+		}
+	}
+}
+
+func TestComputePageRankWeights(t *testing.T) {
+	// hub is linked to both others, strongly to heavy
+	nodes := []string{"hub", "heavy", "light", "isolated"}
+	edges := []archiveEdge{
+		{From: "hub", To: "heavy", Similarity: 0.9},
+		{From: "hub", To: "light", Similarity: 0.1},
+		{From: "hub", To: "hub", Similarity: 1},
+		{From: "hub", To: "unknown", Similarity: 1},
+		{From: "light", To: "heavy", Similarity: -0.5},
+	}
+	ranks := computePageRank(nodes, edges, 0.85)
+
+	sum := 0.0
+	for _, score := range ranks {
+		sum += score
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("scores sum to %v, want 1", sum)
+	}
+	if !(ranks["hub"] > ranks["heavy"] && ranks["heavy"] > ranks["light"]) {
+		t.Errorf("want hub > heavy > light, got %v", ranks)
+	}
+	if ranks["isolated"] >= ranks["light"] {
+		t.Errorf("isolated node ranked %v, not below linked light %v", ranks["isolated"], ranks["light"])
+	}
+}
+
+func TestComputePageRankNoEdges(t *testing.T) {
+	ranks := computePageRank([]string{"a", "b", "c", "d"}, nil, 0.85)
+	for node, score := range ranks {
+		if math.Abs(score-0.25) > 1e-12 {
+			t.Errorf("rank of %s = %v, want 0.25", node, score)
+		}
+	}
+}
+
+func TestParsePageRankDamping(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"", defaultPageRankDamping, false},
+		{"0.5", 0.5, false},
+		{" 0.9 ", 0.9, false},
+		{"0", 0, true},
+		{"1", 0, true},
+		{"-0.2", 0, true},
+		{"high", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePageRankDamping(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePageRankDamping(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parsePageRankDamping(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Allowed values of each preference, keyed by the User node property.
+// "you" is the addressing style createUser assigns.
+var preferenceValues = map[string][]string{
+	"language":        {"vi", "en"},
+	"tone":            {"friendly", "formal", "casual"},
+	"addressingStyle": {"tôi", "mình", "em", "you"},
+}
+
+// Check a preference name and value against preferenceValues, or parse a
+// retrieval preference, and return the value to store
+func parsePreference(field string, value string) (any, error) {
+	if _, ok := retrievalPreferenceParsers[field]; ok {
+		return parseRetrievalPreference(field, value)
+	}
+	allowed, ok := preferenceValues[field]
+	if !ok {
+		fields := append(sortedKeys(preferenceValues), sortedKeys(retrievalPreferenceParsers)...)
+		return nil, fmt.Errorf("unknown preference %q (want %s)", field, strings.Join(fields, ", "))
+	}
+	if !containsString(allowed, value) {
+		return nil, fmt.Errorf("invalid %s %q (want %s)", field, value, strings.Join(allowed, ", "))
+	}
+	return value, nil
+}
+
+// Load a user's preferences on the caller's session
+func getUserPreferences(ctx context.Context, session neo4j.SessionWithContext, userID string) (UserPreferences, error) {
+	user, err := loadUser(ctx, session, userID)
+	if err != nil {
+		return UserPreferences{}, err
+	}
+	return user.Preferences, nil
+}
+
+// Set the given preferences (property name to value) on a user after
+// validating all of them, and return the resulting preferences
+func updateUserPreferences(ctx context.Context, userID string, updates map[string]string) (UserPreferences, error) {
+	if len(updates) == 0 {
+		return UserPreferences{}, fmt.Errorf("no preferences to update")
+	}
+	updateMap := make(map[string]any, len(updates))
+	for _, field := range sortedKeys(updates) {
+		value, err := parsePreference(field, updates[field])
+		if err != nil {
+			return UserPreferences{}, err
+		}
+		updateMap[field] = value
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {userId: $userId})
+			SET u += $updates
+			RETURN u
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "updates": updateMap})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("user %s not found", userID)
+		}
+		node, _ := record.Values[0].(neo4j.Node)
+		return userFromNode(node).Preferences, nil
+	})
+	if err != nil {
+		return UserPreferences{}, fmt.Errorf("failed to update preferences: %v", err)
+	}
+	return result.(UserPreferences), nil
+}
+
+// Instructions added to the chat system prompt per preference value
+var preferencePromptText = map[string]map[string]string{
+	"language": {
+		"vi": "Always reply in Vietnamese.",
+		"en": "Always reply in English.",
+	},
+	"tone": {
+		"friendly": "Use a warm, friendly tone.",
+		"formal":   "Use a polite, formal tone.",
+		"casual":   "Use a relaxed, casual tone.",
+	},
+	"addressingStyle": {
+		"tôi":  `When replying in Vietnamese, refer to yourself as "tôi".`,
+		"mình": `When replying in Vietnamese, refer to yourself as "mình".`,
+		"em":   `When replying in Vietnamese, refer to yourself as "em" and to the customer as "anh/chị".`,
+	},
+}
+
+// Build the chat system prompt for a user's preferences: chatSystemPrompt
+// followed by one instruction per recognised preference value
+func chatSystemPromptFor(prefs UserPreferences) string {
+	lines := []string{chatSystemPrompt}
+	for _, pref := range []struct{ field, value string }{
+		{"language", prefs.Language},
+		{"tone", prefs.Tone},
+		{"addressingStyle", prefs.AddressingStyle},
+	} {
+		if text, ok := preferencePromptText[pref.field][pref.value]; ok {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// Print a user's preferences
+func printPreferences(prefs UserPreferences) {
+	fmt.Println("⚙️ Preferences:")
+	fmt.Printf("  language                %s\n", prefs.Language)
+	fmt.Printf("  tone                    %s\n", prefs.Tone)
+	fmt.Printf("  addressingStyle         %s\n", prefs.AddressingStyle)
+	printRetrievalPreferences(prefs.Retrieval)
+}
+
+// In-chat /prefs: show preferences, or "/prefs <field> <value>" to set one
+func handlePrefsCommand(ctx context.Context, fields []string, userID string) {
+	switch len(fields) {
+	case 1:
+		session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+		defer session.Close(context.Background())
+		prefs, err := getUserPreferences(ctx, session, userID)
+		if err != nil {
+			slog.Error("Error loading preferences", "userId", userID, "err", err)
+			return
+		}
+		printPreferences(prefs)
+	case 3:
+		prefs, err := updateUserPreferences(ctx, userID, map[string]string{fields[1]: fields[2]})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		printPreferences(prefs)
+	default:
+		fmt.Println("Usage: /prefs [<field> <value>]")
+	}
+}
+
+// prefs: show or change a user's preferences out of the chat
+func runPrefs(args []string) error {
+	if len(args) == 0 || (args[0] != "get" && args[0] != "set") {
+		return fmt.Errorf("usage: prefs get --user <userId> | prefs set --user <userId> [--language vi|en] [--tone friendly|formal|casual] [--addressing-style tôi|mình|em|you] [--retrieval-top-k n] [--retrieval-min-similarity f] [--inject-context true|false]")
+	}
+
+	flags := flag.NewFlagSet("prefs "+args[0], flag.ExitOnError)
+	user := flags.String("user", "", "ID of the user")
+	var language, tone, addressing, topK, minSimilarity, injectContext *string
+	if args[0] == "set" {
+		language = flags.String("language", "", "preferred language")
+		tone = flags.String("tone", "", "preferred tone")
+		addressing = flags.String("addressing-style", "", "preferred addressing style")
+		topK = flags.String("retrieval-top-k", "", "related messages retrieved per turn (0-50, or default)")
+		minSimilarity = flags.String("retrieval-min-similarity", "", "minimum similarity of retrieved messages (or default)")
+		injectContext = flags.String("inject-context", "", "inject retrieved messages into replies: true, false or default")
+	}
+	flags.Parse(args[1:])
+	if *user == "" {
+		return fmt.Errorf("--user is required")
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	ctx := context.Background()
+	if args[0] == "get" {
+		session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+		defer session.Close(context.Background())
+		prefs, err := getUserPreferences(ctx, session, *user)
+		if err != nil {
+			return err
+		}
+		printPreferences(prefs)
+		return nil
+	}
+
+	updates := make(map[string]string)
+	fields := map[string]string{
+		"language":               *language,
+		"tone":                   *tone,
+		"addressingStyle":        *addressing,
+		"retrievalTopK":          *topK,
+		"retrievalMinSimilarity": *minSimilarity,
+		"injectContext":          *injectContext,
+	}
+	for field, value := range fields {
+		if value != "" {
+			updates[field] = value
+		}
+	}
+	prefs, err := updateUserPreferences(ctx, *user, updates)
+	if err != nil {
+		return err
+	}
+	printPreferences(prefs)
+	return nil
+}
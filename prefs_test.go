@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParsePreference(t *testing.T) {
+	tests := []struct {
+		field   string
+		value   string
+		want    any
+		wantErr bool
+	}{
+		{"language", "en", "en", false},
+		{"tone", "formal", "formal", false},
+		{"addressingStyle", "mình", "mình", false},
+		{"language", "fr", nil, true},
+		{"tone", "Formal", nil, true},
+		{"addressingStyle", "", nil, true},
+		{"nickname", "Bo", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePreference(tt.field, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePreference(%q, %q) error = %v, wantErr %v", tt.field, tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parsePreference(%q, %q) = %v, want %v", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateUserPreferences(t *testing.T) {
+	session := requireNeo4j(t, nil)
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	prefs, err := updateUserPreferences(ctx, userID, map[string]string{"language": "en", "tone": "formal"})
+	if err != nil {
+		t.Fatalf("updateUserPreferences: %v", err)
+	}
+	if prefs.Language != "en" || prefs.Tone != "formal" || prefs.AddressingStyle != defaultUserPreferences.AddressingStyle {
+		t.Errorf("preferences = %+v, want en, formal and the default addressing style", prefs)
+	}
+
+	// one invalid value rejects the whole update
+	if _, err := updateUserPreferences(ctx, userID, map[string]string{"language": "vi", "tone": "grumpy"}); err == nil {
+		t.Error("updateUserPreferences accepted an invalid tone")
+	}
+	stored, err := getUserPreferences(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("getUserPreferences: %v", err)
+	}
+	if stored.Language != "en" || stored.Tone != "formal" {
+		t.Errorf("stored preferences = %+v after a rejected update, want en and formal", stored)
+	}
+
+	if _, err := updateUserPreferences(ctx, "missing-"+userID, map[string]string{"language": "vi"}); err == nil {
+		t.Error("updateUserPreferences succeeded for an unknown user")
+	}
+}
+
+func TestChatSystemPromptFor(t *testing.T) {
+	prompt := chatSystemPromptFor(UserPreferences{Language: "en", Tone: "formal", AddressingStyle: "em"})
+	if !strings.HasPrefix(prompt, chatSystemPrompt) {
+		t.Errorf("prompt does not start with chatSystemPrompt:\n%s", prompt)
+	}
+	for _, want := range []string{
+		preferencePromptText["language"]["en"],
+		preferencePromptText["tone"]["formal"],
+		preferencePromptText["addressingStyle"]["em"],
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt lacks %q:\n%s", want, prompt)
+		}
+	}
+
+	// unknown values and "you" add nothing
+	if got := chatSystemPromptFor(UserPreferences{Language: "fr", AddressingStyle: "you"}); got != chatSystemPrompt {
+		t.Errorf("prompt = %q, want chatSystemPrompt alone", got)
+	}
+}
+
+func TestStoredPreferencesShapeChatPrompt(t *testing.T) {
+	session := requireNeo4j(t, nil)
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	if _, err := updateUserPreferences(ctx, userID, map[string]string{"language": "en", "tone": "casual"}); err != nil {
+		t.Fatalf("updateUserPreferences: %v", err)
+	}
+	prefs, err := getUserPreferences(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("getUserPreferences: %v", err)
+	}
+	prompt := chatSystemPromptFor(prefs)
+	if !strings.Contains(prompt, "Always reply in English.") || !strings.Contains(prompt, "relaxed, casual tone") {
+		t.Errorf("prompt from stored preferences = %q", prompt)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Periods after which a user's token usage starts again from zero
+const (
+	TokenQuotaMonthly = "monthly"
+	TokenQuotaTotal   = "total"
+)
+
+// Returned (wrapped) when a user has used up cfg.TokenQuota
+var errTokenQuotaExceeded = errors.New("token quota exceeded")
+
+// Validate a TOKEN_QUOTA_PERIOD value
+func parseTokenQuotaPeriod(value string) (string, error) {
+	switch value {
+	case TokenQuotaMonthly, TokenQuotaTotal:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid TOKEN_QUOTA_PERIOD %q (want %s or %s)", value, TokenQuotaMonthly, TokenQuotaTotal)
+}
+
+// Key of the quota period containing now, stored as tokenPeriod on the user:
+// the month for monthly quotas, "" for a total quota
+func tokenQuotaPeriod(now time.Time) string {
+	if cfg.TokenQuotaPeriod == TokenQuotaMonthly {
+		return now.UTC().Format("2006-01")
+	}
+	return ""
+}
+
+// Add a chat completion's tokens to the user's usage for the current
+// period (tokensUsed, reset when the period changes) and overall
+// (tokensUsedTotal)
+func recordTokenUsage(ctx context.Context, tx neo4j.ManagedTransaction, userID string, tokens int) error {
+	query := `
+		MATCH (u:User {userId: $userId})
+		SET u.tokensUsed = CASE WHEN coalesce(u.tokenPeriod, "") = $period THEN coalesce(u.tokensUsed, 0) ELSE 0 END + $tokens,
+			u.tokenPeriod = $period,
+			u.tokensUsedTotal = coalesce(u.tokensUsedTotal, 0) + $tokens
+	`
+	params := map[string]any{"userId": userID, "period": tokenQuotaPeriod(time.Now()), "tokens": tokens}
+	if _, err := tx.Run(ctx, query, params); err != nil {
+		return fmt.Errorf("failed to record token usage: %v", err)
+	}
+	return nil
+}
+
+// Tokens the user has used in the current quota period
+func tokensUsed(ctx context.Context, tx neo4j.ManagedTransaction, userID string) (int64, error) {
+	query := `
+		MATCH (u:User {userId: $userId})
+		RETURN CASE WHEN coalesce(u.tokenPeriod, "") = $period THEN coalesce(u.tokensUsed, 0) ELSE 0 END
+	`
+	records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "period": tokenQuotaPeriod(time.Now())})
+	if err != nil {
+		return 0, err
+	}
+	if !records.Next(ctx) {
+		return 0, records.Err()
+	}
+	used, _ := records.Record().Values[0].(int64)
+	return used, nil
+}
+
+// Fail with errTokenQuotaExceeded once the user's usage reaches
+// cfg.TokenQuota (0 = no quota)
+func checkTokenQuota(ctx context.Context, tx neo4j.ManagedTransaction, userID string) error {
+	if cfg.TokenQuota <= 0 {
+		return nil
+	}
+	used, err := tokensUsed(ctx, tx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load token usage: %v", err)
+	}
+	if used >= cfg.TokenQuota {
+		period := "in total"
+		if cfg.TokenQuotaPeriod == TokenQuotaMonthly {
+			period = "this month"
+		}
+		return fmt.Errorf("%w: user %s has used %d of %d tokens %s", errTokenQuotaExceeded, userID, used, cfg.TokenQuota, period)
+	}
+	return nil
+}
+
+// checkTokenQuota in its own read transaction on the caller's session
+func checkUserTokenQuota(ctx context.Context, session neo4j.SessionWithContext, userID string) error {
+	if cfg.TokenQuota <= 0 {
+		return nil
+	}
+	_, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		return nil, checkTokenQuota(ctx, tx, userID)
+	}, txTimeout(ctx))
+	if err != nil && !errors.Is(err, errTokenQuotaExceeded) {
+		return fmt.Errorf("failed to check token quota: %w", neo4jError(ctx, err))
+	}
+	return err
+}
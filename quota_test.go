@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestTokenQuotaPeriod(t *testing.T) {
+	for _, value := range []string{TokenQuotaMonthly, TokenQuotaTotal} {
+		if got, err := parseTokenQuotaPeriod(value); err != nil || got != value {
+			t.Errorf("parseTokenQuotaPeriod(%q) = %q, %v", value, got, err)
+		}
+	}
+	if _, err := parseTokenQuotaPeriod("weekly"); err == nil {
+		t.Error("parseTokenQuotaPeriod accepted weekly")
+	}
+
+	// months are UTC, so a late evening in UTC+7 is still the UTC month
+	now := time.Date(2026, 3, 31, 23, 30, 0, 0, time.FixedZone("UTC+7", 7*3600))
+	setTestConfig(t, func(c *Config) { c.TokenQuotaPeriod = TokenQuotaMonthly })
+	if got := tokenQuotaPeriod(now); got != "2026-03" {
+		t.Errorf("monthly period = %q, want 2026-03", got)
+	}
+	setTestConfig(t, func(c *Config) { c.TokenQuotaPeriod = TokenQuotaTotal })
+	if got := tokenQuotaPeriod(now); got != "" {
+		t.Errorf("total period = %q, want empty", got)
+	}
+}
+
+func TestTokenQuota(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TokenQuota = 100
+		c.TokenQuotaPeriod = TokenQuotaMonthly
+	})
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	record := func(tokens int) {
+		t.Helper()
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			return nil, recordTokenUsage(ctx, tx, userID, tokens)
+		})
+		if err != nil {
+			t.Fatalf("recordTokenUsage: %v", err)
+		}
+	}
+
+	record(60)
+	if err := checkUserTokenQuota(ctx, session, userID); err != nil {
+		t.Fatalf("checkUserTokenQuota under the quota: %v", err)
+	}
+	record(40)
+	if err := checkUserTokenQuota(ctx, session, userID); !errors.Is(err, errTokenQuotaExceeded) {
+		t.Fatalf("checkUserTokenQuota at the quota = %v, want errTokenQuotaExceeded", err)
+	}
+
+	// usage from an earlier month no longer counts
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(ctx, "MATCH (u:User {userId: $userId}) SET u.tokenPeriod = '2000-01'", map[string]any{"userId": userID})
+		return nil, err
+	})
+	if err != nil {
+		t.Fatalf("failed to age token usage: %v", err)
+	}
+	if err := checkUserTokenQuota(ctx, session, userID); err != nil {
+		t.Errorf("checkUserTokenQuota in a new month: %v", err)
+	}
+	record(10)
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		used, err := tokensUsed(ctx, tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		records, err := tx.Run(ctx, "MATCH (u:User {userId: $userId}) RETURN u.tokensUsedTotal", map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		total, _ := record.Values[0].(int64)
+		return [2]int64{used, total}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to load token usage: %v", err)
+	}
+	if usage := result.([2]int64); usage != [2]int64{10, 110} {
+		t.Errorf("usage = %d this period, %d total; want 10 and 110", usage[0], usage[1])
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Topic changes for one message found by reclassifyAll
+type topicChange struct {
+	MessageID string
+	// New topic list: the extracted tags plus kept auto-topics
+	Topics     []string
+	Removed    []string
+	Extraction TopicExtraction
+}
+
+// Message to reclassify with the auto-topics it belongs to
+type reclassifyItem struct {
+	Message    Message
+	AutoTopics []string
+}
+
+// Tags in a that are not in b
+func missingTopics(a []string, b []string) []string {
+	var missing []string
+	for _, topic := range a {
+		if !containsString(b, topic) {
+			missing = append(missing, topic)
+		}
+	}
+	return missing
+}
+
+// Re-extract topics for every message of a user under the current taxonomy,
+// dropping BELONGS_TO edges to retired tags and adding edges for new ones.
+// Auto-topics are kept. Messages are written in batches of
+// cfg.ReclassifyBatchSize, waiting cfg.ReclassifyDelay between extractions.
+// With dryRun the changes are printed but not written. Orphaned topics are
+// pruned afterwards. Returns the number of messages whose topics changed.
+func reclassifyAll(ctx context.Context, client *openai.Client, userID string, dryRun bool) (int, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})
+			RETURN m.messageId, m.content, coalesce(m.topics, []),
+				[(m)-[r:BELONGS_TO]->(t:Topic) WHERE r.topicPromptVersion = $autoVersion | t.name]
+			ORDER BY m.timestamp, m.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "autoVersion": autoTopicVersion})
+		if err != nil {
+			return nil, err
+		}
+
+		var items []reclassifyItem
+		for records.Next(ctx) {
+			values := records.Record().Values
+			message := Message{Topics: toStringSlice(values[2])}
+			message.MessageID, _ = values[0].(string)
+			message.Content, _ = values[1].(string)
+			items = append(items, reclassifyItem{Message: message, AutoTopics: toStringSlice(values[3])})
+		}
+		return items, records.Err()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to load messages for reclassification: %v", err)
+	}
+	items := result.([]reclassifyItem)
+
+	batchSize := max(cfg.ReclassifyBatchSize, 1)
+	currentVersion := topicPromptVersion()
+	changed := 0
+	var batch []topicChange
+	flush := func() error {
+		if len(batch) == 0 || dryRun {
+			batch = nil
+			return nil
+		}
+		unlock := userIngestLocks.Lock(userID)
+		defer unlock()
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			for _, change := range batch {
+				query := `
+					MATCH (m:Message {messageId: $messageId})
+					SET m.topics = $topics,
+						m.topicPromptVersion = $version,
+						m.topicTagsRaw = $topicTagsRaw,
+						m.topicTagsRejected = $topicTagsRejected
+					WITH m
+					OPTIONAL MATCH (m)-[r:BELONGS_TO]->(t:Topic)
+					WHERE t.name IN $removed
+					DELETE r
+				`
+				params := map[string]any{
+					"messageId":         change.MessageID,
+					"topics":            change.Topics,
+					"version":           currentVersion,
+					"topicTagsRaw":      change.Extraction.Raw,
+					"topicTagsRejected": len(change.Extraction.Rejected),
+					"removed":           change.Removed,
+				}
+				if _, err := tx.Run(ctx, query, params); err != nil {
+					return nil, err
+				}
+				linkMessageTopics(ctx, tx, change.MessageID, change.Extraction.Accepted, currentVersion)
+			}
+			return nil, nil
+		})
+		batch = nil
+		if err != nil {
+			return fmt.Errorf("failed to write reclassified topics: %v", err)
+		}
+		return nil
+	}
+
+	for i, item := range items {
+		if i > 0 && cfg.ReclassifyDelay > 0 {
+			select {
+			case <-ctx.Done():
+				return changed, ctx.Err()
+			case <-time.After(cfg.ReclassifyDelay):
+			}
+		}
+
+		extraction, err := extractTopicTags(ctx, client, item.Message.Content)
+		if err != nil {
+			slog.Error("Error reclassifying message", "messageId", item.Message.MessageID, "err", err)
+			continue
+		}
+
+		topics := append(append([]string{}, extraction.Accepted...), missingTopics(item.AutoTopics, extraction.Accepted)...)
+		added := missingTopics(topics, item.Message.Topics)
+		removed := missingTopics(item.Message.Topics, topics)
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+
+		changed++
+		if dryRun {
+			fmt.Printf("🏷️ %s: +%v -%v\n", item.Message.MessageID, added, removed)
+		}
+		batch = append(batch, topicChange{
+			MessageID:  item.Message.MessageID,
+			Topics:     topics,
+			Removed:    removed,
+			Extraction: extraction,
+		})
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return changed, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return changed, err
+	}
+
+	if dryRun {
+		fmt.Printf("🏷️ Dry run: %d/%d messages would be reclassified\n", changed, len(items))
+		return changed, nil
+	}
+
+	pruned, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		return pruneOrphanTopics(ctx, tx)
+	})
+	if err != nil {
+		return changed, err
+	}
+	fmt.Printf("🏷️ Reclassified %d/%d messages, pruned %d orphaned topics\n", changed, len(items), pruned.(int))
+	return changed, nil
+}
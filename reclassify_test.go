@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestMissingTopics(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want []string
+	}{
+		{[]string{"Áo", "Giày"}, []string{"Giày"}, []string{"Áo"}},
+		{[]string{"Áo"}, []string{"Áo", "Giày"}, nil},
+		{nil, []string{"Áo"}, nil},
+		{[]string{"Áo", "Mũ"}, nil, []string{"Áo", "Mũ"}},
+	}
+	for _, tt := range tests {
+		if got := missingTopics(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("missingTopics(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// Names of the topics a message has BELONGS_TO edges to, sorted
+func testTopicEdges(t *testing.T, session neo4j.SessionWithContext, messageID string) []string {
+	t.Helper()
+	ctx := context.Background()
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, "MATCH (:Message {messageId: $id})-[:BELONGS_TO]->(t:Topic) RETURN t.name", map[string]any{"id": messageID})
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for records.Next(ctx) {
+			name, _ := records.Record().Values[0].(string)
+			names = append(names, name)
+		}
+		return names, records.Err()
+	})
+	if err != nil {
+		t.Fatalf("failed to load topic edges: %v", err)
+	}
+	names := result.([]string)
+	sort.Strings(names)
+	return names
+}
+
+func TestReclassifyAll(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.OpenAIMaxRetries = 0
+		c.ReclassifyBatchSize = 1
+		c.ReclassifyDelay = 0
+	})
+	ctx := context.Background()
+	client, fake := newFakeOpenAI(t)
+	fake.chatReply = func(content string) string {
+		if strings.Contains(content, "giày") {
+			return "Giày"
+		}
+		return "Áo"
+	}
+
+	userID := createTestUser(t, session)
+	now := time.Now().Unix()
+	retagged := storeTestMessage(t, session, userID, Message{Content: "giày còn size 42 không", Timestamp: now, Topics: []string{"Áo"}})
+	unchanged := storeTestMessage(t, session, userID, Message{Content: "áo thun trắng", Timestamp: now + 1, Topics: []string{"Áo"}})
+
+	changed, err := reclassifyAll(ctx, client, userID, true)
+	if err != nil || changed != 1 {
+		t.Fatalf("dry run reclassifyAll = %d, %v; want 1 change", changed, err)
+	}
+	if got := testTopicEdges(t, session, retagged.MessageID); !reflect.DeepEqual(got, []string{"Áo"}) {
+		t.Fatalf("dry run changed topics to %v", got)
+	}
+
+	changed, err = reclassifyAll(ctx, client, userID, false)
+	if err != nil || changed != 1 {
+		t.Fatalf("reclassifyAll = %d, %v; want 1 change", changed, err)
+	}
+	if got := testTopicEdges(t, session, retagged.MessageID); !reflect.DeepEqual(got, []string{"Giày"}) {
+		t.Errorf("retagged message belongs to %v, want [Giày]", got)
+	}
+	if got := testTopicEdges(t, session, unchanged.MessageID); !reflect.DeepEqual(got, []string{"Áo"}) {
+		t.Errorf("unchanged message belongs to %v, want [Áo]", got)
+	}
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if !reflect.DeepEqual(messages[0].Topics, []string{"Giày"}) {
+		t.Errorf("stored topics = %v, want [Giày]", messages[0].Topics)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Ensure every message added within cfg.ReconcileLookback is linked to all
+// above-threshold messages of its user, creating edges missed by concurrent
+// or failed ingestion. Waits cfg.ReconcileDelay between messages to limit
+// load on the database. Returns the number of edges created.
+func reconcileEdges(ctx context.Context) (int, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message)
+			WHERE m.timestamp >= $since AND (size(m.embedding) > 0 OR m.embeddingGz IS NOT NULL)
+			RETURN m, m.userId
+			ORDER BY m.timestamp
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"since": time.Now().Add(-cfg.ReconcileLookback).Unix()})
+		if err != nil {
+			return nil, err
+		}
+
+		var pending []userMessage
+		for records.Next(ctx) {
+			record := records.Record()
+			node, ok := record.Values[0].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			userID, _ := record.Values[1].(string)
+			pending = append(pending, userMessage{Message: messageFromNode(node), UserID: userID})
+		}
+		return pending, records.Err()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to load recent messages: %v", err)
+	}
+
+	created := 0
+	for i, item := range result.([]userMessage) {
+		if i > 0 && cfg.ReconcileDelay > 0 {
+			select {
+			case <-ctx.Done():
+				return created, ctx.Err()
+			case <-time.After(cfg.ReconcileDelay):
+			}
+		}
+
+		unlock := userIngestLocks.Lock(item.UserID)
+		edges, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			return createSimilarityEdges(ctx, tx, item.Message, item.UserID)
+		})
+		unlock()
+		if err != nil {
+			slog.Error("Failed to reconcile edges", "messageId", item.Message.MessageID, "userId", item.UserID, "err", err)
+			continue
+		}
+		created += edges.(int)
+	}
+
+	if created > 0 {
+		fmt.Printf("🔧 Reconciled %d missing similarity edges\n", created)
+	}
+	return created, nil
+}
+
+// Run reconcileEdges every cfg.ReconcileInterval until ctx is cancelled.
+// Does nothing when the interval is zero (the default).
+func startEdgeReconciler(ctx context.Context) {
+	if cfg.ReconcileInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.ReconcileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := reconcileEdges(ctx); err != nil && ctx.Err() == nil {
+					slog.Error("Edge reconciliation failed", "err", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestReconcileEdgesRestoresMissingLink(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.ReconcileLookback = time.Hour
+		c.ReconcileDelay = 0
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+	})
+	ctx := context.Background()
+
+	userID := createTestUser(t, session)
+	now := time.Now().Unix()
+	first := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0}})
+	second := storeTestMessage(t, session, userID, Message{Content: "giày cỡ 42", Timestamp: now, Embedding: []float64{0.9, 0.1}})
+	if n := countTestLinks(t, session, first.MessageID, second.MessageID); n != 1 {
+		t.Fatalf("%d links after ingestion, want 1", n)
+	}
+
+	// lose the edge as a failed concurrent write would
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(ctx, "MATCH (:Message {messageId: $id})-[r:CONTEXTUAL_LINK]-() DELETE r", map[string]any{"id": first.MessageID})
+		return nil, err
+	})
+	if err != nil {
+		t.Fatalf("failed to delete link: %v", err)
+	}
+
+	if _, err := reconcileEdges(ctx); err != nil {
+		t.Fatalf("reconcileEdges: %v", err)
+	}
+	if n := countTestLinks(t, session, first.MessageID, second.MessageID); n != 1 {
+		t.Errorf("%d links after reconciliation, want 1", n)
+	}
+}
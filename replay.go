@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// One line of a replay file
+type replayRecord struct {
+	UserID    string `json:"userId"`
+	Sender    string `json:"sender"`
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Decode and validate one JSON line of a replay or ingest stream.
+// defaultUserID is used when the line has no userId and the current time
+// when it has no timestamp.
+func parseRecordLine(line string, defaultUserID string) (replayRecord, error) {
+	var record replayRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return record, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if record.UserID == "" {
+		record.UserID = defaultUserID
+	}
+	if record.UserID == "" || record.Sender == "" || record.Content == "" {
+		return record, fmt.Errorf("userId, sender and content are required")
+	}
+	if record.Timestamp == 0 {
+		record.Timestamp = time.Now().Unix()
+	}
+	return record, nil
+}
+
+// Sidecar file recording the last successfully ingested line of a replay
+func checkpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// Read the last ingested line number from the checkpoint, 0 if none
+func readCheckpoint(path string) (int, error) {
+	data, err := os.ReadFile(checkpointPath(path))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	line, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid checkpoint %s: %v", checkpointPath(path), err)
+	}
+	return line, nil
+}
+
+// Atomically record the last ingested line number
+func writeCheckpoint(path string, line int) error {
+	tmp := checkpointPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(line)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, checkpointPath(path))
+}
+
+// Report whether the user already has this message, so a resumed replay
+// does not duplicate lines ingested just before the checkpoint was written
+func messageAlreadyIngested(ctx context.Context, session neo4j.SessionWithContext, userID string, hash string, timestamp int64) (bool, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId, contentHash: $contentHash, timestamp: $timestamp})
+			RETURN count(m) > 0
+		`
+		params := map[string]any{
+			"userId":      userID,
+			"contentHash": hash,
+			"timestamp":   timestamp,
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		exists, _ := record.Values[0].(bool)
+		return exists, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
+
+// Ingest a JSONL file of {userId, sender, content, timestamp} records
+// through the message pipeline. defaultUserID is used for lines without a
+// userId. Progress is checkpointed after every line up to the first failed
+// one, and the checkpoint is kept when any line failed; with resume the
+// replay continues after the last checkpointed line. Invalid or failing
+// lines are reported per line ("line N") in the BatchResult and do not stop
+// the replay.
+func replayFile(ctx context.Context, client *openai.Client, path string, defaultUserID string, resume bool) (BatchResult, error) {
+	var batch BatchResult
+	file, err := os.Open(path)
+	if err != nil {
+		return batch, fmt.Errorf("failed to open replay file: %v", err)
+	}
+	defer file.Close()
+
+	startAfter := 0
+	if resume {
+		startAfter, err = readCheckpoint(path)
+		if err != nil {
+			return batch, err
+		}
+		if startAfter > 0 {
+			fmt.Printf("⏩ Resuming replay after line %d\n", startAfter)
+		}
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	// Lines are stored in batches of cfg.TopicUpsertBatchSize (one at a
+	// time when unset) so a batch's topics can be upserted together
+	type replayLine struct {
+		number  int
+		id      string
+		userID  string
+		message Message
+		exists  bool
+	}
+	var pending []replayLine
+	users := make(map[string]bool)
+	flush := func() {
+		var messages []Message
+		for _, line := range pending {
+			if !line.exists {
+				messages = append(messages, line.message)
+			}
+		}
+		batchCtx := topicBatchContext(ctx, session, messages)
+		for _, line := range pending {
+			if line.exists {
+				batch.skip()
+			} else {
+				if err := addMessageAndCreateEdges(batchCtx, session, line.message, line.userID); err != nil {
+					batch.fail(line.id, err)
+					continue
+				}
+				users[line.userID] = true
+				batch.succeed(line.id)
+			}
+
+			// Never move past a failed line, so a resumed replay retries it
+			if batch.Failed > 0 {
+				continue
+			}
+			if err := writeCheckpoint(path, line.number); err != nil {
+				slog.Error("Failed to write replay checkpoint", "line", line.number, "err", err)
+			}
+		}
+		pending = pending[:0]
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if lineNumber <= startAfter {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return batch, err
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lineID := fmt.Sprintf("line %d", lineNumber)
+
+		record, err := parseRecordLine(line, defaultUserID)
+		if err != nil {
+			batch.fail(lineID, err)
+			continue
+		}
+
+		message := Message{
+			MessageID:   generateID(),
+			Timestamp:   record.Timestamp,
+			Sender:      record.Sender,
+			Content:     record.Content,
+			ContentHash: contentHash(record.Sender, record.Content),
+		}
+
+		exists, err := messageAlreadyIngested(ctx, session, record.UserID, message.ContentHash, message.Timestamp)
+		if err != nil {
+			batch.fail(lineID, fmt.Errorf("failed to check for existing message: %v", err))
+			continue
+		}
+		// Earlier lines of the pending batch are not stored yet
+		for _, earlier := range pending {
+			if earlier.userID == record.UserID && earlier.message.ContentHash == message.ContentHash && earlier.message.Timestamp == message.Timestamp {
+				exists = true
+			}
+		}
+		if !exists {
+			message.CorrelationID = generateID()
+			enrichMessage(withCorrelationID(ctx, message.CorrelationID), newOpenAIEnricher(client), &message)
+		}
+
+		pending = append(pending, replayLine{number: lineNumber, id: lineID, userID: record.UserID, message: message, exists: exists})
+		if len(pending) >= max(cfg.TopicUpsertBatchSize, 1) {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return batch, fmt.Errorf("failed to read replay file: %v", err)
+	}
+	flush()
+
+	// Imported timestamps may be older or newer than the live lastActive
+	for userID := range users {
+		if _, err := recomputeLastActive(ctx, userID); err != nil {
+			slog.Error("Failed to recompute last active", "userId", userID, "err", err)
+		}
+	}
+
+	if batch.Failed > 0 {
+		if startAfter, _ := readCheckpoint(path); startAfter > 0 {
+			fmt.Printf("⏸️ Keeping the checkpoint at line %d; rerun with --resume to retry the failed lines\n", startAfter)
+		}
+	} else if err := os.Remove(checkpointPath(path)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove replay checkpoint", "err", err)
+	}
+	logBatchFailures("Replay", batch)
+	fmt.Printf("📥 Replay finished: %d messages ingested, %d already present, %d failed\n", batch.Succeeded, batch.Skipped, batch.Failed)
+	return batch, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.jsonl")
+
+	if line, err := readCheckpoint(path); err != nil || line != 0 {
+		t.Fatalf("readCheckpoint without a checkpoint = %d, %v; want 0, nil", line, err)
+	}
+	for _, want := range []int{3, 120} {
+		if err := writeCheckpoint(path, want); err != nil {
+			t.Fatalf("writeCheckpoint(%d): %v", want, err)
+		}
+		if line, err := readCheckpoint(path); err != nil || line != want {
+			t.Errorf("readCheckpoint = %d, %v; want %d", line, err, want)
+		}
+	}
+	if _, err := os.Stat(checkpointPath(path) + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary checkpoint left behind: %v", err)
+	}
+}
+
+func TestReadCheckpointInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.jsonl")
+	if err := os.WriteFile(checkpointPath(path), []byte("line five\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCheckpoint(path); err == nil {
+		t.Error("readCheckpoint accepted a non-numeric checkpoint")
+	}
+}
+
+func TestParseRecordLine(t *testing.T) {
+	record, err := parseRecordLine(`{"sender": "human", "content": "giày size 42", "timestamp": 1700000000}`, "u1")
+	want := replayRecord{UserID: "u1", Sender: "human", Content: "giày size 42", Timestamp: 1700000000}
+	if err != nil || record != want {
+		t.Errorf("parseRecordLine = %+v, %v; want %+v", record, err, want)
+	}
+	record, err = parseRecordLine(`{"userId": "u2", "sender": "ai", "content": "dạ còn ạ"}`, "u1")
+	if err != nil || record.UserID != "u2" || record.Timestamp == 0 {
+		t.Errorf("parseRecordLine without a timestamp = %+v, %v; want u2 at the current time", record, err)
+	}
+	for _, line := range []string{
+		"not json",
+		`{"sender": "human", "content": "giày"}`,
+		`{"userId": "u2", "content": "giày"}`,
+		`{"userId": "u2", "sender": "human"}`,
+	} {
+		if _, err := parseRecordLine(line, ""); err == nil {
+			t.Errorf("parseRecordLine(%s) accepted an invalid line", line)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// System prompt of the chat
+const chatSystemPrompt = "You are a helpful and friendly chatbot."
+
+// Run a chat completion over history and post-process the reply. Returns
+// the reply and its generation info (with the unprocessed reply when
+// cfg.KeepOriginalResponse is set).
+func generateReply(ctx context.Context, client *openai.Client, history []openai.ChatCompletionMessage) (string, *GenerationInfo, error) {
+	request := openai.ChatCompletionRequest{
+		Model:    cfg.ChatModel,
+		Messages: history,
+	}
+	resp, err := withOpenAIRetry(ctx, func(ctx context.Context) (openai.ChatCompletionResponse, error) {
+		return client.CreateChatCompletion(ctx, request)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return finishReply(request, resp)
+}
+
+// Reply and generation info of a completed chat completion, post-processed
+// as described for generateReply
+func finishReply(request openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) (string, *GenerationInfo, error) {
+	if len(resp.Choices) == 0 {
+		return "", nil, fmt.Errorf("no choices in chat completion")
+	}
+
+	reply := resp.Choices[0].Message.Content
+	generation := newGenerationInfo(request, resp)
+	if processed := postProcessResponse(reply); processed != reply {
+		if cfg.KeepOriginalResponse {
+			generation.OriginalContent = reply
+		}
+		reply = processed
+	}
+	return reply, generation, nil
+}
+
+// Returned (wrapped) by streamReply when the stream breaks after content
+// has arrived, so the partial reply is neither stored nor linked
+var errReplyInterrupted = errors.New("reply stream interrupted")
+
+// Like generateReply, but stream the completion and pass each piece of
+// content to onDelta as it arrives. With post-processors registered, the
+// stream is buffered and onDelta gets the whole processed reply once, so
+// what is shown matches what is stored. Opening the stream is retried as in
+// withOpenAIRetry; a stream that breaks after content has arrived, or ends
+// without a finish reason, fails with errReplyInterrupted instead.
+func streamReply(ctx context.Context, client *openai.Client, history []openai.ChatCompletionMessage, onDelta func(string)) (string, *GenerationInfo, error) {
+	request := openai.ChatCompletionRequest{
+		Model:         cfg.ChatModel,
+		Messages:      history,
+		Stream:        true,
+		StreamOptions: &openai.StreamOptions{IncludeUsage: true},
+	}
+	live := len(responsePostProcessors) == 0
+	// Set when content has already been passed on, so the call is not retried
+	var interrupted error
+	resp, err := withOpenAIRetry(ctx, func(ctx context.Context) (openai.ChatCompletionResponse, error) {
+		resp := openai.ChatCompletionResponse{}
+		stream, err := client.CreateChatCompletionStream(ctx, request)
+		if err != nil {
+			return resp, err
+		}
+		defer stream.Close()
+
+		var content strings.Builder
+		finished := false
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				if !finished && content.Len() > 0 {
+					interrupted = fmt.Errorf("stream ended without a finish reason")
+				}
+				break
+			}
+			if err != nil {
+				if content.Len() == 0 {
+					return resp, err
+				}
+				interrupted = contextError(ctx, err)
+				break
+			}
+			if chunk.Model != "" {
+				resp.Model = chunk.Model
+			}
+			if chunk.Usage != nil {
+				resp.Usage = *chunk.Usage
+			}
+			for _, choice := range chunk.Choices {
+				if choice.Index != 0 {
+					continue
+				}
+				if choice.Delta.Content != "" {
+					content.WriteString(choice.Delta.Content)
+					if live {
+						onDelta(choice.Delta.Content)
+					}
+				}
+				if choice.FinishReason != "" {
+					finished = true
+				}
+			}
+		}
+		if interrupted != nil {
+			return resp, nil
+		}
+		if content.Len() == 0 {
+			return resp, fmt.Errorf("no content in chat completion stream")
+		}
+		resp.Choices = []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content.String()},
+		}}
+		return resp, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if interrupted != nil {
+		slog.Warn("Reply stream interrupted, dropping the partial reply", "err", interrupted)
+		return "", nil, fmt.Errorf("%w: %w", errReplyInterrupted, interrupted)
+	}
+	reply, generation, err := finishReply(request, resp)
+	if err == nil && !live {
+		onDelta(reply)
+	}
+	return reply, generation, err
+}
+
+// Link an AI reply to the human message it answers with REPLIES_TO and clear
+// the human message's awaitingReply flag
+func linkReply(ctx context.Context, session neo4j.SessionWithContext, humanMessageID string, replyMessageID string) error {
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (human:Message {messageId: $humanId})
+			MATCH (reply:Message {messageId: $replyId})
+			MERGE (reply)-[:REPLIES_TO]->(human)
+			SET human.awaitingReply = false
+		`
+		_, err := tx.Run(ctx, query, map[string]any{"humanId": humanMessageID, "replyId": replyMessageID})
+		return nil, err
+	}, txTimeout(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to link reply: %w", neo4jError(ctx, err))
+	}
+	return nil
+}
+
+// Load a user's human messages still waiting for a reply, oldest first
+func awaitingReplies(ctx context.Context, userID string) ([]Message, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})
+			WHERE m.awaitingReply = true
+			RETURN m
+			ORDER BY m.timestamp, m.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		var messages []Message
+		for records.Next(ctx) {
+			if node, ok := records.Record().Values[0].(neo4j.Node); ok {
+				messages = append(messages, messageFromNode(node))
+			}
+		}
+		return messages, records.Err()
+	}, txTimeout(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages awaiting a reply: %w", neo4jError(ctx, err))
+	}
+	return result.([]Message), nil
+}
+
+// Generate and store replies for a user's messages left awaiting one when
+// the chat completion failed. Each message is answered on its own, without
+// the rest of the conversation.
+func answerAwaitingReplies(ctx context.Context, client *openai.Client, userID string) (BatchResult, error) {
+	var batch BatchResult
+	pending, err := awaitingReplies(ctx, userID)
+	if err != nil {
+		return batch, err
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	systemPrompt := chatSystemPrompt
+	if prefs, err := getUserPreferences(ctx, session, userID); err != nil {
+		slog.Warn("Error loading preferences, using the default prompt", "userId", userID, "err", err)
+	} else {
+		systemPrompt = chatSystemPromptFor(prefs)
+	}
+
+	for _, message := range pending {
+		history := []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: message.Content},
+		}
+		reply, generation, err := generateReply(withCallSpacer(ctx, interactiveCallSpacer), client, history)
+		if err != nil {
+			batch.fail(message.MessageID, err)
+			continue
+		}
+
+		fmt.Printf("Bot (reply to %q from %s): %s\n", message.Content, time.Unix(message.Timestamp, 0).Format("2006-01-02 15:04"), reply)
+		stored, err := ingestMessage(ctx, session, "ai", reply, newOpenAIEnricher(client), userID, messageScope{SessionID: message.SessionID, ScrimID: message.ScrimID}, generation, false)
+		if err != nil {
+			batch.fail(message.MessageID, fmt.Errorf("failed to store reply: %w", err))
+			continue
+		}
+		if err := linkReply(ctx, session, message.MessageID, stored.MessageID); err != nil {
+			batch.fail(message.MessageID, err)
+			continue
+		}
+		batch.succeed(message.MessageID)
+	}
+
+	logBatchFailures("Reply retry", batch)
+	fmt.Printf("💬 Replied to %d/%d messages awaiting a reply\n", batch.Succeeded, len(pending))
+	return batch, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Messages a stored message is linked to as their reply
+func testReplies(t *testing.T, session neo4j.SessionWithContext, messageID string) []string {
+	t.Helper()
+	ctx := context.Background()
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (reply:Message)-[:REPLIES_TO]->(:Message {messageId: $messageId})
+			RETURN reply.messageId
+			ORDER BY reply.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"messageId": messageID})
+		if err != nil {
+			return nil, err
+		}
+		var replies []string
+		for records.Next(ctx) {
+			id, _ := records.Record().Values[0].(string)
+			replies = append(replies, id)
+		}
+		return replies, records.Err()
+	})
+	if err != nil {
+		t.Fatalf("failed to load replies: %v", err)
+	}
+	return result.([]string)
+}
+
+func TestFailedReplyIsRecoverable(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.OpenAIMaxRetries = 0
+		c.DedupWindow = 0
+	})
+	ctx := context.Background()
+	client, fake := newFakeOpenAI(t)
+	userID := createTestUser(t, session)
+
+	// a chat turn whose completion fails with a server error
+	fake.chatStatus = http.StatusInternalServerError
+	human, err := ingestMessage(ctx, session, "human", "còn size 42 không?", newOpenAIEnricher(client), userID, messageScope{}, nil, true)
+	if err != nil {
+		t.Fatalf("ingestMessage: %v", err)
+	}
+	history := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: human.Content}}
+	if _, _, err := generateReply(ctx, client, history); err == nil {
+		t.Fatal("generateReply succeeded against a failing server")
+	}
+	awaiting, err := awaitingReplies(ctx, userID)
+	if err != nil {
+		t.Fatalf("awaitingReplies: %v", err)
+	}
+	if len(awaiting) != 1 || awaiting[0].MessageID != human.MessageID || !awaiting[0].AwaitingReply {
+		t.Fatalf("awaiting replies = %+v, want the human message flagged", awaiting)
+	}
+
+	// a failing retry keeps the flag
+	batch, err := answerAwaitingReplies(ctx, client, userID)
+	if err != nil {
+		t.Fatalf("answerAwaitingReplies: %v", err)
+	}
+	if batch.Failed != 1 {
+		t.Errorf("retry against a failing server = %+v, want 1 failure", batch)
+	}
+	if awaiting, _ := awaitingReplies(ctx, userID); len(awaiting) != 1 {
+		t.Errorf("%d messages awaiting a reply after a failed retry, want 1", len(awaiting))
+	}
+
+	fake.mu.Lock()
+	fake.chatStatus = 0
+	fake.chatReply = func(string) string { return "dạ còn size 42 ạ" }
+	fake.mu.Unlock()
+	batch, err = answerAwaitingReplies(ctx, client, userID)
+	if err != nil {
+		t.Fatalf("answerAwaitingReplies: %v", err)
+	}
+	if batch.Succeeded != 1 || batch.Failed != 0 {
+		t.Errorf("retry = %+v, want 1 success", batch)
+	}
+	if awaiting, _ := awaitingReplies(ctx, userID); len(awaiting) != 0 {
+		t.Errorf("%d messages awaiting a reply after the retry, want none", len(awaiting))
+	}
+	replies := testReplies(t, session, human.MessageID)
+	if len(replies) != 1 {
+		t.Fatalf("human message has %d replies, want 1", len(replies))
+	}
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	for _, message := range messages {
+		if message.MessageID == replies[0] && (message.Sender != "ai" || message.Content != "dạ còn size 42 ạ") {
+			t.Errorf("reply = %+v, want the generated bot reply", message)
+		}
+	}
+}
+
+// OpenAI client whose chat completion stream sends each of events as one
+// server-sent event and then closes the connection
+func newFakeStream(t *testing.T, events ...string) *openai.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	t.Cleanup(server.Close)
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	return openai.NewClientWithConfig(config)
+}
+
+// Stream event carrying content, and finishing the reply when finish is set
+func streamChunk(content string, finish bool) string {
+	finishReason := "null"
+	if finish {
+		finishReason = `"stop"`
+	}
+	delta, _ := json.Marshal(content)
+	return fmt.Sprintf(`{"id": "c1", "object": "chat.completion.chunk", "model": "gpt-4o-mini", "choices": [{"index": 0, "delta": {"content": %s}, "finish_reason": %s}]}`, delta, finishReason)
+}
+
+func TestStreamReply(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.OpenAIMaxRetries = 0 })
+	complete := []string{streamChunk("Dạ, gọi ", false), streamChunk("0912 345 678 ạ", true), "[DONE]"}
+	tests := []struct {
+		name       string
+		events     []string
+		redact     bool
+		wantReply  string
+		wantDeltas []string
+		wantErr    bool
+	}{
+		{"streamed as it arrives", complete, false, "Dạ, gọi 0912 345 678 ạ", []string{"Dạ, gọi ", "0912 345 678 ạ"}, false},
+		{"buffered for post-processing", complete, true, "Dạ, gọi [phone] ạ", []string{"Dạ, gọi [phone] ạ"}, false},
+		{"broken mid-way", []string{streamChunk("Dạ, gọi ", false), `{"error": {"message": "connection reset", "type": "server_error"}}`}, false, "", []string{"Dạ, gọi "}, true},
+		{"ended without finishing", []string{streamChunk("Dạ, gọi ", false)}, true, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetPostProcessors(t)
+			if tt.redact {
+				registerResponsePostProcessor(redactContactDetails)
+			}
+			var deltas []string
+			history := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "số điện thoại shop?"}}
+			reply, _, err := streamReply(context.Background(), newFakeStream(t, tt.events...), history, func(delta string) {
+				deltas = append(deltas, delta)
+			})
+			if tt.wantErr != errors.Is(err, errReplyInterrupted) {
+				t.Fatalf("streamReply error = %v, want interrupted %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("streamReply: %v", err)
+			}
+			if reply != tt.wantReply || !reflect.DeepEqual(deltas, tt.wantDeltas) {
+				t.Errorf("reply %q shown as %q, want %q shown as %q", reply, deltas, tt.wantReply, tt.wantDeltas)
+			}
+		})
+	}
+}
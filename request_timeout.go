@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Context for one Neo4j or OpenAI operation, cancelled after
+// cfg.RequestTimeout (no deadline when it is 0) or when parent is
+func requestContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if cfg.RequestTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, cfg.RequestTimeout)
+}
+
+// Transaction option bounding a Neo4j transaction by ctx's deadline, so a
+// stalled transaction is aborted server-side instead of blocking forever.
+// ctx alone only stops the client from waiting; the server keeps running
+// the transaction until its own timeout.
+func txTimeout(ctx context.Context) func(*neo4j.TransactionConfig) {
+	return func(config *neo4j.TransactionConfig) {
+		if deadline, ok := ctx.Deadline(); ok {
+			config.Timeout = max(time.Until(deadline), time.Millisecond)
+		}
+	}
+}
+
+// Wrap err as a timeout when ctx has expired, keeping ctx's error for
+// errors.Is(err, context.DeadlineExceeded)
+func contextError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w (%v)", cfg.RequestTimeout, ctx.Err(), err)
+	}
+	return fmt.Errorf("cancelled: %w (%v)", ctx.Err(), err)
+}
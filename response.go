@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Transforms a bot reply before it is shown and stored
+type ResponsePostProcessor func(reply string) string
+
+// Post-processors applied in order to every bot reply. Empty by default, so
+// replies are shown and stored as generated.
+var responsePostProcessors []ResponsePostProcessor
+
+// Add a post-processor to the end of the pipeline
+func registerResponsePostProcessor(processor ResponsePostProcessor) {
+	responsePostProcessors = append(responsePostProcessors, processor)
+}
+
+// Run a bot reply through the post-processing pipeline
+func postProcessResponse(reply string) string {
+	for _, processor := range responsePostProcessors {
+		reply = processor(reply)
+	}
+	return reply
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`(?:\+84|\b0)(?:[\s.-]?\d){9,10}\b`)
+)
+
+// Replace email addresses and phone numbers with placeholders
+func redactContactDetails(reply string) string {
+	reply = emailPattern.ReplaceAllString(reply, "[email]")
+	return phonePattern.ReplaceAllString(reply, "[phone]")
+}
+
+// Register the post-processors enabled in the configuration: stripping
+// cfg.ResponseStripPatterns, redacting contact details and appending
+// cfg.ResponseDisclaimer, in that order
+func registerConfiguredPostProcessors() error {
+	for _, pattern := range cfg.ResponseStripPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid strip pattern %q: %v", pattern, err)
+		}
+		registerResponsePostProcessor(func(reply string) string {
+			return strings.TrimSpace(re.ReplaceAllString(reply, ""))
+		})
+	}
+	if cfg.ResponseRedactContacts {
+		registerResponsePostProcessor(redactContactDetails)
+	}
+	if disclaimer := cfg.ResponseDisclaimer; disclaimer != "" {
+		registerResponsePostProcessor(func(reply string) string {
+			return reply + "\n\n" + disclaimer
+		})
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Run the test with an empty post-processing pipeline, restored afterwards
+func resetPostProcessors(t *testing.T) {
+	t.Helper()
+	saved := responsePostProcessors
+	responsePostProcessors = nil
+	t.Cleanup(func() { responsePostProcessors = saved })
+}
+
+func TestPostProcessResponseOrder(t *testing.T) {
+	resetPostProcessors(t)
+	if got := postProcessResponse("Dạ"); got != "Dạ" {
+		t.Errorf("reply without post-processors = %q, want it unchanged", got)
+	}
+
+	registerResponsePostProcessor(func(reply string) string { return reply + " a" })
+	registerResponsePostProcessor(strings.ToUpper)
+	if got := postProcessResponse("dạ"); got != "DẠ A" {
+		t.Errorf("postProcessResponse = %q, want processors applied in registration order", got)
+	}
+}
+
+func TestRedactContactDetails(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{"Liên hệ shop@example.vn nhé", "Liên hệ [email] nhé"},
+		{"Gọi 0912 345 678 hoặc +84 912.345.678", "Gọi [phone] hoặc [phone]"},
+		{"Mã đơn 20240101123 đã giao", "Mã đơn 20240101123 đã giao"},
+		{"Size 42 còn 3 đôi", "Size 42 còn 3 đôi"},
+	}
+	for _, tt := range tests {
+		if got := redactContactDetails(tt.reply); got != tt.want {
+			t.Errorf("redactContactDetails(%q) = %q, want %q", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterConfiguredPostProcessors(t *testing.T) {
+	resetPostProcessors(t)
+	setTestConfig(t, func(c *Config) {
+		c.ResponseStripPatterns = []string{`(?i)là một AI[^.]*\.`}
+		c.ResponseRedactContacts = true
+		c.ResponseDisclaimer = "Giá có thể thay đổi."
+	})
+	if err := registerConfiguredPostProcessors(); err != nil {
+		t.Fatalf("registerConfiguredPostProcessors: %v", err)
+	}
+	got := postProcessResponse("Là một AI, mình không chắc. Gọi 0912345678 nhé")
+	if want := "Gọi [phone] nhé\n\nGiá có thể thay đổi."; got != want {
+		t.Errorf("postProcessResponse = %q, want %q", got, want)
+	}
+
+	resetPostProcessors(t)
+	setTestConfig(t, func(c *Config) { c.ResponseStripPatterns = []string{"("} })
+	if err := registerConfiguredPostProcessors(); err == nil {
+		t.Error("registerConfiguredPostProcessors accepted an invalid pattern")
+	}
+}
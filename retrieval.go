@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// When chat input triggers retrieval of related stored messages
+const (
+	RetrievalAlways    = "always"
+	RetrievalQuestions = "questions"
+)
+
+// Validate a RETRIEVAL_TRIGGER value
+func parseRetrievalTrigger(value string) (string, error) {
+	switch value {
+	case RetrievalAlways, RetrievalQuestions:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid RETRIEVAL_TRIGGER %q (want %s or %s)", value, RetrievalAlways, RetrievalQuestions)
+}
+
+// Default QUESTION_WORDS: interrogatives and requests to recall or explain
+var defaultQuestionWords = []string{
+	"what", "when", "where", "who", "whom", "which", "why", "how",
+	"do", "does", "did", "is", "are", "was", "were", "can", "could", "should", "would", "will",
+	"remind", "remember", "recall", "tell me", "explain", "describe", "summarize", "find", "show me",
+}
+
+// Decides whether chat input is an information-seeking question worth
+// retrieving context for when cfg.RetrievalTrigger is "questions". Replace
+// it to use a different classifier.
+var isRetrievalQuestion = questionHeuristic
+
+// Treat input as a question when it contains a question mark or starts with
+// one of cfg.QuestionWords (case-insensitive, whole words)
+func questionHeuristic(input string) bool {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if strings.Contains(input, "?") {
+		return true
+	}
+	for _, word := range cfg.QuestionWords {
+		word = strings.ToLower(word)
+		if rest, ok := strings.CutPrefix(input, word); ok && (rest == "" || !unicode.IsLetter([]rune(rest)[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether this chat input should get retrieved context under the
+// user's retrieval settings
+func shouldRetrieve(input string, settings RetrievalSettings) bool {
+	if !settings.InjectContext || settings.TopK <= 0 {
+		return false
+	}
+	return cfg.RetrievalTrigger == RetrievalAlways || isRetrievalQuestion(input)
+}
+
+// Message ranked by similarity to a query
+type ScoredMessage struct {
+	Message    Message `json:"message"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Sort candidates by similarity, highest first. Ties go to the newer
+// message, then to the smaller messageId, so equal scores (short or
+// duplicate content) always rank the same way.
+func rankScoredMessages(candidates []ScoredMessage) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		if a.Message.Timestamp != b.Message.Timestamp {
+			return a.Message.Timestamp > b.Message.Timestamp
+		}
+		return a.Message.MessageID < b.Message.MessageID
+	})
+}
+
+// Assemble the context prompt injected before a chat completion from
+// retrieved messages, in rankScoredMessages order. Candidates below
+// minSimilarity are dropped; when none remain the prompt is empty and no
+// context should be injected.
+func buildContextPrompt(candidates []ScoredMessage, minSimilarity float64) string {
+	ranked := append([]ScoredMessage(nil), candidates...)
+	rankScoredMessages(ranked)
+
+	var b strings.Builder
+	for _, candidate := range ranked {
+		if candidate.Similarity < minSimilarity {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("Relevant earlier messages from this conversation history:\n")
+		}
+		timestamp := time.Unix(candidate.Message.Timestamp, 0).Format("2006-01-02 15:04")
+		fmt.Fprintf(&b, "- [%s] %s: %s\n", timestamp, candidate.Message.Sender, candidate.Message.Content)
+	}
+	return b.String()
+}
+
+// Rank the user's stored messages by similarity to queryEmbedding and return
+// the top k (all when k <= 0), skipping excludeIDs such as the message the
+// query embedding belongs to. With a scrimID only that scrim's messages are
+// considered. Chunked messages are compared chunk by chunk
+// as in messageSimilarity.
+func retrieveSimilarMessages(ctx context.Context, session neo4j.SessionWithContext, userID string, scrimID string, queryEmbedding []float64, k int, excludeIDs ...string) ([]ScoredMessage, error) {
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	query := Message{Embedding: queryEmbedding}
+	var results []ScoredMessage
+	for _, message := range messages {
+		if len(message.Embedding) == 0 || containsString(excludeIDs, message.MessageID) {
+			continue
+		}
+		if scrimID != "" && message.ScrimID != scrimID {
+			continue
+		}
+		results = append(results, ScoredMessage{Message: message, Similarity: messageSimilarity(query, message)})
+	}
+	rankScoredMessages(results)
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// Copy of history with a system message carrying the context prompt placed
+// just before the latest message, leaving history itself unchanged
+func withContextPrompt(history []openai.ChatCompletionMessage, prompt string) []openai.ChatCompletionMessage {
+	if len(history) == 0 {
+		return history
+	}
+	last := len(history) - 1
+	withContext := make([]openai.ChatCompletionMessage, 0, len(history)+1)
+	withContext = append(withContext, history[:last]...)
+	withContext = append(withContext, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: prompt})
+	return append(withContext, history[last])
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Largest retrievalTopK a user may set
+const maxRetrievalTopK = 50
+
+// Value that clears a retrieval preference back to the configured default
+const preferenceDefault = "default"
+
+// A user's own retrieval settings, stored on the User node. Nil fields fall
+// back to cfg.RetrievalK, cfg.RetrievalMinSimilarity and injecting context.
+type RetrievalPreferences struct {
+	TopK          *int     `json:"topK,omitempty"`
+	MinSimilarity *float64 `json:"minSimilarity,omitempty"`
+	InjectContext *bool    `json:"injectContext,omitempty"`
+}
+
+// Retrieval behaviour for one chat turn
+type RetrievalSettings struct {
+	TopK          int
+	MinSimilarity float64
+	InjectContext bool
+}
+
+// Resolve a user's retrieval preferences against the configured defaults
+func (p RetrievalPreferences) Settings() RetrievalSettings {
+	settings := RetrievalSettings{TopK: cfg.RetrievalK, MinSimilarity: cfg.RetrievalMinSimilarity, InjectContext: true}
+	if p.TopK != nil {
+		settings.TopK = *p.TopK
+	}
+	if p.MinSimilarity != nil {
+		settings.MinSimilarity = *p.MinSimilarity
+	}
+	if p.InjectContext != nil {
+		settings.InjectContext = *p.InjectContext
+	}
+	return settings
+}
+
+// Parsers of the retrieval preferences, keyed by the User node property.
+// They return nil for "default", which removes the property.
+var retrievalPreferenceParsers = map[string]func(string) (any, error){
+	"retrievalTopK": func(value string) (any, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > maxRetrievalTopK {
+			return nil, fmt.Errorf("invalid retrievalTopK %q (want 0-%d or %s)", value, maxRetrievalTopK, preferenceDefault)
+		}
+		return int64(n), nil
+	},
+	"retrievalMinSimilarity": func(value string) (any, error) {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < -1 || f > 1 {
+			return nil, fmt.Errorf("invalid retrievalMinSimilarity %q (want -1 to 1 or %s)", value, preferenceDefault)
+		}
+		return f, nil
+	},
+	"injectContext": func(value string) (any, error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid injectContext %q (want true, false or %s)", value, preferenceDefault)
+		}
+		return b, nil
+	},
+}
+
+// Parse a retrieval preference, with "default" clearing it
+func parseRetrievalPreference(field string, value string) (any, error) {
+	if strings.EqualFold(value, preferenceDefault) {
+		return nil, nil
+	}
+	return retrievalPreferenceParsers[field](value)
+}
+
+// Read the retrieval preferences from User node properties
+func retrievalPreferencesFromProps(props map[string]any) RetrievalPreferences {
+	var prefs RetrievalPreferences
+	if topK, ok := props["retrievalTopK"].(int64); ok {
+		n := int(topK)
+		prefs.TopK = &n
+	}
+	if minSimilarity, ok := props["retrievalMinSimilarity"].(float64); ok {
+		prefs.MinSimilarity = &minSimilarity
+	}
+	if inject, ok := props["injectContext"].(bool); ok {
+		prefs.InjectContext = &inject
+	}
+	return prefs
+}
+
+// Print the effective retrieval settings, marking those left at the default
+func printRetrievalPreferences(prefs RetrievalPreferences) {
+	settings := prefs.Settings()
+	source := func(set bool) string {
+		if set {
+			return ""
+		}
+		return " (default)"
+	}
+	fmt.Printf("  retrievalTopK           %d%s\n", settings.TopK, source(prefs.TopK != nil))
+	fmt.Printf("  retrievalMinSimilarity  %.2f%s\n", settings.MinSimilarity, source(prefs.MinSimilarity != nil))
+	fmt.Printf("  injectContext           %t%s\n", settings.InjectContext, source(prefs.InjectContext != nil))
+}
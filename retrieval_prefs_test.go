@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRetrievalPreferenceSettings(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.RetrievalK = 5
+		c.RetrievalMinSimilarity = 0.3
+	})
+	if got, want := (RetrievalPreferences{}).Settings(), (RetrievalSettings{TopK: 5, MinSimilarity: 0.3, InjectContext: true}); got != want {
+		t.Errorf("default settings = %+v, want %+v", got, want)
+	}
+
+	prefs := retrievalPreferencesFromProps(map[string]any{
+		"retrievalTopK":          int64(2),
+		"retrievalMinSimilarity": 0.75,
+		"injectContext":          false,
+	})
+	if got, want := prefs.Settings(), (RetrievalSettings{TopK: 2, MinSimilarity: 0.75, InjectContext: false}); got != want {
+		t.Errorf("stored settings = %+v, want %+v", got, want)
+	}
+	// zero values are preferences too, not unset
+	prefs = retrievalPreferencesFromProps(map[string]any{"retrievalTopK": int64(0), "retrievalMinSimilarity": 0.0})
+	if got := prefs.Settings(); got.TopK != 0 || got.MinSimilarity != 0 {
+		t.Errorf("zero settings = %+v, want top-k and min similarity 0", got)
+	}
+}
+
+func TestParseRetrievalPreference(t *testing.T) {
+	tests := []struct {
+		field   string
+		value   string
+		want    any
+		wantErr bool
+	}{
+		{"retrievalTopK", "10", int64(10), false},
+		{"retrievalTopK", "0", int64(0), false},
+		{"retrievalTopK", "51", nil, true},
+		{"retrievalTopK", "-1", nil, true},
+		{"retrievalTopK", "Default", nil, false},
+		{"retrievalMinSimilarity", "0.6", 0.6, false},
+		{"retrievalMinSimilarity", "1.5", nil, true},
+		{"injectContext", "false", false, false},
+		{"injectContext", "sometimes", nil, true},
+		{"injectContext", "default", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parsePreference(tt.field, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePreference(%q, %q) error = %v, wantErr %v", tt.field, tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parsePreference(%q, %q) = %v, want %v", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateRetrievalPreferences(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) { c.RetrievalK = 5 })
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	prefs, err := updateUserPreferences(ctx, userID, map[string]string{"retrievalTopK": "2", "injectContext": "false"})
+	if err != nil {
+		t.Fatalf("updateUserPreferences: %v", err)
+	}
+	if settings := prefs.Retrieval.Settings(); settings.TopK != 2 || settings.InjectContext {
+		t.Errorf("settings = %+v, want top-k 2 without context injection", settings)
+	}
+
+	// "default" removes the stored value
+	if _, err := updateUserPreferences(ctx, userID, map[string]string{"retrievalTopK": "default"}); err != nil {
+		t.Fatalf("updateUserPreferences: %v", err)
+	}
+	prefs, err = getUserPreferences(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("getUserPreferences: %v", err)
+	}
+	if prefs.Retrieval.TopK != nil || prefs.Retrieval.InjectContext == nil || *prefs.Retrieval.InjectContext {
+		t.Errorf("retrieval preferences = %+v, want top-k cleared and injection still off", prefs.Retrieval)
+	}
+	if settings := prefs.Retrieval.Settings(); settings.TopK != 5 {
+		t.Errorf("top-k = %d after clearing, want the configured 5", settings.TopK)
+	}
+}
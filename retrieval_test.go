@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestBuildContextPromptMinSimilarity(t *testing.T) {
+	candidates := []ScoredMessage{
+		{Message: Message{MessageID: "weak", Sender: "human", Content: "unrelated", Timestamp: 100}, Similarity: 0.2},
+		{Message: Message{MessageID: "strong", Sender: "human", Content: "size 42 shoes", Timestamp: 200}, Similarity: 0.9},
+		{Message: Message{MessageID: "fair", Sender: "ai", Content: "we have size 42", Timestamp: 300}, Similarity: 0.6},
+	}
+
+	prompt := buildContextPrompt(candidates, 0.5)
+	if strings.Contains(prompt, "unrelated") {
+		t.Errorf("prompt includes a candidate below the minimum similarity:\n%s", prompt)
+	}
+	strong, fair := strings.Index(prompt, "size 42 shoes"), strings.Index(prompt, "we have size 42")
+	if strong < 0 || fair < 0 || strong > fair {
+		t.Errorf("prompt lacks the kept candidates in similarity order:\n%s", prompt)
+	}
+
+	if prompt := buildContextPrompt(candidates, 0.95); prompt != "" {
+		t.Errorf("prompt = %q with no candidate above the minimum, want empty", prompt)
+	}
+	if prompt := buildContextPrompt(nil, 0); prompt != "" {
+		t.Errorf("prompt = %q without candidates, want empty", prompt)
+	}
+}
+
+func TestWithContextPrompt(t *testing.T) {
+	history := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "persona"},
+		{Role: openai.ChatMessageRoleUser, Content: "question"},
+	}
+	got := withContextPrompt(history, "context")
+	if len(got) != 3 || got[1].Content != "context" || got[1].Role != openai.ChatMessageRoleSystem || got[2].Content != "question" {
+		t.Errorf("withContextPrompt = %+v, want the context just before the question", got)
+	}
+	if len(history) != 2 || history[1].Content != "question" {
+		t.Errorf("history changed: %+v", history)
+	}
+}
+
+func TestRankScoredMessagesTies(t *testing.T) {
+	candidates := []ScoredMessage{
+		{Message: Message{MessageID: "old", Timestamp: 100}, Similarity: 0.8},
+		{Message: Message{MessageID: "b", Timestamp: 200}, Similarity: 0.8},
+		{Message: Message{MessageID: "best", Timestamp: 50}, Similarity: 0.9},
+		{Message: Message{MessageID: "a", Timestamp: 200}, Similarity: 0.8},
+		{Message: Message{MessageID: "weak", Timestamp: 300}, Similarity: 0.1},
+	}
+	want := []string{"best", "a", "b", "old", "weak"}
+
+	// the same order whatever order the candidates arrive in
+	for _, reversed := range []bool{false, true} {
+		ranked := append([]ScoredMessage(nil), candidates...)
+		if reversed {
+			for i, j := 0, len(ranked)-1; i < j; i, j = i+1, j-1 {
+				ranked[i], ranked[j] = ranked[j], ranked[i]
+			}
+		}
+		rankScoredMessages(ranked)
+		var got []string
+		for _, candidate := range ranked {
+			got = append(got, candidate.Message.MessageID)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("ranked (reversed %v) = %v, want %v", reversed, got, want)
+		}
+	}
+}
+
+func TestSimilarityQueriesOrderTies(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.VectorIndex = false
+		c.ServerSideSimilarity = false
+	})
+	message := Message{MessageID: "m1", Embedding: []float64{1, 0}}
+	if query, _ := similarityCandidatesQuery(message, "u1"); !strings.Contains(query, "ORDER BY m2.timestamp DESC, m2.messageId") {
+		t.Errorf("scan query does not break timestamp ties by messageId:\n%s", query)
+	}
+	if query, _ := vectorCandidatesQuery(message, "u1"); !strings.Contains(query, "ORDER BY score DESC, m2.timestamp DESC, m2.messageId") {
+		t.Errorf("vector query does not break score ties:\n%s", query)
+	}
+}
+
+func TestQuestionHeuristic(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.QuestionWords = append(append([]string{}, defaultQuestionWords...), "cho hỏi") })
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"Giày size 42 còn không?", true},
+		{"what did I order last week", true},
+		{"  Remind me about my order", true},
+		{"Tell me the return policy", true},
+		{"Cho hỏi giá áo thun", true},
+		{"whatever, thanks", false},
+		{"Dossier received", false},
+		{"I will order tomorrow", false},
+		{"Cảm ơn shop", false},
+	}
+	for _, tt := range tests {
+		if got := questionHeuristic(tt.input); got != tt.want {
+			t.Errorf("questionHeuristic(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestShouldRetrieve(t *testing.T) {
+	enabled := RetrievalSettings{TopK: 5, InjectContext: true}
+	tests := []struct {
+		name     string
+		trigger  string
+		input    string
+		settings RetrievalSettings
+		want     bool
+	}{
+		{"question", RetrievalQuestions, "how much is it?", enabled, true},
+		{"statement", RetrievalQuestions, "thanks a lot", enabled, false},
+		{"always", RetrievalAlways, "thanks a lot", enabled, true},
+		{"injection off", RetrievalAlways, "how much is it?", RetrievalSettings{TopK: 5}, false},
+		{"top k zero", RetrievalAlways, "how much is it?", RetrievalSettings{InjectContext: true}, false},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) {
+			c.RetrievalTrigger = tt.trigger
+			c.QuestionWords = defaultQuestionWords
+		})
+		if got := shouldRetrieve(tt.input, tt.settings); got != tt.want {
+			t.Errorf("%s: shouldRetrieve(%q) = %v, want %v", tt.name, tt.input, got, tt.want)
+		}
+	}
+
+	// the classifier is replaceable
+	saved := isRetrievalQuestion
+	t.Cleanup(func() { isRetrievalQuestion = saved })
+	isRetrievalQuestion = func(input string) bool { return strings.HasPrefix(input, "!") }
+	setTestConfig(t, func(c *Config) { c.RetrievalTrigger = RetrievalQuestions })
+	if !shouldRetrieve("!recall", enabled) || shouldRetrieve("how much is it?", enabled) {
+		t.Error("shouldRetrieve does not use isRetrievalQuestion")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Message waiting in the enrichment retry queue
+type pendingEnrichment struct {
+	Message  Message
+	UserID   string
+	Attempts int64
+}
+
+// Delay before the next enrichment attempt after the given number of failures
+func enrichmentBackoff(attempts int64) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	shift := attempts - 1
+	if shift > 16 {
+		shift = 16
+	}
+	return cfg.RetryBaseDelay * time.Duration(1<<shift)
+}
+
+// Load messages flagged with needsEnrichment whose backoff has elapsed
+func loadPendingEnrichments(ctx context.Context, session neo4j.SessionWithContext) ([]pendingEnrichment, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message)
+			WHERE m.needsEnrichment = true AND coalesce(m.nextEnrichmentAt, 0) <= $now
+			RETURN m, m.userId, coalesce(m.enrichmentAttempts, 0)
+			ORDER BY m.timestamp
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"now": time.Now().Unix()})
+		if err != nil {
+			return nil, err
+		}
+
+		var pending []pendingEnrichment
+		for records.Next(ctx) {
+			record := records.Record()
+			node, ok := record.Values[0].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			userID, _ := record.Values[1].(string)
+			attempts, _ := record.Values[2].(int64)
+			pending = append(pending, pendingEnrichment{
+				Message:  messageFromNode(node),
+				UserID:   userID,
+				Attempts: attempts,
+			})
+		}
+		return pending, records.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]pendingEnrichment), nil
+}
+
+// Retry embedding and topic extraction for messages stored without them.
+// Failed attempts are rescheduled with exponential backoff; after
+// cfg.RetryMaxAttempts the message is dropped from the queue and marked
+// enrichmentFailed. Each queued message is reported in the BatchResult.
+func processRetryQueue(ctx context.Context, enricher MessageEnricher) (BatchResult, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	pending, err := loadPendingEnrichments(ctx, session)
+	if err != nil {
+		return BatchResult{}, fmt.Errorf("failed to load retry queue: %v", err)
+	}
+
+	var batch BatchResult
+	for _, item := range pending {
+		if err := ctx.Err(); err != nil {
+			return batch, err
+		}
+
+		message, reembedded, enrichErr := retryEnrichment(ctx, enricher, item.Message)
+		if enrichErr != nil {
+			attempts := item.Attempts + 1
+			slog.Warn("Enrichment retry failed", "messageId", message.MessageID, "attempt", attempts, "attempts", cfg.RetryMaxAttempts, "err", enrichErr)
+			if err := recordEnrichmentFailure(ctx, session, message.MessageID, attempts); err != nil {
+				slog.Error("Failed to update retry state", "messageId", message.MessageID, "err", err)
+			}
+			batch.fail(message.MessageID, enrichErr)
+			continue
+		}
+
+		unlock := userIngestLocks.Lock(item.UserID)
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			query := `
+				MATCH (m:Message {messageId: $messageId})
+				SET m.embedding = $embedding,
+					m.embeddingGz = $embeddingGz,
+					m.embeddingModel = $embeddingModel,
+					m.topics = $topics,
+					m.topicPromptVersion = $topicPromptVersion,
+					m.topicTagsRaw = $topicTagsRaw,
+					m.topicTagsRejected = $topicTagsRejected,
+					m.needsEnrichment = false,
+					m.enrichmentAttempts = $attempts
+				REMOVE m.nextEnrichmentAt
+			`
+			plainEmbedding, compressedEmbedding := storedEmbedding(message.Embedding)
+			params := map[string]any{
+				"messageId":          message.MessageID,
+				"embedding":          plainEmbedding,
+				"embeddingGz":        compressedEmbedding,
+				"embeddingModel":     nil,
+				"topics":             message.Topics,
+				"attempts":           item.Attempts + 1,
+				"topicPromptVersion": message.TopicPromptVersion,
+				"topicTagsRaw":       message.TopicTagsRaw,
+				"topicTagsRejected":  message.TopicTagsRejected,
+			}
+			if message.EmbeddingModel != "" {
+				params["embeddingModel"] = message.EmbeddingModel
+			}
+			if _, err := tx.Run(ctx, query, params); err != nil {
+				return nil, fmt.Errorf("failed to store enrichment: %v", err)
+			}
+
+			if reembedded {
+				if err := storeMessageChunks(ctx, tx, message.MessageID, message.Chunks); err != nil {
+					return nil, err
+				}
+			}
+			linkMessageTopics(ctx, tx, message.MessageID, message.Topics, message.TopicPromptVersion)
+			return createSimilarityEdges(ctx, tx, message, item.UserID)
+		})
+		unlock()
+		if err != nil {
+			slog.Error("Failed to persist enrichment", "messageId", message.MessageID, "userId", item.UserID, "err", err)
+			batch.fail(message.MessageID, fmt.Errorf("failed to persist enrichment: %v", err))
+			continue
+		}
+
+		batch.succeed(message.MessageID)
+		slog.Info("Enriched queued message", "messageId", message.MessageID, "userId", item.UserID)
+	}
+
+	fmt.Printf("♻️ Retry queue processed: %d/%d messages enriched\n", batch.Succeeded, len(pending))
+	return batch, nil
+}
+
+// Extract the topics of a queued message when it has none, then embed it
+// when it has no embedding. Reports whether the message was re-embedded.
+func retryEnrichment(ctx context.Context, enricher MessageEnricher, message Message) (Message, bool, error) {
+	if len(message.Topics) == 0 {
+		extraction, err := extractTopicsWith(ctx, enricher, message.Content)
+		if err != nil {
+			return message, false, fmt.Errorf("topics: %v", err)
+		}
+		message.Topics = extraction.Accepted
+		message.TopicPromptVersion = topicPromptVersion()
+		message.TopicTagsRaw = extraction.Raw
+		message.TopicTagsRejected = len(extraction.Rejected)
+	}
+	if len(message.Embedding) > 0 {
+		return message, false, nil
+	}
+	input, _ := messageEmbeddingText(ctx, message.Content, message.Topics)
+	embedding, err := enricher.Embed(ctx, input)
+	if err != nil {
+		return message, false, fmt.Errorf("embedding: %v", err)
+	}
+	message.Embedding = embedding
+	message.EmbeddingModel = cfg.EmbeddingModel
+	embedMessageChunks(ctx, enricher, &message)
+	return message, true, nil
+}
+
+// Bump the attempt counter and schedule the next retry, or give up once the
+// maximum number of attempts is reached
+func recordEnrichmentFailure(ctx context.Context, session neo4j.SessionWithContext, messageID string, attempts int64) error {
+	giveUp := attempts >= int64(cfg.RetryMaxAttempts)
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {messageId: $messageId})
+			SET m.enrichmentAttempts = $attempts,
+				m.nextEnrichmentAt = $nextAt,
+				m.needsEnrichment = NOT $giveUp,
+				m.enrichmentFailed = $giveUp
+		`
+		params := map[string]any{
+			"messageId": messageID,
+			"attempts":  attempts,
+			"nextAt":    time.Now().Add(enrichmentBackoff(attempts)).Unix(),
+			"giveUp":    giveUp,
+		}
+		_, err := tx.Run(ctx, query, params)
+		return nil, err
+	})
+	if err == nil && giveUp {
+		slog.Warn("Giving up enrichment", "messageId", messageID, "attempts", attempts)
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnrichmentBackoff(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.RetryBaseDelay = time.Minute })
+	tests := []struct {
+		attempts int64
+		want     time.Duration
+	}{
+		{0, 0},
+		{-1, 0},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{17, 65536 * time.Minute},
+		{100, 65536 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := enrichmentBackoff(tt.attempts); got != tt.want {
+			t.Errorf("enrichmentBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetryEnrichment(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.EmbeddingTemplate = defaultEmbeddingTemplate
+		c.ChunkSize = 0
+	})
+	ctx := context.Background()
+	queued := Message{MessageID: "m1", Content: "Giày size 42 còn không?"}
+
+	t.Run("missing both", func(t *testing.T) {
+		enricher := &stubEnricher{topics: []string{"Giày"}}
+		message, reembedded, err := retryEnrichment(ctx, enricher, queued)
+		if err != nil {
+			t.Fatalf("retryEnrichment: %v", err)
+		}
+		if !reembedded || !reflect.DeepEqual(message.Embedding, stubEmbedding(queued.Content)) {
+			t.Errorf("embedding = %v (reembedded %v), want %v", message.Embedding, reembedded, stubEmbedding(queued.Content))
+		}
+		if !reflect.DeepEqual(message.Topics, []string{"Giày"}) || message.TopicPromptVersion != topicPromptVersion() {
+			t.Errorf("topics = %v under %q", message.Topics, message.TopicPromptVersion)
+		}
+		if message.EmbeddingModel != cfg.EmbeddingModel {
+			t.Errorf("EmbeddingModel = %q, want %q", message.EmbeddingModel, cfg.EmbeddingModel)
+		}
+	})
+
+	t.Run("keeps existing enrichment", func(t *testing.T) {
+		stored := queued
+		stored.Topics = []string{"Áo"}
+		stored.Embedding = []float64{0.5, 0.5}
+		enricher := &stubEnricher{}
+		message, reembedded, err := retryEnrichment(ctx, enricher, stored)
+		if err != nil || reembedded {
+			t.Fatalf("retryEnrichment = reembedded %v, %v", reembedded, err)
+		}
+		if len(enricher.embedded) != 0 || len(enricher.extracted) != 0 {
+			t.Errorf("enricher called: embedded %q, extracted %q", enricher.embedded, enricher.extracted)
+		}
+		if !reflect.DeepEqual(message, stored) {
+			t.Errorf("message changed: %+v", message)
+		}
+	})
+
+	t.Run("topic failure skips embedding", func(t *testing.T) {
+		enricher := &stubEnricher{topicsErr: errors.New("rate limited")}
+		if _, _, err := retryEnrichment(ctx, enricher, queued); err == nil {
+			t.Fatal("retryEnrichment succeeded without topics")
+		}
+		if len(enricher.embedded) != 0 {
+			t.Errorf("embedded %q after the topic extraction failed", enricher.embedded)
+		}
+	})
+
+	t.Run("embedding failure", func(t *testing.T) {
+		enricher := &stubEnricher{topics: []string{"Giày"}, embedErr: errors.New("timeout")}
+		if _, reembedded, err := retryEnrichment(ctx, enricher, queued); err == nil || reembedded {
+			t.Errorf("retryEnrichment = reembedded %v, %v, want an embedding error", reembedded, err)
+		}
+	})
+}
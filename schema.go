@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Uniqueness constraints on node IDs and indexes used by lookup queries.
+// The unique Topic.name lets concurrent MERGEs of one topic resolve to a
+// single node, and the unique UserNameLock.name serialises findOrCreateUser
+// per name; Message.userId backs the similarity candidate query.
+var schemaStatements = []struct {
+	name      string
+	statement string
+}{
+	{"user_id_unique", "CREATE CONSTRAINT user_id_unique IF NOT EXISTS FOR (u:User) REQUIRE u.userId IS UNIQUE"},
+	{"message_id_unique", "CREATE CONSTRAINT message_id_unique IF NOT EXISTS FOR (m:Message) REQUIRE m.messageId IS UNIQUE"},
+	{"topic_name_unique", "CREATE CONSTRAINT topic_name_unique IF NOT EXISTS FOR (t:Topic) REQUIRE t.name IS UNIQUE"},
+	{"user_name_lock_unique", "CREATE CONSTRAINT user_name_lock_unique IF NOT EXISTS FOR (l:UserNameLock) REQUIRE l.name IS UNIQUE"},
+	{"message_user", "CREATE INDEX message_user IF NOT EXISTS FOR (m:Message) ON (m.userId)"},
+	{"user_last_active", "CREATE INDEX user_last_active IF NOT EXISTS FOR (u:User) ON (u.lastActive)"},
+	{"chunk_message", "CREATE INDEX chunk_message IF NOT EXISTS FOR (c:Chunk) ON (c.messageId)"},
+}
+
+// Create the schemaStatements constraints and indexes that do not exist
+// yet, logging which were created and which were already present. A
+// constraint cannot be created while duplicates exist, e.g. two Topic nodes
+// of one name; the error names the constraint.
+func initSchema(ctx context.Context, driver neo4j.DriverWithContext) error {
+	session := driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	created, present := []string{}, []string{}
+	for _, schema := range schemaStatements {
+		result, err := session.Run(ctx, schema.statement, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", schema.name, err)
+		}
+		summary, err := result.Consume(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", schema.name, err)
+		}
+		counters := summary.Counters()
+		if counters.ConstraintsAdded()+counters.IndexesAdded() > 0 {
+			created = append(created, schema.name)
+		} else {
+			present = append(present, schema.name)
+		}
+	}
+	slog.Info("Schema ready", "created", created, "present", present)
+	return nil
+}
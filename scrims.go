@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Scrim session that users participate in and messages are posted to.
+// Messages in a scrim are stored with its scrimId, linked to it with
+// IN_SCRIM and only compared against the scrim's other messages.
+type Scrim struct {
+	ScrimID   string `json:"scrimId"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Create a scrim and return its ID
+func createScrim(ctx context.Context, session neo4j.SessionWithContext, name string) (string, error) {
+	scrimID := generateID()
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := "CREATE (s:Scrim {scrimId: $scrimId, name: $name, createdAt: $createdAt})"
+		params := map[string]any{
+			"scrimId":   scrimID,
+			"name":      name,
+			"createdAt": time.Now().Unix(),
+		}
+		_, err := tx.Run(ctx, query, params)
+		return nil, err
+	}, txTimeout(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to create scrim: %w", neo4jError(ctx, err))
+	}
+	fmt.Printf("🎮 Created scrim: %s (ID: %s)\n", name, scrimID)
+	return scrimID, nil
+}
+
+// Add a user to a scrim's participants; joining twice keeps the first joinedAt
+func joinScrim(ctx context.Context, session neo4j.SessionWithContext, userID string, scrimID string) error {
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {userId: $userId})
+			MATCH (s:Scrim {scrimId: $scrimId})
+			MERGE (u)-[r:PARTICIPATES_IN]->(s)
+			ON CREATE SET r.joinedAt = $joinedAt
+			RETURN s.name
+		`
+		params := map[string]any{
+			"userId":   userID,
+			"scrimId":  scrimID,
+			"joinedAt": time.Now().Unix(),
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := records.Single(ctx); err != nil {
+			return nil, fmt.Errorf("user %s or scrim %s not found", userID, scrimID)
+		}
+		return nil, nil
+	}, txTimeout(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to join scrim: %w", neo4jError(ctx, err))
+	}
+	fmt.Printf("🎮 User %s participates in scrim %s\n", userID, scrimID)
+	return nil
+}
+
+// Link a new message to its scrim. Only participants can post to a scrim.
+func linkMessageScrim(ctx context.Context, tx neo4j.ManagedTransaction, userID string, messageID string, scrimID string) error {
+	query := `
+		MATCH (:User {userId: $userId})-[:PARTICIPATES_IN]->(s:Scrim {scrimId: $scrimId})
+		MATCH (m:Message {messageId: $messageId})
+		MERGE (m)-[:IN_SCRIM]->(s)
+		RETURN count(s)
+	`
+	params := map[string]any{
+		"userId":    userID,
+		"messageId": messageID,
+		"scrimId":   scrimID,
+	}
+	records, err := tx.Run(ctx, query, params)
+	if err != nil {
+		return fmt.Errorf("failed to link message to scrim: %v", err)
+	}
+	if !records.Next(ctx) {
+		if err := records.Err(); err != nil {
+			return fmt.Errorf("failed to link message to scrim: %v", err)
+		}
+		return fmt.Errorf("user %s does not participate in scrim %s", userID, scrimID)
+	}
+	return nil
+}
+
+// Scrim restriction for candidate and retrieval queries: nil (no
+// restriction) for messages outside a scrim
+func scrimParam(scrimID string) any {
+	if scrimID == "" {
+		return nil
+	}
+	return scrimID
+}
+
+// Load the messages posted to a scrim by any participant, oldest first
+func scrimMessages(ctx context.Context, scrimID string) ([]userMessage, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message)-[:IN_SCRIM]->(:Scrim {scrimId: $scrimId})
+			RETURN m, m.userId
+			ORDER BY m.timestamp, m.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"scrimId": scrimID})
+		if err != nil {
+			return nil, err
+		}
+
+		var messages []userMessage
+		for records.Next(ctx) {
+			record := records.Record()
+			node, ok := record.Values[0].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			userID, _ := record.Values[1].(string)
+			messages = append(messages, userMessage{Message: messageFromNode(node), UserID: userID})
+		}
+		return messages, records.Err()
+	}, txTimeout(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scrim messages: %w", neo4jError(ctx, err))
+	}
+	return result.([]userMessage), nil
+}
+
+// Print the messages of a scrim
+func printScrimMessages(scrimID string, messages []userMessage) {
+	if len(messages) == 0 {
+		fmt.Printf("🎮 Scrim %s has no messages\n", scrimID)
+		return
+	}
+	fmt.Printf("🎮 %d messages in scrim %s:\n", len(messages), scrimID)
+	for _, item := range messages {
+		timestamp := time.Unix(item.Message.Timestamp, 0).Format("2006-01-02 15:04")
+		fmt.Printf("  [%s] %s (%s): %s\n", timestamp, item.UserID, item.Message.Sender, item.Message.Content)
+	}
+}
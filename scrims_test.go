@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestScrimParam(t *testing.T) {
+	if got := scrimParam(""); got != nil {
+		t.Errorf("scrimParam(\"\") = %v, want nil", got)
+	}
+	if got := scrimParam("s1"); got != "s1" {
+		t.Errorf("scrimParam(s1) = %v, want s1", got)
+	}
+}
+
+func TestScrimScopedMessages(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.ServerSideSimilarity = false
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+	})
+	ctx := context.Background()
+	player := createTestUser(t, session)
+	outsider := createTestUser(t, session)
+
+	scrimID, err := createScrim(ctx, session, "test "+t.Name())
+	if err != nil {
+		t.Fatalf("createScrim: %v", err)
+	}
+	t.Cleanup(func() {
+		session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx, "MATCH (s:Scrim {scrimId: $scrimId}) DETACH DELETE s", map[string]any{"scrimId": scrimID})
+		})
+	})
+	if err := joinScrim(ctx, session, player, scrimID); err != nil {
+		t.Fatalf("joinScrim: %v", err)
+	}
+	if err := joinScrim(ctx, session, player, scrimID); err != nil {
+		t.Errorf("joining twice: %v", err)
+	}
+	if err := joinScrim(ctx, session, player, "missing-"+scrimID); err == nil {
+		t.Error("joinScrim succeeded for an unknown scrim")
+	}
+
+	now := time.Now().Unix()
+	outside := storeTestMessage(t, session, player, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0}})
+	first := storeTestMessage(t, session, player, Message{Content: "giày cỡ 42", Timestamp: now + 1, Embedding: []float64{1, 0}, ScrimID: scrimID})
+	second := storeTestMessage(t, session, player, Message{Content: "giày 42", Timestamp: now + 2, Embedding: []float64{0.9, 0.1}, ScrimID: scrimID})
+
+	// scrim messages are only compared within the scrim
+	if n := countTestLinks(t, session, first.MessageID, second.MessageID); n != 1 {
+		t.Errorf("%d links between scrim messages, want 1", n)
+	}
+	if n := countTestLinks(t, session, first.MessageID, outside.MessageID) + countTestLinks(t, session, second.MessageID, outside.MessageID); n != 0 {
+		t.Errorf("%d links from scrim messages to an outside message, want 0", n)
+	}
+
+	rejected := Message{MessageID: generateID(), Sender: "human", Content: "cho mình vào với", Timestamp: now + 3, ScrimID: scrimID}
+	rejected.ContentHash = contentHash(rejected.Sender, rejected.Content)
+	if err := addMessageAndCreateEdges(ctx, session, rejected, outsider); err == nil {
+		t.Error("a non-participant posted to the scrim")
+	}
+
+	messages, err := scrimMessages(ctx, scrimID)
+	if err != nil {
+		t.Fatalf("scrimMessages: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Message.MessageID != first.MessageID || messages[1].Message.MessageID != second.MessageID || messages[0].UserID != player {
+		t.Errorf("scrim messages = %+v, want the player's two scrim messages in order", messages)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Returned by retrieval functions for a user without any messages, so
+// callers can show an empty state instead of an error
+var errNoMessages = errors.New("no messages yet for this user")
+
+// Message shown for errNoMessages
+const noMessagesText = "No messages yet for this user"
+
+// Count the messages owned by a user
+func countUserMessages(ctx context.Context, session neo4j.SessionWithContext, userID string) (int64, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, "MATCH (m:Message {userId: $userId}) RETURN count(m)", map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		count, _ := record.Values[0].(int64)
+		return count, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %v", err)
+	}
+	return result.(int64), nil
+}
+
+// Find the user's messages most similar to a query, at most limit and none
+// below cfg.RetrievalMinSimilarity, ranked by rankScoredMessages. Chunked
+// messages score by their best (or mean) matching chunk. With a
+// topic overlap boost configured, the query's topics are extracted too. Returns
+// errNoMessages without embedding the query when the user has no messages.
+func searchMessages(ctx context.Context, client *openai.Client, userID string, query string, limit int) ([]ScoredMessage, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	count, err := countUserMessages(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, errNoMessages
+	}
+
+	embedding, err := getQueryEmbedding(ctx, client, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %v", err)
+	}
+
+	// Topics are only needed to apply the topic overlap boost
+	var queryTopics []string
+	if cfg.TopicOverlapBoost != 1 {
+		if queryTopics, err = extractTopics(ctx, client, query); err != nil {
+			slog.Warn("Error extracting query topics, ranking by cosine only", "err", err)
+		}
+	}
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return nil, err
+	}
+	results := []ScoredMessage{}
+	queryMessage := Message{Embedding: embedding, Topics: queryTopics}
+	for _, message := range messages {
+		similarity := messageSimilarity(queryMessage, message)
+		if similarity >= cfg.RetrievalMinSimilarity {
+			results = append(results, ScoredMessage{Message: message, Similarity: similarity})
+		}
+	}
+	rankScoredMessages(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Summary of a user's stored conversation
+type UserStats struct {
+	Messages      int64          `json:"messages"`
+	BySender      map[string]int `json:"bySender"`
+	Topics        int64          `json:"topics"`
+	Edges         int64          `json:"edges"`
+	Isolated      int64          `json:"isolated"`
+	FirstMessage  int64          `json:"firstMessage"`
+	LatestMessage int64          `json:"latestMessage"`
+}
+
+// Compute message, topic and edge counts for a user. Returns errNoMessages
+// when the user has no messages.
+func userStats(ctx context.Context, userID string) (UserStats, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	count, err := countUserMessages(ctx, session, userID)
+	if err != nil {
+		return UserStats{}, err
+	}
+	if count == 0 {
+		return UserStats{}, errNoMessages
+	}
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		stats := UserStats{Messages: count, BySender: make(map[string]int)}
+
+		records, err := tx.Run(ctx, `
+			MATCH (m:Message {userId: $userId})
+			RETURN m.sender, count(m), min(m.timestamp), max(m.timestamp)
+		`, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			sender, _ := values[0].(string)
+			senderCount, _ := values[1].(int64)
+			first, _ := values[2].(int64)
+			latest, _ := values[3].(int64)
+			stats.BySender[sender] = int(senderCount)
+			if stats.FirstMessage == 0 || first < stats.FirstMessage {
+				stats.FirstMessage = first
+			}
+			stats.LatestMessage = max(stats.LatestMessage, latest)
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		countOf := func(query string) (int64, error) {
+			records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+			if err != nil {
+				return 0, err
+			}
+			record, err := records.Single(ctx)
+			if err != nil {
+				return 0, err
+			}
+			value, _ := record.Values[0].(int64)
+			return value, nil
+		}
+		if stats.Topics, err = countOf("MATCH (:Message {userId: $userId})-[:BELONGS_TO]->(t:Topic) RETURN count(DISTINCT t)"); err != nil {
+			return nil, err
+		}
+		if stats.Edges, err = countOf("MATCH (:Message {userId: $userId})-[r:CONTEXTUAL_LINK]-() RETURN count(DISTINCT r)"); err != nil {
+			return nil, err
+		}
+		if stats.Isolated, err = countOf("MATCH (m:Message {userId: $userId}) WHERE NOT (m)-[:CONTEXTUAL_LINK]-() RETURN count(m)"); err != nil {
+			return nil, err
+		}
+		return stats, nil
+	})
+	if err != nil {
+		return UserStats{}, fmt.Errorf("failed to compute stats: %v", err)
+	}
+	return result.(UserStats), nil
+}
+
+// Print search results
+func printSearchResults(results []ScoredMessage) {
+	if len(results) == 0 {
+		fmt.Println("No matching messages")
+		return
+	}
+	fmt.Printf("🔎 %d matching messages:\n", len(results))
+	for _, result := range results {
+		timestamp := time.Unix(result.Message.Timestamp, 0).Format("2006-01-02 15:04")
+		fmt.Printf("  %.3f [%s] %s: %s\n", result.Similarity, timestamp, result.Message.Sender, result.Message.Content)
+	}
+}
+
+// Print a user's stats
+func printUserStats(stats UserStats) {
+	fmt.Println("📈 Stats:")
+	fmt.Printf("  messages   %d\n", stats.Messages)
+	for _, sender := range sortedKeys(stats.BySender) {
+		fmt.Printf("    %-8s %d\n", sender, stats.BySender[sender])
+	}
+	fmt.Printf("  topics     %d\n", stats.Topics)
+	fmt.Printf("  edges      %d\n", stats.Edges)
+	fmt.Printf("  isolated   %d\n", stats.Isolated)
+	fmt.Printf("  first      %s\n", time.Unix(stats.FirstMessage, 0).Format("2006-01-02 15:04"))
+	fmt.Printf("  latest     %s\n", time.Unix(stats.LatestMessage, 0).Format("2006-01-02 15:04"))
+}
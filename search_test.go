@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetrievalWithoutMessages(t *testing.T) {
+	session := requireNeo4j(t, nil)
+	ctx := context.Background()
+	client, fake := newFakeOpenAI(t)
+	userID := createTestUser(t, session)
+
+	if _, err := searchMessages(ctx, client, userID, "giày size 42", 5); !errors.Is(err, errNoMessages) {
+		t.Errorf("searchMessages: err = %v, want errNoMessages", err)
+	}
+	if _, err := userStats(ctx, userID); !errors.Is(err, errNoMessages) {
+		t.Errorf("userStats: err = %v, want errNoMessages", err)
+	}
+	if _, err := coherenceScore(ctx, userID); !errors.Is(err, errNoMessages) {
+		t.Errorf("coherenceScore: err = %v, want errNoMessages", err)
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("%d OpenAI requests for an empty history, want none", len(fake.requests))
+	}
+}
+
+func TestUserStats(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+	})
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now - 10, Embedding: []float64{1, 0}, Topics: []string{"Giày"}})
+	storeTestMessage(t, session, userID, Message{Sender: "ai", Content: "dạ còn giày size 42", Timestamp: now - 5, Embedding: []float64{0.9, 0.1}, Topics: []string{"Giày"}})
+	storeTestMessage(t, session, userID, Message{Content: "mũ", Timestamp: now, Embedding: []float64{0, 1}, Topics: []string{"Mũ"}})
+
+	stats, err := userStats(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("userStats: %v", err)
+	}
+	want := UserStats{
+		Messages:      3,
+		BySender:      map[string]int{"human": 2, "ai": 1},
+		Topics:        2,
+		Edges:         1,
+		Isolated:      1,
+		FirstMessage:  now - 10,
+		LatestMessage: now,
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("userStats = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Largest accepted POST /messages body
+const maxMessageRequestBytes = 1 << 20
+
+// Body of POST /messages
+type postMessageRequest struct {
+	UserID  string `json:"userId"`
+	Sender  string `json:"sender"`
+	Content string `json:"content"`
+}
+
+// HTTP API over the ingestion pipeline:
+//
+//	POST /messages            enrich and store a message, returning it
+//	GET  /users/{id}/messages list a user's messages in timestamp order, a
+//	                          page (?limit=, default 50) at a time from ?cursor=
+//	GET  /healthz             report whether Neo4j is reachable
+func newAPIHandler(enricher MessageEnricher) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /messages", func(w http.ResponseWriter, r *http.Request) {
+		handlePostMessage(w, r, enricher)
+	})
+	mux.HandleFunc("GET /users/{id}/messages", handleListMessages)
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	return mux
+}
+
+// POST /messages: run a message through ingestMessage for an existing user.
+// No reply is generated here, so human messages are not left awaiting one.
+func handlePostMessage(w http.ResponseWriter, r *http.Request, enricher MessageEnricher) {
+	var request postMessageRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageRequestBytes)).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	switch {
+	case request.UserID == "" || request.Content == "":
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("userId and content are required"))
+		return
+	case request.Sender != "human" && request.Sender != "ai":
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid sender %q (want human or ai)", request.Sender))
+		return
+	}
+
+	ctx := r.Context()
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	if _, err := loadUser(ctx, session, request.UserID); err != nil {
+		writeJSONError(w, apiErrorStatus(err), err)
+		return
+	}
+	message, err := ingestMessage(ctx, session, request.Sender, request.Content, enricher, request.UserID, messageScope{}, nil, false)
+	if err != nil {
+		writeJSONError(w, apiErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, message)
+}
+
+// GET /users/{id}/messages: a page of the user's messages, oldest first,
+// with the cursor of the next page
+func handleListMessages(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	limit := defaultMessagePageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxMessagePageSize {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q (want 1-%d)", raw, maxMessagePageSize))
+			return
+		}
+		limit = n
+	}
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" {
+		if _, _, err := parseMessageCursor(cursor); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	if _, err := loadUser(ctx, session, userID); err != nil {
+		writeJSONError(w, apiErrorStatus(err), err)
+		return
+	}
+	page, err := loadUserMessagePage(ctx, session, userID, cursor, limit)
+	if err != nil {
+		writeJSONError(w, apiErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// HTTP status for a pipeline error
+func apiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errTokenQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errNeo4jUnavailable), errors.Is(err, errOpenAIQuota):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Warn("Failed to write response", "err", err)
+	}
+}
+
+// Write {"error": "..."}, logging server-side failures
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		slog.Error("API request failed", "status", status, "err", err)
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// Serve the HTTP API on addr until ctx is cancelled, then stop accepting
+// requests and wait up to cfg.ShutdownTimeout for those in flight. The
+// caller closes the driver after this returns.
+func serveAPI(ctx context.Context, addr string, enricher MessageEnricher) error {
+	server := &http.Server{Addr: addr, Handler: newAPIHandler(enricher)}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	slog.Info("Serving HTTP API", "addr", addr)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down the HTTP server: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Cosine functions usable for server-side similarity, in order of
+// preference. vector.similarity.cosine (Neo4j 5.18+) returns (1 + cos) / 2,
+// so it is mapped back to the cosine range.
+var serverCosineFunctions = []struct {
+	name string
+	expr string
+}{
+	{"gds.similarity.cosine", "gds.similarity.cosine(m2.embedding, $embedding)"},
+	{"vector.similarity.cosine", "2 * vector.similarity.cosine(m2.embedding, $embedding) - 1"},
+}
+
+// Cached result of server-side cosine function detection
+var serverSimilarityCapability struct {
+	once sync.Once
+	mu   sync.Mutex
+	// Cypher expression computing the cosine, "" when unavailable
+	expr string
+}
+
+// Report whether the error means a Cypher function is missing, e.g. GDS not
+// installed
+func isFunctionUnsupportedError(err error) bool {
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) && neo4jErr.Code == "Neo.ClientError.Statement.SyntaxError" {
+		return strings.Contains(strings.ToLower(neo4jErr.Msg), "unknown function")
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "unknown function")
+}
+
+// Cypher expression for the cosine between m2.embedding and $embedding, or
+// "" when the server has no cosine function. Detected once; a warning is
+// logged once when falling back to the in-Go computation.
+func serverCosineExpression() string {
+	serverSimilarityCapability.once.Do(func() {
+		expr, err := detectServerCosine()
+		if err != nil {
+			slog.Warn("Server-side similarity unavailable, using in-Go similarity", "err", err)
+		} else if expr == "" {
+			slog.Warn("Neither gds.similarity.cosine nor vector.similarity.cosine found, using in-Go similarity")
+		}
+		serverSimilarityCapability.mu.Lock()
+		serverSimilarityCapability.expr = expr
+		serverSimilarityCapability.mu.Unlock()
+	})
+
+	serverSimilarityCapability.mu.Lock()
+	defer serverSimilarityCapability.mu.Unlock()
+	return serverSimilarityCapability.expr
+}
+
+// Stop computing similarity server-side after a query reported the
+// function missing
+func markServerSimilarityUnavailable(err error) {
+	serverSimilarityCapability.once.Do(func() {})
+	serverSimilarityCapability.mu.Lock()
+	defer serverSimilarityCapability.mu.Unlock()
+	if serverSimilarityCapability.expr != "" {
+		slog.Warn("Server-side similarity failed, falling back to in-Go similarity", "err", err)
+	}
+	serverSimilarityCapability.expr = ""
+}
+
+// Look up the cosine functions in a separate session, so a failure cannot
+// abort an ingestion transaction
+func detectServerCosine() (string, error) {
+	ctx := context.Background()
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	names := make([]string, len(serverCosineFunctions))
+	for i, function := range serverCosineFunctions {
+		names[i] = function.name
+	}
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, `
+			SHOW FUNCTIONS YIELD name
+			WHERE name IN $names
+			RETURN collect(name)
+		`, map[string]any{"names": names})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return toStringSlice(record.Values[0]), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	found := result.([]string)
+	for _, function := range serverCosineFunctions {
+		if containsString(found, function.name) {
+			return function.expr, nil
+		}
+	}
+	return "", nil
+}
+
+// Report whether candidate filtering for this message should run in Cypher.
+// Compressed embeddings cannot be read by Cypher and chunked similarity needs
+// every candidate, so both keep the in-Go path.
+func useServerSimilarity(message Message) bool {
+	return cfg.ServerSideSimilarity && !cfg.CompressEmbeddings && cfg.ChunkSize <= 0 &&
+		len(message.Embedding) > 0 && serverCosineExpression() != ""
+}
+
+// Lowest cosine that can still produce an edge for a message: the smallest
+// configured threshold, lowered by the topic overlap boost
+func minimumCandidateSimilarity() float64 {
+	threshold := cfg.SimilarityThreshold
+	for _, pairThreshold := range cfg.SenderPairThresholds {
+		threshold = min(threshold, pairThreshold)
+	}
+	if cfg.TopicOverlapBoost > 1 && threshold > 0 {
+		threshold /= cfg.TopicOverlapBoost
+	}
+	return threshold
+}
+
+// Candidate query computing the cosine in Cypher: the same messages as the
+// scan query (window and candidate limit applied first), but only those
+// whose cosine can clear minimumCandidateSimilarity are returned. Returns
+// the scan query's columns so the exact similarity is recomputed in Go.
+func serverSimilarityCandidatesQuery(message Message, userID string, cosine string) (string, map[string]any) {
+	query := `
+		MATCH (m2:Message {userId: $userId})
+		WHERE m2.messageId <> $messageId AND m2.timestamp >= $since
+			AND ($scrimId IS NULL OR m2.scrimId = $scrimId)
+		WITH m2
+		ORDER BY m2.timestamp DESC, m2.messageId
+	`
+	params := map[string]any{
+		"messageId":     message.MessageID,
+		"userId":        userID,
+		"since":         int64(0),
+		"scrimId":       scrimParam(message.ScrimID),
+		"embedding":     message.Embedding,
+		"minSimilarity": minimumCandidateSimilarity(),
+	}
+	if cfg.SimilarityWindow > 0 {
+		params["since"] = time.Now().Add(-cfg.SimilarityWindow).Unix()
+	}
+	if cfg.SimilarityCandidateLimit > 0 {
+		query += "LIMIT $limit\n"
+		params["limit"] = cfg.SimilarityCandidateLimit
+	}
+	query += `
+		WITH m2
+		WHERE m2.embedding IS NOT NULL AND size(m2.embedding) = size($embedding)
+		WITH m2, ` + cosine + ` AS score
+		WHERE score > $minSimilarity
+		RETURN m2.messageId as messageId, m2.embedding as embedding, m2.content as content, m2.sender as sender, m2.embeddingGz as embeddingGz, m2.topics as topics, [(m2)-[:HAS_CHUNK]->(c:Chunk) | c.embedding] as chunks
+		ORDER BY m2.timestamp DESC, m2.messageId
+	`
+	return query, params
+}
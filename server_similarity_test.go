@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestServerSideSimilarityEdges(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.ServerSideSimilarity = true
+		c.CompressEmbeddings = false
+		c.ChunkSize = 0
+		c.SimilarityThreshold = 0.5
+		c.SenderPairThresholds = nil
+		c.TopicOverlapBoost = 1
+	})
+	if serverCosineExpression() == "" {
+		t.Skip("test database has no cosine function")
+	}
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	first := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Embedding: []float64{1, 0, 0}})
+	unrelated := storeTestMessage(t, session, userID, Message{Content: "mũ", Timestamp: now + 1, Embedding: []float64{0, 0, 1}})
+	similar := storeTestMessage(t, session, userID, Message{Content: "giày cỡ 42", Timestamp: now + 2, Embedding: []float64{0.9, 0.1, 0}})
+
+	if n := countTestLinks(t, session, first.MessageID, similar.MessageID); n != 1 {
+		t.Errorf("%d links between similar messages, want 1", n)
+	}
+	if n := countTestLinks(t, session, unrelated.MessageID, similar.MessageID) + countTestLinks(t, session, unrelated.MessageID, first.MessageID); n != 0 {
+		t.Errorf("%d links to the unrelated message, want none", n)
+	}
+}
+
+func TestIsFunctionUnsupportedError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&neo4j.Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError", Msg: "Unknown function 'gds.similarity.cosine'"}, true},
+		{errors.New("Unknown function 'vector.similarity.cosine'"), true},
+		{&neo4j.Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError", Msg: "Invalid input 'MATCH'"}, false},
+		{errors.New("connection reset by peer"), false},
+	}
+	for _, tt := range tests {
+		if got := isFunctionUnsupportedError(tt.err); got != tt.want {
+			t.Errorf("isFunctionUnsupportedError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestUseServerSimilarity(t *testing.T) {
+	serverSimilarityCapability.once.Do(func() {})
+	serverSimilarityCapability.mu.Lock()
+	serverSimilarityCapability.expr = serverCosineFunctions[0].expr
+	serverSimilarityCapability.mu.Unlock()
+	t.Cleanup(func() { markServerSimilarityUnavailable(nil) })
+
+	message := Message{MessageID: "m1", Embedding: []float64{1, 0}}
+	tests := []struct {
+		name    string
+		edit    func(*Config)
+		message Message
+		want    bool
+	}{
+		{"enabled", func(c *Config) {}, message, true},
+		{"disabled", func(c *Config) { c.ServerSideSimilarity = false }, message, false},
+		{"compressed embeddings", func(c *Config) { c.CompressEmbeddings = true }, message, false},
+		{"chunking", func(c *Config) { c.ChunkSize = 200 }, message, false},
+		{"no embedding", func(c *Config) {}, Message{MessageID: "m2"}, false},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) {
+			c.ServerSideSimilarity = true
+			c.CompressEmbeddings = false
+			c.ChunkSize = 0
+			tt.edit(c)
+		})
+		if got := useServerSimilarity(tt.message); got != tt.want {
+			t.Errorf("%s: useServerSimilarity = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	markServerSimilarityUnavailable(errors.New("Unknown function 'gds.similarity.cosine'"))
+	setTestConfig(t, func(c *Config) {
+		c.ServerSideSimilarity = true
+		c.CompressEmbeddings = false
+		c.ChunkSize = 0
+	})
+	if useServerSimilarity(message) {
+		t.Error("useServerSimilarity = true after the function was reported missing")
+	}
+}
+
+func TestServerSimilarityCandidatesQuery(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.SimilarityThreshold = 0.6
+		c.SenderPairThresholds = nil
+		c.TopicOverlapBoost = 1.5
+		c.SimilarityCandidateLimit = 20
+		c.SimilarityWindow = 0
+	})
+	query, params := serverSimilarityCandidatesQuery(Message{MessageID: "m1", Embedding: []float64{1, 0}}, "u1", serverCosineFunctions[1].expr)
+	if !strings.Contains(query, serverCosineFunctions[1].expr+" AS score") || !strings.Contains(query, "LIMIT $limit") {
+		t.Errorf("query lacks the cosine filter or candidate limit:\n%s", query)
+	}
+	// the boost can lift a 0.4 cosine over the 0.6 threshold, so 0.4 must pass the filter
+	if got := params["minSimilarity"].(float64); math.Abs(got-0.4) > 1e-9 {
+		t.Errorf("minSimilarity = %v, want 0.4", got)
+	}
+}
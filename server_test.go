@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostMessageRejectsInvalidBodies(t *testing.T) {
+	// rejected before Neo4j is used
+	handler := newAPIHandler(&stubEnricher{})
+	for _, body := range []string{
+		`{"userId": "u1", "sender": "human"`,
+		`{"userId": "u1", "sender": "human", "content": ""}`,
+		`{"userId": "u1", "sender": "bot", "content": "hi"}`,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(body)))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, recorder.Code)
+		}
+	}
+}
+
+func TestPostMessageNotAwaitingReply(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) { c.DedupWindow = 0 })
+	userID := createTestUser(t, session)
+	server := httptest.NewServer(newAPIHandler(&stubEnricher{}))
+	t.Cleanup(server.Close)
+
+	body := `{"userId": "` + userID + `", "sender": "human", "content": "còn size 42 không?"}`
+	resp, err := http.Post(server.URL+"/messages", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /messages: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /messages = %d, want 201", resp.StatusCode)
+	}
+	var posted Message
+	if err := json.NewDecoder(resp.Body).Decode(&posted); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if posted.AwaitingReply {
+		t.Error("posted message returned as awaiting a reply")
+	}
+
+	// nothing on the API path replies, so --retry-replies must not pick it up
+	messages, err := loadUserMessages(context.Background(), session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].MessageID != posted.MessageID || messages[0].AwaitingReply {
+		t.Errorf("stored messages = %+v, want the posted message not awaiting a reply", messages)
+	}
+	awaiting, err := awaitingReplies(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("awaitingReplies: %v", err)
+	}
+	if len(awaiting) != 0 {
+		t.Errorf("%d messages awaiting a reply, want none", len(awaiting))
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Chat session and optional scrim a chat message is stored under
+type messageScope struct {
+	SessionID string
+	ScrimID   string
+}
+
+// Start a chat session for the user: a (User)-[:HAS_SESSION]->(Session)
+// node that CONTAINS every message sent in it. Returns the session ID.
+func createSession(ctx context.Context, session neo4j.SessionWithContext, userID string) (string, error) {
+	sessionID := generateID()
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {userId: $userId})
+			CREATE (u)-[:HAS_SESSION]->(s:Session {sessionId: $sessionId, userId: $userId, startedAt: $startedAt})
+			RETURN s.sessionId
+		`
+		params := map[string]any{
+			"userId":    userID,
+			"sessionId": sessionID,
+			"startedAt": time.Now().Unix(),
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := records.Single(ctx); err != nil {
+			return nil, fmt.Errorf("user %s not found", userID)
+		}
+		return nil, nil
+	}, txTimeout(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", neo4jError(ctx, err))
+	}
+	slog.Info("Started chat session", "sessionId", sessionID, "userId", userID)
+	return sessionID, nil
+}
+
+// Add a new message to its chat session
+func linkSessionMessage(ctx context.Context, tx neo4j.ManagedTransaction, sessionID string, messageID string) error {
+	query := `
+		MATCH (s:Session {sessionId: $sessionId})
+		MATCH (m:Message {messageId: $messageId})
+		MERGE (s)-[:CONTAINS]->(m)
+		RETURN count(s)
+	`
+	records, err := tx.Run(ctx, query, map[string]any{"sessionId": sessionID, "messageId": messageID})
+	if err != nil {
+		return fmt.Errorf("failed to link message to session: %v", err)
+	}
+	if !records.Next(ctx) {
+		if err := records.Err(); err != nil {
+			return fmt.Errorf("failed to link message to session: %v", err)
+		}
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	return nil
+}
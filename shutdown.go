@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Cancel the root context on SIGINT or SIGTERM so the REPL and background
+// workers wind down and main returns through its deferred closes. If main
+// has not returned after cfg.ShutdownTimeout, or on a second signal, the
+// driver is closed and the process exits.
+func handleShutdownSignals(stop context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Println("\n🛑 Shutting down, finishing the current message...")
+		stop()
+
+		select {
+		case <-signals:
+		case <-time.After(cfg.ShutdownTimeout):
+			slog.Warn("Shutdown did not finish in time", "timeout", cfg.ShutdownTimeout)
+		}
+		neo4jDriver.Close(context.Background())
+		os.Exit(1)
+	}()
+}
+
+// Deliver lines read from r until EOF. A read error, if any, is sent on the
+// error channel before lines is closed.
+func scanLines(r io.Reader) (<-chan string, <-chan error) {
+	lines := make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			errs <- err
+		}
+	}()
+	return lines, errs
+}
+
+// Wait for the next input line; false at EOF or once ctx is cancelled
+func nextLine(ctx context.Context, lines <-chan string) (string, bool) {
+	select {
+	case <-ctx.Done():
+		return "", false
+	case line, ok := <-lines:
+		return line, ok
+	}
+}
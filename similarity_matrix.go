@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Write the pairwise cosine similarity matrix of a user's messages as CSV,
+// with message IDs as the header row and first column. Refuses users with
+// more than cfg.SimilarityMatrixMaxMessages messages since the matrix is O(n²).
+func exportSimilarityMatrix(ctx context.Context, userID string, w io.Writer) error {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		return err
+	}
+	if limit := cfg.SimilarityMatrixMaxMessages; limit > 0 && len(messages) > limit {
+		return fmt.Errorf("user has %d messages, more than the similarity matrix limit of %d", len(messages), limit)
+	}
+	return writeSimilarityMatrix(ctx, messages, w)
+}
+
+// Write the cosine similarity matrix of messages as CSV, in message order
+func writeSimilarityMatrix(ctx context.Context, messages []Message, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, 0, len(messages)+1)
+	header = append(header, "messageId")
+	for _, message := range messages {
+		header = append(header, message.MessageID)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, a := range messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row := make([]string, 0, len(messages)+1)
+		row = append(row, a.MessageID)
+		for _, b := range messages {
+			row = append(row, strconv.FormatFloat(cosineSimilarity(a.Embedding, b.Embedding), 'f', 6, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
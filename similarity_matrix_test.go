@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWriteSimilarityMatrix(t *testing.T) {
+	messages := []Message{
+		{MessageID: "m1", Embedding: []float64{1, 0}},
+		{MessageID: "m2", Embedding: []float64{0, 1}},
+		{MessageID: "m3", Embedding: []float64{1, 1}},
+	}
+	var b strings.Builder
+	if err := writeSimilarityMatrix(context.Background(), messages, &b); err != nil {
+		t.Fatalf("writeSimilarityMatrix: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"messageId,m1,m2,m3",
+		"m1,1.000000,0.000000,0.707107",
+		"m2,0.000000,1.000000,0.707107",
+		"m3,0.707107,0.707107,1.000000",
+		"",
+	}, "\n")
+	if b.String() != want {
+		t.Errorf("matrix =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteSimilarityMatrixCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var b strings.Builder
+	if err := writeSimilarityMatrix(ctx, []Message{{MessageID: "m1", Embedding: []float64{1}}}, &b); err == nil {
+		t.Error("writeSimilarityMatrix ignored a cancelled context")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Detected message content types
+const (
+	ContentTypeProse = "prose"
+	ContentTypeJSON  = "json"
+	ContentTypeURL   = "url"
+)
+
+var (
+	urlPattern   = regexp.MustCompile(`https?://[^\s<>"]+`)
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// Classify content as a JSON payload, a bare link, or prose
+func detectContentType(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return ContentTypeJSON
+	}
+	if urlPattern.FindString(trimmed) == trimmed && trimmed != "" {
+		return ContentTypeURL
+	}
+	return ContentTypeProse
+}
+
+// Text to embed for a message. JSON payloads and links embed poorly as raw
+// text, so with cfg.StructuredContent enabled they are turned into a short
+// description first; prose is returned unchanged.
+func embeddingInput(ctx context.Context, content string) (string, string) {
+	contentType := detectContentType(content)
+	if !cfg.StructuredContent {
+		return content, contentType
+	}
+
+	switch contentType {
+	case ContentTypeJSON:
+		if text := describeJSON(content, cfg.StructuredKeys); text != "" {
+			return text, contentType
+		}
+	case ContentTypeURL:
+		return describeURL(ctx, strings.TrimSpace(content)), contentType
+	}
+	return content, contentType
+}
+
+// Describe a JSON payload by its key fields ("name: Áo thun; price: 199000").
+// Falls back to all scalar fields when none of the keys are present.
+func describeJSON(content string, keys []string) string {
+	payload, ok := parseJSONPayload(content)
+	if !ok {
+		return ""
+	}
+
+	fields := make(map[string][]string)
+	collectJSONFields("", payload, fields)
+
+	var parts []string
+	for _, key := range keys {
+		if values := jsonFieldValues(fields, key); len(values) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s", key, strings.Join(values, ", ")))
+		}
+	}
+	if len(parts) == 0 {
+		for _, path := range sortedKeys(fields) {
+			parts = append(parts, fmt.Sprintf("%s: %s", path, strings.Join(fields[path], ", ")))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+// Decode a JSON payload
+func parseJSONPayload(content string) (any, bool) {
+	var payload any
+	if err := json.Unmarshal([]byte(content), &payload); err != nil {
+		return nil, false
+	}
+	return payload, true
+}
+
+// Values of the flattened fields whose path is key or ends in ".key",
+// ignoring case, in path order
+func jsonFieldValues(fields map[string][]string, key string) []string {
+	var values []string
+	for _, path := range sortedKeys(fields) {
+		if strings.EqualFold(path, key) || strings.HasSuffix(strings.ToLower(path), "."+strings.ToLower(key)) {
+			values = append(values, fields[path]...)
+		}
+	}
+	return values
+}
+
+// Flatten scalar JSON values into dotted paths
+func collectJSONFields(prefix string, value any, fields map[string][]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			collectJSONFields(path, child, fields)
+		}
+	case []any:
+		for _, child := range v {
+			collectJSONFields(prefix, child, fields)
+		}
+	case nil:
+	default:
+		if prefix == "" {
+			prefix = "value"
+		}
+		fields[prefix] = append(fields[prefix], fmt.Sprint(v))
+	}
+}
+
+// Describe a link by its page title when cfg.FetchURLTitles is set, else by
+// its host and the words in its path
+func describeURL(ctx context.Context, rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	if cfg.FetchURLTitles {
+		if title, err := fetchPageTitle(ctx, rawURL); err != nil {
+			slog.Warn("Failed to fetch page title", "url", rawURL, "err", err)
+		} else if title != "" {
+			return fmt.Sprintf("Link to %s: %s", parsed.Host, title)
+		}
+	}
+
+	words := strings.FieldsFunc(parsed.Path, func(r rune) bool {
+		return r == '/' || r == '-' || r == '_' || r == '.' || r == '+'
+	})
+	if len(words) == 0 {
+		return "Link to " + parsed.Host
+	}
+	return fmt.Sprintf("Link to %s: %s", parsed.Host, strings.Join(words, " "))
+}
+
+// Fetch a page and return the contents of its <title>
+func fetchPageTitle(ctx context.Context, rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	if err != nil {
+		return "", err
+	}
+	match := titlePattern.FindSubmatch(body)
+	if match == nil {
+		return "", nil
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " "), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{"name": "Áo thun", "price": 199000}`, ContentTypeJSON},
+		{` [1, 2, 3] `, ContentTypeJSON},
+		{`{"name": "broken"`, ContentTypeProse},
+		{"https://shop.example.com/ao-thun-trang", ContentTypeURL},
+		{"see https://shop.example.com/ao", ContentTypeProse},
+		{"Áo này còn size M không?", ContentTypeProse},
+		{"", ContentTypeProse},
+	}
+	for _, tt := range tests {
+		if got := detectContentType(tt.content); got != tt.want {
+			t.Errorf("detectContentType(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeJSON(t *testing.T) {
+	content := `{"product": {"name": "Áo thun", "Price": 199000, "tags": ["cotton", "white"]}, "id": 7}`
+	if got, want := describeJSON(content, []string{"name", "price"}), "name: Áo thun; price: 199000"; got != want {
+		t.Errorf("describeJSON with keys = %q, want %q", got, want)
+	}
+	if got, want := describeJSON(content, []string{"sku"}), "id: 7; product.Price: 199000; product.name: Áo thun; product.tags: cotton, white"; got != want {
+		t.Errorf("describeJSON without matching keys = %q, want %q", got, want)
+	}
+	if got := describeJSON("not json", []string{"name"}); got != "" {
+		t.Errorf("describeJSON(invalid) = %q, want empty", got)
+	}
+}
+
+func TestDescribeURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head><title> Áo thun &amp; quần\n jean </title></head></html>")
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	setTestConfig(t, func(c *Config) { c.FetchURLTitles = false })
+	if got, want := describeURL(ctx, "https://shop.example.com/ao-thun/trang_size-m.html"), "Link to shop.example.com: ao thun trang size m html"; got != want {
+		t.Errorf("describeURL from the path = %q, want %q", got, want)
+	}
+	if got, want := describeURL(ctx, "https://shop.example.com/"), "Link to shop.example.com"; got != want {
+		t.Errorf("describeURL without a path = %q, want %q", got, want)
+	}
+
+	setTestConfig(t, func(c *Config) { c.FetchURLTitles = true })
+	host := server.Listener.Addr().String()
+	if got, want := describeURL(ctx, server.URL+"/p/1"), "Link to "+host+": Áo thun & quần jean"; got != want {
+		t.Errorf("describeURL from the title = %q, want %q", got, want)
+	}
+}
+
+func TestEmbeddingInputStructured(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.StructuredContent = true
+		c.StructuredKeys = []string{"name"}
+		c.FetchURLTitles = false
+	})
+	input, contentType := embeddingInput(context.Background(), `{"name": "Giày", "size": 42}`)
+	if input != "name: Giày" || contentType != ContentTypeJSON {
+		t.Errorf("embeddingInput = %q, %q", input, contentType)
+	}
+
+	setTestConfig(t, func(c *Config) { c.StructuredContent = false })
+	raw := `{"name": "Giày"}`
+	if input, contentType := embeddingInput(context.Background(), raw); input != raw || contentType != ContentTypeJSON {
+		t.Errorf("embeddingInput without StructuredContent = %q, %q; want the raw content", input, contentType)
+	}
+}
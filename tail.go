@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Options for following newly ingested messages
+type tailOptions struct {
+	Since    time.Time
+	UserID   string
+	Topic    string
+	Interval time.Duration
+}
+
+// Position in the message stream: the latest timestamp printed and the IDs
+// already printed at that timestamp (timestamps have one-second resolution)
+type tailCursor struct {
+	Timestamp int64
+	Seen      map[string]bool
+}
+
+// Fetch messages at or after the cursor, filtered by user and topic, and
+// advance the cursor past them
+func fetchTailMessages(ctx context.Context, session neo4j.SessionWithContext, cursor *tailCursor, opts tailOptions) ([]userMessage, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message)
+			WHERE m.timestamp >= $cursor
+				AND ($userId = "" OR m.userId = $userId)
+				AND ($topic = "" OR $topic IN m.topics)
+			RETURN m, m.userId
+			ORDER BY m.timestamp, m.messageId
+		`
+		params := map[string]any{
+			"cursor": cursor.Timestamp,
+			"userId": opts.UserID,
+			"topic":  opts.Topic,
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages []userMessage
+		for records.Next(ctx) {
+			record := records.Record()
+			node, ok := record.Values[0].(neo4j.Node)
+			if !ok {
+				continue
+			}
+			userID, _ := record.Values[1].(string)
+			messages = append(messages, userMessage{Message: messageFromNode(node), UserID: userID})
+		}
+		return messages, records.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cursor.advance(result.([]userMessage)), nil
+}
+
+// Drop the messages already printed from a batch in timestamp order and
+// move the cursor past the rest, which are returned
+func (c *tailCursor) advance(items []userMessage) []userMessage {
+	var fresh []userMessage
+	for _, item := range items {
+		message := item.Message
+		if message.Timestamp == c.Timestamp && c.Seen[message.MessageID] {
+			continue
+		}
+		if message.Timestamp > c.Timestamp {
+			c.Timestamp = message.Timestamp
+			c.Seen = make(map[string]bool)
+		}
+		c.Seen[message.MessageID] = true
+		fresh = append(fresh, item)
+	}
+	return fresh
+}
+
+// Print one tailed message
+func printTailMessage(w io.Writer, item userMessage) {
+	message := item.Message
+	topics := "no topics"
+	if len(message.Topics) > 0 {
+		topics = strings.Join(message.Topics, ", ")
+	}
+	fmt.Fprintf(w, "[%s] user=%s %-5s (%s) %s\n",
+		time.Unix(message.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		item.UserID, message.Sender, topics, message.Content)
+}
+
+// Poll for new messages every opts.Interval and print them until ctx is cancelled
+func tailMessages(ctx context.Context, w io.Writer, opts tailOptions) error {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	cursor := &tailCursor{Timestamp: opts.Since.Unix(), Seen: make(map[string]bool)}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		messages, err := fetchTailMessages(ctx, session, cursor, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to poll messages: %v", err)
+		}
+		for _, item := range messages {
+			printTailMessage(w, item)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tailItems(ids ...string) []userMessage {
+	items := make([]userMessage, len(ids))
+	for i, id := range ids {
+		// "b@20" is message b at timestamp 20
+		messageID, at, _ := strings.Cut(id, "@")
+		timestamp, _ := strconv.ParseInt(at, 10, 64)
+		items[i] = userMessage{Message: Message{MessageID: messageID, Timestamp: timestamp}, UserID: "u1"}
+	}
+	return items
+}
+
+func tailIDs(items []userMessage) string {
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, item.Message.MessageID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestTailCursorAdvance(t *testing.T) {
+	cursor := &tailCursor{Timestamp: 10, Seen: make(map[string]bool)}
+
+	// polls return everything at or after the cursor timestamp
+	polls := []struct {
+		batch []userMessage
+		want  string
+	}{
+		{tailItems("a@10", "b@20", "c@20"), "a,b,c"},
+		{tailItems("b@20", "c@20"), ""},
+		{tailItems("b@20", "c@20", "d@20", "e@30"), "d,e"},
+		{tailItems("e@30"), ""},
+	}
+	for i, poll := range polls {
+		if got := tailIDs(cursor.advance(poll.batch)); got != poll.want {
+			t.Errorf("poll %d printed %q, want %q", i, got, poll.want)
+		}
+	}
+	if cursor.Timestamp != 30 || len(cursor.Seen) != 1 {
+		t.Errorf("cursor = %d with %d seen, want 30 with 1", cursor.Timestamp, len(cursor.Seen))
+	}
+}
+
+func TestPrintTailMessage(t *testing.T) {
+	var b strings.Builder
+	at := time.Date(2026, 3, 1, 9, 30, 0, 0, time.Local).Unix()
+	printTailMessage(&b, userMessage{UserID: "u1", Message: Message{Timestamp: at, Sender: "ai", Content: "Còn size 42", Topics: []string{"Giày", "Khuyến mãi"}}})
+	printTailMessage(&b, userMessage{UserID: "u1", Message: Message{Timestamp: at, Sender: "human", Content: "ok"}})
+
+	want := "[2026-03-01 09:30:00] user=u1 ai    (Giày, Khuyến mãi) Còn size 42\n" +
+		"[2026-03-01 09:30:00] user=u1 human (no topics) ok\n"
+	if b.String() != want {
+		t.Errorf("printed\n%s\nwant\n%s", b.String(), want)
+	}
+}
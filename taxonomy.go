@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Tags used when neither TOPIC_TAGS_FILE nor TOPIC_TAGS is set
+var defaultTopicTags = []string{"Áo", "Quần", "Giày", "Túi", "Mũ", "Khuyến mãi", "Giảm giá", "Freeship", "Combo"}
+
+// Load the topic taxonomy from the JSON array in TOPIC_TAGS_FILE, else the
+// comma-separated TOPIC_TAGS, else defaultTopicTags. Tags are normalized
+// and deduplicated by topic key (case-insensitively when caseFold is set);
+// an empty taxonomy is an error.
+func loadTopicTags(caseFold bool) ([]string, error) {
+	tags := envList("TOPIC_TAGS", defaultTopicTags)
+	if path := strings.TrimSpace(os.Getenv("TOPIC_TAGS_FILE")); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TOPIC_TAGS_FILE: %v", err)
+		}
+		tags = nil
+		if err := json.Unmarshal(data, &tags); err != nil {
+			return nil, fmt.Errorf("invalid TOPIC_TAGS_FILE %s: want a JSON array of strings: %v", path, err)
+		}
+	}
+
+	var cleaned []string
+	keys := make(map[string]bool)
+	for _, tag := range tags {
+		tag = normalizeTopicName(tag)
+		key := topicKeyFold(tag, caseFold)
+		if tag == "" || keys[key] {
+			continue
+		}
+		keys[key] = true
+		cleaned = append(cleaned, tag)
+	}
+	if len(cleaned) == 0 {
+		return nil, fmt.Errorf("the topic tag list is empty; set TOPIC_TAGS or TOPIC_TAGS_FILE")
+	}
+	return cleaned, nil
+}
+
+// Normalize a topic name: NFC, trimmed, with runs of whitespace collapsed
+// to one space, so differently encoded spellings of a tag compare equal
+func normalizeTopicName(name string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+}
+
+// Key under which topic names are the same topic: the normalized name,
+// case-folded when caseFold is set
+func topicKeyFold(name string, caseFold bool) string {
+	name = normalizeTopicName(name)
+	if caseFold {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+// Topic key of a name under cfg.TopicCaseFold
+func topicKey(name string) string {
+	return topicKeyFold(name, cfg.TopicCaseFold)
+}
+
+// The cfg.TopicTags spelling of a topic name, or "" if it is not a tag
+func taxonomyTag(name string) string {
+	key := topicKey(name)
+	for _, tag := range cfg.TopicTags {
+		if topicKey(tag) == key {
+			return tag
+		}
+	}
+	return ""
+}
+
+// Display name a topic is stored under: its taxonomy spelling when it is a
+// tag, else the normalized name. Every Topic MERGE goes through this so
+// spellings that differ only in encoding, spacing or (with
+// cfg.TopicCaseFold) case share one node.
+func canonicalTopicName(name string) string {
+	if tag := taxonomyTag(name); tag != "" {
+		return tag
+	}
+	return normalizeTopicName(name)
+}
+
+// Canonical names of topics, without duplicates or empty names, in order
+func canonicalTopicNames(topics []string) []string {
+	if topics == nil {
+		return nil
+	}
+	canonical := []string{}
+	for _, topic := range topics {
+		if name := canonicalTopicName(topic); name != "" && !containsString(canonical, name) {
+			canonical = append(canonical, name)
+		}
+	}
+	return canonical
+}
+
+// System prompt for topic extraction restricted to tags
+func topicExtractionPrompt(tags []string) string {
+	return `Phân tích nội dung và gán tag thương mại điện tử phù hợp từ danh sách sau:
+
+Danh sách tag có sẵn:
+["` + strings.Join(tags, `", "`) + `"]
+
+Quy tắc gán tag:
+1. Chỉ sử dụng các tag trong danh sách trên
+2. Gán tag dựa trên nội dung thực tế của tin nhắn
+3. Một tin nhắn có thể có nhiều tag
+4. Nếu không có tag phù hợp thì trả về "không có tag"
+
+Trả về danh sách tag phân cách bằng dấu phẩy, không có dấu ngoặc kép.`
+}
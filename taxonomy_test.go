@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// "Giày" with the grave accent as a combining mark (NFD)
+const decomposedGiay = "Giày"
+
+func TestNormalizeTopicName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{decomposedGiay, "Giày"},
+		{"  Giảm \t giá ", "Giảm giá"},
+		{"   ", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeTopicName(tt.name); got != tt.want {
+			t.Errorf("normalizeTopicName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if topicKeyFold("GIÀY", true) != topicKeyFold(decomposedGiay, true) {
+		t.Error("case-folded keys differ for GIÀY and decomposed Giày")
+	}
+	if topicKeyFold("GIÀY", false) == topicKeyFold("Giày", false) {
+		t.Error("keys without case folding ignore case")
+	}
+}
+
+func TestLoadTopicTags(t *testing.T) {
+	t.Setenv("TOPIC_TAGS_FILE", "")
+	t.Setenv("TOPIC_TAGS", "Giày, "+decomposedGiay+", giày,  Túi  xách ")
+	tags, err := loadTopicTags(false)
+	if err != nil {
+		t.Fatalf("loadTopicTags: %v", err)
+	}
+	if want := []string{"Giày", "giày", "Túi xách"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %q, want %q", tags, want)
+	}
+	if tags, _ := loadTopicTags(true); !reflect.DeepEqual(tags, []string{"Giày", "Túi xách"}) {
+		t.Errorf("case-folded tags = %q, want Giày and Túi xách", tags)
+	}
+
+	// the file wins over TOPIC_TAGS
+	path := filepath.Join(t.TempDir(), "tags.json")
+	if err := os.WriteFile(path, []byte(`[" Mũ ", "Áo"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TOPIC_TAGS_FILE", path)
+	if tags, err := loadTopicTags(false); err != nil || !reflect.DeepEqual(tags, []string{"Mũ", "Áo"}) {
+		t.Errorf("tags from file = %q, %v", tags, err)
+	}
+	if err := os.WriteFile(path, []byte(`["  "]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTopicTags(false); err == nil {
+		t.Error("loadTopicTags accepted an empty taxonomy")
+	}
+}
+
+func TestValidateTopicTagsNormalizes(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.TopicCaseFold = true
+	})
+	extraction := validateTopicTags(decomposedGiay + ", GIẢM  GIÁ, giày")
+	if want := []string{"Giày", "Giảm giá"}; !reflect.DeepEqual(extraction.Accepted, want) {
+		t.Errorf("topics = %q, want %q", extraction.Accepted, want)
+	}
+}
+
+func TestTopicSpellingsShareNode(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.TopicCaseFold = true
+	})
+	userID := createTestUser(t, session)
+
+	message := storeTestMessage(t, session, userID, Message{Content: "giày", Timestamp: time.Now().Unix(), Topics: []string{decomposedGiay, " giày ", "GIÀY"}})
+	if got := testTopicEdges(t, session, message.MessageID); !reflect.DeepEqual(got, []string{"Giày"}) {
+		t.Errorf("topics = %q, want only Giày", got)
+	}
+}
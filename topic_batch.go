@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+type upsertedTopicsKey struct{}
+
+// Mark that the Topic nodes of messages stored with ctx were already created
+// by upsertTopics, so addMessageAndCreateEdges only links to them
+func withUpsertedTopics(ctx context.Context) context.Context {
+	return context.WithValue(ctx, upsertedTopicsKey{}, true)
+}
+
+// Report whether ctx was marked by withUpsertedTopics
+func topicsUpserted(ctx context.Context) bool {
+	upserted, _ := ctx.Value(upsertedTopicsKey{}).(bool)
+	return upserted
+}
+
+// Distinct topics of a batch of messages, in first-seen order
+func distinctTopics(messages []Message) []string {
+	var topics []string
+	for _, message := range messages {
+		for _, topic := range canonicalTopicNames(message.Topics) {
+			if !containsString(topics, topic) {
+				topics = append(topics, topic)
+			}
+		}
+	}
+	return topics
+}
+
+// MERGE each topic node once, in a single transaction, before a batch of
+// messages is linked to them. Popular topics are then locked once per batch
+// instead of once per message.
+func upsertTopics(ctx context.Context, session neo4j.SessionWithContext, topics []string) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	rows := make([]map[string]any, 0, len(topics))
+	for _, topic := range topics {
+		rows = append(rows, map[string]any{"name": topic, "topicId": generateID()})
+	}
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			UNWIND $topics AS topic
+			MERGE (t:Topic {name: topic.name})
+			ON CREATE SET t.topicId = topic.topicId, t.createdAt = $timestamp
+		`
+		_, err := tx.Run(ctx, query, map[string]any{"topics": rows, "timestamp": time.Now().Unix()})
+		return nil, err
+	}, txTimeout(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to upsert topics: %w", neo4jError(ctx, err))
+	}
+	return nil
+}
+
+// Context for storing the next batch of messages: with
+// cfg.TopicUpsertBatchSize set, the batch's topics are upserted first and
+// the context marked with withUpsertedTopics. When batching is off or the
+// upsert fails, messages MERGE their own topics as usual.
+func topicBatchContext(ctx context.Context, session neo4j.SessionWithContext, batch []Message) context.Context {
+	if cfg.TopicUpsertBatchSize <= 0 {
+		return ctx
+	}
+	if err := upsertTopics(ctx, session, distinctTopics(batch)); err != nil {
+		slog.Warn("Batched topic upsert failed, merging topics per message", "err", err)
+		return ctx
+	}
+	return withUpsertedTopics(ctx)
+}
+
+// Link a message to topic nodes created by upsertTopics via BELONGS_TO.
+// Topics missing from the upserted set are logged and merged as
+// linkMessageTopics does, so none is left unlinked.
+func linkUpsertedTopics(ctx context.Context, tx neo4j.ManagedTransaction, messageID string, topics []string, promptVersion string) error {
+	query := `
+		MATCH (m:Message {messageId: $messageId})
+		UNWIND $topics AS topicName
+		MATCH (t:Topic {name: topicName})
+		MERGE (m)-[r:BELONGS_TO]->(t)
+		SET r.topicPromptVersion = $promptVersion
+		RETURN t.name
+	`
+	params := map[string]any{
+		"messageId":     messageID,
+		"topics":        topics,
+		"promptVersion": promptVersion,
+	}
+	records, err := tx.Run(ctx, query, params)
+	if err != nil {
+		return fmt.Errorf("failed to link message to topics: %v", err)
+	}
+	linked := make(map[string]bool, len(topics))
+	for records.Next(ctx) {
+		name, _ := records.Record().Values[0].(string)
+		linked[name] = true
+	}
+	if err := records.Err(); err != nil {
+		return fmt.Errorf("failed to link message to topics: %v", err)
+	}
+
+	var missing []string
+	for _, topic := range topics {
+		if !linked[topic] {
+			missing = append(missing, topic)
+		}
+	}
+	if len(missing) > 0 {
+		slog.Warn("Topics missing from the batch upsert, merging them per message", "messageId", messageID, "topics", missing)
+		linkMessageTopics(ctx, tx, messageID, missing, promptVersion)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestDistinctTopics(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.TopicTags = defaultTopicTags })
+	messages := []Message{
+		{Topics: []string{"Giày", " Giảm giá "}},
+		{},
+		{Topics: []string{"Giảm giá", "Túi xách", "Giày"}},
+	}
+	want := []string{"Giày", "Giảm giá", "Túi xách"}
+	if got := distinctTopics(messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("distinctTopics = %v, want %v", got, want)
+	}
+	if got := distinctTopics([]Message{{}}); got != nil {
+		t.Errorf("distinctTopics without topics = %v, want nil", got)
+	}
+}
+
+func TestTopicBatchContextDisabled(t *testing.T) {
+	setTestConfig(t, func(c *Config) { c.TopicUpsertBatchSize = 0 })
+	// with batching off no session is needed
+	ctx := topicBatchContext(context.Background(), nil, []Message{{Topics: []string{"Giày"}}})
+	if topicsUpserted(ctx) {
+		t.Error("context marked as upserted with batching off")
+	}
+	if !topicsUpserted(withUpsertedTopics(context.Background())) {
+		t.Error("withUpsertedTopics context not reported as upserted")
+	}
+}
+
+func TestTopicBatchLinksMessages(t *testing.T) {
+	// topics unique to the test, so the batch creates them
+	suffix := " " + generateID()
+	shoes, sale := "Giày"+suffix, "Giảm giá"+suffix
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = []string{shoes, sale}
+		c.TopicUpsertBatchSize = 2
+	})
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	batch := []Message{
+		{MessageID: generateID(), Sender: "human", Content: "giày sale", Timestamp: now, Topics: []string{shoes, sale}},
+		{MessageID: generateID(), Sender: "human", Content: "giày nữa", Timestamp: now + 1, Topics: []string{shoes}},
+	}
+	batchCtx := topicBatchContext(ctx, session, batch)
+	if !topicsUpserted(batchCtx) {
+		t.Fatal("batch topics were not upserted")
+	}
+	for _, message := range batch {
+		message.ContentHash = contentHash(message.Sender, message.Content)
+		if err := addMessageAndCreateEdges(batchCtx, session, message, userID); err != nil {
+			t.Fatalf("addMessageAndCreateEdges: %v", err)
+		}
+	}
+	upserted := testTopicNodes(t, session, shoes, sale)
+
+	// a topic left out of the upserted set is still linked
+	bags := "Túi xách" + suffix
+	late := Message{MessageID: generateID(), Sender: "human", Content: "túi xách", Timestamp: now + 2, Topics: []string{shoes, bags}}
+	late.ContentHash = contentHash(late.Sender, late.Content)
+	if err := addMessageAndCreateEdges(batchCtx, session, late, userID); err != nil {
+		t.Fatalf("addMessageAndCreateEdges: %v", err)
+	}
+	batch = append(batch, late)
+
+	for i, want := range [][]string{{shoes, sale}, {shoes}, {shoes, bags}} {
+		if got := testTopicEdges(t, session, batch[i].MessageID); !reflect.DeepEqual(got, want) {
+			t.Errorf("message %d topics = %v, want %v", i, got, want)
+		}
+	}
+	// each shared topic is the single node the batch upserted
+	if got := testTopicNodes(t, session, shoes, sale, bags); !reflect.DeepEqual(got[shoes], upserted[shoes]) || !reflect.DeepEqual(got[sale], upserted[sale]) || len(got[bags]) != 1 {
+		t.Errorf("topic nodes = %v, want one each, %v as upserted", got, upserted)
+	}
+}
+
+// IDs of the Topic nodes with each of names
+func testTopicNodes(t *testing.T, session neo4j.SessionWithContext, names ...string) map[string][]string {
+	t.Helper()
+	ctx := context.Background()
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (t:Topic)
+			WHERE t.name IN $names
+			RETURN t.name, t.topicId
+			ORDER BY t.topicId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"names": names})
+		if err != nil {
+			return nil, err
+		}
+		nodes := make(map[string][]string)
+		for records.Next(ctx) {
+			name, _ := records.Record().Values[0].(string)
+			topicID, _ := records.Record().Values[1].(string)
+			nodes[name] = append(nodes[name], topicID)
+		}
+		return nodes, records.Err()
+	})
+	if err != nil {
+		t.Fatalf("failed to load topic nodes: %v", err)
+	}
+	return result.(map[string][]string)
+}
+
+func TestReplayFileBatchedTopics(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.OpenAIMaxRetries = 0
+		c.TopicUpsertBatchSize = 3
+	})
+	client, _ := newFakeOpenAI(t)
+	userID := createTestUser(t, session)
+
+	// the repeated line is caught within its batch, before either is stored
+	lines := []string{
+		`{"sender": "human", "content": "giày size 42", "timestamp": 1700000000}`,
+		`{"sender": "human", "content": "giày size 42", "timestamp": 1700000000}`,
+		`{"sender": "ai", "content": "dạ còn ạ", "timestamp": 1700000001}`,
+		`{"sender": "human", "content": "cảm ơn", "timestamp": 1700000002}`,
+	}
+	path := filepath.Join(t.TempDir(), "replay.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := replayFile(context.Background(), client, path, userID, false)
+	if err != nil {
+		t.Fatalf("replayFile: %v", err)
+	}
+	if batch.Succeeded != 3 || batch.Skipped != 1 || batch.Failed != 0 {
+		t.Errorf("replay = %d succeeded, %d skipped, %d failed; want 3, 1 and 0", batch.Succeeded, batch.Skipped, batch.Failed)
+	}
+	messages, err := loadUserMessages(context.Background(), session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Errorf("%d messages stored, want 3", len(messages))
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Formats exportTopicGraph can write
+const (
+	TopicGraphJSON = "json"
+	TopicGraphDOT  = "dot"
+)
+
+// Topic in a topic graph, sized by the number of the user's messages in it
+type TopicGraphNode struct {
+	Name     string `json:"name"`
+	Messages int64  `json:"messages"`
+}
+
+// Pair of topics and the number of the user's messages tagged with both
+type TopicGraphEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Messages int64  `json:"messages"`
+}
+
+// Topic-level view of a user's messages, without messages or embeddings
+type topicGraph struct {
+	UserID string           `json:"userId"`
+	Topics []TopicGraphNode `json:"topics"`
+	Edges  []TopicGraphEdge `json:"edges"`
+}
+
+// Validate a topic graph format
+func parseTopicGraphFormat(value string) (string, error) {
+	switch value {
+	case TopicGraphJSON, TopicGraphDOT:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid topic graph format %q (want %s or %s)", value, TopicGraphJSON, TopicGraphDOT)
+}
+
+// Load the topics of a user's messages with their message counts, and each
+// pair of topics co-occurring on the user's messages (counted from
+// BELONGS_TO edges, each pair once)
+func loadTopicGraph(ctx context.Context, userID string) (topicGraph, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		graph := topicGraph{UserID: userID, Topics: []TopicGraphNode{}, Edges: []TopicGraphEdge{}}
+		nodeQuery := `
+			MATCH (m:Message {userId: $userId})-[:BELONGS_TO]->(t:Topic)
+			RETURN t.name, count(DISTINCT m) AS messages
+			ORDER BY messages DESC, t.name
+		`
+		records, err := tx.Run(ctx, nodeQuery, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			node := TopicGraphNode{}
+			node.Name, _ = values[0].(string)
+			node.Messages, _ = values[1].(int64)
+			graph.Topics = append(graph.Topics, node)
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		edgeQuery := `
+			MATCH (t1:Topic)<-[:BELONGS_TO]-(m:Message {userId: $userId})-[:BELONGS_TO]->(t2:Topic)
+			WHERE t1.name < t2.name
+			RETURN t1.name, t2.name, count(DISTINCT m) AS messages
+			ORDER BY messages DESC, t1.name, t2.name
+		`
+		records, err = tx.Run(ctx, edgeQuery, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		for records.Next(ctx) {
+			values := records.Record().Values
+			edge := TopicGraphEdge{}
+			edge.From, _ = values[0].(string)
+			edge.To, _ = values[1].(string)
+			edge.Messages, _ = values[2].(int64)
+			graph.Edges = append(graph.Edges, edge)
+		}
+		return graph, records.Err()
+	}, txTimeout(ctx))
+	if err != nil {
+		return topicGraph{}, fmt.Errorf("failed to load topic graph: %w", neo4jError(ctx, err))
+	}
+	return result.(topicGraph), nil
+}
+
+// Write a topic graph as an undirected Graphviz graph. Node width follows
+// the topic's message count and edge pen width the co-occurrence count, both
+// relative to the largest.
+func writeTopicGraphDOT(w io.Writer, graph topicGraph) error {
+	var maxTopic, maxEdge int64 = 1, 1
+	for _, node := range graph.Topics {
+		maxTopic = max(maxTopic, node.Messages)
+	}
+	for _, edge := range graph.Edges {
+		maxEdge = max(maxEdge, edge.Messages)
+	}
+
+	if _, err := fmt.Fprintf(w, "graph topics {\n"); err != nil {
+		return err
+	}
+	for _, node := range graph.Topics {
+		width := 0.5 + 1.5*float64(node.Messages)/float64(maxTopic)
+		label := fmt.Sprintf("%s (%d)", node.Name, node.Messages)
+		if _, err := fmt.Fprintf(w, "  %s [label=%s, width=%.2f];\n", strconv.Quote(node.Name), strconv.Quote(label), width); err != nil {
+			return err
+		}
+	}
+	for _, edge := range graph.Edges {
+		penWidth := 1 + 4*float64(edge.Messages)/float64(maxEdge)
+		if _, err := fmt.Fprintf(w, "  %s -- %s [label=\"%d\", weight=%d, penwidth=%.2f];\n", strconv.Quote(edge.From), strconv.Quote(edge.To), edge.Messages, edge.Messages, penWidth); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "}\n")
+	return err
+}
+
+// Export the topic graph of a user's messages in the given format: topics
+// with message counts and co-occurrence edges weighted by shared messages
+func exportTopicGraph(ctx context.Context, userID string, w io.Writer, format string) error {
+	graph, err := loadTopicGraph(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if format == TopicGraphDOT {
+		if err := writeTopicGraphDOT(w, graph); err != nil {
+			return fmt.Errorf("failed to write topic graph: %v", err)
+		}
+		return nil
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(graph); err != nil {
+		return fmt.Errorf("failed to write topic graph: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTopicGraphFormat(t *testing.T) {
+	for _, value := range []string{TopicGraphJSON, TopicGraphDOT} {
+		if got, err := parseTopicGraphFormat(value); err != nil || got != value {
+			t.Errorf("parseTopicGraphFormat(%q) = %q, %v", value, got, err)
+		}
+	}
+	if _, err := parseTopicGraphFormat("DOT"); err == nil {
+		t.Error("parseTopicGraphFormat accepted DOT")
+	}
+}
+
+func TestWriteTopicGraphDOT(t *testing.T) {
+	graph := topicGraph{
+		Topics: []TopicGraphNode{{Name: "Giày", Messages: 2}, {Name: `Túi "xách"`, Messages: 1}},
+		Edges:  []TopicGraphEdge{{From: "Giày", To: `Túi "xách"`, Messages: 1}},
+	}
+	var b bytes.Buffer
+	if err := writeTopicGraphDOT(&b, graph); err != nil {
+		t.Fatalf("writeTopicGraphDOT: %v", err)
+	}
+	want := strings.Join([]string{
+		"graph topics {",
+		`  "Giày" [label="Giày (2)", width=2.00];`,
+		`  "Túi \"xách\"" [label="Túi \"xách\" (1)", width=1.25];`,
+		`  "Giày" -- "Túi \"xách\"" [label="1", weight=1, penwidth=5.00];`,
+		"}",
+		"",
+	}, "\n")
+	if got := b.String(); got != want {
+		t.Errorf("DOT output:\n%s\nwant:\n%s", got, want)
+	}
+
+	b.Reset()
+	if err := writeTopicGraphDOT(&b, topicGraph{}); err != nil || b.String() != "graph topics {\n}\n" {
+		t.Errorf("empty graph = %q, %v", b.String(), err)
+	}
+}
+
+func TestExportTopicGraph(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) { c.TopicTags = defaultTopicTags })
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	storeTestMessage(t, session, userID, Message{Content: "giày giảm giá", Timestamp: now, Topics: []string{"Giày", "Giảm giá"}})
+	storeTestMessage(t, session, userID, Message{Content: "giày nữa", Timestamp: now + 1, Topics: []string{"Giày"}})
+	storeTestMessage(t, session, userID, Message{Content: "cảm ơn", Timestamp: now + 2})
+
+	var b bytes.Buffer
+	if err := exportTopicGraph(ctx, userID, &b, TopicGraphJSON); err != nil {
+		t.Fatalf("exportTopicGraph: %v", err)
+	}
+	var graph topicGraph
+	if err := json.Unmarshal(b.Bytes(), &graph); err != nil {
+		t.Fatalf("topic graph is not valid JSON: %v", err)
+	}
+	want := topicGraph{
+		UserID: userID,
+		Topics: []TopicGraphNode{{Name: "Giày", Messages: 2}, {Name: "Giảm giá", Messages: 1}},
+		Edges:  []TopicGraphEdge{{From: "Giày", To: "Giảm giá", Messages: 1}},
+	}
+	if !reflect.DeepEqual(graph, want) {
+		t.Errorf("topic graph = %+v, want %+v", graph, want)
+	}
+
+	// a user without topics still gets lists
+	other := createTestUser(t, session)
+	b.Reset()
+	if err := exportTopicGraph(ctx, other, &b, TopicGraphJSON); err != nil {
+		t.Fatalf("exportTopicGraph: %v", err)
+	}
+	if !strings.Contains(b.String(), `"topics": []`) || !strings.Contains(b.String(), `"edges": []`) {
+		t.Errorf("empty topic graph = %s", b.String())
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Co-occurring topics listed per topic by messageTopicNeighbors
+const topicNeighborLimit = 5
+
+// Topic and the number of messages it shares with another topic
+type TopicNeighbor struct {
+	Name     string `json:"name"`
+	Messages int64  `json:"messages"`
+}
+
+// One of a message's topics with the topics it most often co-occurs with
+type MessageTopic struct {
+	Name      string          `json:"name"`
+	Neighbors []TopicNeighbor `json:"neighbors"`
+}
+
+// List a message's topics by name, each with the topics most often tagged on
+// the same messages (across all users, at most topicNeighborLimit, by shared
+// message count). Co-occurrence is counted from BELONGS_TO edges. A message
+// without topics returns an empty list; an unknown message is an error.
+func messageTopicNeighbors(ctx context.Context, messageID string) ([]MessageTopic, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {messageId: $messageId})
+			OPTIONAL MATCH (m)-[:BELONGS_TO]->(t:Topic)
+			OPTIONAL MATCH (t)<-[:BELONGS_TO]-(other:Message)-[:BELONGS_TO]->(n:Topic)
+			WHERE n <> t
+			WITH m, t, n, count(DISTINCT other) AS shared
+			ORDER BY shared DESC, n.name
+			WITH m, t, collect(CASE WHEN n IS NOT NULL THEN {name: n.name, messages: shared} END) AS neighbors
+			RETURN t.name, neighbors[..$limit]
+			ORDER BY t.name
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"messageId": messageID, "limit": topicNeighborLimit})
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		topics := []MessageTopic{}
+		for records.Next(ctx) {
+			found = true
+			values := records.Record().Values
+			name, ok := values[0].(string)
+			if !ok {
+				// The message has no topics
+				continue
+			}
+			topic := MessageTopic{Name: name, Neighbors: []TopicNeighbor{}}
+			if neighbors, ok := values[1].([]interface{}); ok {
+				for _, value := range neighbors {
+					entry, ok := value.(map[string]any)
+					if !ok {
+						continue
+					}
+					neighbor := TopicNeighbor{}
+					neighbor.Name, _ = entry["name"].(string)
+					neighbor.Messages, _ = entry["messages"].(int64)
+					topic.Neighbors = append(topic.Neighbors, neighbor)
+				}
+			}
+			topics = append(topics, topic)
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("message %s not found", messageID)
+		}
+		return topics, nil
+	}, txTimeout(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load topic neighbors: %w", neo4jError(ctx, err))
+	}
+	return result.([]MessageTopic), nil
+}
+
+// Print a message's topics with their co-occurring topics
+func printMessageTopicNeighbors(messageID string, topics []MessageTopic) {
+	if len(topics) == 0 {
+		fmt.Printf("🏷️ Message %s has no topics\n", messageID)
+		return
+	}
+
+	fmt.Printf("🏷️ Topics of message %s:\n", messageID)
+	for _, topic := range topics {
+		if len(topic.Neighbors) == 0 {
+			fmt.Printf("  %s (no co-occurring topics)\n", topic.Name)
+			continue
+		}
+		fmt.Printf("  %s, often with:", topic.Name)
+		for _, neighbor := range topic.Neighbors {
+			fmt.Printf(" %s (%d)", neighbor.Name, neighbor.Messages)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageTopicNeighbors(t *testing.T) {
+	// topics unique to the test, so other data cannot add co-occurrences
+	suffix := " " + generateID()
+	shoes, sale, hats, bags := "Giày"+suffix, "Giảm giá"+suffix, "Mũ"+suffix, "Túi"+suffix
+	session := requireNeo4j(t, func(c *Config) { c.TopicTags = []string{shoes, sale, hats, bags} })
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	now := time.Now().Unix()
+	message := storeTestMessage(t, session, userID, Message{Content: "giày giảm giá", Timestamp: now, Topics: []string{shoes, hats}})
+	storeTestMessage(t, session, userID, Message{Content: "giày sale", Timestamp: now + 1, Topics: []string{shoes, sale}})
+	storeTestMessage(t, session, userID, Message{Content: "giày sale nữa", Timestamp: now + 2, Topics: []string{shoes, sale}})
+	storeTestMessage(t, session, userID, Message{Content: "giày và túi", Timestamp: now + 3, Topics: []string{shoes, bags}})
+	untagged := storeTestMessage(t, session, userID, Message{Content: "cảm ơn", Timestamp: now + 4})
+
+	topics, err := messageTopicNeighbors(ctx, message.MessageID)
+	if err != nil {
+		t.Fatalf("messageTopicNeighbors: %v", err)
+	}
+	want := []MessageTopic{
+		{Name: shoes, Neighbors: []TopicNeighbor{{sale, 2}, {hats, 1}, {bags, 1}}},
+		{Name: hats, Neighbors: []TopicNeighbor{{shoes, 1}}},
+	}
+	// neighbors with equal counts are ordered by name
+	if bags < hats {
+		want[0].Neighbors[1], want[0].Neighbors[2] = want[0].Neighbors[2], want[0].Neighbors[1]
+	}
+	if !reflect.DeepEqual(topics, want) {
+		t.Errorf("topics = %+v, want %+v", topics, want)
+	}
+
+	if topics, err := messageTopicNeighbors(ctx, untagged.MessageID); err != nil || len(topics) != 0 {
+		t.Errorf("untagged message topics = %+v, %v; want none", topics, err)
+	}
+	if _, err := messageTopicNeighbors(ctx, "missing-"+message.MessageID); err == nil {
+		t.Error("messageTopicNeighbors succeeded for an unknown message")
+	}
+}
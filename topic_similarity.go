@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Topic ranked by the similarity of its name embedding to another topic's
+type ScoredTopic struct {
+	Name       string  `json:"name"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Load every topic with a stored embedding, by name
+func loadTopicEmbeddings(ctx context.Context, tx neo4j.ManagedTransaction) (map[string][]float64, error) {
+	records, err := tx.Run(ctx, `
+		MATCH (t:Topic)
+		WHERE t.embedding IS NOT NULL
+		RETURN t.name, t.embedding
+	`, nil)
+	if err != nil {
+		return nil, err
+	}
+	embeddings := make(map[string][]float64)
+	for records.Next(ctx) {
+		values := records.Record().Values
+		name, ok := values[0].(string)
+		if !ok {
+			continue
+		}
+		if embedding, ok := asFloat64Slice(values[1], "topic", name); ok {
+			embeddings[name] = embedding
+		}
+	}
+	return embeddings, records.Err()
+}
+
+// Link a topic to every other embedded topic whose name embedding has a
+// cosine similarity above cfg.TopicSimilarityThreshold with SIMILAR_TOPIC,
+// updating the similarity of existing edges. Returns the number created.
+func linkSimilarTopics(ctx context.Context, tx neo4j.ManagedTransaction, name string, embedding []float64) (int, error) {
+	embeddings, err := loadTopicEmbeddings(ctx, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load topic embeddings: %v", err)
+	}
+
+	created := 0
+	for _, other := range sortedKeys(embeddings) {
+		if other == name {
+			continue
+		}
+		similarity := cosineSimilarity(embedding, embeddings[other])
+		if similarity <= cfg.TopicSimilarityThreshold {
+			continue
+		}
+		query := `
+			MATCH (t1:Topic {name: $name1})
+			MATCH (t2:Topic {name: $name2})
+			MERGE (t1)-[r:SIMILAR_TOPIC]-(t2)
+			SET r.similarity = $similarity
+		`
+		result, err := tx.Run(ctx, query, map[string]any{"name1": name, "name2": other, "similarity": similarity})
+		if err != nil {
+			return created, fmt.Errorf("failed to link similar topics: %v", err)
+		}
+		summary, err := result.Consume(ctx)
+		if err != nil {
+			return created, fmt.Errorf("failed to link similar topics: %v", err)
+		}
+		created += summary.Counters().RelationshipsCreated()
+	}
+	return created, nil
+}
+
+// Embed the named topics that have no embedding yet (every such topic when
+// names is nil) and link each to its similar topics. Returns the number of
+// topics embedded.
+func embedNewTopics(ctx context.Context, session neo4j.SessionWithContext, embedder Embedder, names []string) (int, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, `
+			MATCH (t:Topic)
+			WHERE t.embedding IS NULL AND ($names IS NULL OR t.name IN $names)
+			RETURN t.name
+			ORDER BY t.name
+		`, map[string]any{"names": names})
+		if err != nil {
+			return nil, err
+		}
+		var missing []string
+		for records.Next(ctx) {
+			if name, ok := records.Record().Values[0].(string); ok {
+				missing = append(missing, name)
+			}
+		}
+		return missing, records.Err()
+	}, txTimeout(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load topics without embeddings: %w", neo4jError(ctx, err))
+	}
+	missing := result.([]string)
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	embeddings, err := embedTexts(ctx, embedder, missing)
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed topics: %v", err)
+	}
+
+	result, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		linked := 0
+		for i, name := range missing {
+			query := `
+				MATCH (t:Topic {name: $topicName})
+				WHERE t.embedding IS NULL
+				SET t.embedding = $embedding
+			`
+			if _, err := tx.Run(ctx, query, map[string]any{"topicName": name, "embedding": embeddings[i]}); err != nil {
+				return nil, err
+			}
+			created, err := linkSimilarTopics(ctx, tx, name, embeddings[i])
+			if err != nil {
+				return nil, err
+			}
+			linked += created
+		}
+		return linked, nil
+	}, txTimeout(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("failed to store topic embeddings: %w", neo4jError(ctx, err))
+	}
+
+	slog.Info("Embedded new topics", "topics", len(missing), "links", result.(int))
+	return len(missing), nil
+}
+
+// Rank the other embedded topics by the similarity of their name embedding
+// to the topic's, highest first, returning at most limit (all when <= 0)
+func similarTopics(ctx context.Context, name string, limit int) ([]ScoredTopic, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		return loadTopicEmbeddings(ctx, tx)
+	}, txTimeout(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load topic embeddings: %w", neo4jError(ctx, err))
+	}
+	embeddings := result.(map[string][]float64)
+	embedding, ok := embeddings[name]
+	if !ok {
+		return nil, fmt.Errorf("topic %q not found or not embedded", name)
+	}
+
+	var topics []ScoredTopic
+	for _, other := range sortedKeys(embeddings) {
+		if other != name {
+			topics = append(topics, ScoredTopic{Name: other, Similarity: cosineSimilarity(embedding, embeddings[other])})
+		}
+	}
+	sort.SliceStable(topics, func(i, j int) bool { return topics[i].Similarity > topics[j].Similarity })
+	if limit > 0 && len(topics) > limit {
+		topics = topics[:limit]
+	}
+	return topics, nil
+}
+
+// Print the topics most similar to a topic, marking those above
+// cfg.TopicSimilarityThreshold
+func printSimilarTopics(name string, topics []ScoredTopic) {
+	if len(topics) == 0 {
+		fmt.Printf("🧭 No other embedded topics to compare with %s\n", name)
+		return
+	}
+	fmt.Printf("🧭 Topics similar to %s:\n", name)
+	for _, topic := range topics {
+		marker := ""
+		if topic.Similarity > cfg.TopicSimilarityThreshold {
+			marker = " (above threshold)"
+		}
+		fmt.Printf("  %.3f  %s%s\n", topic.Similarity, topic.Name, marker)
+	}
+}
+
+// Embed a stored message's topics that are new, logging failures, when
+// cfg.EmbedNewTopics is set
+func embedMessageTopics(ctx context.Context, session neo4j.SessionWithContext, embedder Embedder, message Message) {
+	if !cfg.EmbedNewTopics || len(message.Topics) == 0 {
+		return
+	}
+	if _, err := embedNewTopics(ctx, session, embedder, message.Topics); err != nil {
+		slog.Error("Error embedding new topics", "messageId", message.MessageID, "err", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Result of validating a topic extraction response against cfg.TopicTags
+type TopicExtraction struct {
+	// Tags kept, in the order the model listed them
+	Accepted []string
+	// Number of tags the model returned
+	Raw int
+	// Tags the model returned that are not in cfg.TopicTags
+	Rejected []string
+}
+
+// Running totals of topic extractions since startup
+type topicTagCounter struct {
+	mu           sync.Mutex
+	extractions  int
+	raw          int
+	accepted     int
+	rejected     int
+	rejectedTags map[string]int
+}
+
+// Topic extraction totals for this process, shown by /topicstats
+var topicTagStats = &topicTagCounter{rejectedTags: make(map[string]int)}
+
+// Add one extraction to the totals
+func (c *topicTagCounter) record(extraction TopicExtraction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.extractions++
+	c.raw += extraction.Raw
+	c.accepted += len(extraction.Accepted)
+	c.rejected += len(extraction.Rejected)
+	for _, tag := range extraction.Rejected {
+		c.rejectedTags[tag]++
+	}
+}
+
+// Print the totals and the most frequently rejected tags, which are
+// candidates for adding to cfg.TopicTags or for tightening the prompt
+func (c *topicTagCounter) print() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Println("🏷️ Topic extraction:")
+	fmt.Printf("  extractions  %d\n", c.extractions)
+	fmt.Printf("  tags raw     %d\n", c.raw)
+	fmt.Printf("  accepted     %d\n", c.accepted)
+	fmt.Printf("  rejected     %d\n", c.rejected)
+	if c.raw > 0 {
+		fmt.Printf("  reject rate  %.1f%%\n", 100*float64(c.rejected)/float64(c.raw))
+	}
+
+	tags := sortedKeys(c.rejectedTags)
+	sort.SliceStable(tags, func(i, j int) bool { return c.rejectedTags[tags[i]] > c.rejectedTags[tags[j]] })
+	if len(tags) > 10 {
+		tags = tags[:10]
+	}
+	for _, tag := range tags {
+		fmt.Printf("  rejected %-12s %d\n", tag, c.rejectedTags[tag])
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateTopicTagsRejected(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.TopicCaseFold = true
+		c.MaxTopicsPerMessage = 0
+	})
+	tests := []struct {
+		text string
+		want TopicExtraction
+	}{
+		{"Áo, Giày", TopicExtraction{Accepted: []string{"Áo", "Giày"}, Raw: 2}},
+		{"áo, Đồng hồ,  Kính  mát ", TopicExtraction{Accepted: []string{"Áo"}, Raw: 3, Rejected: []string{"Đồng hồ", "Kính mát"}}},
+		{"Đồng hồ", TopicExtraction{Raw: 1, Rejected: []string{"Đồng hồ"}}},
+		{"Không có tag", TopicExtraction{Accepted: []string{}}},
+	}
+	for _, tt := range tests {
+		got := validateTopicTags(tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateTopicTags(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTopicTagCounterRecord(t *testing.T) {
+	counter := &topicTagCounter{rejectedTags: make(map[string]int)}
+	counter.record(TopicExtraction{Accepted: []string{"Áo"}, Raw: 3, Rejected: []string{"Đồng hồ", "Kính"}})
+	counter.record(TopicExtraction{Raw: 1, Rejected: []string{"Đồng hồ"}})
+	counter.record(TopicExtraction{Accepted: []string{}})
+
+	if counter.extractions != 3 || counter.raw != 4 || counter.accepted != 1 || counter.rejected != 3 {
+		t.Errorf("totals = %d extractions, %d raw, %d accepted, %d rejected; want 3, 4, 1, 3",
+			counter.extractions, counter.raw, counter.accepted, counter.rejected)
+	}
+	want := map[string]int{"Đồng hồ": 2, "Kính": 1}
+	if !reflect.DeepEqual(counter.rejectedTags, want) {
+		t.Errorf("rejectedTags = %v, want %v", counter.rejectedTags, want)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// System prompt for summarizing a topic's messages
+const topicSummaryPrompt = `Bạn là trợ lý phân tích hội thoại của một cửa hàng thương mại điện tử.
+Tóm tắt ngắn gọn (tối đa 5 gạch đầu dòng) những gì khách hàng đã nói về chủ đề được nêu:
+câu hỏi thường gặp, mong muốn, phàn nàn và câu trả lời của shop. Không bịa thêm thông tin.`
+
+// Chat completion API the topic summarizer calls, satisfied by *openai.Client
+type chatCompleter interface {
+	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// Pick at most n messages spread evenly over messages (kept in order)
+func sampleMessages(messages []Message, n int) []Message {
+	if n <= 0 || len(messages) <= n {
+		return messages
+	}
+	sampled := make([]Message, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, messages[i*len(messages)/n])
+	}
+	return sampled
+}
+
+// Lines sent to the summarizer, oldest first, stopping once maxChars would
+// be exceeded (0 = no budget)
+func topicSummaryInput(messages []Message, maxChars int) string {
+	var b strings.Builder
+	for _, message := range messages {
+		line := fmt.Sprintf("- [%s] %s: %s\n", time.Unix(message.Timestamp, 0).Format("2006-01-02"), message.Sender, message.Content)
+		if maxChars > 0 && b.Len()+len(line) > maxChars {
+			break
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// Summarize what a user's messages say about a topic. Messages are sampled
+// down to cfg.TopicSummaryMaxMessages and cut to cfg.TopicSummaryMaxChars.
+// With cfg.CacheTopicSummaries the summary is kept on a TOPIC_SUMMARY edge
+// from the user to the topic, together with the timestamp of the newest
+// message it covers, and reused until a newer message joins the topic.
+func summarizeTopic(ctx context.Context, client chatCompleter, userID string, topic string) (string, error) {
+	topic = canonicalTopicName(topic)
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})-[:BELONGS_TO]->(t:Topic {name: $topic})
+			RETURN m
+			ORDER BY m.timestamp, m.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "topic": topic})
+		if err != nil {
+			return nil, err
+		}
+		var messages []Message
+		for records.Next(ctx) {
+			if node, ok := records.Record().Values[0].(neo4j.Node); ok {
+				messages = append(messages, messageFromNode(node))
+			}
+		}
+		return messages, records.Err()
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to load topic messages: %v", err)
+	}
+	messages := result.([]Message)
+	if len(messages) == 0 {
+		return "", fmt.Errorf("no messages about %q for this user", topic)
+	}
+	latest := messages[len(messages)-1].Timestamp
+
+	if cfg.CacheTopicSummaries {
+		cached, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			query := `
+				MATCH (:User {userId: $userId})-[s:TOPIC_SUMMARY]->(:Topic {name: $topic})
+				WHERE s.latestMessageAt >= $latest
+				RETURN s.summary
+			`
+			records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "topic": topic, "latest": latest})
+			if err != nil {
+				return nil, err
+			}
+			if !records.Next(ctx) {
+				return "", records.Err()
+			}
+			summary, _ := records.Record().Values[0].(string)
+			return summary, nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to load cached summary: %v", err)
+		}
+		if summary := cached.(string); summary != "" {
+			return summary, nil
+		}
+	}
+
+	summary, sampled, err := summarizeMessages(ctx, client, topic, messages)
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.CacheTopicSummaries {
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			query := `
+				MATCH (u:User {userId: $userId})
+				MATCH (t:Topic {name: $topic})
+				MERGE (u)-[s:TOPIC_SUMMARY]->(t)
+				SET s.summary = $summary,
+					s.latestMessageAt = $latest,
+					s.messageCount = $count,
+					s.summarizedAt = $now
+			`
+			params := map[string]any{
+				"userId":  userID,
+				"topic":   topic,
+				"summary": summary,
+				"latest":  latest,
+				"count":   len(messages),
+				"now":     time.Now().Unix(),
+			}
+			_, err := tx.Run(ctx, query, params)
+			return nil, err
+		})
+		if err != nil {
+			return summary, fmt.Errorf("failed to cache summary: %v", err)
+		}
+	}
+	slog.Info("Summarized topic", "userId", userID, "topic", topic, "sampled", sampled, "messages", len(messages))
+	return summary, nil
+}
+
+// Ask the chat model to summarize messages about topic, after sampling them
+// down to cfg.TopicSummaryMaxMessages and cutting them to
+// cfg.TopicSummaryMaxChars. Returns the summary and how many messages were
+// sampled.
+func summarizeMessages(ctx context.Context, client chatCompleter, topic string, messages []Message) (string, int, error) {
+	sampled := sampleMessages(messages, cfg.TopicSummaryMaxMessages)
+	request := openai.ChatCompletionRequest{
+		Model: cfg.ChatModel,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: topicSummaryPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("Chủ đề: %s\n\n%s", topic, topicSummaryInput(sampled, cfg.TopicSummaryMaxChars))},
+		},
+		MaxTokens:   300,
+		Temperature: 0.2,
+	}
+	resp, err := withOpenAIRetry(ctx, func(ctx context.Context) (openai.ChatCompletionResponse, error) {
+		return client.CreateChatCompletion(ctx, request)
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to summarize topic: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", 0, fmt.Errorf("no response from topic summary")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), len(sampled), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// chatCompleter recording its requests and answering with reply
+type fakeChatCompleter struct {
+	reply    string
+	requests []openai.ChatCompletionRequest
+}
+
+func (c *fakeChatCompleter) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	c.requests = append(c.requests, request)
+	if c.reply == "" {
+		return openai.ChatCompletionResponse{}, nil
+	}
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: c.reply}}},
+	}, nil
+}
+
+// Messages "message 0" ... "message n-1", an hour apart
+func numberedMessages(n int) []Message {
+	messages := make([]Message, n)
+	for i := range messages {
+		messages[i] = Message{MessageID: fmt.Sprint(i), Timestamp: int64(i * 3600), Sender: "human", Content: fmt.Sprintf("message %d", i)}
+	}
+	return messages
+}
+
+func TestSampleMessages(t *testing.T) {
+	messages := numberedMessages(10)
+	sampled := sampleMessages(messages, 4)
+	var contents []string
+	for _, message := range sampled {
+		contents = append(contents, message.Content)
+	}
+	if got, want := strings.Join(contents, ","), "message 0,message 2,message 5,message 7"; got != want {
+		t.Errorf("sampleMessages(10, 4) = %s, want %s", got, want)
+	}
+	if got := sampleMessages(messages, 0); len(got) != 10 {
+		t.Errorf("sampleMessages(10, 0) kept %d messages, want all 10", len(got))
+	}
+	if got := sampleMessages(messages, 20); len(got) != 10 {
+		t.Errorf("sampleMessages(10, 20) kept %d messages, want all 10", len(got))
+	}
+}
+
+func TestSummarizeMessagesSamplesAndBudgets(t *testing.T) {
+	// Each input line is 33 bytes: "- [1970-01-01] human: message 0\n"
+	tests := []struct {
+		name        string
+		edit        func(*Config)
+		wantLines   int
+		wantSampled int
+	}{
+		{"defaults", nil, 10, 10},
+		{"sampled", func(c *Config) { c.TopicSummaryMaxMessages = 4 }, 4, 4},
+		{"char budget", func(c *Config) { c.TopicSummaryMaxMessages, c.TopicSummaryMaxChars = 4, 70 }, 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t, tt.edit)
+			client := &fakeChatCompleter{reply: "  - customers ask about refunds\n"}
+			summary, sampled, err := summarizeMessages(context.Background(), client, "refund", numberedMessages(10))
+			if err != nil {
+				t.Fatalf("summarizeMessages() error = %v", err)
+			}
+			if summary != "- customers ask about refunds" {
+				t.Errorf("summary = %q, want the trimmed reply", summary)
+			}
+			if sampled != tt.wantSampled {
+				t.Errorf("sampled = %d, want %d", sampled, tt.wantSampled)
+			}
+			if len(client.requests) != 1 {
+				t.Fatalf("made %d requests, want 1", len(client.requests))
+			}
+			prompt := client.requests[0].Messages[1].Content
+			if lines := strings.Count(prompt, "\n- ["); lines != tt.wantLines {
+				t.Errorf("prompt has %d message lines, want %d:\n%s", lines, tt.wantLines, prompt)
+			}
+		})
+	}
+}
+
+func TestSummarizeMessagesNoChoices(t *testing.T) {
+	setTestConfig(t, nil)
+	if _, _, err := summarizeMessages(context.Background(), &fakeChatCompleter{}, "refund", numberedMessages(3)); err == nil {
+		t.Error("summarizeMessages() with an empty response succeeded, want an error")
+	}
+}
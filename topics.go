@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Load a topic with its embedding and the user's most recent messages
+// linked to it (newest first, at most cfg.TopicMessageLimit)
+func getTopicWithMessages(ctx context.Context, userID string, topicName string) (Topic, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (t:Topic {name: $topicName})
+			OPTIONAL MATCH (m:Message {userId: $userId})-[:BELONGS_TO]->(t)
+			WITH t, m
+			ORDER BY m.timestamp DESC
+			WITH t, collect(m) AS messages
+			RETURN t, messages[..$limit]
+		`
+		params := map[string]any{
+			"topicName": topicName,
+			"userId":    userID,
+			"limit":     cfg.TopicMessageLimit,
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+		if !records.Next(ctx) {
+			if err := records.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("topic %q not found", topicName)
+		}
+
+		return topicFromRecord(topicName, records.Record().Values)
+	})
+	if err != nil {
+		return Topic{}, fmt.Errorf("failed to load topic: %v", err)
+	}
+
+	return result.(Topic), nil
+}
+
+// Build a Topic from a (topic node, message nodes) record of
+// getTopicWithMessages. Values that are not nodes are skipped.
+func topicFromRecord(topicName string, values []any) (Topic, error) {
+	node, ok := values[0].(neo4j.Node)
+	if !ok {
+		return Topic{}, fmt.Errorf("unexpected topic value %T", values[0])
+	}
+	topic := Topic{
+		Name:      topicName,
+		Embedding: decodeStoredEmbedding(node.Props["embedding"], nil),
+		Messages:  []Message{},
+	}
+	topic.TopicID, _ = node.Props["topicId"].(string)
+
+	if list, ok := values[1].([]interface{}); ok {
+		for _, v := range list {
+			if messageNode, ok := v.(neo4j.Node); ok {
+				topic.Messages = append(topic.Messages, messageFromNode(messageNode))
+			}
+		}
+	}
+	return topic, nil
+}
+
+// Re-extract topics for messages tagged under an older topic prompt and
+// rebuild their BELONGS_TO edges. With fromVersion empty every message not
+// tagged under the current topicPromptVersion() is processed, except manual
+// corrections from setMessageTopics; otherwise only messages tagged under
+// fromVersion. Per-message failures are reported in
+// the BatchResult rather than aborting the backfill.
+func backfillTopics(ctx context.Context, client *openai.Client, fromVersion string) (BatchResult, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	currentVersion := topicPromptVersion()
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message)
+			WHERE ($fromVersion = "" AND NOT coalesce(m.topicPromptVersion, "") IN [$currentVersion, $manualVersion])
+				OR ($fromVersion <> "" AND m.topicPromptVersion = $fromVersion)
+			RETURN m.messageId, m.content
+			ORDER BY m.timestamp
+		`
+		params := map[string]any{
+			"fromVersion":    fromVersion,
+			"currentVersion": currentVersion,
+			"manualVersion":  manualTopicVersion,
+		}
+		records, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages []Message
+		for records.Next(ctx) {
+			record := records.Record()
+			message := Message{}
+			message.MessageID, _ = record.Values[0].(string)
+			message.Content, _ = record.Values[1].(string)
+			messages = append(messages, message)
+		}
+		return messages, records.Err()
+	})
+	if err != nil {
+		return BatchResult{}, fmt.Errorf("failed to query messages for topic backfill: %v", err)
+	}
+
+	messages := result.([]Message)
+	var batch BatchResult
+	for _, message := range messages {
+		if err := ctx.Err(); err != nil {
+			return batch, err
+		}
+
+		extraction, err := extractTopicTags(ctx, client, message.Content)
+		if err != nil {
+			batch.fail(message.MessageID, err)
+			continue
+		}
+
+		_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			query := `
+				MATCH (m:Message {messageId: $messageId})
+				SET m.topics = $topics,
+					m.topicPromptVersion = $version,
+					m.topicTagsRaw = $topicTagsRaw,
+					m.topicTagsRejected = $topicTagsRejected
+				WITH m
+				OPTIONAL MATCH (m)-[r:BELONGS_TO]->(:Topic)
+				DELETE r
+			`
+			params := map[string]any{
+				"messageId":         message.MessageID,
+				"topics":            extraction.Accepted,
+				"version":           currentVersion,
+				"topicTagsRaw":      extraction.Raw,
+				"topicTagsRejected": len(extraction.Rejected),
+			}
+			if _, err := tx.Run(ctx, query, params); err != nil {
+				return nil, err
+			}
+			linkMessageTopics(ctx, tx, message.MessageID, extraction.Accepted, currentVersion)
+			return nil, nil
+		})
+		if err != nil {
+			batch.fail(message.MessageID, fmt.Errorf("failed to update topics: %v", err))
+			continue
+		}
+		batch.succeed(message.MessageID)
+	}
+
+	logBatchFailures("Topic backfill", batch)
+	fmt.Printf("🏷️ Backfilled topics for %d/%d messages (prompt version %s, %d failed)\n", batch.Succeeded, len(messages), currentVersion, batch.Failed)
+	return batch, nil
+}
+
+// Delete topics no message belongs to anymore. Returns the number deleted.
+func pruneOrphanTopics(ctx context.Context, tx neo4j.ManagedTransaction) (int, error) {
+	result, err := tx.Run(ctx, `
+		MATCH (t:Topic)
+		WHERE NOT (t)<-[:BELONGS_TO]-(:Message)
+		DETACH DELETE t
+	`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune orphan topics: %v", err)
+	}
+	summary, err := result.Consume(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune orphan topics: %v", err)
+	}
+	return summary.Counters().NodesDeleted(), nil
+}
+
+// topicPromptVersion recorded on messages and BELONGS_TO edges set by
+// setMessageTopics
+const manualTopicVersion = "manual"
+
+// Map tags to their cfg.TopicTags spelling, rejecting tags outside the taxonomy
+func canonicalTopics(topics []string) ([]string, error) {
+	canonical := []string{}
+	for _, topic := range topics {
+		topic = normalizeTopicName(topic)
+		if topic == "" {
+			continue
+		}
+		match := taxonomyTag(topic)
+		if match == "" {
+			return nil, fmt.Errorf("unknown topic %q (want %s)", topic, strings.Join(cfg.TopicTags, ", "))
+		}
+		if !containsString(canonical, match) {
+			canonical = append(canonical, match)
+		}
+	}
+	return canonical, nil
+}
+
+// Replace a message's topics with a manual correction: the topics property
+// is overwritten, BELONGS_TO edges to dropped topics are removed, edges to
+// the new ones are merged, and topics left without messages are pruned.
+// Every topic must be in cfg.TopicTags; an empty list clears the message's topics.
+func setMessageTopics(ctx context.Context, messageID string, topics []string) error {
+	topics, err := canonicalTopics(topics)
+	if err != nil {
+		return err
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	owner, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(ctx, "MATCH (m:Message {messageId: $messageId}) RETURN m.userId", map[string]any{"messageId": messageID})
+		if err != nil {
+			return nil, err
+		}
+		record, err := result.Single(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("message %s not found", messageID)
+		}
+		userID, _ := record.Values[0].(string)
+		return userID, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load message: %v", err)
+	}
+
+	unlock := userIngestLocks.Lock(owner.(string))
+	defer unlock()
+
+	pruned, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {messageId: $messageId})
+			SET m.topics = $topics, m.topicPromptVersion = $version
+			WITH m
+			OPTIONAL MATCH (m)-[r:BELONGS_TO]->(t:Topic)
+			WHERE NOT t.name IN $topics
+			DELETE r
+		`
+		params := map[string]any{
+			"messageId": messageID,
+			"topics":    topics,
+			"version":   manualTopicVersion,
+		}
+		if _, err := tx.Run(ctx, query, params); err != nil {
+			return nil, err
+		}
+		linkMessageTopics(ctx, tx, messageID, topics, manualTopicVersion)
+		return pruneOrphanTopics(ctx, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set message topics: %v", err)
+	}
+
+	fmt.Printf("🏷️ Retagged message %s: %v, pruned %d orphaned topics\n", messageID, topics, pruned.(int))
+	return nil
+}
+
+// ID of the user's most recent human message, or errNoMessages
+func latestHumanMessageID(ctx context.Context, userID string) (string, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId, sender: "human"})
+			RETURN m.messageId
+			ORDER BY m.timestamp DESC, m.messageId DESC
+			LIMIT 1
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		if !records.Next(ctx) {
+			return "", records.Err()
+		}
+		id, _ := records.Record().Values[0].(string)
+		return id, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to load latest message: %v", err)
+	}
+	if result.(string) == "" {
+		return "", errNoMessages
+	}
+	return result.(string), nil
+}
+
+// Embed every configured tag that has no topic embedding yet, creating the
+// Topic node if needed, and link it to similar topics. Returns the number of
+// topics embedded.
+func warmTopicEmbeddings(ctx context.Context, client *openai.Client) (int, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, `
+			MATCH (t:Topic)
+			WHERE t.name IN $names AND t.embedding IS NOT NULL
+			RETURN t.name
+		`, map[string]any{"names": cfg.TopicTags})
+		if err != nil {
+			return nil, err
+		}
+		embedded := make(map[string]bool)
+		for records.Next(ctx) {
+			name, _ := records.Record().Values[0].(string)
+			embedded[name] = true
+		}
+		return embedded, records.Err()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to load topic embeddings: %v", err)
+	}
+	embedded := result.(map[string]bool)
+
+	var missing []string
+	for _, tag := range cfg.TopicTags {
+		if !embedded[tag] {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	embeddings, err := getEmbeddings(ctx, client, missing)
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed topics: %v", err)
+	}
+
+	_, err = session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		for i, name := range missing {
+			query := `
+				MERGE (t:Topic {name: $topicName})
+				ON CREATE SET t.topicId = $topicId, t.createdAt = $timestamp
+				SET t.embedding = $embedding
+			`
+			params := map[string]any{
+				"topicName": name,
+				"topicId":   generateID(),
+				"timestamp": time.Now().Unix(),
+				"embedding": embeddings[i],
+			}
+			if _, err := tx.Run(ctx, query, params); err != nil {
+				return nil, err
+			}
+			if _, err := linkSimilarTopics(ctx, tx, name, embeddings[i]); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store topic embeddings: %v", err)
+	}
+
+	fmt.Printf("🔥 Warmed %d topic embeddings\n", len(missing))
+	return len(missing), nil
+}
+
+// Run warmTopicEmbeddings once in the background when
+// cfg.WarmTopicEmbeddings is set, so ingestion never waits on it
+func startTopicEmbeddingWarmer(ctx context.Context, client *openai.Client) {
+	if !cfg.WarmTopicEmbeddings {
+		return
+	}
+
+	go func() {
+		if _, err := warmTopicEmbeddings(ctx, client); err != nil && ctx.Err() == nil {
+			slog.Error("Topic embedding warmer failed", "err", err)
+		}
+	}()
+}
+
+// Load the user's messages tagged with a topic, oldest first. The name is
+// looked up under its canonicalTopicName, so any spelling of a tag finds it.
+// An unknown topic gives no messages rather than an error.
+func messagesByTopic(ctx context.Context, session neo4j.SessionWithContext, userID string, topic string) ([]Message, error) {
+	topic = canonicalTopicName(topic)
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (m:Message {userId: $userId})-[:BELONGS_TO]->(t:Topic {name: $topic})
+			RETURN m
+			ORDER BY m.timestamp, m.messageId
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID, "topic": topic})
+		if err != nil {
+			return nil, err
+		}
+		var messages []Message
+		for records.Next(ctx) {
+			if node, ok := records.Record().Values[0].(neo4j.Node); ok {
+				messages = append(messages, messageFromNode(node))
+			}
+		}
+		return messages, records.Err()
+	}, txTimeout(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load topic messages: %w", neo4jError(ctx, err))
+	}
+	return result.([]Message), nil
+}
+
+// Print the messages of a topic with their timestamps
+func printTopicMessages(topic string, messages []Message) {
+	if len(messages) == 0 {
+		fmt.Printf("No messages about %q yet\n", topic)
+		return
+	}
+	fmt.Printf("🏷️ %d messages about %s:\n", len(messages), topic)
+	for _, message := range messages {
+		fmt.Printf("  [%s] %s: %s\n", time.Unix(message.Timestamp, 0).Format("2006-01-02 15:04"), message.Sender, message.Content)
+	}
+}
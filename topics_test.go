@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestCanonicalTopics(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.TopicTags = []string{"Shipping", "Giày"}
+		c.TopicCaseFold = true
+	})
+
+	got, err := canonicalTopics([]string{" shipping ", "SHIPPING", "giày", ""})
+	if err != nil {
+		t.Fatalf("canonicalTopics: %v", err)
+	}
+	if want := []string{"Shipping", "Giày"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("canonicalTopics = %q, want %q", got, want)
+	}
+
+	if _, err := canonicalTopics([]string{"Shipping", "Returns"}); err == nil {
+		t.Error("canonicalTopics accepted a tag outside the taxonomy")
+	}
+}
+
+func TestCanonicalTopicNameLookup(t *testing.T) {
+	// /topic and /summary look topics up under this name, so a user's
+	// spelling must land on the one stored by MERGE
+	tests := []struct {
+		caseFold bool
+		name     string
+		want     string
+	}{
+		{true, "shipping", "Shipping"},
+		{true, "  SHIPPING\t", "Shipping"},
+		{false, "shipping", "shipping"},
+		{false, " Shipping ", "Shipping"},
+		{true, "custom  topic", "custom topic"},
+	}
+	for _, tt := range tests {
+		setTestConfig(t, func(c *Config) {
+			c.TopicTags = []string{"Shipping"}
+			c.TopicCaseFold = tt.caseFold
+		})
+		if got := canonicalTopicName(tt.name); got != tt.want {
+			t.Errorf("canonicalTopicName(%q) with caseFold %v = %q, want %q", tt.name, tt.caseFold, got, tt.want)
+		}
+	}
+}
+
+func TestTopicFromRecord(t *testing.T) {
+	topicNode := neo4j.Node{Props: map[string]any{"topicId": "t1", "embedding": []any{0.5, 0.25}}}
+	messages := []any{
+		neo4j.Node{Props: map[string]any{"messageId": "m2", "content": "newer"}},
+		nil,
+		neo4j.Node{Props: map[string]any{"messageId": "m1", "content": "older"}},
+	}
+
+	topic, err := topicFromRecord("Giày", []any{topicNode, messages})
+	if err != nil {
+		t.Fatalf("topicFromRecord: %v", err)
+	}
+	if topic.TopicID != "t1" || topic.Name != "Giày" || !reflect.DeepEqual(topic.Embedding, []float64{0.5, 0.25}) {
+		t.Errorf("topic = %+v", topic)
+	}
+	if len(topic.Messages) != 2 || topic.Messages[0].MessageID != "m2" || topic.Messages[1].MessageID != "m1" {
+		t.Errorf("messages = %+v, want m2 then m1", topic.Messages)
+	}
+
+	empty, err := topicFromRecord("Áo", []any{neo4j.Node{Props: map[string]any{}}, []any{}})
+	if err != nil || empty.Messages == nil || len(empty.Messages) != 0 {
+		t.Errorf("topic without messages = %+v, %v; want an empty, non-nil list", empty, err)
+	}
+
+	if _, err := topicFromRecord("Áo", []any{"not a node", nil}); err == nil {
+		t.Error("topicFromRecord accepted a non-node topic")
+	}
+}
+
+func TestWarmTopicEmbeddings(t *testing.T) {
+	tags := []string{"warm " + generateID(), "warm " + generateID()}
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = tags
+		c.EmbeddingDimensions = 4
+		c.OpenAIMaxRetries = 0
+	})
+	ctx := context.Background()
+	t.Cleanup(func() {
+		session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx, "MATCH (t:Topic) WHERE t.name IN $names DETACH DELETE t", map[string]any{"names": tags})
+		})
+	})
+	client, fake := newFakeOpenAI(t)
+
+	warmed, err := warmTopicEmbeddings(ctx, client)
+	if err != nil {
+		t.Fatalf("warmTopicEmbeddings: %v", err)
+	}
+	if warmed != 2 || len(fake.requests) != 1 {
+		t.Errorf("warmed %d topics in %d requests, want 2 in 1", warmed, len(fake.requests))
+	}
+	topic, err := getTopicWithMessages(ctx, "no-such-user", tags[0])
+	if err != nil {
+		t.Fatalf("getTopicWithMessages: %v", err)
+	}
+	if len(topic.Embedding) != 4 {
+		t.Errorf("stored embedding = %v, want 4 dimensions", topic.Embedding)
+	}
+
+	// embedded topics are skipped on the next run
+	if warmed, err := warmTopicEmbeddings(ctx, client); err != nil || warmed != 0 || len(fake.requests) != 1 {
+		t.Errorf("second run warmed %d topics (%v) in %d requests, want none", warmed, err, len(fake.requests)-1)
+	}
+}
+
+func TestSetMessageTopics(t *testing.T) {
+	session := requireNeo4j(t, func(c *Config) {
+		c.TopicTags = defaultTopicTags
+		c.TopicCaseFold = true
+	})
+	ctx := context.Background()
+	userID := createTestUser(t, session)
+
+	if _, err := latestHumanMessageID(ctx, userID); !errors.Is(err, errNoMessages) {
+		t.Errorf("latestHumanMessageID without messages: err = %v, want errNoMessages", err)
+	}
+	now := time.Now().Unix()
+	earlier := storeTestMessage(t, session, userID, Message{Content: "áo thun", Timestamp: now - 1, Topics: []string{"Áo"}})
+	message := storeTestMessage(t, session, userID, Message{Content: "giày size 42", Timestamp: now, Topics: []string{"Áo", "Mũ"}})
+	storeTestMessage(t, session, userID, Message{Sender: "ai", Content: "dạ còn ạ", Timestamp: now + 1})
+	if id, err := latestHumanMessageID(ctx, userID); err != nil || id != message.MessageID {
+		t.Fatalf("latestHumanMessageID = %q, %v; want %s", id, err, message.MessageID)
+	}
+
+	if err := setMessageTopics(ctx, message.MessageID, []string{"giày", "Giảm giá"}); err != nil {
+		t.Fatalf("setMessageTopics: %v", err)
+	}
+	if got := testTopicEdges(t, session, message.MessageID); !reflect.DeepEqual(got, []string{"Giày", "Giảm giá"}) {
+		t.Errorf("retagged message belongs to %v, want [Giày Giảm giá]", got)
+	}
+	if got := testTopicEdges(t, session, earlier.MessageID); !reflect.DeepEqual(got, []string{"Áo"}) {
+		t.Errorf("other message belongs to %v, want [Áo]", got)
+	}
+	messages, err := loadUserMessages(ctx, session, userID)
+	if err != nil {
+		t.Fatalf("loadUserMessages: %v", err)
+	}
+	if got := messages[1]; !reflect.DeepEqual(got.Topics, []string{"Giày", "Giảm giá"}) || got.TopicPromptVersion != manualTopicVersion {
+		t.Errorf("stored topics = %v under version %q, want the correction under %q", got.Topics, got.TopicPromptVersion, manualTopicVersion)
+	}
+
+	if err := setMessageTopics(ctx, message.MessageID, []string{"Đồng hồ"}); err == nil {
+		t.Error("setMessageTopics accepted a tag outside the taxonomy")
+	}
+	if err := setMessageTopics(ctx, "missing-"+message.MessageID, []string{"Áo"}); err == nil {
+		t.Error("setMessageTopics succeeded for an unknown message")
+	}
+
+	if err := setMessageTopics(ctx, message.MessageID, nil); err != nil {
+		t.Fatalf("setMessageTopics to clear topics: %v", err)
+	}
+	if got := testTopicEdges(t, session, message.MessageID); len(got) != 0 {
+		t.Errorf("cleared message still belongs to %v", got)
+	}
+}
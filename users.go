@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Returned by loadUser for an unknown user ID
+var errUserNotFound = errors.New("user not found")
+
+// Build a User from the properties of a Neo4j :User node
+func userFromNode(node neo4j.Node) User {
+	props := node.Props
+	user := User{}
+	user.UserID, _ = props["userId"].(string)
+	user.Name, _ = props["name"].(string)
+	user.CreatedAt, _ = props["createdAt"].(int64)
+	user.LastActive, _ = props["lastActive"].(int64)
+	user.Preferences.Language, _ = props["language"].(string)
+	user.Preferences.Tone, _ = props["tone"].(string)
+	user.Preferences.AddressingStyle, _ = props["addressingStyle"].(string)
+	user.Preferences.Retrieval = retrievalPreferencesFromProps(props)
+	return user
+}
+
+// Parse a duration that also accepts a day suffix, e.g. "30d" or "12h"
+func parseDayDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Find users whose lastActive is older than the cutoff, most stale first
+func inactiveUsers(ctx context.Context, since time.Duration) ([]User, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User)
+			WHERE u.lastActive < $cutoff
+			RETURN u
+			ORDER BY u.lastActive ASC
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"cutoff": time.Now().Add(-since).Unix()})
+		if err != nil {
+			return nil, err
+		}
+
+		var users []User
+		for records.Next(ctx) {
+			if node, ok := records.Record().Values[0].(neo4j.Node); ok {
+				users = append(users, userFromNode(node))
+			}
+		}
+		return users, records.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inactive users: %v", err)
+	}
+
+	return result.([]User), nil
+}
+
+// Print users inactive for longer than the given duration
+func printInactiveUsers(ctx context.Context, since time.Duration) error {
+	users, err := inactiveUsers(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		fmt.Printf("✅ No users inactive for more than %s\n", since)
+		return nil
+	}
+
+	fmt.Printf("💤 %d users inactive for more than %s:\n", len(users), since)
+	for _, user := range users {
+		lastActive := time.Unix(user.LastActive, 0)
+		fmt.Printf("  %s  %-20s last active %s (%s ago)\n", user.UserID, user.Name, lastActive.Format(time.RFC3339), time.Since(lastActive).Round(time.Hour))
+	}
+	return nil
+}
+
+// Set a user's lastActive to their latest human message timestamp. Users
+// without human messages fall back to their createdAt. Returns the new value.
+func recomputeLastActive(ctx context.Context, userID string) (int64, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		query := `
+			MATCH (u:User {userId: $userId})
+			OPTIONAL MATCH (u)-[:OWNS]->(m:Message {sender: "human"})
+			WITH u, max(m.timestamp) AS latest
+			SET u.lastActive = coalesce(latest, u.createdAt)
+			RETURN u.lastActive
+		`
+		records, err := tx.Run(ctx, query, map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("user %s not found", userID)
+		}
+		lastActive, _ := record.Values[0].(int64)
+		return lastActive, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to recompute last active: %v", err)
+	}
+
+	lastActive := result.(int64)
+	fmt.Printf("🕒 Recomputed lastActive for user %s: %s\n", userID, time.Unix(lastActive, 0).Format(time.RFC3339))
+	return lastActive, nil
+}
+
+// Recompute lastActive for every user
+func recomputeAllLastActive(ctx context.Context) error {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, "MATCH (u:User) RETURN u.userId", nil)
+		if err != nil {
+			return nil, err
+		}
+		var userIDs []string
+		for records.Next(ctx) {
+			if id, ok := records.Record().Values[0].(string); ok {
+				userIDs = append(userIDs, id)
+			}
+		}
+		return userIDs, records.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list users: %v", err)
+	}
+
+	for _, userID := range result.([]string) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := recomputeLastActive(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load a user by ID
+func getUser(ctx context.Context, userID string) (User, error) {
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	return loadUser(ctx, session, userID)
+}
+
+// Load a user by ID on the caller's session
+func loadUser(ctx context.Context, session neo4j.SessionWithContext, userID string) (User, error) {
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, "MATCH (u:User {userId: $userId}) RETURN u", map[string]any{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		if !records.Next(ctx) {
+			if err := records.Err(); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %s", errUserNotFound, userID)
+		}
+		node, ok := records.Record().Values[0].(neo4j.Node)
+		if !ok {
+			return nil, fmt.Errorf("unexpected user value %T", records.Record().Values[0])
+		}
+		return userFromNode(node), nil
+	})
+	if err != nil {
+		return User{}, fmt.Errorf("failed to load user: %w", neo4jError(ctx, err))
+	}
+	return result.(User), nil
+}
+
+// Pick the chat user from the --user / --new-user / --user-name options: an
+// existing user by ID, a newly created one by name, or the user with a name
+// (created if missing). Exactly one must be given.
+func resolveChatUser(ctx context.Context, session neo4j.SessionWithContext, existingUserID string, newUserName string, userName string) (string, error) {
+	given := 0
+	for _, option := range []string{existingUserID, newUserName, userName} {
+		if option != "" {
+			given++
+		}
+	}
+	switch {
+	case given > 1:
+		return "", fmt.Errorf("use only one of --user, --new-user and --user-name")
+	case existingUserID != "":
+		user, err := getUser(ctx, existingUserID)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("👤 Continuing as user: %s (ID: %s)\n", user.Name, user.UserID)
+		return user.UserID, nil
+	case newUserName != "":
+		slog.Debug("Creating new user", "name", newUserName)
+		userID, err := createUser(ctx, session, newUserName)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("✅ User created successfully with ID: %s\n", userID)
+		return userID, nil
+	case userName != "":
+		return findOrCreateUser(ctx, session, userName)
+	default:
+		return "", fmt.Errorf("chat mode requires --user <userId>, --new-user <name> or --user-name <name>")
+	}
+}
+
+// Preferences given to new users
+var defaultUserPreferences = UserPreferences{
+	Language:        "en",
+	Tone:            "friendly",
+	AddressingStyle: "you",
+}
+
+// Return the ID of the user with this name, creating the user if none
+// exists. Names are not unique (--new-user may reuse one), so a MERGE on
+// the name alone would not stop two concurrent runs from both creating a
+// user. Instead each transaction first MERGEs and writes the name's
+// UserNameLock node, whose uniqueness constraint makes concurrent runs wait
+// for each other, then looks the user up and creates it only if missing.
+// With several matches the oldest user is returned.
+func findOrCreateUser(ctx context.Context, session neo4j.SessionWithContext, name string) (string, error) {
+	now := time.Now().Unix()
+	result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		lockQuery := `
+			MERGE (l:UserNameLock {name: $name})
+			SET l.lockedAt = $now
+		`
+		if _, err := tx.Run(ctx, lockQuery, map[string]any{"name": name, "now": now}); err != nil {
+			return nil, err
+		}
+
+		findQuery := `
+			MATCH (u:User {name: $name})
+			RETURN u.userId
+			ORDER BY u.createdAt, u.userId
+			LIMIT 1
+		`
+		records, err := tx.Run(ctx, findQuery, map[string]any{"name": name})
+		if err != nil {
+			return nil, err
+		}
+		if records.Next(ctx) {
+			userID, _ := records.Record().Values[0].(string)
+			return []any{userID, false}, nil
+		}
+		if err := records.Err(); err != nil {
+			return nil, err
+		}
+
+		createQuery := `
+			CREATE (u:User {
+				userId: $userId,
+				name: $name,
+				createdAt: $now,
+				lastActive: $now,
+				language: $language,
+				tone: $tone,
+				addressingStyle: $addressingStyle
+			})
+		`
+		params := map[string]any{
+			"name":            name,
+			"userId":          generateID(),
+			"now":             now,
+			"language":        defaultUserPreferences.Language,
+			"tone":            defaultUserPreferences.Tone,
+			"addressingStyle": defaultUserPreferences.AddressingStyle,
+		}
+		if _, err := tx.Run(ctx, createQuery, params); err != nil {
+			return nil, err
+		}
+		return []any{params["userId"], true}, nil
+	}, txTimeout(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to find or create user: %w", neo4jError(ctx, err))
+	}
+
+	values := result.([]any)
+	userID, _ := values[0].(string)
+	if created, _ := values[1].(bool); created {
+		fmt.Printf("👤 Created new user: %s (ID: %s)\n", name, userID)
+	} else {
+		fmt.Printf("👤 Continuing as user: %s (ID: %s)\n", name, userID)
+	}
+	return userID, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestParseDayDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{" 1.5d ", 36 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"xd", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDayDuration(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDayDuration(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDayDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestUserFromNode(t *testing.T) {
+	node := neo4j.Node{Props: map[string]any{
+		"userId":     "u1",
+		"name":       "Lan",
+		"createdAt":  int64(100),
+		"lastActive": int64(200),
+		"language":   "vi",
+	}}
+	user := userFromNode(node)
+	if user.UserID != "u1" || user.Name != "Lan" || user.CreatedAt != 100 || user.LastActive != 200 || user.Preferences.Language != "vi" {
+		t.Errorf("userFromNode = %+v", user)
+	}
+
+	// lastActive of the wrong type reads as never active, which inactiveUsers
+	// would report as most stale
+	stale := userFromNode(neo4j.Node{Props: map[string]any{"userId": "u2", "lastActive": "yesterday"}})
+	if stale.LastActive != 0 {
+		t.Errorf("LastActive = %d, want 0 for a malformed value", stale.LastActive)
+	}
+}
+
+func TestRecomputeLastActive(t *testing.T) {
+	session := requireNeo4j(t, nil)
+	ctx := context.Background()
+
+	userID := createTestUser(t, session)
+	storeTestMessage(t, session, userID, Message{Sender: "human", Content: "first", Timestamp: 1000})
+	storeTestMessage(t, session, userID, Message{Sender: "human", Content: "latest", Timestamp: 3000})
+	storeTestMessage(t, session, userID, Message{Sender: "ai", Content: "a reply", Timestamp: 5000})
+
+	lastActive, err := recomputeLastActive(ctx, userID)
+	if err != nil {
+		t.Fatalf("recomputeLastActive: %v", err)
+	}
+	if lastActive != 3000 {
+		t.Errorf("lastActive = %d, want 3000 from the latest human message", lastActive)
+	}
+
+	// Without human messages lastActive falls back to createdAt
+	quiet := createTestUser(t, session)
+	user, err := getUser(ctx, quiet)
+	if err != nil {
+		t.Fatalf("getUser: %v", err)
+	}
+	if lastActive, err := recomputeLastActive(ctx, quiet); err != nil || lastActive != user.CreatedAt {
+		t.Errorf("recomputeLastActive = %d, %v; want createdAt %d", lastActive, err, user.CreatedAt)
+	}
+
+	if _, err := recomputeLastActive(ctx, "no-such-user"); err == nil {
+		t.Error("recomputeLastActive succeeded for an unknown user")
+	}
+}
+
+func TestResolveChatUserOptions(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name                   string
+		existing, created, any string
+	}{
+		{"none", "", "", ""},
+		{"user and new user", "u1", "Lan", ""},
+		{"user and user name", "u1", "", "Lan"},
+		{"all three", "u1", "Lan", "Minh"},
+	}
+	for _, tt := range tests {
+		// rejected before Neo4j is used, so no session is needed
+		if _, err := resolveChatUser(ctx, nil, tt.existing, tt.created, tt.any); err == nil {
+			t.Errorf("%s: resolveChatUser accepted the options", tt.name)
+		}
+	}
+}
+
+func TestResolveChatUser(t *testing.T) {
+	session := requireNeo4j(t, nil)
+	ctx := context.Background()
+
+	userID := createTestUser(t, session)
+	if got, err := resolveChatUser(ctx, session, userID, "", ""); err != nil || got != userID {
+		t.Errorf("resolveChatUser(--user %s) = %q, %v", userID, got, err)
+	}
+	if _, err := resolveChatUser(ctx, session, "no-such-user", "", ""); !errors.Is(err, errUserNotFound) {
+		t.Errorf("resolveChatUser(--user no-such-user) error = %v, want errUserNotFound", err)
+	}
+}
+
+func TestFindOrCreateUserConcurrently(t *testing.T) {
+	requireNeo4j(t, nil)
+	ctx := context.Background()
+	// the UserNameLock constraint is what serialises the calls
+	if err := initSchema(ctx, neo4jDriver); err != nil {
+		t.Fatalf("initSchema: %v", err)
+	}
+	name := "test user " + generateID()
+	t.Cleanup(func() {
+		session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+		defer session.Close(ctx)
+		session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			return tx.Run(ctx, "MATCH (n) WHERE (n:User OR n:UserNameLock) AND n.name = $name DETACH DELETE n", map[string]any{"name": name})
+		})
+	})
+
+	const runs = 8
+	ids := make(chan string, runs)
+	errs := make(chan error, runs)
+	for range runs {
+		go func() {
+			session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+			defer session.Close(ctx)
+			userID, err := findOrCreateUser(ctx, session, name)
+			ids <- userID
+			errs <- err
+		}()
+	}
+	seen := make(map[string]bool)
+	for range runs {
+		if err := <-errs; err != nil {
+			t.Errorf("findOrCreateUser: %v", err)
+		}
+		seen[<-ids] = true
+	}
+	if len(seen) != 1 {
+		t.Errorf("concurrent runs returned %d user IDs, want 1", len(seen))
+	}
+
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		records, err := tx.Run(ctx, "MATCH (u:User {name: $name}) RETURN count(u)", map[string]any{"name": name})
+		if err != nil {
+			return nil, err
+		}
+		record, err := records.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return record.Values[0], nil
+	})
+	if err != nil {
+		t.Fatalf("failed to count users: %v", err)
+	}
+	if count := result.(int64); count != 1 {
+		t.Errorf("%d users named %q, want 1", count, name)
+	}
+}
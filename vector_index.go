@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Name of the vector index on Message.embedding
+const messageVectorIndex = "message_embedding"
+
+// Create the cosine vector index on Message.embedding with
+// cfg.EmbeddingDimensions dimensions if it does not exist, with CREATE
+// VECTOR INDEX (Neo4j 5.13+) or else db.index.vector.createNodeIndex (5.11).
+// On servers without vector support it logs and leaves the in-Go scan in
+// charge.
+func ensureVectorIndex() error {
+	ctx := context.Background()
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	statements := []string{
+		fmt.Sprintf("CREATE VECTOR INDEX %s IF NOT EXISTS FOR (m:Message) ON (m.embedding) OPTIONS {indexConfig: {`vector.dimensions`: %d, `vector.similarity_function`: 'cosine'}}", messageVectorIndex, cfg.EmbeddingDimensions),
+		fmt.Sprintf("CALL db.index.vector.createNodeIndex('%s', 'Message', 'embedding', %d, 'cosine')", messageVectorIndex, cfg.EmbeddingDimensions),
+	}
+	var err error
+	for _, statement := range statements {
+		var result neo4j.ResultWithContext
+		result, err = session.Run(ctx, statement, nil)
+		if err == nil {
+			_, err = result.Consume(ctx)
+		}
+		// The procedure has no IF NOT EXISTS and fails on an existing index
+		if err == nil || strings.Contains(strings.ToLower(err.Error()), "equivalent index already exists") {
+			slog.Info("Vector index ready", "index", messageVectorIndex, "dimensions", cfg.EmbeddingDimensions)
+			return nil
+		}
+		if !isVectorUnsupportedError(err) {
+			return fmt.Errorf("failed to create vector index: %v", err)
+		}
+	}
+	slog.Warn("Vector indexes are not supported by this server, using in-Go similarity", "err", err)
+	return nil
+}
+
+// Cached result of vector index capability detection
+var vectorIndexCapability struct {
+	once      sync.Once
+	mu        sync.Mutex
+	available bool
+}
+
+// Report whether the error means the vector procedure or index is missing,
+// e.g. on Neo4j before 5.13
+func isVectorUnsupportedError(err error) bool {
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) {
+		switch neo4jErr.Code {
+		case "Neo.ClientError.Procedure.ProcedureNotFound",
+			"Neo.ClientError.Statement.SyntaxError":
+			return true
+		}
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "there is no procedure with the name") ||
+		strings.Contains(message, "no such vector schema index")
+}
+
+// Detect whether db.index.vector.queryNodes and the message vector index
+// exist. Runs once; the result is cached and a warning is logged once when
+// falling back to the in-Go similarity scan.
+func vectorIndexAvailable() bool {
+	vectorIndexCapability.once.Do(func() {
+		available, err := detectVectorIndex()
+		if err != nil {
+			slog.Warn("Vector index unavailable, using in-Go similarity", "err", err)
+		} else if !available {
+			slog.Warn("Vector index not found, using in-Go similarity", "index", messageVectorIndex)
+		}
+		vectorIndexCapability.mu.Lock()
+		vectorIndexCapability.available = available
+		vectorIndexCapability.mu.Unlock()
+	})
+
+	vectorIndexCapability.mu.Lock()
+	defer vectorIndexCapability.mu.Unlock()
+	return vectorIndexCapability.available
+}
+
+// Stop using the vector index after a query reported it unsupported
+func markVectorIndexUnavailable(err error) {
+	vectorIndexCapability.once.Do(func() {})
+	vectorIndexCapability.mu.Lock()
+	defer vectorIndexCapability.mu.Unlock()
+	if vectorIndexCapability.available {
+		slog.Warn("Vector index query failed, falling back to in-Go similarity", "err", err)
+	}
+	vectorIndexCapability.available = false
+}
+
+// Check for the vector query procedure and index in a separate session, so
+// a failure cannot abort an ingestion transaction
+func detectVectorIndex() (bool, error) {
+	ctx := context.Background()
+	session := neo4jDriver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(context.Background())
+
+	result, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		procedures, err := tx.Run(ctx, `
+			SHOW PROCEDURES YIELD name
+			WHERE name = "db.index.vector.queryNodes"
+			RETURN count(*) > 0
+		`, nil)
+		if err != nil {
+			return false, err
+		}
+		record, err := procedures.Single(ctx)
+		if err != nil {
+			return false, err
+		}
+		if found, _ := record.Values[0].(bool); !found {
+			return false, nil
+		}
+
+		indexes, err := tx.Run(ctx, `
+			SHOW INDEXES YIELD name, type
+			WHERE name = $name AND type = "VECTOR"
+			RETURN count(*) > 0
+		`, map[string]any{"name": messageVectorIndex})
+		if err != nil {
+			return false, err
+		}
+		record, err = indexes.Single(ctx)
+		if err != nil {
+			return false, err
+		}
+		found, _ := record.Values[0].(bool)
+		return found, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.(bool), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestIsVectorUnsupportedError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&neo4j.Neo4jError{Code: "Neo.ClientError.Procedure.ProcedureNotFound", Msg: "no procedure"}, true},
+		{fmt.Errorf("query failed: %w", &neo4j.Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError", Msg: "Invalid input 'VECTOR'"}), true},
+		{errors.New("There is no procedure with the name `db.index.vector.queryNodes` registered"), true},
+		{errors.New("no such vector schema index: message_embedding"), true},
+		{&neo4j.Neo4jError{Code: "Neo.TransientError.General.DatabaseUnavailable", Msg: "database unavailable"}, false},
+		{errors.New("connection reset by peer"), false},
+	}
+	for _, tt := range tests {
+		if got := isVectorUnsupportedError(tt.err); got != tt.want {
+			t.Errorf("isVectorUnsupportedError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestMarkVectorIndexUnavailableFallsBack(t *testing.T) {
+	setTestConfig(t, func(c *Config) {
+		c.VectorIndex = true
+		c.CompressEmbeddings = false
+	})
+	vectorIndexCapability.once.Do(func() {})
+	vectorIndexCapability.mu.Lock()
+	vectorIndexCapability.available = true
+	vectorIndexCapability.mu.Unlock()
+	t.Cleanup(func() { markVectorIndexUnavailable(nil) })
+
+	message := Message{MessageID: "m1", Embedding: []float64{1, 0}}
+	if !useVectorIndex(message) {
+		t.Fatal("useVectorIndex = false with an available index")
+	}
+	markVectorIndexUnavailable(errors.New("no such vector schema index"))
+	if useVectorIndex(message) {
+		t.Error("useVectorIndex = true after the index was reported unsupported")
+	}
+	if query, _ := similarityCandidatesQuery(message, "u1"); strings.Contains(query, "db.index.vector.queryNodes") {
+		t.Errorf("candidate query still uses the vector index:\n%s", query)
+	}
+}